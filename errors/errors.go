@@ -5,6 +5,15 @@ import (
 	"fmt"
 	"strings"
 	"errors"
+	"runtime/debug"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"io"
+	"net"
+	"os"
+	"syscall"
 )
 
 // ErrorType 代表错误类型。
@@ -22,12 +31,126 @@ const (
 	ERROR_TYPE_SCHEDULER ErrorType = "scheduler error"
 )
 
+// Error 用于获得错误类型的字符串形式。
+// 错误类型实现了error接口，因此可以用Is判断爬虫错误是否属于某个类型。
+func (et ErrorType) Error() string {
+	return string(et)
+}
+
+// ErrorCode 代表错误码，用于区分错误的具体原因。
+type ErrorCode string
+
+// 错误码常量。
+const (
+	// ERROR_CODE_UNKNOWN 代表未知的错误。
+	ERROR_CODE_UNKNOWN ErrorCode = "unknown"
+	// ERROR_CODE_ILLEGAL_PARAMETER 代表非法的参数。
+	ERROR_CODE_ILLEGAL_PARAMETER ErrorCode = "illegal_parameter"
+	// ERROR_CODE_PANIC 代表从panic中恢复的错误。
+	ERROR_CODE_PANIC ErrorCode = "panic"
+	// ERROR_CODE_TIMEOUT 代表超时。
+	ERROR_CODE_TIMEOUT ErrorCode = "timeout"
+	// ERROR_CODE_CANCELED 代表操作被取消。
+	ERROR_CODE_CANCELED ErrorCode = "canceled"
+	// ERROR_CODE_DNS 代表域名解析失败。
+	ERROR_CODE_DNS ErrorCode = "dns"
+	// ERROR_CODE_CONNECTION 代表连接被拒绝、重置或意外关闭。
+	ERROR_CODE_CONNECTION ErrorCode = "connection"
+	// ERROR_CODE_TLS 代表TLS握手或证书验证失败。
+	ERROR_CODE_TLS ErrorCode = "tls"
+	// ERROR_CODE_BODY_TOO_LARGE 代表响应体超出大小限制。
+	ERROR_CODE_BODY_TOO_LARGE ErrorCode = "body_too_large"
+	// ERROR_CODE_INVALID_ITEM 代表条目未通过校验。
+	ERROR_CODE_INVALID_ITEM ErrorCode = "invalid_item"
+)
+
+// Error 用于获得错误码的字符串形式。
+// 错误码实现了error接口，因此可以用Is判断爬虫错误是否带有某个错误码。
+func (code ErrorCode) Error() string {
+	return string(code)
+}
+
+// Stage 代表错误发生的处理阶段。
+type Stage string
+
+// 处理阶段常量。
+const (
+	// STAGE_SCHEDULE 代表调度阶段。
+	STAGE_SCHEDULE Stage = "schedule"
+	// STAGE_DOWNLOAD 代表下载阶段。
+	STAGE_DOWNLOAD Stage = "download"
+	// STAGE_RECORD 代表记录原始HTTP交互的阶段。
+	STAGE_RECORD Stage = "record"
+	// STAGE_ANALYZE 代表分析器读取响应的阶段。
+	STAGE_ANALYZE Stage = "analyze"
+	// STAGE_PARSE 代表响应解析函数的解析阶段。
+	STAGE_PARSE Stage = "parse"
+	// STAGE_VALIDATE 代表条目校验阶段。
+	STAGE_VALIDATE Stage = "validate"
+	// STAGE_PROCESS 代表条目处理函数的处理阶段。
+	STAGE_PROCESS Stage = "process"
+)
+
+// ErrorContext 代表错误发生时的上下文。
+type ErrorContext struct {
+	// URL 代表相关请求的URL。
+	URL string
+	// Depth 代表相关请求的深度。
+	Depth uint32
+	// MID 代表发生错误的组件的ID，为空代表调度器。
+	MID string
+	// Stage 代表错误发生的处理阶段。
+	Stage Stage
+}
+
+// merge 用于以另一个上下文中的非零值覆盖当前上下文，并返回结果。
+func (ctx ErrorContext) merge(another ErrorContext) ErrorContext {
+	if another.URL != "" {
+		ctx.URL = another.URL
+	}
+	if another.Depth != 0 {
+		ctx.Depth = another.Depth
+	}
+	if another.MID != "" {
+		ctx.MID = another.MID
+	}
+	if another.Stage != "" {
+		ctx.Stage = another.Stage
+	}
+	return ctx
+}
+
 // CrawlerError 代表爬虫错误的接口类型。
+// 爬虫错误可以用Is和As检查其原因，也可以用Is(err, ERROR_CODE_TIMEOUT)等判断其类型和错误码。
 type CrawlerError interface {
 	// Type 用于获得错误的类型。
 	Type() ErrorType
 	// Error 用于获得错误提示信息。
 	Error() string
+	// Code 用于获得错误码，未指定时根据错误的原因推断。
+	Code() ErrorCode
+	// Context 用于获得错误发生时的上下文。
+	Context() ErrorContext
+	// Unwrap 用于获得错误的原因，没有时返回nil。
+	Unwrap() error
+	// WithCode 用于生成一个带有指定错误码的副本。
+	WithCode(code ErrorCode) CrawlerError
+	// WithContext 用于生成一个上下文被补充的副本，只有ctx中的非零值会覆盖原有的值。
+	WithContext(ctx ErrorContext) CrawlerError
+	// Record 用于获得爬虫错误的JSON形式，爬虫错误被编码为JSON时也使用该形式。
+	Record() ErrorRecord
+}
+
+// ErrorRecord 代表爬虫错误的JSON形式，可用于解码错误接收方保存的爬虫错误。
+type ErrorRecord struct {
+	Type    ErrorType `json:"type"`
+	Code    ErrorCode `json:"code"`
+	Message string    `json:"message"`
+	URL     string    `json:"url,omitempty"`
+	Depth   uint32    `json:"depth"`
+	MID     string    `json:"mid,omitempty"`
+	Stage   Stage     `json:"stage,omitempty"`
+	Cause   string    `json:"cause,omitempty"`
 }
 
 // myCrawlerError 代表爬虫错误的实现类型。
@@ -38,6 +161,12 @@ type vientianeCrawlerError struct {
 	errMsg string
 	// fullErrMsg 代表完整的错误提示信息。
 	fullErrMsg string
+	// code 代表指定的错误码，为空时根据原因推断。
+	code ErrorCode
+	// ctx 代表错误发生时的上下文。
+	ctx ErrorContext
+	// cause 代表错误的原因。
+	cause error
 }
 
 // NewCrawlerError 用于创建一个新的爬虫错误值。
@@ -49,8 +178,37 @@ func NewCrawlerError(errType ErrorType, errMsg string) CrawlerError {
 }
 
 // NewCrawlerErrorBy 用于根据给定的错误值创建一个新的爬虫错误值。
+// 给定的错误值会作为原因被保留，若它本身是爬虫错误，则其错误码和上下文也会被继承。
 func NewCrawlerErrorBy(errType ErrorType, err error) CrawlerError {
-	return NewCrawlerError(errType, err.Error())
+	if err == nil {
+		return NewCrawlerError(errType, "")
+	}
+	return NewCrawlerErrorWith(errType, err.Error(), err)
+}
+
+// NewCrawlerErrorWith 用于创建一个带有提示信息和原因的爬虫错误值。
+// 若原因本身是爬虫错误，则其错误码和上下文会被继承。
+func NewCrawlerErrorWith(errType ErrorType, errMsg string, cause error) CrawlerError {
+	ce := &vientianeCrawlerError{
+		errType: errType,
+		errMsg:  strings.TrimSpace(errMsg),
+		cause:   cause,
+	}
+	var inner CrawlerError
+	if errors.As(cause, &inner) {
+		ce.code = inner.Code()
+		ce.ctx = inner.Context()
+	}
+	return ce
+}
+
+// Wrap 用于为错误值补充上下文。
+// 爬虫错误会被直接补充上下文，其他错误会先以NewCrawlerErrorBy包装为给定类型的爬虫错误。
+func Wrap(errType ErrorType, err error, ctx ErrorContext) CrawlerError {
+	if ce, ok := err.(CrawlerError); ok {
+		return ce.WithContext(ctx)
+	}
+	return NewCrawlerErrorBy(errType, err).WithContext(ctx)
 }
 
 func (ce *vientianeCrawlerError) Type() ErrorType {
@@ -64,6 +222,65 @@ func (ce *vientianeCrawlerError) Error() string {
 	return ce.fullErrMsg
 }
 
+func (ce *vientianeCrawlerError) Code() ErrorCode {
+	if ce.code != "" {
+		return ce.code
+	}
+	return Classify(ce.cause)
+}
+
+func (ce *vientianeCrawlerError) Context() ErrorContext {
+	return ce.ctx
+}
+
+func (ce *vientianeCrawlerError) Unwrap() error {
+	return ce.cause
+}
+
+func (ce *vientianeCrawlerError) WithCode(code ErrorCode) CrawlerError {
+	copied := *ce
+	copied.code = code
+	return &copied
+}
+
+func (ce *vientianeCrawlerError) WithContext(ctx ErrorContext) CrawlerError {
+	copied := *ce
+	copied.ctx = ce.ctx.merge(ctx)
+	return &copied
+}
+
+// Is 用于判断爬虫错误是否属于给定的错误类型或带有给定的错误码。
+// 对原因的判断由Unwrap完成。
+func (ce *vientianeCrawlerError) Is(target error) bool {
+	switch t := target.(type) {
+	case ErrorType:
+		return ce.errType == t
+	case ErrorCode:
+		return ce.Code() == t
+	}
+	return false
+}
+
+func (ce *vientianeCrawlerError) Record() ErrorRecord {
+	record := ErrorRecord{
+		Type:    ce.errType,
+		Code:    ce.Code(),
+		Message: ce.errMsg,
+		URL:     ce.ctx.URL,
+		Depth:   ce.ctx.Depth,
+		MID:     ce.ctx.MID,
+		Stage:   ce.ctx.Stage,
+	}
+	if ce.cause != nil {
+		record.Cause = ce.cause.Error()
+	}
+	return record
+}
+
+func (ce *vientianeCrawlerError) MarshalJSON() ([]byte, error) {
+	return json.Marshal(ce.Record())
+}
+
 // genFullErrMsg 用于生成错误提示信息，并给相应的字段赋值。
 func (ce *vientianeCrawlerError) genFullErrMsg() {
 	var buffer bytes.Buffer
@@ -77,7 +294,70 @@ func (ce *vientianeCrawlerError) genFullErrMsg() {
 	return
 }
 
+// Classify 用于根据错误值推断错误码。
+// 爬虫错误返回其错误码，无法识别的错误返回ERROR_CODE_UNKNOWN。
+func Classify(err error) ErrorCode {
+	if err == nil {
+		return ERROR_CODE_UNKNOWN
+	}
+	var ce CrawlerError
+	if errors.As(err, &ce) {
+		return ce.Code()
+	}
+	var pe *PanicError
+	if errors.As(err, &pe) {
+		return ERROR_CODE_PANIC
+	}
+	var ipe IllegalParameterError
+	if errors.As(err, &ipe) {
+		return ERROR_CODE_ILLEGAL_PARAMETER
+	}
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		return ERROR_CODE_DNS
+	}
+	if errors.Is(err, context.Canceled) {
+		return ERROR_CODE_CANCELED
+	}
+	if errors.Is(err, context.DeadlineExceeded) || errors.Is(err, os.ErrDeadlineExceeded) {
+		return ERROR_CODE_TIMEOUT
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return ERROR_CODE_TIMEOUT
+	}
+	var recordHeaderErr tls.RecordHeaderError
+	var certErr *tls.CertificateVerificationError
+	var authorityErr x509.UnknownAuthorityError
+	var hostnameErr x509.HostnameError
+	var invalidErr x509.CertificateInvalidError
+	if errors.As(err, &recordHeaderErr) || errors.As(err, &certErr) ||
+		errors.As(err, &authorityErr) || errors.As(err, &hostnameErr) ||
+		errors.As(err, &invalidErr) {
+		return ERROR_CODE_TLS
+	}
+	var opErr *net.OpError
+	if errors.As(err, &opErr) || errors.Is(err, syscall.ECONNREFUSED) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return ERROR_CODE_CONNECTION
+	}
+	return ERROR_CODE_UNKNOWN
+}
+
+// Is 等同于标准库的errors.Is，以免调用方同时导入两个errors包。
+func Is(err, target error) bool {
+	return errors.Is(err, target)
+}
+
+// As 等同于标准库的errors.As。
+func As(err error, target interface{}) bool {
+	return errors.As(err, target)
+}
 
+// Unwrap 等同于标准库的errors.Unwrap。
+func Unwrap(err error) error {
+	return errors.Unwrap(err)
+}
 
 // IllegalParameterError 代表非法的参数的错误类型。
 type IllegalParameterError struct {
@@ -96,6 +376,42 @@ func (ipe IllegalParameterError) Error() string {
 	return ipe.msg
 }
 
+// PanicError 代表从panic中恢复得到的错误类型。
+type PanicError struct {
+	// Value 代表传给panic的值。
+	Value interface{}
+	// Stack 代表发生panic时的调用栈。
+	Stack []byte
+}
+
+// NewPanicError 会根据recover得到的值创建一个PanicError类型的实例。
+// 应在延迟函数中调用，以便记录发生panic时的调用栈。
+func NewPanicError(value interface{}) *PanicError {
+	return &PanicError{
+		Value: value,
+		Stack: debug.Stack(),
+	}
+}
+
+func (pe *PanicError) Error() string {
+	return fmt.Sprintf("panic: %v", pe.Value)
+}
+
+// DropItemError 代表条目处理函数要求丢弃条目的错误类型。
+// 条目处理管道收到该错误时会停止处理该条目，且不把它视为错误。
+type DropItemError struct {
+	// Reason 代表丢弃条目的原因。
+	Reason string
+}
+
+// NewDropItemError 用于创建一个DropItemError类型的实例。
+func NewDropItemError(reason string) *DropItemError {
+	return &DropItemError{Reason: strings.TrimSpace(reason)}
+}
+
+func (de *DropItemError) Error() string {
+	return "item dropped: " + de.Reason
+}
 
 func New(errMsg string)error {
 	return errors.New(errMsg)
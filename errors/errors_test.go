@@ -0,0 +1,90 @@
+package errors
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"testing"
+)
+
+func TestCrawlerErrorCause(t *testing.T) {
+	dnsErr := &net.DNSError{Err: "no such host", Name: "example.invalid", IsNotFound: true}
+	cause := fmt.Errorf("Get %q: %w", "http://example.invalid/", dnsErr)
+	ce := NewCrawlerErrorBy(ERROR_TYPE_DOWNLOADER, cause).WithContext(ErrorContext{
+		URL:   "http://example.invalid/",
+		Depth: 2,
+		MID:   "D1",
+		Stage: STAGE_DOWNLOAD,
+	})
+	if ce.Error() != "crawler error: downloader error: "+cause.Error() {
+		t.Fatalf("Inconsistent error message: %q", ce.Error())
+	}
+	var target *net.DNSError
+	if !As(ce, &target) || target != dnsErr {
+		t.Fatalf("The cause should be reachable by As")
+	}
+	if !Is(ce, ERROR_CODE_DNS) || !Is(ce, ERROR_TYPE_DOWNLOADER) || Is(ce, ERROR_TYPE_ANALYZER) {
+		t.Fatalf("Inconsistent result of Is: code: %s, type: %s", ce.Code(), ce.Type())
+	}
+	//外层的爬虫错误继承错误码和上下文
+	outer := NewCrawlerErrorBy(ERROR_TYPE_SCHEDULER, ce)
+	if outer.Code() != ERROR_CODE_DNS || outer.Context().MID != "D1" || Unwrap(outer) != ce {
+		t.Fatalf("The outer error should inherit the code and context: %+v", outer.Record())
+	}
+	wrapped := Wrap(ERROR_TYPE_SCHEDULER, ce, ErrorContext{MID: "D2"})
+	if wrapped.Error() != ce.Error() || wrapped.Context().MID != "D2" ||
+		wrapped.Context().URL != "http://example.invalid/" || ce.Context().MID != "D1" {
+		t.Fatalf("Wrap should only add context to a copy: %+v", wrapped.Record())
+	}
+	data, err := json.Marshal(ce)
+	if err != nil {
+		t.Fatalf("An error occurs when encoding the error: %s", err)
+	}
+	var record ErrorRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		t.Fatalf("An error occurs when decoding the error: %s", err)
+	}
+	expected := ErrorRecord{Type: ERROR_TYPE_DOWNLOADER, Code: ERROR_CODE_DNS, Message: cause.Error(),
+		URL: "http://example.invalid/", Depth: 2, MID: "D1", Stage: STAGE_DOWNLOAD, Cause: cause.Error()}
+	if record != expected {
+		t.Fatalf("Inconsistent error record: expected: %+v, actual: %+v", expected, record)
+	}
+}
+
+func TestClassify(t *testing.T) {
+	timeoutErr := &net.OpError{Op: "dial", Err: &timeoutError{}}
+	for _, c := range []struct {
+		err  error
+		code ErrorCode
+	}{
+		{nil, ERROR_CODE_UNKNOWN},
+		{New("boom"), ERROR_CODE_UNKNOWN},
+		{NewIllegalParameterError("nil request"), ERROR_CODE_ILLEGAL_PARAMETER},
+		{NewPanicError("boom"), ERROR_CODE_PANIC},
+		{fmt.Errorf("read: %w", context.DeadlineExceeded), ERROR_CODE_TIMEOUT},
+		{context.Canceled, ERROR_CODE_CANCELED},
+		{timeoutErr, ERROR_CODE_TIMEOUT},
+		{&net.OpError{Op: "dial", Err: New("connection refused")}, ERROR_CODE_CONNECTION},
+		{io.ErrUnexpectedEOF, ERROR_CODE_CONNECTION},
+		{NewCrawlerError(ERROR_TYPE_ANALYZER, "too large").WithCode(ERROR_CODE_BODY_TOO_LARGE),
+			ERROR_CODE_BODY_TOO_LARGE},
+	} {
+		if code := Classify(c.err); code != c.code {
+			t.Fatalf("Inconsistent code of %v: expected: %s, actual: %s", c.err, c.code, code)
+		}
+	}
+	ce := NewCrawlerErrorWith(ERROR_TYPE_PIPELINE, "panic in processor", NewPanicError("boom"))
+	var pe *PanicError
+	if !As(ce, &pe) || ce.Code() != ERROR_CODE_PANIC || strings.Contains(ce.Error(), "goroutine") {
+		t.Fatalf("Inconsistent panic error: %s %s", ce.Code(), ce.Error())
+	}
+}
+
+type timeoutError struct{}
+
+func (*timeoutError) Error() string   { return "i/o timeout" }
+func (*timeoutError) Timeout() bool   { return true }
+func (*timeoutError) Temporary() bool { return true }
@@ -2,7 +2,6 @@ package module
 
 import (
 	"github.com/Vientiane/structure"
-	"net/http"
 )
 
 //组件摘要结构的类型
@@ -57,10 +56,80 @@ type Downloader interface {
 	Module
 	//根据请求内容获取响应
 	Download(req *structure.Request) (*structure.Response, error)
+	//返回原始HTTP交互的记录器，nil代表不记录
+	Recorder() Recorder
+	//设置原始HTTP交互的记录器，nil代表不记录
+	SetRecorder(recorder Recorder)
+	//返回记录和缓存响应时读取响应体的大小限制，只使用其中的最大字节数
+	BodyLimit() BodyLimit
+	//设置记录和缓存响应时读取响应体的大小限制，只使用其中的最大字节数
+	//超出限制的响应不会被记录和缓存，但仍会被完整地交给分析器
+	SetBodyLimit(limit BodyLimit)
+}
+
+//用于记录下载器获取的原始HTTP交互的接口类型
+//该接口的实现类型必须是并发安全的
+type Recorder interface {
+	//记录一次下载，body为完整的响应体
+	//返回错误时下载器仍会返回该响应，同时返回记录失败的错误
+	Record(resp *structure.Response, body []byte) error
 }
 
 //用于解析HTTP响应函数的类型
-type ParseResponse func(httpResp *http.Response, respDepth uint32) ([]structure.Data, []error)
+//通过resp.HTTPResp()获取HTTP响应，通过resp.Request()获取请求及其元数据
+type ParseResponse func(resp *structure.Response) ([]structure.Data, []error)
+
+//响应解析函数的匹配条件的类型
+//零值代表匹配所有响应，多个条件同时给出时需全部满足
+type ParserCondition struct {
+	//可匹配的MIME类型列表，如"text/html"或"image/*"，为空代表不限制
+	//响应头中没有内容类型时会根据响应体的内容推断
+	MIMETypes []string
+	//可匹配的最小状态码，0代表不限制
+	MinStatus int
+	//可匹配的最大状态码，0代表不限制
+	MaxStatus int
+	//请求URL需匹配的正则表达式，为空代表不限制
+	URLPattern string
+	//可匹配的最小响应深度
+	MinDepth uint32
+	//可匹配的最大响应深度，0代表不限制
+	MaxDepth uint32
+}
+
+//带匹配条件的响应解析器的类型
+type RespParser struct {
+	//解析器的名称，用于统计
+	Name string
+	//响应解析函数
+	Parse ParseResponse
+	//匹配条件，只有满足条件的响应才会交给响应解析函数
+	Condition ParserCondition
+}
+
+//响应解析器的统计信息的类型
+type ParserStats struct {
+	//解析器的名称
+	Name string `json:"name"`
+	//解析器被考虑的次数，即分析器收到的响应数
+	Called uint64 `json:"called"`
+	//响应满足匹配条件而调用响应解析函数的次数
+	Matched uint64 `json:"matched"`
+	//响应解析函数返回的错误数，包括由panic转换而来的错误
+	Errors uint64 `json:"errors"`
+	//响应解析函数发生panic的次数
+	Panics uint64 `json:"panics"`
+}
+
+//响应体大小限制的类型
+type BodyLimit struct {
+	//响应体的最大字节数，0代表不限制
+	MaxSize int64
+	//超出最大字节数时是否截断响应体，否则拒绝该响应
+	Truncate bool
+	//响应体超过此字节数时会被暂存到临时文件，0代表总是保存在内存中
+	SpillThreshold int64
+}
 
 //Analyzer代表分析器的接口类型
 //该接口的实现类型必须是并发安全的
@@ -68,11 +137,37 @@ type Analyzer interface {
 	Module
 	//用于返回当前分析器使用的响应解析函数的列表
 	RespParsers() []ParseResponse
+	//用于返回当前分析器使用的带匹配条件的响应解析器的列表
+	Routes() []RespParser
+	//用于返回各响应解析器的统计信息
+	ParserStats() []ParserStats
 	//根据规则分析响应并返回请求和条目
 	Analyze(resp *structure.Response) ([]structure.Data, []error)
+	//返回是否在调用响应解析函数之前把响应体转换为UTF-8编码
+	Transcoding() bool
+	//设置是否在调用响应解析函数之前把响应体转换为UTF-8编码
+	SetTranscoding(transcoding bool)
+	//返回响应体大小的限制
+	BodyLimit() BodyLimit
+	//设置响应体大小的限制
+	SetBodyLimit(limit BodyLimit)
+	//返回响应的去重器，nil代表不去重
+	Deduplicator() Deduplicator
+	//设置响应的去重器，nil代表不去重
+	//重复的响应不会交给任何响应解析函数
+	SetDeduplicator(deduplicator Deduplicator)
+}
+
+//用于判断响应内容是否重复的接口类型
+//该接口的实现类型必须是并发安全的
+type Deduplicator interface {
+	//判断响应是否与之前的响应重复，body为完整的响应体，mediaType为响应的MIME类型
+	//不重复的响应会被记录，以便判断之后的响应
+	Duplicate(resp *structure.Response, body []byte, mediaType string) bool
 }
 
 //用于处理条目的函数类型
+//返回errors.DropItemError或包装了它的错误时条目会被丢弃，不再交给之后的条目处理函数
 type ProcessItem func(item structure.Item)(result structure.Item,err error)
 
 //pipeline代表条目处理管道的接口类型
@@ -88,6 +183,32 @@ type Pipeline interface {
 	FailFast()bool
 	//设置是否快速失败
 	SetFailFast(failFast bool)
+	//返回可同时处理的条目的最大数量，0代表条目处理管道自身不限制
+	//调度器会为并发上限为0的条目处理管道只分配一个处理条目的协程
+	Concurrency() uint32
+	//设置可同时处理的条目的最大数量，应在调度器初始化之前调用
+	//调度器只在初始化时根据它计算处理条目的协程数量，之后的修改不会改变协程数量
+	SetConcurrency(concurrency uint32)
+	//返回条目校验器，nil代表不校验
+	Validator() ItemValidator
+	//设置条目校验器，nil代表不校验，应在调度器启动之前调用
+	//未通过校验的条目不会交给任何条目处理函数
+	SetValidator(validator ItemValidator)
+	//返回未通过校验的条目的接收函数
+	RejectSink() RejectItem
+	//设置未通过校验的条目的接收函数，应在调度器启动之前调用
+	//为nil时未通过校验的条目会以错误的形式返回
+	SetRejectSink(sink RejectItem)
 }
 
+//用于校验条目的接口类型
+//该接口的实现类型必须是并发安全的
+type ItemValidator interface {
+	//返回条目未通过校验的所有原因，通过校验时返回空切片
+	Validate(item structure.Item) []string
+}
+
+//用于接收未通过校验的条目及其原因的函数类型
+type RejectItem func(item structure.Item, reasons []string)
+
 
@@ -7,22 +7,99 @@ import (
 	"github.com/Vientiane/toolkit/reader"
 	"github.com/Vientiane/module"
 	"github.com/Vientiane/module/stub"
+	"github.com/Vientiane/toolkit/charset"
+	"io"
+	"io/ioutil"
+	"sync/atomic"
 )
 
 //分析器接口的实现类型
 type vientianeAnalyzer struct{
 	stub.ModuleInternal
-	//响应解析器列表
-	respParsers []module.ParseResponse
+	//带匹配条件的响应解析器列表
+	routes []*parserRoute
+	//是否在调用响应解析函数之前把响应体转换为UTF-8编码
+	transcoding bool
+	//响应体大小的限制
+	bodyLimit module.BodyLimit
+	//响应的去重器
+	deduplicator module.Deduplicator
+	//重复的响应数
+	duplicateCount uint64
 }
 
 func(a *vientianeAnalyzer)RespParsers() []module.ParseResponse {
 	//每个实例拿到的都是函数的拷贝
-	parser := make([]module.ParseResponse, len(a.respParsers))
-	copy(parser, a.respParsers)
+	parser := make([]module.ParseResponse, len(a.routes))
+	for i, route := range a.routes {
+		parser[i] = route.Parse
+	}
 	return parser
 }
 
+func(a *vientianeAnalyzer)Routes() []module.RespParser {
+	routes := make([]module.RespParser, len(a.routes))
+	for i, route := range a.routes {
+		routes[i] = route.RespParser
+	}
+	return routes
+}
+
+func(a *vientianeAnalyzer)ParserStats() []module.ParserStats {
+	stats := make([]module.ParserStats, len(a.routes))
+	for i, route := range a.routes {
+		stats[i] = route.stats()
+	}
+	return stats
+}
+
+//分析器摘要中的额外信息的类型
+type summaryExtra struct {
+	//各响应解析器的统计信息
+	Parsers []module.ParserStats `json:"parsers"`
+	//所有响应解析器发生panic的总次数
+	Panics uint64 `json:"panics"`
+	//被去重器判定为重复而未解析的响应数
+	Duplicates uint64 `json:"duplicates"`
+}
+
+func(a *vientianeAnalyzer)Summary() module.SummaryStruct {
+	summary := a.ModuleInternal.Summary()
+	extra := summaryExtra{
+		Parsers:    a.ParserStats(),
+		Duplicates: atomic.LoadUint64(&a.duplicateCount),
+	}
+	for _, stats := range extra.Parsers {
+		extra.Panics += stats.Panics
+	}
+	summary.Extra = extra
+	return summary
+}
+
+func(a *vientianeAnalyzer)Deduplicator() module.Deduplicator {
+	return a.deduplicator
+}
+
+func(a *vientianeAnalyzer)SetDeduplicator(deduplicator module.Deduplicator) {
+	a.deduplicator = deduplicator
+}
+
+func(a *vientianeAnalyzer)Transcoding()bool {
+	return a.transcoding
+}
+
+func(a *vientianeAnalyzer)SetTranscoding(transcoding bool) {
+	a.transcoding = transcoding
+}
+
+func(a *vientianeAnalyzer)BodyLimit()module.BodyLimit {
+	return a.bodyLimit
+}
+
+func(a *vientianeAnalyzer)SetBodyLimit(limit module.BodyLimit) {
+	a.bodyLimit = limit
+}
+
 func(a *vientianeAnalyzer)Analyze(resp *structure.Response) (dataList []structure.Data,errorList []error) {
 	a.ModuleInternal.IncrHandlingNumber()
 	defer a.ModuleInternal.DecrHandlingNumber()
@@ -51,30 +128,100 @@ func(a *vientianeAnalyzer)Analyze(resp *structure.Response) (dataList []structur
 		return
 	}
 	a.ModuleInternal.IncrAcceptedCount()
-	respDepth := resp.Depth()
 	if httpResp.Body != nil {
 		defer httpResp.Body.Close()
 	}
-	multipleReader, err := reader.NewMultipleReader(httpResp.Body)
+	bodyLimit := a.bodyLimit
+	if bodyLimit.MaxSize > 0 && !bodyLimit.Truncate &&
+		httpResp.ContentLength > bodyLimit.MaxSize {
+		errorList = append(errorList, a.tooLargeError(resp,
+			fmt.Sprintf("%d > %d", httpResp.ContentLength, bodyLimit.MaxSize)))
+		return
+	}
+	multipleReader, err := reader.NewLimitedMultipleReader(httpResp.Body,
+		bodyLimit.MaxSize, bodyLimit.SpillThreshold)
+	if err != nil {
+		errorList = append(errorList, errors.Wrap(errors.ERROR_TYPE_ANALYZER, err, a.errorContext(resp, errors.STAGE_ANALYZE)))
+		return
+	}
+	//转码后多重读取器会被替换，原来的由detectCharset关闭
+	defer func() { multipleReader.Close() }()
+	if multipleReader.Truncated() && !bodyLimit.Truncate {
+		errorList = append(errorList, a.tooLargeError(resp,
+			fmt.Sprintf("more than %d bytes", bodyLimit.MaxSize)))
+		return
+	}
+	transcoded, err := a.detectCharset(resp, multipleReader)
 	if err != nil {
-		errorList = append(errorList, errors.NewCrawlerError(errors.ERROR_TYPE_ANALYZER, err.Error()))
+		errorList = append(errorList, errors.Wrap(errors.ERROR_TYPE_ANALYZER, err, a.errorContext(resp, errors.STAGE_ANALYZE)))
+		return
+	}
+	multipleReader = transcoded
+	//转码后的响应体可能变长，同样受大小限制
+	if multipleReader.Truncated() && !bodyLimit.Truncate {
+		errorList = append(errorList, a.tooLargeError(resp,
+			fmt.Sprintf("more than %d bytes after transcoding", bodyLimit.MaxSize)))
 		return
 	}
 	dataList = []structure.Data{}
-	for _, respParser := range a.respParsers {
-		httpResp.Body = multipleReader.Reader()
-		pDataList, pErrorList := respParser(httpResp, respDepth)
+	//只在有解析器需要时才获取响应的MIME类型，且只获取一次
+	var mediaType string
+	var mediaTypeDone bool
+	getMediaType := func() string {
+		if !mediaTypeDone {
+			mediaType = responseMediaType(httpResp, multipleReader)
+			mediaTypeDone = true
+		}
+		return mediaType
+	}
+	if deduplicator := a.deduplicator; deduplicator != nil {
+		//去重器需要完整的响应体，同样受大小限制
+		bodyReader := multipleReader.Reader()
+		var r io.Reader = bodyReader
+		if bodyLimit.MaxSize > 0 {
+			r = io.LimitReader(bodyReader, bodyLimit.MaxSize)
+		}
+		body, err := ioutil.ReadAll(r)
+		bodyReader.Close()
+		if err != nil {
+			errorList = append(errorList, errors.Wrap(errors.ERROR_TYPE_ANALYZER, err, a.errorContext(resp, errors.STAGE_ANALYZE)))
+			return
+		}
+		//去重器可能需要解析文档树，文档树会被之后的解析函数共享
+		treeReader := multipleReader.Reader()
+		httpResp.Body = treeReader
+		duplicate := deduplicator.Duplicate(resp, body, getMediaType())
+		treeReader.Close()
+		if duplicate {
+			atomic.AddUint64(&a.duplicateCount, 1)
+			a.ModuleInternal.IncrCompletedCount()
+			return
+		}
+	}
+	for _, route := range a.routes {
+		atomic.AddUint64(&route.calledCount, 1)
+		if !route.match(resp, getMediaType) {
+			continue
+		}
+		atomic.AddUint64(&route.matchedCount, 1)
+		//每个解析函数都使用独立的读取器，调用结束后立即关闭以释放暂存文件的文件描述符
+		routeBody := multipleReader.Reader()
+		httpResp.Body = routeBody
+		pDataList, pErrorList := route.call(resp, a.ID())
+		routeBody.Close()
 		if pDataList != nil {
 			for _, pData := range pDataList {
 				if pData != nil {
-					dataList = appendDataList(dataList, pData, respDepth)
+					dataList = appendDataList(dataList, pData, resp)
 				}
 			}
 		}
 		if pErrorList != nil {
 			for _, pError := range pErrorList {
 				if pError != nil {
-					errorList = append(errorList, pError)
+					atomic.AddUint64(&route.errorCount, 1)
+					errorList = append(errorList, errors.Wrap(errors.ERROR_TYPE_ANALYZER,
+						pError, a.errorContext(resp, errors.STAGE_PARSE)))
 				}
 			}
 		}
@@ -85,21 +232,96 @@ func(a *vientianeAnalyzer)Analyze(resp *structure.Response) (dataList []structur
 	return dataList, errorList
 }
 
+// errorContext 用于生成分析响应时发生的错误的上下文
+func (a *vientianeAnalyzer) errorContext(resp *structure.Response, stage errors.Stage) errors.ErrorContext {
+	return errors.ErrorContext{
+		URL:   resp.HTTPResp().Request.URL.String(),
+		Depth: resp.Depth(),
+		MID:   string(a.ID()),
+		Stage: stage,
+	}
+}
+
+// tooLargeError 用于生成响应体超出大小限制的错误，size描述响应体的大小
+func (a *vientianeAnalyzer) tooLargeError(resp *structure.Response, size string) error {
+	errMsg := fmt.Sprintf("too large response body: %s (requestURL: %s)",
+		size, resp.HTTPResp().Request.URL)
+	return errors.NewCrawlerError(errors.ERROR_TYPE_ANALYZER, errMsg).
+		WithCode(errors.ERROR_CODE_BODY_TOO_LARGE).WithContext(a.errorContext(resp, errors.STAGE_ANALYZE))
+}
+
+// detectCharset 用于检测响应体的字符集并记录在响应上
+// 若需要转码，则返回包含UTF-8编码的响应体的多重读取器，并关闭原来的多重读取器
+// 转码后的响应体同样受大小限制，超出部分会被截断并标记
+func (a *vientianeAnalyzer) detectCharset(resp *structure.Response,
+	multipleReader reader.MultipleReader) (reader.MultipleReader, error) {
+	httpResp := resp.HTTPResp()
+	contentType := httpResp.Header.Get("Content-Type")
+	head := make([]byte, charset.PEEK_SIZE)
+	headReader := multipleReader.Reader()
+	n, _ := io.ReadFull(headReader, head)
+	headReader.Close()
+	name, _ := charset.Detect(head[:n], contentType)
+	resp.SetCharset(name)
+	if !a.transcoding || charset.IsUTF8(name) {
+		return multipleReader, nil
+	}
+	bodyReader := multipleReader.Reader()
+	utf8Reader, err := charset.NewUTF8Reader(bodyReader, name)
+	if err != nil {
+		bodyReader.Close()
+		return nil, err
+	}
+	utf8MultipleReader, err := reader.NewLimitedMultipleReader(utf8Reader,
+		a.bodyLimit.MaxSize, a.bodyLimit.SpillThreshold)
+	bodyReader.Close()
+	if err != nil {
+		return nil, err
+	}
+	//原来的多重读取器已被替换，其暂存的临时文件可以释放
+	multipleReader.Close()
+	if contentType != "" {
+		httpResp.Header.Set("Content-Type",
+			charset.ReplaceContentTypeCharset(contentType, "utf-8"))
+	}
+	return utf8MultipleReader, nil
+}
+
 // appendDataList 用于添加请求值或条目值到列表
+// 新请求的深度会被设为响应深度加1（同一逻辑深度的请求则与响应深度相同），并以响应的URL作为来源页面
+// 条目会带上产生它的请求的元数据和响应的摘要
 func appendDataList(dataList []structure.Data, data structure.Data,
-	respDepth uint32) []structure.Data {
+	resp *structure.Response) []structure.Data {
 	if data == nil {
 		return dataList
 	}
-	req, ok := data.(*structure.Request)
-	if !ok {
-		return append(dataList, data)
-	}
-	newDepth := respDepth + 1
-	if req.Depth() != newDepth {
-		req = structure.NewRequest(req.HTTPReq(), newDepth)
+	switch d := data.(type) {
+	case *structure.Request:
+		newDepth := resp.Depth() + 1
+		if d.SameDepth() {
+			newDepth = resp.Depth()
+		}
+		if d.Depth() != newDepth {
+			d = d.WithDepth(newDepth)
+		}
+		if d.Referer() == "" {
+			d.SetReferer(resp.HTTPResp().Request.URL.String())
+		}
+		return append(dataList, d)
+	case structure.Item:
+		if _, ok := d[structure.ITEM_KEY_RESPONSE]; !ok {
+			d[structure.ITEM_KEY_RESPONSE] = resp.Summary()
+		}
+		if req := resp.Request(); req != nil {
+			if _, ok := d[structure.ITEM_KEY_META]; !ok {
+				if meta := req.MetaMap(); len(meta) > 0 {
+					d[structure.ITEM_KEY_META] = meta
+				}
+			}
+		}
+		return append(dataList, d)
 	}
-	return append(dataList, req)
+	return append(dataList, data)
 }
 
 func NewAnalyzer(mid module.MID,scoreCalculator module.CalculateScore,
@@ -116,18 +338,47 @@ func NewAnalyzer(mid module.MID,scoreCalculator module.CalculateScore,
 		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_ANALYZER,
 			errors.NewIllegalParameterError("empty response parser list"))
 	}
-	var innerParsers []module.ParseResponse
+	var innerParsers []module.RespParser
 	for i, parser := range respParsers {
 		if parser == nil {
 			errMsg := fmt.Sprintf("nil response parser[%d]", i)
 			return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_ANALYZER,
 				errors.NewIllegalParameterError(errMsg))
 		}
-		innerParsers = append(innerParsers, parser)
+		innerParsers = append(innerParsers, module.RespParser{Parse: parser})
+	}
+	return newAnalyzer(moduleBase, innerParsers)
+}
+
+//用于创建带匹配条件的分析器
+//分析器只会把满足匹配条件的响应交给对应的响应解析函数
+func NewAnalyzerWithRoutes(mid module.MID, scoreCalculator module.CalculateScore,
+	respParsers []module.RespParser) (module.Analyzer, error) {
+	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
+	if err != nil {
+		return nil, err
+	}
+	if len(respParsers) == 0 {
+		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_ANALYZER,
+			errors.NewIllegalParameterError("empty response parser list"))
+	}
+	return newAnalyzer(moduleBase, respParsers)
+}
+
+func newAnalyzer(moduleBase stub.ModuleInternal,
+	respParsers []module.RespParser) (module.Analyzer, error) {
+	routes := make([]*parserRoute, 0, len(respParsers))
+	for i, parser := range respParsers {
+		route, err := newParserRoute(parser, i)
+		if err != nil {
+			return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_ANALYZER,
+				errors.NewIllegalParameterError(err.Error()))
+		}
+		routes = append(routes, route)
 	}
 	return &vientianeAnalyzer{
 		ModuleInternal: moduleBase,
-		respParsers:    innerParsers,
+		routes:         routes,
 	}, nil
 }
 
@@ -0,0 +1,224 @@
+package analyzer
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+)
+
+//按照响应体判断重复的去重器
+type bodyDeduplicator map[string]bool
+
+func (d bodyDeduplicator) Duplicate(resp *structure.Response, body []byte, mediaType string) bool {
+	if d[string(body)] {
+		return true
+	}
+	d[string(body)] = true
+	return false
+}
+
+func TestDeduplicator(t *testing.T) {
+	mid := module.MID("A1|127.0.0.1:8080")
+	var parsed []string
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{
+			Name: "html",
+			Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+				//去重器读取响应体后，解析函数仍然可以读取完整的响应体
+				root, err := resp.HTMLNode()
+				if err != nil {
+					return nil, []error{err}
+				}
+				parsed = append(parsed, root.LastChild.LastChild.FirstChild.Data)
+				return nil, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	a.SetDeduplicator(bodyDeduplicator{})
+	for _, url := range []string{"http://a.com/", "http://b.com/", "http://c.com/"} {
+		body := "<html><body>same</body></html>"
+		if url == "http://c.com/" {
+			body = "<html><body>other</body></html>"
+		}
+		if _, errs := a.Analyze(genTestResponse(url, 200, "text/html", body, 0)); len(errs) > 0 {
+			t.Fatalf("Unexpected errors: %v", errs)
+		}
+	}
+	if len(parsed) != 2 || parsed[0] != "same" || parsed[1] != "other" {
+		t.Fatalf("Unexpected parsed pages: %v", parsed)
+	}
+	extra := a.Summary().Extra.(summaryExtra)
+	if extra.Duplicates != 1 {
+		t.Fatalf("Expected 1 duplicate, got %d", extra.Duplicates)
+	}
+}
+
+//去重器读取的响应体不应超出大小限制，转码后也是如此
+func TestDeduplicatorBodyLimit(t *testing.T) {
+	mid := module.MID("A2|127.0.0.1:8080")
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{Name: "none", Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+			return nil, nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	a.SetTranscoding(true)
+	a.SetBodyLimit(module.BodyLimit{MaxSize: 10, Truncate: true, SpillThreshold: 4})
+	var sizes []int
+	a.SetDeduplicator(deduplicatorFunc(func(body []byte) bool {
+		sizes = append(sizes, len(body))
+		return false
+	}))
+	//ISO-8859-1编码的每个非ASCII字节转码后占两个字节
+	body := strings.Repeat("\xe9", 30)
+	resp := genTestResponse("http://a.com/", 200, "text/plain; charset=iso-8859-1", body, 0)
+	if _, errs := a.Analyze(resp); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(sizes) != 1 || sizes[0] != 10 {
+		t.Fatalf("Inconsistent body sizes seen by the deduplicator: %v", sizes)
+	}
+}
+
+//每个解析函数读取的响应体在调用之后都应被关闭，暂存到临时文件时也是如此
+func TestRouteBodyClosed(t *testing.T) {
+	mid := module.MID("A3|127.0.0.1:8080")
+	var bodies []io.ReadCloser
+	parse := func(resp *structure.Response) ([]structure.Data, []error) {
+		bodies = append(bodies, resp.HTTPResp().Body)
+		return nil, nil
+	}
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{Name: "first", Parse: parse},
+		{Name: "second", Parse: parse},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	a.SetBodyLimit(module.BodyLimit{SpillThreshold: 4})
+	resp := genTestResponse("http://a.com/", 200, "text/plain", "spilled body", 0)
+	if _, errs := a.Analyze(resp); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(bodies) != 2 {
+		t.Fatalf("Expected 2 parsed bodies, got %d", len(bodies))
+	}
+	for i, body := range bodies {
+		if _, err := body.Read(make([]byte, 1)); err == nil || err == io.EOF {
+			t.Fatalf("The body of route %d should be closed, got error %v", i, err)
+		}
+	}
+}
+
+//去重器使用的响应体在去重之后应被关闭，没有匹配的解析函数时也是如此
+func TestDeduplicatorBodyClosed(t *testing.T) {
+	mid := module.MID("A4|127.0.0.1:8080")
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{Name: "none", Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+			return nil, nil
+		}, Condition: module.ParserCondition{MIMETypes: []string{"text/html"}}},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	a.SetBodyLimit(module.BodyLimit{SpillThreshold: 4})
+	var body io.ReadCloser
+	a.SetDeduplicator(respDeduplicatorFunc(func(resp *structure.Response) bool {
+		body = resp.HTTPResp().Body
+		return false
+	}))
+	resp := genTestResponse("http://a.com/", 200, "text/plain", "spilled body", 0)
+	if _, errs := a.Analyze(resp); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if _, err := body.Read(make([]byte, 1)); err == nil || err == io.EOF {
+		t.Fatalf("The body of the deduplicator should be closed, got error %v", err)
+	}
+}
+
+//转码后的响应体同样受大小限制
+func TestTranscodedBodyLimit(t *testing.T) {
+	mid := module.MID("A5|127.0.0.1:8080")
+	var sizes []int
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{Name: "size", Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+			body, err := ioutil.ReadAll(resp.HTTPResp().Body)
+			if err != nil {
+				return nil, []error{err}
+			}
+			sizes = append(sizes, len(body))
+			return nil, nil
+		}},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	a.SetTranscoding(true)
+	//ISO-8859-1编码的30个字节转码后占60个字节
+	body := strings.Repeat("\xe9", 30)
+	contentType := "text/plain; charset=iso-8859-1"
+	a.SetBodyLimit(module.BodyLimit{MaxSize: 40, Truncate: true})
+	if _, errs := a.Analyze(genTestResponse("http://a.com/", 200, contentType, body, 0)); len(errs) > 0 {
+		t.Fatalf("Unexpected errors: %v", errs)
+	}
+	if len(sizes) != 1 || sizes[0] != 40 {
+		t.Fatalf("The transcoded body should be truncated: %v", sizes)
+	}
+	a.SetBodyLimit(module.BodyLimit{MaxSize: 40})
+	_, errs := a.Analyze(genTestResponse("http://b.com/", 200, contentType, body, 0))
+	if len(errs) != 1 || !errors.Is(errs[0], errors.ERROR_CODE_BODY_TOO_LARGE) {
+		t.Fatalf("Expected a too large body error, got %v", errs)
+	}
+	if len(sizes) != 1 {
+		t.Fatalf("The too large transcoded body should not be parsed: %v", sizes)
+	}
+}
+
+type deduplicatorFunc func(body []byte) bool
+
+func (f deduplicatorFunc) Duplicate(resp *structure.Response, body []byte, mediaType string) bool {
+	return f(body)
+}
+
+type respDeduplicatorFunc func(resp *structure.Response) bool
+
+func (f respDeduplicatorFunc) Duplicate(resp *structure.Response, body []byte, mediaType string) bool {
+	return f(resp)
+}
+
+func TestAppendDataList(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "http://example.com/list", nil)
+	req := structure.NewRequest(httpReq, 1).SetMeta("category", "books")
+	resp := structure.NewResponseBy(&http.Response{StatusCode: 200, Request: httpReq}, req)
+	nextHTTPReq, _ := http.NewRequest("GET", "http://example.com/list?page=2", nil)
+	pageHTTPReq, _ := http.NewRequest("GET", "http://example.com/list?page=3", nil)
+	dataList := appendDataList(nil, structure.NewRequest(nextHTTPReq, 0), resp)
+	dataList = appendDataList(dataList, structure.NewRequest(pageHTTPReq, 0).SetSameDepth(true), resp)
+	dataList = appendDataList(dataList, structure.Item{"title": "x"}, resp)
+	next := dataList[0].(*structure.Request)
+	if next.Depth() != 2 || next.Referer() != "http://example.com/list" ||
+		next.HTTPReq().Header.Get("Referer") != "http://example.com/list" {
+		t.Fatalf("Inconsistent new request: depth: %d, referer: %q", next.Depth(), next.Referer())
+	}
+	if page := dataList[1].(*structure.Request); page.Depth() != 1 {
+		t.Fatalf("A same-depth request should keep the response depth: %d", page.Depth())
+	}
+	item := dataList[2].(structure.Item)
+	if item.Meta()["category"] != "books" {
+		t.Fatalf("The item should carry the request metadata: %v", item.Meta())
+	}
+	if summary, ok := item.Response(); !ok || summary.URL != "http://example.com/list" || summary.Depth != 1 {
+		t.Fatalf("The item should carry the response summary: %+v", summary)
+	}
+}
@@ -0,0 +1,163 @@
+package analyzer
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"regexp"
+	"strings"
+	"sync/atomic"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/reader"
+)
+
+//用于推断内容类型时读取的最大字节数
+const SNIFF_SIZE = 512
+
+//带匹配条件和统计信息的响应解析器
+type parserRoute struct {
+	module.RespParser
+	//编译后的URL匹配条件
+	urlRegexp *regexp.Regexp
+	//MIME类型条件，已转换为小写
+	mimeTypes    []string
+	calledCount  uint64
+	matchedCount uint64
+	errorCount   uint64
+	panicCount   uint64
+}
+
+//用于创建带匹配条件的响应解析器，index用于生成默认的名称
+func newParserRoute(p module.RespParser, index int) (*parserRoute, error) {
+	if p.Parse == nil {
+		return nil, fmt.Errorf("nil response parser[%d]", index)
+	}
+	cond := p.Condition
+	if cond.MaxStatus > 0 && cond.MinStatus > cond.MaxStatus {
+		return nil, fmt.Errorf("invalid status range of response parser[%d]: %d-%d",
+			index, cond.MinStatus, cond.MaxStatus)
+	}
+	if cond.MaxDepth > 0 && cond.MinDepth > cond.MaxDepth {
+		return nil, fmt.Errorf("invalid depth range of response parser[%d]: %d-%d",
+			index, cond.MinDepth, cond.MaxDepth)
+	}
+	route := &parserRoute{RespParser: p}
+	if route.Name == "" {
+		route.Name = fmt.Sprintf("parser[%d]", index)
+	}
+	if cond.URLPattern != "" {
+		urlRegexp, err := regexp.Compile(cond.URLPattern)
+		if err != nil {
+			return nil, fmt.Errorf("invalid URL pattern of response parser[%d]: %s",
+				index, err)
+		}
+		route.urlRegexp = urlRegexp
+	}
+	for _, mimeType := range cond.MIMETypes {
+		mimeType = strings.ToLower(strings.TrimSpace(mimeType))
+		if mimeType == "" {
+			continue
+		}
+		route.mimeTypes = append(route.mimeTypes, mimeType)
+	}
+	return route, nil
+}
+
+//用于判断响应是否满足匹配条件
+//mediaType用于获取响应的MIME类型，只在需要时调用
+func (route *parserRoute) match(resp *structure.Response, mediaType func() string) bool {
+	cond := route.Condition
+	httpResp := resp.HTTPResp()
+	if cond.MinStatus > 0 && httpResp.StatusCode < cond.MinStatus {
+		return false
+	}
+	if cond.MaxStatus > 0 && httpResp.StatusCode > cond.MaxStatus {
+		return false
+	}
+	depth := resp.Depth()
+	if depth < cond.MinDepth || (cond.MaxDepth > 0 && depth > cond.MaxDepth) {
+		return false
+	}
+	if route.urlRegexp != nil &&
+		!route.urlRegexp.MatchString(httpResp.Request.URL.String()) {
+		return false
+	}
+	if len(route.mimeTypes) == 0 {
+		return true
+	}
+	actual := mediaType()
+	for _, mimeType := range route.mimeTypes {
+		if matchMIMEType(mimeType, actual) {
+			return true
+		}
+	}
+	return false
+}
+
+//用于获取统计信息
+func (route *parserRoute) stats() module.ParserStats {
+	return module.ParserStats{
+		Name:    route.Name,
+		Called:  atomic.LoadUint64(&route.calledCount),
+		Matched: atomic.LoadUint64(&route.matchedCount),
+		Errors:  atomic.LoadUint64(&route.errorCount),
+		Panics:  atomic.LoadUint64(&route.panicCount),
+	}
+}
+
+//用于调用响应解析函数
+//响应解析函数中发生的panic会被转换为带有调用栈的爬虫错误，已产生的数据会被丢弃
+func (route *parserRoute) call(resp *structure.Response,
+	mid module.MID) (dataList []structure.Data, errorList []error) {
+	defer func() {
+		if p := recover(); p != nil {
+			atomic.AddUint64(&route.panicCount, 1)
+			pe := errors.NewPanicError(p)
+			errMsg := fmt.Sprintf("%s (parser: %s, requestURL: %s, MID: %s)\n%s",
+				pe, route.Name, resp.HTTPResp().Request.URL, mid, pe.Stack)
+			dataList = nil
+			errorList = []error{errors.NewCrawlerErrorWith(errors.ERROR_TYPE_ANALYZER, errMsg, pe)}
+		}
+	}()
+	return route.Parse(resp)
+}
+
+//用于判断MIME类型是否匹配
+//pattern支持"*/*"、"type/*"和"type/*+suffix"的形式
+func matchMIMEType(pattern string, mediaType string) bool {
+	if pattern == "*/*" || pattern == mediaType {
+		return true
+	}
+	index := strings.Index(pattern, "/*")
+	if index < 0 || !strings.HasPrefix(mediaType, pattern[:index+1]) {
+		return false
+	}
+	suffix := pattern[index+2:]
+	if suffix == "" {
+		return true
+	}
+	return strings.HasPrefix(suffix, "+") && strings.HasSuffix(mediaType, suffix)
+}
+
+//用于获取响应的MIME类型
+//响应头中没有内容类型时，根据响应体开头的内容推断
+func responseMediaType(httpResp *http.Response, multipleReader reader.MultipleReader) string {
+	contentType := httpResp.Header.Get("Content-Type")
+	if contentType == "" {
+		head := make([]byte, SNIFF_SIZE)
+		headReader := multipleReader.Reader()
+		n, _ := io.ReadFull(headReader, head)
+		headReader.Close()
+		contentType = http.DetectContentType(head[:n])
+	}
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		//忽略不规范的参数部分
+		mediaType = strings.TrimSpace(strings.Split(contentType, ";")[0])
+	}
+	return strings.ToLower(mediaType)
+}
@@ -0,0 +1,146 @@
+package analyzer
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+)
+
+func genTestResponse(rawURL string, statusCode int, contentType string,
+	body string, depth uint32) *structure.Response {
+	httpReq, _ := http.NewRequest("GET", rawURL, nil)
+	header := http.Header{}
+	if contentType != "" {
+		header.Set("Content-Type", contentType)
+	}
+	httpResp := &http.Response{
+		StatusCode: statusCode,
+		Header:     header,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    httpReq,
+	}
+	return structure.NewResponse(httpResp, depth)
+}
+
+func TestRoutes(t *testing.T) {
+	called := map[string]int{}
+	genParser := func(name string, cond module.ParserCondition) module.RespParser {
+		return module.RespParser{
+			Name: name,
+			Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+				called[name]++
+				return nil, nil
+			},
+			Condition: cond,
+		}
+	}
+	mid := module.MID("A1|127.0.0.1:8080")
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		genParser("all", module.ParserCondition{}),
+		genParser("html", module.ParserCondition{MIMETypes: []string{"text/html"},
+			MinStatus: 200, MaxStatus: 299}),
+		genParser("image", module.ParserCondition{MIMETypes: []string{"image/*"}}),
+		genParser("api", module.ParserCondition{URLPattern: `/api/`, MaxDepth: 1}),
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	responses := []*structure.Response{
+		genTestResponse("http://example.com/", 200, "text/html; charset=utf-8", "<html></html>", 0),
+		genTestResponse("http://example.com/404", 404, "text/html", "", 1),
+		genTestResponse("http://example.com/a.png", 200, "", "\x89PNG\x0D\x0A\x1A\x0A", 1),
+		genTestResponse("http://example.com/api/list", 200, "application/json", "{}", 2),
+		genTestResponse("http://example.com/sniffed", 200, "", "<!DOCTYPE html><html></html>", 1),
+	}
+	for _, resp := range responses {
+		if _, errs := a.Analyze(resp); len(errs) != 0 {
+			t.Fatalf("Errors occur when analyzing: %v", errs)
+		}
+	}
+	expected := map[string]int{"all": 5, "html": 2, "image": 1}
+	for name, count := range expected {
+		if called[name] != count {
+			t.Fatalf("Inconsistent call count of parser %q: expected: %d, actual: %d",
+				name, count, called[name])
+		}
+	}
+	if called["api"] != 0 {
+		t.Fatalf("Parser %q should not be called: %d", "api", called["api"])
+	}
+	stats := a.ParserStats()
+	if stats[1].Name != "html" || stats[1].Called != 5 || stats[1].Matched != 2 {
+		t.Fatalf("Inconsistent parser stats: %+v", stats[1])
+	}
+	for _, c := range []struct {
+		pattern   string
+		mediaType string
+		matched   bool
+	}{
+		{"*/*", "text/plain", true},
+		{"text/*", "text/html", true},
+		{"text/*", "image/png", false},
+		{"application/*+json", "application/ld+json", true},
+		{"application/*+json", "application/json", false},
+		{"application/*+json", "application/xml", false},
+	} {
+		if matchMIMEType(c.pattern, c.mediaType) != c.matched {
+			t.Fatalf("Inconsistent MIME type matching result: %q %q", c.pattern, c.mediaType)
+		}
+	}
+	_, err = NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		genParser("bad", module.ParserCondition{URLPattern: "("}),
+	})
+	if err == nil {
+		t.Fatalf("No error when creating an analyzer with an invalid URL pattern")
+	}
+}
+
+func TestParserPanic(t *testing.T) {
+	mid := module.MID("A1|127.0.0.1:8080")
+	var calledAfterPanic bool
+	a, err := NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, []module.RespParser{
+		{
+			Name: "broken",
+			Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+				var m map[string]int
+				m["boom"]++
+				return nil, nil
+			},
+		},
+		{
+			Name: "fine",
+			Parse: func(resp *structure.Response) ([]structure.Data, []error) {
+				calledAfterPanic = true
+				return []structure.Data{structure.Item{"ok": true}}, nil
+			},
+		},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating an analyzer: %s", err)
+	}
+	dataList, errs := a.Analyze(genTestResponse("http://example.com/p", 200, "text/html", "", 0))
+	if !calledAfterPanic || len(dataList) != 1 {
+		t.Fatalf("The other parsers should still be called: %v", dataList)
+	}
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	errMsg := errs[0].Error()
+	for _, part := range []string{"panic: assignment to entry in nil map", "parser: broken",
+		"requestURL: http://example.com/p", "MID: A1|127.0.0.1:8080", "goroutine"} {
+		if !strings.Contains(errMsg, part) {
+			t.Fatalf("The error message %q should contain %q", errMsg, part)
+		}
+	}
+	stats := a.ParserStats()
+	if stats[0].Panics != 1 || stats[0].Errors != 1 || stats[1].Panics != 0 {
+		t.Fatalf("Inconsistent parser stats: %+v", stats)
+	}
+	if extra, ok := a.Summary().Extra.(summaryExtra); !ok || extra.Panics != 1 {
+		t.Fatalf("Inconsistent summary extra: %#v", a.Summary().Extra)
+	}
+}
@@ -0,0 +1,207 @@
+package dedup
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/simhash"
+	"golang.org/x/net/html"
+)
+
+//基于内容的去重
+//响应按照响应体的摘要检测完全相同的内容，HTML页面还可以按照正文的SimHash检测近似重复
+//去重器可通过Analyzer.SetDeduplicator用于分析器，也可通过ProcessItem用于条目处理管道
+//去重的状态只保存在内存中
+
+const (
+	//默认的近似重复的最大汉明距离
+	DEFAULT_MAX_DISTANCE = 3
+	//默认的参与近似重复检测的最少正文字符数
+	DEFAULT_MIN_TEXT_LENGTH = 100
+)
+
+//去重配置的类型
+type Config struct {
+	//是否按照响应体的摘要检测完全相同的内容，适用于所有类型的响应
+	Exact bool
+	//是否按照HTML正文的SimHash检测近似重复的页面
+	NearDuplicate bool
+	//近似重复的最大汉明距离，默认为DEFAULT_MAX_DISTANCE，不能超过simhash.BANDS-1
+	MaxDistance int
+	//参与近似重复检测的最少正文字符数，默认为DEFAULT_MIN_TEXT_LENGTH
+	//正文过短的页面（如错误页面）容易被误判为近似重复
+	MinTextLength int
+}
+
+//去重的统计
+type Stats struct {
+	//检查的响应数
+	Checked uint64 `json:"checked"`
+	//完全相同的响应数
+	ExactHits uint64 `json:"exact_hits"`
+	//近似重复的响应数
+	NearHits uint64 `json:"near_hits"`
+	//检查的条目数
+	ItemsChecked uint64 `json:"items_checked"`
+	//重复的条目数
+	ItemHits uint64 `json:"item_hits"`
+}
+
+//基于内容的去重器
+type Deduplicator struct {
+	cfg Config
+	//响应体摘要到第一个URL的映射
+	bodies map[[sha256.Size]byte]string
+	//条目摘要到第一个URL的映射
+	items map[[sha256.Size]byte]string
+	lock  sync.Mutex
+	//正文SimHash的索引
+	near  *simhash.Index
+	stats Stats
+}
+
+//用于创建去重器
+func New(cfg Config) *Deduplicator {
+	if cfg.MaxDistance <= 0 {
+		cfg.MaxDistance = DEFAULT_MAX_DISTANCE
+	}
+	if cfg.MaxDistance > simhash.BANDS-1 {
+		cfg.MaxDistance = simhash.BANDS - 1
+	}
+	if cfg.MinTextLength <= 0 {
+		cfg.MinTextLength = DEFAULT_MIN_TEXT_LENGTH
+	}
+	return &Deduplicator{
+		cfg:    cfg,
+		bodies: map[[sha256.Size]byte]string{},
+		items:  map[[sha256.Size]byte]string{},
+		near:   simhash.NewIndex(cfg.MaxDistance),
+	}
+}
+
+//实现module.Deduplicator接口
+func (d *Deduplicator) Duplicate(resp *structure.Response, body []byte, mediaType string) bool {
+	atomic.AddUint64(&d.stats.Checked, 1)
+	url := resp.Summary().URL
+	if d.cfg.Exact {
+		if _, found := d.lookupOrAdd(d.bodies, sha256.Sum256(body), url); found {
+			atomic.AddUint64(&d.stats.ExactHits, 1)
+			return true
+		}
+	}
+	if d.cfg.NearDuplicate && (mediaType == "text/html" || mediaType == "application/xhtml+xml") {
+		root, err := resp.HTMLNode()
+		if err != nil {
+			return false
+		}
+		text := Text(root)
+		if utf8.RuneCountInString(text) < d.cfg.MinTextLength {
+			return false
+		}
+		if _, _, found := d.near.LookupOrAdd(simhash.Hash(text), url); found {
+			atomic.AddUint64(&d.stats.NearHits, 1)
+			return true
+		}
+	}
+	return false
+}
+
+//用于查找摘要，没有找到时加入映射
+func (d *Deduplicator) lookupOrAdd(m map[[sha256.Size]byte]string,
+	sum [sha256.Size]byte, url string) (string, bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	if first, ok := m[sum]; ok {
+		return first, true
+	}
+	m[sum] = url
+	return "", false
+}
+
+//用于生成按照条目内容去重的条目处理函数，重复的条目会被丢弃
+//fields为参与比较的字段，为空时使用除保留字段（以下划线开头）之外的所有字段
+//io.Reader类型的值无法比较，总是会被忽略，因此这类条目应给出fields
+func (d *Deduplicator) ProcessItem(fields ...string) module.ProcessItem {
+	return func(item structure.Item) (structure.Item, error) {
+		atomic.AddUint64(&d.stats.ItemsChecked, 1)
+		selected := map[string]interface{}{}
+		if len(fields) > 0 {
+			for _, field := range fields {
+				selected[field] = item[field]
+			}
+		} else {
+			for k, v := range item {
+				if strings.HasPrefix(k, "_") {
+					continue
+				}
+				selected[k] = v
+			}
+		}
+		for k, v := range selected {
+			if _, ok := v.(io.Reader); ok {
+				delete(selected, k)
+			}
+		}
+		data, err := json.Marshal(selected)
+		if err != nil {
+			return item, fmt.Errorf("dedup: couldn't encode item: %s", err)
+		}
+		url := ""
+		if summary, ok := item.Response(); ok {
+			url = summary.URL
+		}
+		if first, found := d.lookupOrAdd(d.items, sha256.Sum256(data), url); found {
+			atomic.AddUint64(&d.stats.ItemHits, 1)
+			return item, errors.NewDropItemError("duplicate of the item from " + first)
+		}
+		return item, nil
+	}
+}
+
+//用于获取去重的统计
+func (d *Deduplicator) Stats() Stats {
+	return Stats{
+		Checked:      atomic.LoadUint64(&d.stats.Checked),
+		ExactHits:    atomic.LoadUint64(&d.stats.ExactHits),
+		NearHits:     atomic.LoadUint64(&d.stats.NearHits),
+		ItemsChecked: atomic.LoadUint64(&d.stats.ItemsChecked),
+		ItemHits:     atomic.LoadUint64(&d.stats.ItemHits),
+	}
+}
+
+//不包含正文的元素
+var skippedElements = map[string]bool{
+	"script": true, "style": true, "noscript": true, "template": true,
+	"head": true, "svg": true, "iframe": true,
+}
+
+//用于提取HTML文档的正文，文本之间以空格分隔
+func Text(root *html.Node) string {
+	var parts []string
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode && skippedElements[n.Data] {
+			return
+		}
+		if n.Type == html.TextNode {
+			if text := strings.TrimSpace(n.Data); text != "" {
+				parts = append(parts, text)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	return strings.Join(parts, " ")
+}
+
@@ -0,0 +1,87 @@
+package dedup
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/structure"
+)
+
+func newResp(url, body string) *structure.Response {
+	httpReq, _ := http.NewRequest("GET", url, nil)
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    httpReq,
+	}
+	return structure.NewResponseBy(httpResp, structure.NewRequest(httpReq, 0))
+}
+
+func TestDuplicate(t *testing.T) {
+	d := New(Config{Exact: true, NearDuplicate: true})
+	article := strings.Repeat("Crawlers should avoid storing the same article twice when mirrors exist. ", 5)
+	page := func(extra string) string {
+		return fmt.Sprintf("<html><head><title>t</title><script>var x=%q</script></head>"+
+			"<body><p>%s</p><p>%s</p></body></html>", extra, article, extra)
+	}
+	cases := []struct {
+		url       string
+		body      string
+		mediaType string
+		duplicate bool
+	}{
+		{"http://a.com/1", page("footer"), "text/html", false},
+		//完全相同
+		{"http://b.com/1", page("footer"), "text/html", true},
+		//只有少量文字不同
+		{"http://c.com/1", page("mirror"), "text/html", true},
+		{"http://a.com/2", "<html><body>" + strings.Repeat("Another topic entirely about image formats. ", 5) +
+			"</body></html>", "text/html", false},
+		{"http://a.com/img1", "\x89PNG...", "image/png", false},
+		{"http://b.com/img1", "\x89PNG...", "image/png", true},
+		//正文过短的页面不参与近似重复检测
+		{"http://a.com/404", "<html><body>Not found</body></html>", "text/html", false},
+		{"http://b.com/404", "<html><body>Not found!</body></html>", "text/html", false},
+	}
+	for i, c := range cases {
+		resp := newResp(c.url, c.body)
+		if dup := d.Duplicate(resp, []byte(c.body), c.mediaType); dup != c.duplicate {
+			t.Fatalf("case %d (%s): expected duplicate %v, got %v", i, c.url, c.duplicate, dup)
+		}
+	}
+	stats := d.Stats()
+	if stats.Checked != uint64(len(cases)) || stats.ExactHits != 2 || stats.NearHits != 1 {
+		t.Fatalf("unexpected stats: %+v", stats)
+	}
+}
+
+func TestProcessItem(t *testing.T) {
+	d := New(Config{})
+	process := d.ProcessItem()
+	items := []structure.Item{
+		{"title": "a", "price": 1, structure.ITEM_KEY_META: map[string]interface{}{"page": 1}},
+		{"title": "a", "price": 1, structure.ITEM_KEY_META: map[string]interface{}{"page": 2}},
+		{"title": "a", "price": 2},
+	}
+	var dropped int
+	for _, item := range items {
+		_, err := process(item)
+		if _, ok := err.(*errors.DropItemError); ok {
+			dropped++
+		} else if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if dropped != 1 || d.Stats().ItemHits != 1 {
+		t.Fatalf("expected 1 dropped item, got %d", dropped)
+	}
+	byName := d.ProcessItem("name")
+	byName(structure.Item{"name": "x.png", "reader": strings.NewReader("1")})
+	if _, err := byName(structure.Item{"name": "x.png", "reader": strings.NewReader("2")}); err == nil {
+		t.Fatal("expected the item with the same name to be dropped")
+	}
+}
@@ -0,0 +1,137 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/httpcache"
+)
+
+func TestCache(t *testing.T) {
+	var hits uint64
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddUint64(&hits, 1)
+		switch r.URL.Path {
+		case "/max-age":
+			w.Header().Set("Cache-Control", "max-age=60")
+		case "/etag":
+			w.Header().Set("Cache-Control", "no-cache")
+			w.Header().Set("ETag", `"v1"`)
+			if r.Header.Get("If-None-Match") == `"v1"` {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		case "/no-store":
+			w.Header().Set("Cache-Control", "no-store")
+		case "/too-large":
+			w.Header().Set("Cache-Control", "max-age=60")
+			fmt.Fprint(w, "/too-large-padding")
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer server.Close()
+	dir, err := httpcache.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDownloaderWithCache(module.MID("D1|127.0.0.1:8080"), &http.Client{}, dir,
+		module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	//超出限制的响应体不会被缓存
+	d.SetBodyLimit(module.BodyLimit{MaxSize: 16})
+	cases := []struct {
+		path   string
+		status []string
+		hits   uint64
+	}{
+		{"/max-age", []string{structure.CACHE_STATUS_FETCHED, structure.CACHE_STATUS_FRESH}, 1},
+		{"/etag", []string{structure.CACHE_STATUS_FETCHED, structure.CACHE_STATUS_REVALIDATED}, 2},
+		{"/no-store", []string{structure.CACHE_STATUS_FETCHED, structure.CACHE_STATUS_FETCHED}, 2},
+		{"/too-large", []string{structure.CACHE_STATUS_FETCHED, structure.CACHE_STATUS_FETCHED}, 2},
+	}
+	for _, c := range cases {
+		atomic.StoreUint64(&hits, 0)
+		for i, status := range c.status {
+			httpReq, _ := http.NewRequest("GET", server.URL+c.path, nil)
+			resp, err := d.Download(structure.NewRequest(httpReq, 0))
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+			resp.HTTPResp().Body.Close()
+			if !strings.HasPrefix(string(body), c.path) || resp.HTTPResp().StatusCode != 200 {
+				t.Fatalf("%s[%d]: unexpected response %d %q",
+					c.path, i, resp.HTTPResp().StatusCode, body)
+			}
+			if resp.CacheStatus() != status {
+				t.Fatalf("%s[%d]: expected cache status %s, got %s",
+					c.path, i, status, resp.CacheStatus())
+			}
+		}
+		if n := atomic.LoadUint64(&hits); n != c.hits {
+			t.Fatalf("%s: expected %d server hits, got %d", c.path, c.hits, n)
+		}
+	}
+	cache := d.Summary().Extra.(summaryExtra).Cache
+	if cache.Fresh != 1 || cache.Revalidated != 1 || cache.Fetched != 6 ||
+		cache.HitRatio != 2.0/8.0 {
+		t.Fatalf("unexpected cache summary: %+v", cache)
+	}
+}
+
+//缓存的条目在重新验证后无法使用时会重新获取，计时信息应来自重新获取的过程
+func TestCacheRefetchTiming(t *testing.T) {
+	delay := 50 * time.Millisecond
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("If-None-Match") != "" {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		time.Sleep(delay)
+		fmt.Fprint(w, "fresh")
+	}))
+	defer server.Close()
+	dir, err := httpcache.NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	//响应体比声明的长度短，重新验证时无法读取
+	err = dir.Put(&httpcache.Entry{
+		Method:   http.MethodGet,
+		URL:      server.URL + "/broken",
+		StoredAt: time.Now(),
+		Raw: []byte("HTTP/1.1 200 OK\r\nCache-Control: no-cache\r\nETag: \"v1\"\r\n" +
+			"Content-Length: 100\r\n\r\nstale"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	d, err := NewDownloaderWithCache(module.MID("D1|127.0.0.1:8080"), &http.Client{}, dir,
+		module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL+"/broken", nil)
+	resp, err := d.Download(structure.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+	resp.HTTPResp().Body.Close()
+	if string(body) != "fresh" || resp.CacheStatus() != structure.CACHE_STATUS_FETCHED {
+		t.Fatalf("unexpected response %q (cache status: %s)", body, resp.CacheStatus())
+	}
+	if timing := resp.Timing(); timing.TTFB < delay || timing.Total < delay {
+		t.Fatalf("the timing should come from the refetch: %+v", timing)
+	}
+}
@@ -3,9 +3,17 @@ package downloader
 import (
 	"github.com/Vientiane/structure"
 	"net/http"
+	"net/http/httptrace"
 	"github.com/Vientiane/errors"
 	"github.com/Vientiane/module"
 	"github.com/Vientiane/module/stub"
+	"io"
+	"io/ioutil"
+	"bytes"
+	"fmt"
+	"sync/atomic"
+	"time"
+	"github.com/Vientiane/toolkit/httpcache"
 )
 
 
@@ -15,6 +23,68 @@ type vientianeDownloader struct{
 	stub.ModuleInternal
 	//下载用的http客户端
 	httpClient http.Client
+	//原始HTTP交互的记录器
+	recorder module.Recorder
+	//HTTP缓存目录，nil代表不使用缓存
+	cache *httpcache.Dir
+	//缓存的统计
+	cacheStats cacheStats
+	//记录和缓存响应时读取响应体的大小限制
+	bodyLimit module.BodyLimit
+	//记录响应失败的次数，包括响应体超出限制而未被记录的次数
+	recordErrors uint64
+}
+
+//缓存的统计
+type cacheStats struct {
+	//直接使用新鲜的缓存响应的次数
+	fresh uint64
+	//缓存的响应经服务器验证未改变的次数
+	revalidated uint64
+	//从网络获取响应的次数
+	fetched uint64
+	//保存响应失败的次数
+	storeErrors uint64
+}
+
+//下载器摘要中的额外信息的类型
+type summaryExtra struct {
+	Cache        *cacheSummary `json:"cache,omitempty"`
+	RecordErrors uint64        `json:"record_errors"`
+}
+
+//下载器摘要中缓存信息的类型
+type cacheSummary struct {
+	Fresh       uint64 `json:"fresh"`
+	Revalidated uint64 `json:"revalidated"`
+	Fetched     uint64 `json:"fetched"`
+	StoreErrors uint64 `json:"store_errors"`
+	//使用缓存的响应（新鲜的和验证未改变的）占所有响应的比例
+	HitRatio float64 `json:"hit_ratio"`
+}
+
+func(d *vientianeDownloader)Summary() module.SummaryStruct {
+	summary := d.ModuleInternal.Summary()
+	if d.cache == nil && d.recorder == nil {
+		return summary
+	}
+	extra := summaryExtra{RecordErrors: atomic.LoadUint64(&d.recordErrors)}
+	if d.cache == nil {
+		summary.Extra = extra
+		return summary
+	}
+	cache := &cacheSummary{
+		Fresh:       atomic.LoadUint64(&d.cacheStats.fresh),
+		Revalidated: atomic.LoadUint64(&d.cacheStats.revalidated),
+		Fetched:     atomic.LoadUint64(&d.cacheStats.fetched),
+		StoreErrors: atomic.LoadUint64(&d.cacheStats.storeErrors),
+	}
+	if total := cache.Fresh + cache.Revalidated + cache.Fetched; total > 0 {
+		cache.HitRatio = float64(cache.Fresh+cache.Revalidated) / float64(total)
+	}
+	extra.Cache = cache
+	summary.Extra = extra
+	return summary
 }
 
 func(d *vientianeDownloader)Download(req *structure.Request) (*structure.Response, error) {
@@ -31,16 +101,231 @@ func(d *vientianeDownloader)Download(req *structure.Request) (*structure.Respons
 			errors.NewIllegalParameterError("nil Http request"))
 	}
 	d.ModuleInternal.IncrAcceptedCount()
-	httpResp, err := d.httpClient.Do(httpReq)
+	useCache := d.cache != nil && httpcache.Cacheable(httpReq)
+	var entry *httpcache.Entry
+	if useCache {
+		entry, _ = d.cache.Get(httpReq.Method, httpReq.URL.String(), req.Body())
+		if entry != nil && !httpcache.MustRevalidate(httpReq) && entry.Fresh(time.Now()) {
+			if resp, err := d.cachedResponse(req, entry, structure.CACHE_STATUS_FRESH); err == nil {
+				atomic.AddUint64(&d.cacheStats.fresh, 1)
+				return resp, nil
+			}
+			entry = nil
+		}
+	}
+	req.ResetBody()
+	sendReq := httpReq
+	if entry != nil {
+		//带上验证器，由服务器判断缓存的响应是否改变
+		sendReq = httpReq.Clone(httpReq.Context())
+		if !entry.SetValidators(sendReq) {
+			sendReq, entry = httpReq, nil
+		}
+	}
+	recorder := newTraceRecorder()
+	tracedReq := sendReq.WithContext(
+		httptrace.WithClientTrace(sendReq.Context(), recorder.clientTrace()))
+	httpResp, err := d.httpClient.Do(tracedReq)
+	if err != nil {
+		return nil, downloadError(d.ID(), req, errors.STAGE_DOWNLOAD, err)
+	}
+	if entry != nil && httpResp.StatusCode == http.StatusNotModified {
+		httpResp.Body.Close()
+		updated, err := entry.Revalidated(httpResp, time.Now())
+		if err == nil {
+			if err := d.cache.Put(updated); err != nil {
+				atomic.AddUint64(&d.cacheStats.storeErrors, 1)
+			}
+			if resp, err := d.cachedResponse(req, updated, structure.CACHE_STATUS_REVALIDATED); err == nil {
+				resp.SetTiming(recorder.current())
+				atomic.AddUint64(&d.cacheStats.revalidated, 1)
+				return resp, nil
+			}
+		}
+		//缓存的条目无法使用时重新获取，计时信息只包含重新获取的过程
+		d.cache.Delete(httpReq.Method, httpReq.URL.String(), req.Body())
+		req.ResetBody()
+		recorder = newTraceRecorder()
+		tracedReq = httpReq.WithContext(
+			httptrace.WithClientTrace(httpReq.Context(), recorder.clientTrace()))
+		httpResp, err = d.httpClient.Do(tracedReq)
+		if err != nil {
+			return nil, downloadError(d.ID(), req, errors.STAGE_DOWNLOAD, err)
+		}
+	}
+	d.ModuleInternal.IncrCompletedCount()
+	resp := structure.NewResponseBy(httpResp, req)
+	resp.SetMID(string(d.ID()))
+	resp.SetRedirectChain(redirectChain(httpResp))
+	resp.SetTiming(recorder.current())
+	if httpResp.Body != nil {
+		httpResp.Body = &trackedBody{
+			ReadCloser: httpResp.Body,
+			resp:       resp,
+			recorder:   recorder,
+		}
+	}
+	if useCache {
+		resp.SetCacheStatus(structure.CACHE_STATUS_FETCHED)
+		atomic.AddUint64(&d.cacheStats.fetched, 1)
+	}
+	if (d.recorder != nil || useCache) && httpResp.Body != nil {
+		//记录和缓存时需要完整的响应体，读完后再交给分析器
+		body, exceeded, err := readBody(httpResp, d.bodyLimit.MaxSize)
+		if err != nil {
+			return nil, downloadError(d.ID(), req, errors.STAGE_DOWNLOAD, err)
+		}
+		if exceeded {
+			//超出限制的响应不记录也不缓存，由分析器按照其限制处理
+			if d.recorder == nil {
+				return resp, nil
+			}
+			atomic.AddUint64(&d.recordErrors, 1)
+			return resp, tooLargeError(d.ID(), req, d.bodyLimit.MaxSize)
+		}
+		if useCache {
+			d.store(resp, body)
+		}
+		if d.recorder != nil {
+			if err := d.recorder.Record(resp, body); err != nil {
+				//记录失败不影响已经下载的响应
+				atomic.AddUint64(&d.recordErrors, 1)
+				return resp, recordError(d.ID(), req, err)
+			}
+		}
+	}
+	return resp, nil
+}
+
+//用于读取记录和缓存所需的完整响应体，最多读取maxSize字节，0代表不限制
+//响应体超出限制时exceeded为true，已读取的部分会被放回，响应体仍可从头完整地读取
+func readBody(httpResp *http.Response, maxSize int64) (body []byte, exceeded bool, err error) {
+	var r io.Reader = httpResp.Body
+	if maxSize > 0 {
+		r = io.LimitReader(httpResp.Body, maxSize+1)
+	}
+	body, err = ioutil.ReadAll(r)
+	if err != nil {
+		httpResp.Body.Close()
+		return nil, false, err
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		httpResp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), httpResp.Body), httpResp.Body}
+		return nil, true, nil
+	}
+	httpResp.Body.Close()
+	httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	return body, false, nil
+}
+
+//用于把下载过程中的错误包装为带有上下文的爬虫错误
+func downloadError(mid module.MID, req *structure.Request, stage errors.Stage, err error) error {
+	return errors.Wrap(errors.ERROR_TYPE_DOWNLOADER, err, errors.ErrorContext{
+		URL:   req.HTTPReq().URL.String(),
+		Depth: req.Depth(),
+		MID:   string(mid),
+		Stage: stage,
+	})
+}
+
+//用于生成记录响应失败的错误
+func recordError(mid module.MID, req *structure.Request, err error) error {
+	errMsg := fmt.Sprintf("couldn't record the response: %s (requestURL: %s)",
+		err, req.HTTPReq().URL)
+	return errors.NewCrawlerErrorWith(errors.ERROR_TYPE_DOWNLOADER, errMsg, err).WithContext(errors.ErrorContext{
+		URL:   req.HTTPReq().URL.String(),
+		Depth: req.Depth(),
+		MID:   string(mid),
+		Stage: errors.STAGE_RECORD,
+	})
+}
+
+//用于生成响应体超出限制而未被记录的错误
+func tooLargeError(mid module.MID, req *structure.Request, maxSize int64) error {
+	errMsg := fmt.Sprintf("too large response body to record: more than %d bytes (requestURL: %s)",
+		maxSize, req.HTTPReq().URL)
+	return errors.NewCrawlerError(errors.ERROR_TYPE_DOWNLOADER, errMsg).
+		WithCode(errors.ERROR_CODE_BODY_TOO_LARGE).WithContext(errors.ErrorContext{
+		URL:   req.HTTPReq().URL.String(),
+		Depth: req.Depth(),
+		MID:   string(mid),
+		Stage: errors.STAGE_RECORD,
+	})
+}
+
+//用于根据缓存的条目生成响应
+//使用缓存的响应不是一次完整的HTTP交互，因此不会交给记录器
+func(d *vientianeDownloader)cachedResponse(req *structure.Request,
+	entry *httpcache.Entry, status string) (*structure.Response, error) {
+	resp, _, err := entryResponse(req, entry)
 	if err != nil {
 		return nil, err
 	}
 	d.ModuleInternal.IncrCompletedCount()
-	return structure.NewResponse(httpResp, req.Depth()), nil
+	resp.SetMID(string(d.ID()))
+	resp.SetCacheStatus(status)
+	return resp, nil
+}
+
+//用于在可以保存时把从网络获取的响应保存到缓存
+//保存失败不影响下载，只会计入摘要
+func(d *vientianeDownloader)store(resp *structure.Response, body []byte) {
+	httpResp := resp.HTTPResp()
+	now := time.Now()
+	if !httpcache.Storable(httpResp, now) {
+		return
+	}
+	summary := resp.Summary()
+	err := d.cache.Put(&httpcache.Entry{
+		Method:        http.MethodGet,
+		URL:           summary.URL,
+		FinalURL:      summary.FinalURL,
+		RedirectChain: summary.RedirectChain,
+		StoredAt:      now,
+		Raw:           httpcache.RawResponse(httpResp, body),
+	})
+	if err != nil {
+		atomic.AddUint64(&d.cacheStats.storeErrors, 1)
+	}
+}
+
+func(d *vientianeDownloader)Recorder() module.Recorder {
+	return d.recorder
+}
+
+func(d *vientianeDownloader)SetRecorder(recorder module.Recorder) {
+	d.recorder = recorder
+}
+
+func(d *vientianeDownloader)BodyLimit() module.BodyLimit {
+	return d.bodyLimit
+}
+
+func(d *vientianeDownloader)SetBodyLimit(limit module.BodyLimit) {
+	d.bodyLimit = limit
 }
 
 func NewDownloader(mid module.MID,client *http.Client,
 	scoreCalculator module.CalculateScore)(module.Downloader,error) {
+	return newDownloader(mid, client, nil, scoreCalculator)
+}
+
+//用于创建使用磁盘HTTP缓存的下载器
+//缓存遵循响应的Cache-Control和Expires，过期后会带上If-None-Match或If-Modified-Since重新验证
+func NewDownloaderWithCache(mid module.MID, client *http.Client, cache *httpcache.Dir,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	if cache == nil {
+		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_DOWNLOADER,
+			errors.NewIllegalParameterError("nil http cache"))
+	}
+	return newDownloader(mid, client, cache, scoreCalculator)
+}
+
+func newDownloader(mid module.MID, client *http.Client, cache *httpcache.Dir,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
 		return nil, err
@@ -52,5 +337,6 @@ func NewDownloader(mid module.MID,client *http.Client,
 	return &vientianeDownloader{
 		ModuleInternal: moduleBase,
 		httpClient:         *client,
+		cache:          cache,
 	}, nil
-}
\ No newline at end of file
+}
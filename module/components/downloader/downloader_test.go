@@ -0,0 +1,152 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+)
+
+func TestDownloadError(t *testing.T) {
+	release := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+	}))
+	defer server.Close()
+	defer close(release)
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, err := NewDownloader(mid, &http.Client{Timeout: 50 * time.Millisecond},
+		module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL+"/slow", nil)
+	_, err = d.Download(structure.NewRequest(httpReq, 3))
+	var ce errors.CrawlerError
+	if !errors.As(err, &ce) {
+		t.Fatalf("The download error should be a crawler error: %#v", err)
+	}
+	if !errors.Is(err, errors.ERROR_CODE_TIMEOUT) {
+		t.Fatalf("Inconsistent error code: expected: %s, actual: %s", errors.ERROR_CODE_TIMEOUT, ce.Code())
+	}
+	expected := errors.ErrorContext{URL: server.URL + "/slow", Depth: 3,
+		MID: string(mid), Stage: errors.STAGE_DOWNLOAD}
+	if ce.Context() != expected {
+		t.Fatalf("Inconsistent error context: expected: %+v, actual: %+v", expected, ce.Context())
+	}
+}
+
+func TestDownloadTrace(t *testing.T) {
+	body := strings.Repeat("x", 10000)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/a":
+			http.Redirect(w, r, "/b", http.StatusFound)
+		case "/b":
+			http.Redirect(w, r, "/final", http.StatusMovedPermanently)
+		default:
+			time.Sleep(5 * time.Millisecond)
+			fmt.Fprint(w, body)
+		}
+	}))
+	defer server.Close()
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, err := NewDownloader(mid, &http.Client{}, module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	httpReq, _ := http.NewRequest("GET", server.URL+"/a", nil)
+	resp, err := d.Download(structure.NewRequest(httpReq, 0))
+	if err != nil {
+		t.Fatalf("An error occurs when downloading: %s", err)
+	}
+	expectedChain := []string{server.URL + "/a", server.URL + "/b"}
+	if !reflect.DeepEqual(resp.RedirectChain(), expectedChain) {
+		t.Fatalf("Inconsistent redirect chain: expected: %v, actual: %v", expectedChain, resp.RedirectChain())
+	}
+	if resp.FinalURL() != server.URL+"/final" || resp.MID() != string(mid) {
+		t.Fatalf("Inconsistent final URL or MID: %q %q", resp.FinalURL(), resp.MID())
+	}
+	data, err := ioutil.ReadAll(resp.HTTPResp().Body)
+	if err != nil || len(data) != len(body) {
+		t.Fatalf("An error occurs when reading the body: %v (%d bytes)", err, len(data))
+	}
+	if resp.BytesRead() != uint64(len(body)) {
+		t.Fatalf("Inconsistent bytes read: expected: %d, actual: %d", len(body), resp.BytesRead())
+	}
+	timing := resp.Timing()
+	if timing.TTFB <= 0 || timing.Total < timing.TTFB {
+		t.Fatalf("Inconsistent timing: %+v", timing)
+	}
+	summary := resp.Summary()
+	if summary.BytesRead != uint64(len(body)) || len(summary.RedirectChain) != 2 {
+		t.Fatalf("Inconsistent summary: %+v", summary)
+	}
+}
+
+//记录次数可控的记录器，用于测试
+type testRecorder struct {
+	err    error
+	bodies [][]byte
+}
+
+func (r *testRecorder) Record(resp *structure.Response, body []byte) error {
+	r.bodies = append(r.bodies, body)
+	return r.err
+}
+
+func TestDownloadRecord(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/large" {
+			fmt.Fprint(w, strings.Repeat("x", 100))
+			return
+		}
+		fmt.Fprint(w, "small")
+	}))
+	defer server.Close()
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, err := NewDownloader(mid, &http.Client{}, module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a downloader: %s", err)
+	}
+	recorder := &testRecorder{err: fmt.Errorf("disk full")}
+	d.SetRecorder(recorder)
+	d.SetBodyLimit(module.BodyLimit{MaxSize: 10})
+
+	//记录失败时仍返回响应
+	httpReq, _ := http.NewRequest("GET", server.URL+"/small", nil)
+	resp, err := d.Download(structure.NewRequest(httpReq, 0))
+	if resp == nil || !errors.Is(err, errors.ERROR_TYPE_DOWNLOADER) {
+		t.Fatalf("The response should be returned with a record error: %v %v", resp, err)
+	}
+	if data, _ := ioutil.ReadAll(resp.HTTPResp().Body); string(data) != "small" {
+		t.Fatalf("Inconsistent body: %q", data)
+	}
+
+	//超出限制的响应体不被记录，但仍可被完整地读取
+	recorder.err = nil
+	httpReq, _ = http.NewRequest("GET", server.URL+"/large", nil)
+	resp, err = d.Download(structure.NewRequest(httpReq, 0))
+	if resp == nil || !errors.Is(err, errors.ERROR_CODE_BODY_TOO_LARGE) {
+		t.Fatalf("The response should be returned with a body too large error: %v %v", resp, err)
+	}
+	if len(recorder.bodies) != 1 {
+		t.Fatalf("The too large response should not be recorded: %d", len(recorder.bodies))
+	}
+	if data, _ := ioutil.ReadAll(resp.HTTPResp().Body); len(data) != 100 {
+		t.Fatalf("Inconsistent body length: expected: %d, actual: %d", 100, len(data))
+	}
+	resp.HTTPResp().Body.Close()
+	extra, ok := d.Summary().Extra.(summaryExtra)
+	if !ok || extra.RecordErrors != 2 {
+		t.Fatalf("Inconsistent summary extra: %+v", d.Summary().Extra)
+	}
+}
@@ -0,0 +1,358 @@
+package downloader
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/module/stub"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/httpcache"
+	"github.com/Vientiane/toolkit/warc"
+)
+
+//重放来源的接口类型
+//该接口的实现类型必须是并发安全的
+type ReplaySource interface {
+	//根据请求方法、URL和请求体查找记录的响应，未找到时返回httpcache.ErrNotFound
+	//GET请求的请求体会被忽略，参见httpcache.Key
+	Lookup(method, url string, body []byte) (*httpcache.Entry, error)
+}
+
+//从记录的响应重放的下载器，用于离线地重新运行爬取过程
+type vientianeReplayDownloader struct {
+	//组件的基础实例
+	stub.ModuleInternal
+	//重放来源
+	source ReplaySource
+	//是否在未找到记录时返回错误，否则返回状态码为404的响应
+	strict bool
+	//原始HTTP交互的记录器
+	recorder module.Recorder
+	//记录响应时响应体的大小限制
+	bodyLimit module.BodyLimit
+	//记录响应失败的次数，包括响应体超出限制而未被记录的次数
+	recordErrors uint64
+	//找到记录的次数
+	hitCount uint64
+	//未找到记录的次数
+	missCount uint64
+}
+
+//重放下载器摘要中的额外信息的类型
+type replaySummaryExtra struct {
+	Hits         uint64 `json:"hits"`
+	Misses       uint64 `json:"misses"`
+	Strict       bool   `json:"strict"`
+	RecordErrors uint64 `json:"record_errors"`
+}
+
+func (d *vientianeReplayDownloader) Summary() module.SummaryStruct {
+	summary := d.ModuleInternal.Summary()
+	summary.Extra = replaySummaryExtra{
+		Hits:         atomic.LoadUint64(&d.hitCount),
+		Misses:       atomic.LoadUint64(&d.missCount),
+		Strict:       d.strict,
+		RecordErrors: atomic.LoadUint64(&d.recordErrors),
+	}
+	return summary
+}
+
+func (d *vientianeReplayDownloader) Download(req *structure.Request) (*structure.Response, error) {
+	d.ModuleInternal.IncrHandlingNumber()
+	defer d.ModuleInternal.DecrHandlingNumber()
+	d.ModuleInternal.IncrCalledCount()
+	if req == nil {
+		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_DOWNLOADER,
+			errors.NewIllegalParameterError("nil request"))
+	}
+	httpReq := req.HTTPReq()
+	if httpReq == nil {
+		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_DOWNLOADER,
+			errors.NewIllegalParameterError("nil Http request"))
+	}
+	d.ModuleInternal.IncrAcceptedCount()
+	url := httpReq.URL.String()
+	entry, err := d.source.Lookup(httpReq.Method, url, req.Body())
+	if err == httpcache.ErrNotFound {
+		atomic.AddUint64(&d.missCount, 1)
+		if d.strict {
+			errMsg := fmt.Sprintf("no recorded response (requestURL: %s)", url)
+			return nil, errors.NewCrawlerErrorWith(errors.ERROR_TYPE_DOWNLOADER, errMsg, err).
+				WithContext(errors.ErrorContext{URL: url, Depth: req.Depth(),
+					MID: string(d.ID()), Stage: errors.STAGE_DOWNLOAD})
+		}
+		d.ModuleInternal.IncrCompletedCount()
+		resp := structure.NewResponseBy(missingResponse(httpReq), req)
+		resp.SetMID(string(d.ID()))
+		return resp, nil
+	}
+	if err != nil {
+		return nil, downloadError(d.ID(), req, errors.STAGE_DOWNLOAD, err)
+	}
+	atomic.AddUint64(&d.hitCount, 1)
+	resp, body, err := entryResponse(req, entry)
+	if err != nil {
+		return nil, downloadError(d.ID(), req, errors.STAGE_DOWNLOAD, err)
+	}
+	d.ModuleInternal.IncrCompletedCount()
+	resp.SetMID(string(d.ID()))
+	resp.AddBytesRead(uint64(len(body)))
+	if d.recorder != nil {
+		if maxSize := d.bodyLimit.MaxSize; maxSize > 0 && int64(len(body)) > maxSize {
+			atomic.AddUint64(&d.recordErrors, 1)
+			return resp, tooLargeError(d.ID(), req, maxSize)
+		}
+		if err := d.recorder.Record(resp, body); err != nil {
+			//记录失败不影响重放的响应
+			atomic.AddUint64(&d.recordErrors, 1)
+			return resp, recordError(d.ID(), req, err)
+		}
+	}
+	return resp, nil
+}
+
+func (d *vientianeReplayDownloader) Recorder() module.Recorder {
+	return d.recorder
+}
+
+func (d *vientianeReplayDownloader) SetRecorder(recorder module.Recorder) {
+	d.recorder = recorder
+}
+
+func (d *vientianeReplayDownloader) BodyLimit() module.BodyLimit {
+	return d.bodyLimit
+}
+
+func (d *vientianeReplayDownloader) SetBodyLimit(limit module.BodyLimit) {
+	d.bodyLimit = limit
+}
+
+//用于根据保存的条目生成响应，同时返回完整的响应体
+func entryResponse(req *structure.Request, entry *httpcache.Entry) (*structure.Response, []byte, error) {
+	httpReq := req.HTTPReq()
+	finalReq := httpReq
+	if entry.FinalURL != "" && entry.FinalURL != httpReq.URL.String() {
+		var err error
+		finalReq, err = http.NewRequest(http.MethodGet, entry.FinalURL, nil)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	httpResp, err := entry.Response(finalReq)
+	if err != nil {
+		return nil, nil, err
+	}
+	body, err := ioutil.ReadAll(httpResp.Body)
+	httpResp.Body.Close()
+	if err != nil {
+		return nil, nil, err
+	}
+	httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	resp := structure.NewResponseBy(httpResp, req)
+	resp.SetRedirectChain(entry.RedirectChain)
+	return resp, body, nil
+}
+
+//用于生成未找到记录时的响应
+func missingResponse(httpReq *http.Request) *http.Response {
+	return &http.Response{
+		Status:     "404 Not Found",
+		StatusCode: http.StatusNotFound,
+		Proto:      "HTTP/1.1",
+		ProtoMajor: 1,
+		ProtoMinor: 1,
+		Header: http.Header{
+			"Content-Type":  {"text/plain; charset=utf-8"},
+			"X-Replay-Miss": {"1"},
+		},
+		Body:    ioutil.NopCloser(strings.NewReader("")),
+		Request: httpReq,
+	}
+}
+
+//用于创建重放下载器
+//strict为true时未找到记录的请求会返回错误，否则会得到状态码为404的响应
+func NewReplayDownloader(mid module.MID, source ReplaySource, strict bool,
+	scoreCalculator module.CalculateScore) (module.Downloader, error) {
+	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
+	if err != nil {
+		return nil, err
+	}
+	if source == nil {
+		return nil, errors.NewCrawlerErrorBy(errors.ERROR_TYPE_DOWNLOADER,
+			errors.NewIllegalParameterError("nil replay source"))
+	}
+	return &vientianeReplayDownloader{
+		ModuleInternal: moduleBase,
+		source:         source,
+		strict:         strict,
+	}, nil
+}
+
+//从WARC文件读取的重放来源
+//响应记录会按照请求方法、目标URI和请求记录中的请求体索引，带有元数据记录时还会按照重定向之前的请求URL索引
+//所有的响应都保存在内存中，适合开发和测试规模的存档
+type WARCSource struct {
+	entries map[string]*httpcache.Entry
+}
+
+//用于从WARC文件创建重放来源，同一URL有多条记录时以最后一条为准
+func NewWARCSource(paths ...string) (*WARCSource, error) {
+	responses := make([]*warc.Record, 0)
+	methods := map[string]string{}
+	bodies := map[string][]byte{}
+	metas := map[string][]byte{}
+	for _, path := range paths {
+		err := readWARC(path, func(record *warc.Record) {
+			switch record.Type() {
+			case warc.TYPE_RESPONSE:
+				responses = append(responses, record)
+			case warc.TYPE_REQUEST:
+				block := record.Block
+				respID := record.Header.Get(warc.HEADER_CONCURRENT_TO)
+				if i := bytes.IndexByte(block, ' '); i > 0 {
+					methods[respID] = string(block[:i])
+				}
+				if i := bytes.Index(block, []byte("\r\n\r\n")); i >= 0 && i+4 < len(block) {
+					bodies[respID] = block[i+4:]
+				}
+			case warc.TYPE_METADATA:
+				metas[record.Header.Get(warc.HEADER_REFERS_TO)] = record.Block
+			}
+		})
+		if err != nil {
+			return nil, fmt.Errorf("%s: %s", path, err)
+		}
+	}
+	s := &WARCSource{entries: map[string]*httpcache.Entry{}}
+	for _, record := range responses {
+		method, ok := methods[record.ID()]
+		if !ok {
+			method = http.MethodGet
+		}
+		target := record.Header.Get(warc.HEADER_TARGET_URI)
+		date, _ := record.Date()
+		body := bodies[record.ID()]
+		entry := &httpcache.Entry{
+			Method:      method,
+			URL:         target,
+			RequestBody: body,
+			FinalURL:    target,
+			StoredAt:    date,
+			Raw:         record.Block,
+		}
+		s.entries[httpcache.Key(method, target, body)] = entry
+		requestURL, chain := parseMetadata(metas[record.ID()])
+		if requestURL != "" && requestURL != target {
+			alias := *entry
+			alias.URL = requestURL
+			alias.RedirectChain = chain
+			s.entries[httpcache.Key(method, requestURL, body)] = &alias
+		}
+	}
+	return s, nil
+}
+
+//用于读取WARC文件中的所有记录
+func readWARC(path string, fn func(record *warc.Record)) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	r, err := warc.NewReader(file)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		fn(record)
+	}
+}
+
+//用于从元数据记录中读取重定向之前的请求URL和重定向经过的URL
+func parseMetadata(block []byte) (requestURL string, chain []string) {
+	scanner := bufio.NewScanner(bytes.NewReader(block))
+	for scanner.Scan() {
+		line := scanner.Text()
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			continue
+		}
+		value := strings.TrimSpace(line[i+1:])
+		switch line[:i] {
+		case "requestURL":
+			requestURL = value
+		case "redirect":
+			chain = append(chain, value)
+		}
+	}
+	return
+}
+
+//实现ReplaySource接口
+func (s *WARCSource) Lookup(method, url string, body []byte) (*httpcache.Entry, error) {
+	entry, ok := s.entries[httpcache.Key(method, url, body)]
+	if !ok {
+		return nil, httpcache.ErrNotFound
+	}
+	return entry, nil
+}
+
+//用于获取可查找的URL的数量
+func (s *WARCSource) Len() int {
+	return len(s.entries)
+}
+
+//把原始HTTP响应写入缓存目录的记录器，写入的目录可作为重放来源
+type CacheRecorder struct {
+	dir *httpcache.Dir
+}
+
+//用于创建缓存目录记录器
+func NewCacheRecorder(dir *httpcache.Dir) *CacheRecorder {
+	return &CacheRecorder{dir: dir}
+}
+
+//实现Recorder接口
+func (r *CacheRecorder) Record(resp *structure.Response, body []byte) error {
+	httpResp := resp.HTTPResp()
+	if httpResp == nil {
+		return fmt.Errorf("nil HTTP response")
+	}
+	method := http.MethodGet
+	var reqBody []byte
+	if req := resp.Request(); req != nil && req.Valid() {
+		if req.HTTPReq().Method != "" {
+			method = req.HTTPReq().Method
+		}
+		reqBody = req.Body()
+	}
+	summary := resp.Summary()
+	return r.dir.Put(&httpcache.Entry{
+		Method:        method,
+		URL:           summary.URL,
+		RequestBody:   reqBody,
+		FinalURL:      summary.FinalURL,
+		RedirectChain: summary.RedirectChain,
+		StoredAt:      time.Now(),
+		Raw:           httpcache.RawResponse(httpResp, body),
+	})
+}
@@ -0,0 +1,161 @@
+package downloader
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/httpcache"
+	"github.com/Vientiane/toolkit/warc"
+)
+
+func TestReplay(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>hello</html>")
+	}))
+	dir := t.TempDir()
+	warcRecorder, err := NewWARCRecorder(warc.Config{Path: filepath.Join(dir, "crawl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir, err := httpcache.NewDir(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	//分别用两种记录器记录同一个请求
+	for _, recorder := range []module.Recorder{warcRecorder, NewCacheRecorder(cacheDir)} {
+		d, _ := NewDownloader(module.MID("D1|127.0.0.1:8080"), &http.Client{},
+			module.CalculateScoreSimple)
+		d.SetRecorder(recorder)
+		httpReq, _ := http.NewRequest("GET", server.URL+"/old", nil)
+		if _, err := d.Download(structure.NewRequest(httpReq, 0)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	warcRecorder.Close()
+	//重放时不再访问服务器
+	server.Close()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+	warcSource, err := NewWARCSource(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]ReplaySource{"warc": warcSource, "cache": cacheDir}
+	for name, source := range sources {
+		d, err := NewReplayDownloader(module.MID("D2|127.0.0.1:8080"), source, true,
+			module.CalculateScoreSimple)
+		if err != nil {
+			t.Fatal(err)
+		}
+		httpReq, _ := http.NewRequest("GET", server.URL+"/old", nil)
+		resp, err := d.Download(structure.NewRequest(httpReq, 1))
+		if err != nil {
+			t.Fatalf("%s: %s", name, err)
+		}
+		body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+		if string(body) != "<html>hello</html>" || resp.HTTPResp().StatusCode != 200 {
+			t.Fatalf("%s: unexpected response %d %q", name, resp.HTTPResp().StatusCode, body)
+		}
+		if resp.FinalURL() != server.URL+"/new" || resp.Depth() != 1 {
+			t.Fatalf("%s: unexpected final URL %s", name, resp.FinalURL())
+		}
+		if chain := resp.RedirectChain(); len(chain) != 1 || chain[0] != server.URL+"/old" {
+			t.Fatalf("%s: unexpected redirect chain %v", name, chain)
+		}
+		if ct := resp.HTTPResp().Header.Get("Content-Type"); ct != "text/html" {
+			t.Fatalf("%s: unexpected content type %s", name, ct)
+		}
+		httpReq, _ = http.NewRequest("GET", server.URL+"/missing", nil)
+		if _, err := d.Download(structure.NewRequest(httpReq, 1)); err == nil {
+			t.Fatalf("%s: expected an error for a miss in strict mode", name)
+		}
+		extra := d.Summary().Extra.(replaySummaryExtra)
+		if extra.Hits != 1 || extra.Misses != 1 {
+			t.Fatalf("%s: unexpected summary %+v", name, extra)
+		}
+	}
+
+	d, _ := NewReplayDownloader(module.MID("D3|127.0.0.1:8080"), cacheDir, false,
+		module.CalculateScoreSimple)
+	httpReq, _ := http.NewRequest("GET", server.URL+"/missing", nil)
+	resp, err := d.Download(structure.NewRequest(httpReq, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if resp.HTTPResp().StatusCode != http.StatusNotFound {
+		t.Fatalf("expected 404 for a miss, got %d", resp.HTTPResp().StatusCode)
+	}
+}
+
+func TestReplayRequestBody(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		fmt.Fprintf(w, "result of %s", body)
+	}))
+	dir := t.TempDir()
+	warcRecorder, err := NewWARCRecorder(warc.Config{Path: filepath.Join(dir, "crawl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	cacheDir, err := httpcache.NewDir(filepath.Join(dir, "cache"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	newPost := func(body string) *structure.Request {
+		httpReq, _ := http.NewRequest("POST", server.URL+"/search", strings.NewReader(body))
+		httpReq.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		return structure.NewRequest(httpReq, 0)
+	}
+	//向同一URL发送请求体不同的两个POST请求
+	for _, recorder := range []module.Recorder{warcRecorder, NewCacheRecorder(cacheDir)} {
+		d, _ := NewDownloader(module.MID("D1|127.0.0.1:8080"), &http.Client{},
+			module.CalculateScoreSimple)
+		d.SetRecorder(recorder)
+		for _, body := range []string{"q=a", "q=b"} {
+			if _, err := d.Download(newPost(body)); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	warcRecorder.Close()
+	server.Close()
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+	warcSource, err := NewWARCSource(paths...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sources := map[string]ReplaySource{"warc": warcSource, "cache": cacheDir}
+	for name, source := range sources {
+		d, err := NewReplayDownloader(module.MID("D2|127.0.0.1:8080"), source, true,
+			module.CalculateScoreSimple)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, body := range []string{"q=a", "q=b"} {
+			resp, err := d.Download(newPost(body))
+			if err != nil {
+				t.Fatalf("%s: %s", name, err)
+			}
+			data, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+			if string(data) != "result of "+body {
+				t.Fatalf("%s: unexpected response for %s: %q", name, body, data)
+			}
+		}
+		if _, err := d.Download(newPost("q=c")); err == nil {
+			t.Fatalf("%s: expected an error for an unrecorded request body", name)
+		}
+	}
+}
@@ -0,0 +1,125 @@
+package downloader
+
+import (
+	"crypto/tls"
+	"io"
+	"net/http"
+	"net/http/httptrace"
+	"sync"
+	"time"
+
+	"github.com/Vientiane/structure"
+)
+
+//下载过程的计时记录器
+//有重定向时，同一个记录器会收到多次请求的事件
+type traceRecorder struct {
+	//开始下载的时间
+	start time.Time
+	//各阶段开始的时间
+	dnsStart     time.Time
+	connectStart time.Time
+	tlsStart     time.Time
+	//累计的计时信息
+	timing structure.Timing
+	//专用于计时信息的互斥锁
+	lock sync.Mutex
+}
+
+func newTraceRecorder() *traceRecorder {
+	return &traceRecorder{start: time.Now()}
+}
+
+//用于生成记录计时信息的httptrace钩子
+func (tr *traceRecorder) clientTrace() *httptrace.ClientTrace {
+	return &httptrace.ClientTrace{
+		DNSStart: func(httptrace.DNSStartInfo) {
+			tr.lock.Lock()
+			tr.dnsStart = time.Now()
+			tr.lock.Unlock()
+		},
+		DNSDone: func(httptrace.DNSDoneInfo) {
+			tr.lock.Lock()
+			tr.timing.DNS += time.Since(tr.dnsStart)
+			tr.lock.Unlock()
+		},
+		ConnectStart: func(string, string) {
+			tr.lock.Lock()
+			tr.connectStart = time.Now()
+			tr.lock.Unlock()
+		},
+		ConnectDone: func(string, string, error) {
+			tr.lock.Lock()
+			tr.timing.Connect += time.Since(tr.connectStart)
+			tr.lock.Unlock()
+		},
+		TLSHandshakeStart: func() {
+			tr.lock.Lock()
+			tr.tlsStart = time.Now()
+			tr.lock.Unlock()
+		},
+		TLSHandshakeDone: func(tls.ConnectionState, error) {
+			tr.lock.Lock()
+			tr.timing.TLS += time.Since(tr.tlsStart)
+			tr.lock.Unlock()
+		},
+		GotFirstResponseByte: func() {
+			tr.lock.Lock()
+			tr.timing.TTFB = time.Since(tr.start)
+			tr.lock.Unlock()
+		},
+	}
+}
+
+//用于获取当前的计时信息，总耗时为从开始下载到现在的时间
+func (tr *traceRecorder) current() structure.Timing {
+	tr.lock.Lock()
+	defer tr.lock.Unlock()
+	timing := tr.timing
+	timing.Total = time.Since(tr.start)
+	return timing
+}
+
+//用于获取重定向经过的URL，按请求的先后排列，不包含最终的URL
+func redirectChain(httpResp *http.Response) []string {
+	var chain []string
+	if httpResp == nil || httpResp.Request == nil {
+		return chain
+	}
+	for r := httpResp.Request; r.Response != nil && r.Response.Request != nil; {
+		r = r.Response.Request
+		chain = append([]string{r.URL.String()}, chain...)
+	}
+	return chain
+}
+
+//会统计已读字节数和下载总耗时的响应体
+type trackedBody struct {
+	io.ReadCloser
+	resp     *structure.Response
+	recorder *traceRecorder
+	once     sync.Once
+}
+
+func (tb *trackedBody) Read(p []byte) (n int, err error) {
+	n, err = tb.ReadCloser.Read(p)
+	if n > 0 {
+		tb.resp.AddBytesRead(uint64(n))
+	}
+	if err == io.EOF {
+		tb.finish()
+	}
+	return
+}
+
+func (tb *trackedBody) Close() error {
+	tb.finish()
+	return tb.ReadCloser.Close()
+}
+
+//用于在响应体读完或关闭时记录总耗时
+func (tb *trackedBody) finish() {
+	tb.once.Do(func() {
+		tb.resp.SetTotalTime(tb.recorder.current().Total)
+	})
+}
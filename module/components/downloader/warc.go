@@ -0,0 +1,116 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/httpcache"
+	"github.com/Vientiane/toolkit/warc"
+)
+
+//把原始HTTP交互写入WARC文件的记录器
+//每次下载会写入请求、响应和元数据三条记录
+//响应记录中的响应头会按照实际保存的响应体修正，参见httpcache.RawResponse
+type WARCRecorder struct {
+	writer *warc.Writer
+}
+
+//用于创建WARC记录器，记录器应被加入调度器的ModuleArgs.Closers
+func NewWARCRecorder(cfg warc.Config) (*WARCRecorder, error) {
+	if len(cfg.Info) == 0 {
+		cfg.Info = warc.Header{{Name: "software", Value: "Vientiane"}}
+	}
+	writer, err := warc.NewWriter(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &WARCRecorder{writer: writer}, nil
+}
+
+//实现Recorder接口
+func (r *WARCRecorder) Record(resp *structure.Response, body []byte) error {
+	httpResp := resp.HTTPResp()
+	if httpResp == nil || httpResp.Request == nil || httpResp.Request.URL == nil {
+		return fmt.Errorf("nil HTTP request")
+	}
+	httpReq := httpResp.Request
+	targetURI := httpReq.URL.String()
+	now := time.Now()
+
+	respBlock := httpcache.RawResponse(httpResp, body)
+	respRecord := warc.NewRecord(warc.TYPE_RESPONSE, now,
+		"application/http;msgtype=response", respBlock)
+	respRecord.Header.Set(warc.HEADER_TARGET_URI, targetURI)
+	respRecord.Header.Set(warc.HEADER_BLOCK_DIGEST, warc.Digest(respBlock))
+	respRecord.Header.Set(warc.HEADER_PAYLOAD_DIGEST, warc.Digest(body))
+
+	//重定向后的请求不再携带请求体
+	var reqBody []byte
+	if req := resp.Request(); req != nil && req.Valid() &&
+		req.HTTPReq().URL.String() == targetURI {
+		reqBody = req.Body()
+	}
+	reqBlock := rawRequest(httpReq, reqBody)
+	reqRecord := warc.NewRecord(warc.TYPE_REQUEST, now,
+		"application/http;msgtype=request", reqBlock)
+	reqRecord.Header.Set(warc.HEADER_TARGET_URI, targetURI)
+	reqRecord.Header.Set(warc.HEADER_CONCURRENT_TO, respRecord.ID())
+	reqRecord.Header.Set(warc.HEADER_BLOCK_DIGEST, warc.Digest(reqBlock))
+
+	summary := resp.Summary()
+	fields := warc.Header{
+		{Name: "requestURL", Value: summary.URL},
+		{Name: "depth", Value: strconv.FormatUint(uint64(summary.Depth), 10)},
+		{Name: "fetchTimeMs", Value: strconv.FormatInt(int64(summary.Timing.Total/time.Millisecond), 10)},
+	}
+	for _, url := range summary.RedirectChain {
+		fields = append(fields, warc.Field{Name: "redirect", Value: url})
+	}
+	if summary.MID != "" {
+		fields = append(fields, warc.Field{Name: "downloader", Value: summary.MID})
+	}
+	if req := resp.Request(); req != nil && req.Referer() != "" {
+		fields = append(fields, warc.Field{Name: "via", Value: req.Referer()})
+	}
+	metaBlock := warc.Fields(fields)
+	metaRecord := warc.NewRecord(warc.TYPE_METADATA, now,
+		"application/warc-fields", metaBlock)
+	metaRecord.Header.Set(warc.HEADER_TARGET_URI, targetURI)
+	metaRecord.Header.Set(warc.HEADER_REFERS_TO, respRecord.ID())
+	metaRecord.Header.Set(warc.HEADER_BLOCK_DIGEST, warc.Digest(metaBlock))
+
+	return r.writer.Write(reqRecord, respRecord, metaRecord)
+}
+
+//用于关闭记录器
+func (r *WARCRecorder) Close() error {
+	return r.writer.Close()
+}
+
+//用于生成原始的HTTP请求
+func rawRequest(httpReq *http.Request, body []byte) []byte {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "%s %s HTTP/1.1\r\n", httpReq.Method, httpReq.URL.RequestURI())
+	host := httpReq.Host
+	if host == "" {
+		host = httpReq.URL.Host
+	}
+	fmt.Fprintf(&b, "Host: %s\r\n", host)
+	header := httpReq.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Host")
+	if len(body) > 0 {
+		header.Set("Content-Length", strconv.Itoa(len(body)))
+	}
+	header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
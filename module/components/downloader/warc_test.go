@@ -0,0 +1,100 @@
+package downloader
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/warc"
+)
+
+func TestWARCRecorder(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/old" {
+			http.Redirect(w, r, "/new", http.StatusFound)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html")
+		fmt.Fprint(w, "<html>hello</html>")
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	recorder, err := NewWARCRecorder(warc.Config{Path: filepath.Join(dir, "crawl")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	mid := module.MID("D1|127.0.0.1:8080")
+	d, err := NewDownloader(mid, &http.Client{}, module.CalculateScoreSimple)
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.SetRecorder(recorder)
+	httpReq, _ := http.NewRequest("GET", server.URL+"/old", nil)
+	resp, err := d.Download(structure.NewRequest(httpReq, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+	if string(body) != "<html>hello</html>" {
+		t.Fatalf("unexpected body after recording: %q", body)
+	}
+	if err := recorder.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	paths, _ := filepath.Glob(filepath.Join(dir, "*.warc"))
+	if len(paths) != 1 {
+		t.Fatalf("expected 1 WARC file, got %d", len(paths))
+	}
+	file, _ := os.Open(paths[0])
+	defer file.Close()
+	r, err := warc.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var records []*warc.Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	if len(records) != 4 {
+		t.Fatalf("expected 4 records, got %d", len(records))
+	}
+	req, res, meta := records[1], records[2], records[3]
+	if req.Type() != warc.TYPE_REQUEST || res.Type() != warc.TYPE_RESPONSE ||
+		meta.Type() != warc.TYPE_METADATA {
+		t.Fatalf("unexpected record types: %s %s %s", req.Type(), res.Type(), meta.Type())
+	}
+	if uri := res.Header.Get(warc.HEADER_TARGET_URI); uri != server.URL+"/new" {
+		t.Fatalf("unexpected target URI %s", uri)
+	}
+	if !bytes.HasPrefix(req.Block, []byte("GET /new HTTP/1.1\r\n")) {
+		t.Fatalf("unexpected request block %q", req.Block)
+	}
+	if !bytes.HasSuffix(res.Block, []byte("\r\n\r\n<html>hello</html>")) {
+		t.Fatalf("unexpected response block %q", res.Block)
+	}
+	if res.Header.Get(warc.HEADER_PAYLOAD_DIGEST) != warc.Digest(body) ||
+		res.Header.Get(warc.HEADER_BLOCK_DIGEST) != warc.Digest(res.Block) {
+		t.Fatal("unexpected digests")
+	}
+	if !bytes.Contains(meta.Block, []byte("redirect: "+server.URL+"/old\r\n")) ||
+		meta.Header.Get(warc.HEADER_REFERS_TO) != res.ID() {
+		t.Fatalf("unexpected metadata record %q", meta.Block)
+	}
+}
@@ -0,0 +1,349 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Vientiane/structure"
+)
+
+//条目导出器
+//以条目处理函数的形式把条目写入JSON Lines或CSV文件，支持按大小或时间轮转文件以及gzip压缩
+//导出器应被加入调度器的ModuleArgs.Closers，以便在调度器停止时写出缓冲的数据并关闭文件
+
+//导出的格式
+type Format string
+
+const (
+	FORMAT_JSON_LINES Format = "jsonl"
+	FORMAT_CSV        Format = "csv"
+)
+
+//展开嵌套值时默认使用的分隔符
+const DEFAULT_SEPARATOR = "."
+
+//导出配置的类型
+type Config struct {
+	//导出的格式
+	Format Format
+	//文件路径的前缀，如"output/items"
+	//实际的文件名会带上创建时间、序号和扩展名，如"output/items-20060102T150405-0001.jsonl.gz"
+	Path string
+	//需要导出的字段，为空代表导出所有字段
+	//CSV格式未给出时，以第一个条目的字段（排序后）作为列，之后条目中的新字段会被忽略
+	Columns []string
+	//是否把嵌套的映射展开为多个字段，如{"a":{"b":1}}展开为{"a.b":1}
+	Flatten bool
+	//展开嵌套值时使用的分隔符，默认为DEFAULT_SEPARATOR
+	Separator string
+	//是否忽略以下划线开头的保留字段，如structure.ITEM_KEY_META
+	SkipReserved bool
+	//是否用gzip压缩文件
+	Gzip bool
+	//单个文件写入的最大字节数（压缩前），超出时轮转到新文件，0代表不限制
+	MaxSize int64
+	//单个文件的最长写入时间，超出时轮转到新文件，0代表不限制
+	MaxAge time.Duration
+}
+
+//条目导出器
+type Exporter struct {
+	cfg  Config
+	lock sync.Mutex
+	//当前文件
+	file *os.File
+	gz   *gzip.Writer
+	buf  *bufio.Writer
+	csv  *csv.Writer
+	//当前文件已写入的字节数（压缩前）
+	written int64
+	//当前文件的创建时间
+	openedAt time.Time
+	//文件的序号
+	seq int
+	//CSV的列
+	columns []string
+	closed  bool
+}
+
+//用于创建条目导出器，文件会在写入第一个条目时创建
+func New(cfg Config) (*Exporter, error) {
+	if cfg.Format != FORMAT_JSON_LINES && cfg.Format != FORMAT_CSV {
+		return nil, fmt.Errorf("exporter: unsupported format %q", cfg.Format)
+	}
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("exporter: empty path")
+	}
+	if cfg.MaxSize < 0 || cfg.MaxAge < 0 {
+		return nil, fmt.Errorf("exporter: negative rotation limit")
+	}
+	if cfg.Separator == "" {
+		cfg.Separator = DEFAULT_SEPARATOR
+	}
+	return &Exporter{cfg: cfg, columns: cfg.Columns}, nil
+}
+
+//实现条目处理函数，写入条目后原样返回
+//可作为module.ProcessItem使用：exporter.Process
+func (e *Exporter) Process(item structure.Item) (structure.Item, error) {
+	record, err := e.record(item)
+	if err != nil {
+		return item, err
+	}
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closed {
+		return item, fmt.Errorf("exporter: closed")
+	}
+	if err := e.rotateIfNeeded(); err != nil {
+		return item, err
+	}
+	if err := e.write(record); err != nil {
+		return item, err
+	}
+	return item, nil
+}
+
+//用于把条目转换为待写入的字段映射
+func (e *Exporter) record(item structure.Item) (map[string]interface{}, error) {
+	//借助JSON把结构体等值统一转换为映射、列表和基本类型
+	data, err := json.Marshal(item)
+	if err != nil {
+		return nil, fmt.Errorf("exporter: couldn't encode item: %s", err)
+	}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var record map[string]interface{}
+	if err := decoder.Decode(&record); err != nil {
+		return nil, fmt.Errorf("exporter: couldn't decode item: %s", err)
+	}
+	if e.cfg.SkipReserved {
+		for k := range record {
+			if strings.HasPrefix(k, "_") {
+				delete(record, k)
+			}
+		}
+	}
+	if e.cfg.Flatten {
+		flat := map[string]interface{}{}
+		flatten(flat, "", record, e.cfg.Separator)
+		record = flat
+	}
+	return record, nil
+}
+
+//用于展开嵌套的映射
+func flatten(result map[string]interface{}, prefix string,
+	value map[string]interface{}, separator string) {
+	for k, v := range value {
+		key := k
+		if prefix != "" {
+			key = prefix + separator + k
+		}
+		if nested, ok := v.(map[string]interface{}); ok && len(nested) > 0 {
+			flatten(result, key, nested, separator)
+			continue
+		}
+		result[key] = v
+	}
+}
+
+//用于在需要时创建或轮转文件，调用方需持有锁
+func (e *Exporter) rotateIfNeeded() error {
+	if e.file != nil {
+		sizeExceeded := e.cfg.MaxSize > 0 && e.written >= e.cfg.MaxSize
+		ageExceeded := e.cfg.MaxAge > 0 && time.Since(e.openedAt) >= e.cfg.MaxAge
+		if !sizeExceeded && !ageExceeded {
+			return nil
+		}
+		if err := e.closeFile(); err != nil {
+			return err
+		}
+	}
+	return e.openFile()
+}
+
+//用于创建新文件，调用方需持有锁
+func (e *Exporter) openFile() error {
+	e.seq++
+	e.openedAt = time.Now()
+	name := fmt.Sprintf("%s-%s-%04d.%s", e.cfg.Path,
+		e.openedAt.Format("20060102T150405"), e.seq, e.cfg.Format)
+	if e.cfg.Gzip {
+		name += ".gz"
+	}
+	if dir := filepath.Dir(name); dir != "" {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return fmt.Errorf("exporter: couldn't create directory: %s", err)
+		}
+	}
+	file, err := os.OpenFile(name, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("exporter: couldn't create file: %s", err)
+	}
+	e.file = file
+	var w io.Writer = file
+	if e.cfg.Gzip {
+		e.gz = gzip.NewWriter(file)
+		w = e.gz
+	}
+	e.buf = bufio.NewWriter(w)
+	e.written = 0
+	if e.cfg.Format == FORMAT_CSV {
+		e.csv = csv.NewWriter(&countingWriter{w: e.buf, n: &e.written})
+		if e.columns != nil {
+			return e.writeCSVHeader()
+		}
+	}
+	return nil
+}
+
+//用于写入一条记录，调用方需持有锁
+func (e *Exporter) write(record map[string]interface{}) error {
+	if e.cfg.Format == FORMAT_JSON_LINES {
+		if len(e.cfg.Columns) > 0 {
+			selected := make(map[string]interface{}, len(e.cfg.Columns))
+			for _, column := range e.cfg.Columns {
+				if v, ok := record[column]; ok {
+					selected[column] = v
+				}
+			}
+			record = selected
+		}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("exporter: couldn't encode item: %s", err)
+		}
+		data = append(data, '\n')
+		n, err := e.buf.Write(data)
+		e.written += int64(n)
+		if err != nil {
+			return fmt.Errorf("exporter: couldn't write item: %s", err)
+		}
+		return nil
+	}
+	if e.columns == nil {
+		for k := range record {
+			e.columns = append(e.columns, k)
+		}
+		sort.Strings(e.columns)
+		if err := e.writeCSVHeader(); err != nil {
+			return err
+		}
+	}
+	row := make([]string, len(e.columns))
+	for i, column := range e.columns {
+		row[i] = csvValue(record[column])
+	}
+	if err := e.csv.Write(row); err != nil {
+		return fmt.Errorf("exporter: couldn't write item: %s", err)
+	}
+	//csv.Writer自带缓冲，写出后才能统计到字节数
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+func (e *Exporter) writeCSVHeader() error {
+	if err := e.csv.Write(e.columns); err != nil {
+		return fmt.Errorf("exporter: couldn't write header: %s", err)
+	}
+	e.csv.Flush()
+	return e.csv.Error()
+}
+
+//用于把值转换为CSV单元格，列表和映射以JSON表示
+func csvValue(value interface{}) string {
+	switch v := value.(type) {
+	case nil:
+		return ""
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case bool:
+		if v {
+			return "true"
+		}
+		return "false"
+	default:
+		data, err := json.Marshal(v)
+		if err != nil {
+			return fmt.Sprint(v)
+		}
+		return string(data)
+	}
+}
+
+//用于把缓冲的数据写入文件
+func (e *Exporter) Flush() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.file == nil {
+		return nil
+	}
+	if err := e.buf.Flush(); err != nil {
+		return err
+	}
+	if e.gz != nil {
+		return e.gz.Flush()
+	}
+	return nil
+}
+
+//用于关闭当前文件，调用方需持有锁
+func (e *Exporter) closeFile() error {
+	if e.file == nil {
+		return nil
+	}
+	var errs []string
+	if err := e.buf.Flush(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	if e.gz != nil {
+		if err := e.gz.Close(); err != nil {
+			errs = append(errs, err.Error())
+		}
+	}
+	if err := e.file.Close(); err != nil {
+		errs = append(errs, err.Error())
+	}
+	e.file, e.gz, e.buf, e.csv = nil, nil, nil, nil
+	if len(errs) > 0 {
+		return fmt.Errorf("exporter: couldn't close file: %s", strings.Join(errs, "; "))
+	}
+	return nil
+}
+
+//用于写出缓冲的数据并关闭文件，关闭后不能再写入条目
+func (e *Exporter) Close() error {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	if e.closed {
+		return nil
+	}
+	e.closed = true
+	return e.closeFile()
+}
+
+//统计写入字节数的写入器
+type countingWriter struct {
+	w io.Writer
+	n *int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	*cw.n += int64(n)
+	return n, err
+}
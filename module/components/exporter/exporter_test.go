@@ -0,0 +1,147 @@
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+func readFiles(t *testing.T, dir string, gz bool) [][]byte {
+	paths, err := filepath.Glob(filepath.Join(dir, "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(paths)
+	var contents [][]byte
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var r io.Reader = file
+		if gz {
+			zr, err := gzip.NewReader(file)
+			if err != nil {
+				t.Fatalf("%s: %s", path, err)
+			}
+			r = zr
+		}
+		data, err := io.ReadAll(r)
+		if err != nil {
+			t.Fatalf("%s: %s", path, err)
+		}
+		file.Close()
+		contents = append(contents, data)
+	}
+	return contents
+}
+
+func TestJSONLines(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{
+		Format:       FORMAT_JSON_LINES,
+		Path:         filepath.Join(dir, "items"),
+		Gzip:         true,
+		MaxSize:      1,
+		Flatten:      true,
+		SkipReserved: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	items := []structure.Item{
+		{"name": "a", "price": map[string]interface{}{"amount": 1.5, "currency": "USD"},
+			structure.ITEM_KEY_META: map[string]interface{}{"k": "v"}},
+		{"name": "b", "tags": []string{"x", "y"}},
+	}
+	for _, item := range items {
+		if _, err := e.Process(item); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := e.Process(items[0]); err == nil {
+		t.Fatal("expected an error after close")
+	}
+	files := readFiles(t, dir, true)
+	if len(files) != 2 {
+		t.Fatalf("expected 2 files after rotation, got %d", len(files))
+	}
+	var first map[string]interface{}
+	if err := json.Unmarshal(files[0], &first); err != nil {
+		t.Fatal(err)
+	}
+	if first["price.amount"] != 1.5 || first["price.currency"] != "USD" {
+		t.Fatalf("unexpected flattened record: %v", first)
+	}
+	if _, ok := first[structure.ITEM_KEY_META]; ok {
+		t.Fatalf("reserved field should be skipped: %v", first)
+	}
+}
+
+func TestCSV(t *testing.T) {
+	dir := t.TempDir()
+	e, err := New(Config{
+		Format:  FORMAT_CSV,
+		Path:    filepath.Join(dir, "sub", "items"),
+		Columns: []string{"name", "price.amount", "tags"},
+		Flatten: true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Process(structure.Item{"name": "a, \"quoted\"",
+		"price": map[string]interface{}{"amount": 2}})
+	e.Process(structure.Item{"name": "b", "tags": []string{"x"}, "extra": true})
+	if err := e.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.Close(); err != nil {
+		t.Fatal(err)
+	}
+	files := readFiles(t, filepath.Join(dir, "sub"), false)
+	if len(files) != 1 {
+		t.Fatalf("expected 1 file, got %d", len(files))
+	}
+	records, err := csv.NewReader(bufio.NewReader(
+		bytes.NewReader(files[0]))).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := [][]string{
+		{"name", "price.amount", "tags"},
+		{"a, \"quoted\"", "2", ""},
+		{"b", "", "[\"x\"]"},
+	}
+	if len(records) != len(expected) {
+		t.Fatalf("unexpected records: %v", records)
+	}
+	for i := range expected {
+		for j := range expected[i] {
+			if records[i][j] != expected[i][j] {
+				t.Fatalf("record[%d][%d]: expected %q, got %q",
+					i, j, expected[i][j], records[i][j])
+			}
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	if _, err := New(Config{Format: "xml", Path: "x"}); err == nil {
+		t.Fatal("expected an error for unsupported format")
+	}
+	if _, err := New(Config{Format: FORMAT_CSV}); err == nil {
+		t.Fatal("expected an error for empty path")
+	}
+}
@@ -0,0 +1,299 @@
+package feed
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/charset"
+	"github.com/Vientiane/toolkit/links"
+)
+
+//RSS和Atom订阅源解析
+//支持RSS 2.0、RSS 1.0（RDF）和Atom 1.0，每个条目生成一个structure.Item
+
+//条目中的字段名称
+const (
+	ITEM_KEY_TITLE      = "title"
+	ITEM_KEY_LINK       = "link"
+	ITEM_KEY_ID         = "id"
+	ITEM_KEY_PUBLISHED  = "published"
+	ITEM_KEY_UPDATED    = "updated"
+	ITEM_KEY_AUTHOR     = "author"
+	ITEM_KEY_SUMMARY    = "summary"
+	ITEM_KEY_CONTENT    = "content"
+	ITEM_KEY_CATEGORIES = "categories"
+	ITEM_KEY_ENCLOSURES = "enclosures"
+	ITEM_KEY_FEED_TITLE = "feed_title"
+	ITEM_KEY_FEED_LINK  = "feed_link"
+)
+
+//订阅源的格式
+const (
+	FORMAT_RSS  = "rss"
+	FORMAT_ATOM = "atom"
+)
+
+//订阅源可能使用的MIME类型
+var MIMETypes = []string{
+	"application/rss+xml",
+	"application/atom+xml",
+	"application/rdf+xml",
+	"application/xml",
+	"text/xml",
+}
+
+//解析后的订阅源
+type Feed struct {
+	//格式，FORMAT_RSS或FORMAT_ATOM
+	Format  string
+	Title   string
+	Link    string
+	Entries []*Entry
+}
+
+//订阅源中的条目
+type Entry struct {
+	Title string
+	Link  string
+	ID    string
+	//发布时间，未给出或无法解析时为零值
+	Published time.Time
+	//更新时间，未给出或无法解析时为零值
+	Updated    time.Time
+	Author     string
+	Summary    string
+	Content    string
+	Categories []string
+	Enclosures []Enclosure
+}
+
+//条目的附件，如播客的音频文件
+type Enclosure struct {
+	URL    string `json:"url"`
+	Type   string `json:"type,omitempty"`
+	Length int64  `json:"length,omitempty"`
+}
+
+//用于生成条目对应的structure.Item，空字段会被省略
+//时间以RFC3339格式的字符串表示
+func (e *Entry) Item(feed *Feed) structure.Item {
+	item := structure.Item{}
+	setString := func(key string, value string) {
+		if value != "" {
+			item[key] = value
+		}
+	}
+	setTime := func(key string, value time.Time) {
+		if !value.IsZero() {
+			item[key] = value.Format(time.RFC3339)
+		}
+	}
+	setString(ITEM_KEY_TITLE, e.Title)
+	setString(ITEM_KEY_LINK, e.Link)
+	setString(ITEM_KEY_ID, e.ID)
+	setTime(ITEM_KEY_PUBLISHED, e.Published)
+	setTime(ITEM_KEY_UPDATED, e.Updated)
+	setString(ITEM_KEY_AUTHOR, e.Author)
+	setString(ITEM_KEY_SUMMARY, e.Summary)
+	setString(ITEM_KEY_CONTENT, e.Content)
+	if len(e.Categories) > 0 {
+		item[ITEM_KEY_CATEGORIES] = e.Categories
+	}
+	if len(e.Enclosures) > 0 {
+		item[ITEM_KEY_ENCLOSURES] = e.Enclosures
+	}
+	if feed != nil {
+		setString(ITEM_KEY_FEED_TITLE, feed.Title)
+		setString(ITEM_KEY_FEED_LINK, feed.Link)
+	}
+	return item
+}
+
+//代表内容不是订阅源的错误
+var ErrNotFeed = fmt.Errorf("feed: not an RSS or Atom feed")
+
+//用于解析订阅源
+//base用于把相对链接解析为绝对URL，可以为nil
+//contentType为响应头中的内容类型，其中声明的字符集优先于XML声明中的字符集
+func Parse(r io.Reader, base *url.URL, contentType string) (*Feed, error) {
+	decoder := xml.NewDecoder(r)
+	decoder.Strict = false
+	decoder.CharsetReader = charsetReader(contentType)
+	var root xmlRoot
+	if err := decoder.Decode(&root); err != nil {
+		if _, ok := err.(*xml.SyntaxError); ok && root.XMLName.Local == "" {
+			return nil, ErrNotFeed
+		}
+		return nil, fmt.Errorf("feed: invalid XML: %s", err)
+	}
+	var feed *Feed
+	switch strings.ToLower(root.XMLName.Local) {
+	case "rss":
+		feed = root.Channel.feed(root.Channel.Items)
+	case "rdf":
+		//RSS 1.0的条目与频道并列
+		feed = root.Channel.feed(root.Items)
+	case "feed":
+		feed = root.atomFeed()
+	default:
+		return nil, ErrNotFeed
+	}
+	feed.resolve(base)
+	return feed, nil
+}
+
+//用于生成XML解码器所需的字符集转换函数
+func charsetReader(contentType string) func(string, io.Reader) (io.Reader, error) {
+	var headerCharset string
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		headerCharset = params["charset"]
+	}
+	return func(label string, input io.Reader) (io.Reader, error) {
+		if headerCharset != "" {
+			label = headerCharset
+		}
+		if charset.IsUTF8(label) {
+			return input, nil
+		}
+		return charset.NewUTF8Reader(input, label)
+	}
+}
+
+//用于把条目和附件中的相对链接解析为绝对URL
+func (feed *Feed) resolve(base *url.URL) {
+	resolve := func(link string) string {
+		if absURL, ok := links.Resolve(base, link); ok {
+			return absURL
+		}
+		return strings.TrimSpace(link)
+	}
+	feed.Link = resolve(feed.Link)
+	for _, entry := range feed.Entries {
+		entry.Link = resolve(entry.Link)
+		for i := range entry.Enclosures {
+			entry.Enclosures[i].URL = resolve(entry.Enclosures[i].URL)
+		}
+	}
+}
+
+//解析选项
+type Options struct {
+	//是否为每个条目的链接生成跟进的请求
+	Follow bool
+	//附加在跟进的请求上的元数据
+	Meta map[string]interface{}
+	//跟进的请求的优先级
+	Priority int
+}
+
+//用于生成解析订阅源的响应解析函数
+//内容不是订阅源的响应会被忽略
+func NewParser(opts Options) module.ParseResponse {
+	return func(resp *structure.Response) ([]structure.Data, []error) {
+		httpResp := resp.HTTPResp()
+		if httpResp == nil {
+			return nil, []error{fmt.Errorf("nil HTTP response")}
+		}
+		if httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{fmt.Errorf("nil HTTP request")}
+		}
+		reqURL := httpResp.Request.URL
+		if httpResp.Body == nil {
+			return nil, []error{fmt.Errorf("nil HTTP response body (requestURL: %s)", reqURL)}
+		}
+		feed, err := Parse(httpResp.Body, reqURL, httpResp.Header.Get("Content-Type"))
+		if err == ErrNotFeed {
+			return nil, nil
+		}
+		if err != nil {
+			return nil, []error{fmt.Errorf("%s (requestURL: %s)", err, reqURL)}
+		}
+		var dataList []structure.Data
+		var errs []error
+		for _, entry := range feed.Entries {
+			dataList = append(dataList, entry.Item(feed))
+		}
+		if !opts.Follow {
+			return dataList, nil
+		}
+		for _, entry := range feed.Entries {
+			if entry.Link == "" {
+				continue
+			}
+			httpReq, err := http.NewRequest("GET", entry.Link, nil)
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			req := structure.NewRequest(httpReq, resp.Depth())
+			for k, v := range opts.Meta {
+				req.SetMeta(k, v)
+			}
+			req.SetPriority(opts.Priority)
+			dataList = append(dataList, req)
+		}
+		return dataList, errs
+	}
+}
+
+//用于生成解析订阅源的带匹配条件的响应解析器
+func NewRespParser(opts Options) module.RespParser {
+	return module.RespParser{
+		Name:  "feed",
+		Parse: NewParser(opts),
+		Condition: module.ParserCondition{
+			MIMETypes: MIMETypes,
+			MinStatus: 200,
+			MaxStatus: 299,
+		},
+	}
+}
+
+//用于解析订阅源中的时间，支持RFC 822、RFC 1123和RFC 3339的各种变体
+func parseTime(value string) time.Time {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return time.Time{}
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t
+		}
+	}
+	return time.Time{}
+}
+
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"Mon, 2 Jan 2006 15:04:05 MST",
+	"Mon, 2 Jan 2006 15:04 -0700",
+	"Mon, 2 Jan 2006 15:04 MST",
+	"2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 MST",
+	time.RFC822Z,
+	time.RFC822,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+//用于解析附件的长度
+func parseLength(value string) int64 {
+	length, err := strconv.ParseInt(strings.TrimSpace(value), 10, 64)
+	if err != nil || length < 0 {
+		return 0
+	}
+	return length
+}
@@ -0,0 +1,137 @@
+package feed
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+var testRSS = `<?xml version="1.0" encoding="UTF-8"?>
+<rss version="2.0" xmlns:dc="http://purl.org/dc/elements/1.1/"
+  xmlns:atom="http://www.w3.org/2005/Atom">
+<channel>
+  <title>Example News</title>
+  <atom:link href="http://example.com/feed.xml" rel="self"/>
+  <link>http://example.com/</link>
+  <item>
+    <title>First &amp; foremost</title>
+    <link>/news/1</link>
+    <description><![CDATA[<p>Summary one</p>]]></description>
+    <pubDate>Mon, 02 Jan 2006 15:04:05 -0700</pubDate>
+    <dc:creator>Alice</dc:creator>
+    <category>World</category>
+    <enclosure url="/audio/1.mp3" type="audio/mpeg" length="1234"/>
+  </item>
+  <item>
+    <title>Second</title>
+    <guid>http://example.com/news/2</guid>
+    <pubDate>Tue, 3 Jan 2006 10:00 GMT</pubDate>
+  </item>
+</channel>
+</rss>`
+
+var testAtom = `<?xml version="1.0" encoding="utf-8"?>
+<feed xmlns="http://www.w3.org/2005/Atom">
+  <title type="text">Example Blog</title>
+  <link rel="self" href="http://example.com/atom.xml"/>
+  <link href="http://example.com/blog/"/>
+  <entry>
+    <title type="html">Hello &lt;b&gt;world&lt;/b&gt;</title>
+    <link rel="alternate" href="posts/hello"/>
+    <link rel="enclosure" href="http://example.com/hello.pdf" type="application/pdf"/>
+    <id>urn:uuid:1</id>
+    <updated>2006-01-03T10:00:00Z</updated>
+    <author><name>Bob</name></author>
+    <author><name>Carol</name></author>
+    <summary>Short</summary>
+    <content type="xhtml"><div xmlns="http://www.w3.org/1999/xhtml"><p>Body</p></div></content>
+  </entry>
+</feed>`
+
+func TestParseRSS(t *testing.T) {
+	base, _ := url.Parse("http://example.com/feed.xml")
+	feed, err := Parse(strings.NewReader(testRSS), base, "application/rss+xml")
+	if err != nil {
+		t.Fatalf("An error occurs when parsing RSS: %s", err)
+	}
+	if feed.Format != FORMAT_RSS || feed.Title != "Example News" ||
+		feed.Link != "http://example.com/" || len(feed.Entries) != 2 {
+		t.Fatalf("Inconsistent feed: %+v", feed)
+	}
+	item := feed.Entries[0].Item(feed)
+	expected := structure.Item{
+		ITEM_KEY_TITLE:      "First & foremost",
+		ITEM_KEY_LINK:       "http://example.com/news/1",
+		ITEM_KEY_PUBLISHED:  "2006-01-02T15:04:05-07:00",
+		ITEM_KEY_AUTHOR:     "Alice",
+		ITEM_KEY_SUMMARY:    "<p>Summary one</p>",
+		ITEM_KEY_CATEGORIES: []string{"World"},
+		ITEM_KEY_ENCLOSURES: []Enclosure{{URL: "http://example.com/audio/1.mp3",
+			Type: "audio/mpeg", Length: 1234}},
+		ITEM_KEY_FEED_TITLE: "Example News",
+		ITEM_KEY_FEED_LINK:  "http://example.com/",
+	}
+	if !reflect.DeepEqual(item, expected) {
+		t.Fatalf("Inconsistent item:\nexpected: %#v\nactual:   %#v", expected, item)
+	}
+	second := feed.Entries[1]
+	if second.Link != "http://example.com/news/2" || second.Published.IsZero() {
+		t.Fatalf("Inconsistent entry: %+v", second)
+	}
+}
+
+func TestParseAtom(t *testing.T) {
+	base, _ := url.Parse("http://example.com/atom.xml")
+	feed, err := Parse(strings.NewReader(testAtom), base, "")
+	if err != nil {
+		t.Fatalf("An error occurs when parsing Atom: %s", err)
+	}
+	if feed.Format != FORMAT_ATOM || feed.Title != "Example Blog" ||
+		feed.Link != "http://example.com/blog/" || len(feed.Entries) != 1 {
+		t.Fatalf("Inconsistent feed: %+v", feed)
+	}
+	entry := feed.Entries[0]
+	if entry.Title != "Hello <b>world</b>" || entry.Link != "http://example.com/posts/hello" ||
+		entry.Author != "Bob, Carol" || entry.Published.IsZero() || entry.Summary != "Short" {
+		t.Fatalf("Inconsistent entry: %+v", entry)
+	}
+	if !strings.Contains(entry.Content, "<p>Body</p>") {
+		t.Fatalf("Inconsistent content: %q", entry.Content)
+	}
+	if len(entry.Enclosures) != 1 || entry.Enclosures[0].Type != "application/pdf" {
+		t.Fatalf("Inconsistent enclosures: %+v", entry.Enclosures)
+	}
+}
+
+func TestParser(t *testing.T) {
+	parse := NewParser(Options{Follow: true, Meta: map[string]interface{}{"source": "feed"}})
+	httpReq, _ := http.NewRequest("GET", "http://example.com/feed.xml", nil)
+	genResp := func(body string) *structure.Response {
+		httpResp := &http.Response{
+			StatusCode: 200,
+			Header:     http.Header{"Content-Type": []string{"text/xml; charset=utf-8"}},
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    httpReq,
+		}
+		return structure.NewResponse(httpResp, 1)
+	}
+	dataList, errs := parse(genResp(testRSS))
+	if len(errs) != 0 || len(dataList) != 4 {
+		t.Fatalf("Inconsistent parse result: %v, %v", dataList, errs)
+	}
+	req, ok := dataList[2].(*structure.Request)
+	if !ok || req.HTTPReq().URL.String() != "http://example.com/news/1" ||
+		req.Meta("source") != "feed" {
+		t.Fatalf("Inconsistent follow request: %#v", dataList[2])
+	}
+	for _, body := range []string{`<?xml version="1.0"?><config/>`, `<html><body></body></html>`} {
+		if dataList, errs := parse(genResp(body)); len(dataList) != 0 || len(errs) != 0 {
+			t.Fatalf("Non-feed content should be ignored: %v, %v", dataList, errs)
+		}
+	}
+}
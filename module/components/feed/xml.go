@@ -0,0 +1,204 @@
+package feed
+
+import (
+	"encoding/xml"
+	"strings"
+)
+
+//订阅源的XML结构，同时兼容RSS 2.0、RSS 1.0和Atom 1.0的根元素
+type xmlRoot struct {
+	XMLName xml.Name
+	//RSS的频道
+	Channel xmlChannel `xml:"channel"`
+	//RSS 1.0中与频道并列的条目
+	Items []xmlItem `xml:"item"`
+	//以下为Atom的字段
+	Title   xmlText    `xml:"title"`
+	Links   []xmlLink  `xml:"link"`
+	Entries []xmlEntry `xml:"entry"`
+}
+
+type xmlChannel struct {
+	Title string    `xml:"title"`
+	Links []xmlLink `xml:"link"`
+	Items []xmlItem `xml:"item"`
+}
+
+type xmlItem struct {
+	Title       string         `xml:"title"`
+	Links       []xmlLink      `xml:"link"`
+	Description string         `xml:"description"`
+	Content     string         `xml:"http://purl.org/rss/1.0/modules/content/ encoded"`
+	PubDate     string         `xml:"pubDate"`
+	Date        string         `xml:"http://purl.org/dc/elements/1.1/ date"`
+	Author      string         `xml:"author"`
+	Creator     string         `xml:"http://purl.org/dc/elements/1.1/ creator"`
+	GUID        string         `xml:"guid"`
+	Categories  []string       `xml:"category"`
+	Enclosures  []xmlEnclosure `xml:"enclosure"`
+}
+
+type xmlEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+}
+
+//RSS的<link>以文本给出链接，Atom的<link>以href属性给出链接
+type xmlLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr"`
+	Type   string `xml:"type,attr"`
+	Length string `xml:"length,attr"`
+	Text   string `xml:",chardata"`
+}
+
+type xmlEntry struct {
+	Title      xmlText       `xml:"title"`
+	Links      []xmlLink     `xml:"link"`
+	ID         string        `xml:"id"`
+	Published  string        `xml:"published"`
+	Updated    string        `xml:"updated"`
+	Authors    []xmlPerson   `xml:"author"`
+	Summary    xmlText       `xml:"summary"`
+	Content    xmlText       `xml:"content"`
+	Categories []xmlCategory `xml:"category"`
+}
+
+type xmlPerson struct {
+	Name  string `xml:"name"`
+	Email string `xml:"email"`
+}
+
+type xmlCategory struct {
+	Term string `xml:"term,attr"`
+}
+
+//Atom的文本结构，type为xhtml时内容是XHTML元素
+type xmlText struct {
+	Type  string `xml:"type,attr"`
+	Text  string `xml:",chardata"`
+	Inner string `xml:",innerxml"`
+}
+
+func (t xmlText) String() string {
+	if strings.ToLower(t.Type) == "xhtml" {
+		return strings.TrimSpace(t.Inner)
+	}
+	return strings.TrimSpace(t.Text)
+}
+
+//用于把RSS频道转换为订阅源
+func (ch *xmlChannel) feed(items []xmlItem) *Feed {
+	feed := &Feed{
+		Format: FORMAT_RSS,
+		Title:  strings.TrimSpace(ch.Title),
+		Link:   rssLink(ch.Links),
+	}
+	for _, xi := range items {
+		entry := &Entry{
+			Title:   strings.TrimSpace(xi.Title),
+			Link:    rssLink(xi.Links),
+			ID:      strings.TrimSpace(xi.GUID),
+			Summary: strings.TrimSpace(xi.Description),
+			Content: strings.TrimSpace(xi.Content),
+			Author:  strings.TrimSpace(xi.Creator),
+		}
+		if entry.Author == "" {
+			entry.Author = strings.TrimSpace(xi.Author)
+		}
+		entry.Published = parseTime(xi.PubDate)
+		if entry.Published.IsZero() {
+			entry.Published = parseTime(xi.Date)
+		}
+		if entry.Link == "" && strings.Contains(entry.ID, "://") {
+			//guid为永久链接时可作为条目的链接
+			entry.Link = entry.ID
+		}
+		for _, category := range xi.Categories {
+			if category = strings.TrimSpace(category); category != "" {
+				entry.Categories = append(entry.Categories, category)
+			}
+		}
+		for _, enclosure := range xi.Enclosures {
+			if strings.TrimSpace(enclosure.URL) == "" {
+				continue
+			}
+			entry.Enclosures = append(entry.Enclosures, Enclosure{
+				URL:    strings.TrimSpace(enclosure.URL),
+				Type:   enclosure.Type,
+				Length: parseLength(enclosure.Length),
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+//用于获取RSS中的链接，忽略<atom:link>等以属性给出的链接
+func rssLink(xmlLinks []xmlLink) string {
+	for _, link := range xmlLinks {
+		if text := strings.TrimSpace(link.Text); text != "" {
+			return text
+		}
+	}
+	return ""
+}
+
+//用于把Atom的根元素转换为订阅源
+func (root *xmlRoot) atomFeed() *Feed {
+	feed := &Feed{
+		Format: FORMAT_ATOM,
+		Title:  root.Title.String(),
+		Link:   atomLink(root.Links),
+	}
+	for _, xe := range root.Entries {
+		entry := &Entry{
+			Title:     xe.Title.String(),
+			Link:      atomLink(xe.Links),
+			ID:        strings.TrimSpace(xe.ID),
+			Published: parseTime(xe.Published),
+			Updated:   parseTime(xe.Updated),
+			Summary:   xe.Summary.String(),
+			Content:   xe.Content.String(),
+		}
+		if entry.Published.IsZero() {
+			entry.Published = entry.Updated
+		}
+		var authors []string
+		for _, author := range xe.Authors {
+			if name := strings.TrimSpace(author.Name); name != "" {
+				authors = append(authors, name)
+			}
+		}
+		entry.Author = strings.Join(authors, ", ")
+		for _, category := range xe.Categories {
+			if term := strings.TrimSpace(category.Term); term != "" {
+				entry.Categories = append(entry.Categories, term)
+			}
+		}
+		for _, link := range xe.Links {
+			if strings.ToLower(link.Rel) != "enclosure" || strings.TrimSpace(link.Href) == "" {
+				continue
+			}
+			entry.Enclosures = append(entry.Enclosures, Enclosure{
+				URL:    strings.TrimSpace(link.Href),
+				Type:   link.Type,
+				Length: parseLength(link.Length),
+			})
+		}
+		feed.Entries = append(feed.Entries, entry)
+	}
+	return feed
+}
+
+//用于获取Atom中rel为alternate或未指定rel的链接
+func atomLink(xmlLinks []xmlLink) string {
+	for _, link := range xmlLinks {
+		rel := strings.ToLower(strings.TrimSpace(link.Rel))
+		if (rel == "" || rel == "alternate") && strings.TrimSpace(link.Href) != "" {
+			return strings.TrimSpace(link.Href)
+		}
+	}
+	return ""
+}
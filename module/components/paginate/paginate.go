@@ -0,0 +1,306 @@
+package paginate
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/links"
+	"github.com/Vientiane/toolkit/xpath"
+	"github.com/andybalholm/cascadia"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//自动翻页
+//包装已有的响应解析函数，在其结果之外生成下一页的请求
+//下一页的请求与当前页处于同一逻辑深度，因此翻页不会消耗最大爬取深度
+
+//保存页码的请求元数据的键，第一页的请求可以不带此元数据
+const META_KEY_PAGE = "_page"
+
+//URL模板中页码的占位符
+const PAGE_PLACEHOLDER = "{page}"
+
+//翻页配置的类型
+//NextSelector、NextXPath、RelNext、URLTemplate和Param中至少应给出一个，
+//按照此顺序尝试，第一个找到下一页的方式生效
+type Config struct {
+	//下一页链接的CSS选择器，取所选元素的href属性
+	NextSelector string
+	//下一页链接的XPath表达式，选中元素时取其href属性，选中属性或文本时取其文本
+	NextXPath string
+	//是否识别<link rel="next">和<a rel="next">
+	RelNext bool
+	//带有PAGE_PLACEHOLDER占位符的URL模板，如"/list?page={page}"，相对URL基于当前页解析
+	URLTemplate string
+	//页码所在的查询参数的名称，下一页的URL由当前页的URL替换此参数得到
+	Param string
+	//第一页的页码，默认为1
+	//第一页的页码为0时（如以偏移量翻页），可在第一页的请求上把META_KEY_PAGE元数据设为0
+	Start int
+	//页码的步长，默认为1
+	Step int
+	//最多翻到第几页（从1开始计数），0代表不限制
+	MaxPages int
+	//当前页没有条目时是否停止翻页
+	StopWhenEmpty bool
+	//当前页没有新条目时是否停止翻页，已见过的条目由KeyField或条目的内容判断
+	StopWhenNoNewItems bool
+	//用于判断条目是否重复的字段名称，为空时使用整个条目的内容
+	KeyField string
+}
+
+//翻页器
+type paginator struct {
+	cfg         Config
+	parse       module.ParseResponse
+	nextLocator cascadia.Selector
+	//已见过的条目的键
+	seen     map[string]bool
+	seenLock sync.Mutex
+}
+
+//用于包装响应解析函数，使其自动生成下一页的请求
+//以链接方式翻页时需要解析HTML，文档树与被包装的解析函数共享
+func Wrap(parse module.ParseResponse, cfg Config) (module.ParseResponse, error) {
+	if parse == nil {
+		return nil, fmt.Errorf("paginate: nil response parser")
+	}
+	if cfg.NextSelector == "" && cfg.NextXPath == "" && !cfg.RelNext &&
+		cfg.URLTemplate == "" && cfg.Param == "" {
+		return nil, fmt.Errorf("paginate: no way to find the next page")
+	}
+	if cfg.URLTemplate != "" && !strings.Contains(cfg.URLTemplate, PAGE_PLACEHOLDER) {
+		return nil, fmt.Errorf("paginate: URL template %q has no %s placeholder",
+			cfg.URLTemplate, PAGE_PLACEHOLDER)
+	}
+	if cfg.MaxPages < 0 {
+		return nil, fmt.Errorf("paginate: negative max pages: %d", cfg.MaxPages)
+	}
+	if cfg.Start == 0 {
+		cfg.Start = 1
+	}
+	if cfg.Step == 0 {
+		cfg.Step = 1
+	}
+	p := &paginator{cfg: cfg, parse: parse, seen: map[string]bool{}}
+	if cfg.NextSelector != "" {
+		sel, err := cascadia.Compile(cfg.NextSelector)
+		if err != nil {
+			return nil, fmt.Errorf("paginate: invalid selector %q: %s", cfg.NextSelector, err)
+		}
+		p.nextLocator = sel
+	}
+	if cfg.NextXPath != "" {
+		if _, err := xpath.Compile(cfg.NextXPath); err != nil {
+			return nil, fmt.Errorf("paginate: %s", err)
+		}
+	}
+	return p.Parse, nil
+}
+
+//用于判断是否需要解析HTML以查找下一页的链接
+func (p *paginator) needHTML() bool {
+	return p.cfg.NextSelector != "" || p.cfg.NextXPath != "" || p.cfg.RelNext
+}
+
+func (p *paginator) Parse(resp *structure.Response) ([]structure.Data, []error) {
+	httpResp := resp.HTTPResp()
+	if httpResp == nil || httpResp.Request == nil || httpResp.Request.URL == nil {
+		return p.parse(resp)
+	}
+	var root *html.Node
+	if p.needHTML() && httpResp.Body != nil {
+		//先缓存响应体并解析文档树，再把响应体交给被包装的解析函数
+		body, err := ioutil.ReadAll(httpResp.Body)
+		httpResp.Body.Close()
+		if err != nil {
+			return nil, []error{fmt.Errorf("paginate: %s", err)}
+		}
+		httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		root, _ = resp.HTMLNode()
+		httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	dataList, errs := p.parse(resp)
+	page := p.currentPage(resp)
+	if p.stop(page, dataList) {
+		return dataList, errs
+	}
+	nextURL := p.nextURL(resp, root, page)
+	if nextURL == "" {
+		return dataList, errs
+	}
+	httpReq, err := http.NewRequest("GET", nextURL, nil)
+	if err != nil {
+		return dataList, append(errs, err)
+	}
+	for k, values := range httpResp.Request.Header {
+		if k != "Referer" {
+			httpReq.Header[k] = append([]string(nil), values...)
+		}
+	}
+	req := structure.NewRequest(httpReq, resp.Depth())
+	if current := resp.Request(); current != nil {
+		for k, v := range current.MetaMap() {
+			req.SetMeta(k, v)
+		}
+		req.SetPriority(current.Priority())
+	}
+	req.SetMeta(META_KEY_PAGE, page+p.cfg.Step)
+	req.SetSameDepth(true)
+	return append(dataList, req), errs
+}
+
+//用于获取当前页的页码
+//优先使用请求的元数据，其次使用页码所在的查询参数
+func (p *paginator) currentPage(resp *structure.Response) int {
+	if req := resp.Request(); req != nil {
+		if page, ok := req.Meta(META_KEY_PAGE).(int); ok {
+			return page
+		}
+	}
+	if p.cfg.Param != "" {
+		value := resp.HTTPResp().Request.URL.Query().Get(p.cfg.Param)
+		if page, err := strconv.Atoi(value); err == nil {
+			return page
+		}
+	}
+	return p.cfg.Start
+}
+
+//用于判断是否满足停止翻页的条件
+func (p *paginator) stop(page int, dataList []structure.Data) bool {
+	cfg := p.cfg
+	if cfg.MaxPages > 0 && (page-cfg.Start)/cfg.Step+1 >= cfg.MaxPages {
+		return true
+	}
+	if !cfg.StopWhenEmpty && !cfg.StopWhenNoNewItems {
+		return false
+	}
+	var items []structure.Item
+	for _, data := range dataList {
+		if item, ok := data.(structure.Item); ok {
+			items = append(items, item)
+		}
+	}
+	if len(items) == 0 {
+		return true
+	}
+	if !cfg.StopWhenNoNewItems {
+		return false
+	}
+	p.seenLock.Lock()
+	defer p.seenLock.Unlock()
+	var hasNew bool
+	for _, item := range items {
+		key := p.itemKey(item)
+		if !p.seen[key] {
+			p.seen[key] = true
+			hasNew = true
+		}
+	}
+	return !hasNew
+}
+
+//用于生成判断条目是否重复的键
+func (p *paginator) itemKey(item structure.Item) string {
+	if p.cfg.KeyField != "" {
+		return fmt.Sprint(item[p.cfg.KeyField])
+	}
+	//json.Marshal会对映射的键排序，因此相同内容的条目得到相同的键
+	data, err := json.Marshal(item)
+	if err != nil {
+		return fmt.Sprintf("%v", item)
+	}
+	return fmt.Sprintf("%x", sha1.Sum(data))
+}
+
+//用于获取下一页的URL，找不到时返回空字符串
+func (p *paginator) nextURL(resp *structure.Response, root *html.Node, page int) string {
+	reqURL := resp.HTTPResp().Request.URL
+	if root != nil {
+		base := links.BaseURL(root, reqURL)
+		if p.nextLocator != nil {
+			if n := cascadia.Query(root, p.nextLocator); n != nil {
+				if href, ok := links.Attr(n, "href"); ok {
+					if absURL, ok := links.Resolve(base, href); ok {
+						return absURL
+					}
+				}
+			}
+		}
+		if p.cfg.NextXPath != "" {
+			if n, err := xpath.FindOne(root, p.cfg.NextXPath); err == nil && n != nil {
+				var link string
+				if n.Type == html.ElementNode && !xpath.IsAttribute(n) {
+					link, _ = links.Attr(n, "href")
+				} else {
+					link = xpath.Text(n)
+				}
+				if absURL, ok := links.Resolve(base, link); ok {
+					return absURL
+				}
+			}
+		}
+		if p.cfg.RelNext {
+			if absURL := relNext(root, base); absURL != "" {
+				return absURL
+			}
+		}
+	}
+	nextPage := strconv.Itoa(page + p.cfg.Step)
+	if p.cfg.URLTemplate != "" {
+		link := strings.Replace(p.cfg.URLTemplate, PAGE_PLACEHOLDER, nextPage, -1)
+		if absURL, ok := links.Resolve(reqURL, link); ok {
+			return absURL
+		}
+	}
+	if p.cfg.Param != "" {
+		nextURL := *reqURL
+		query := nextURL.Query()
+		query.Set(p.cfg.Param, nextPage)
+		nextURL.RawQuery = query.Encode()
+		return nextURL.String()
+	}
+	return ""
+}
+
+//用于查找<link rel="next">或<a rel="next">指向的URL
+func relNext(root *html.Node, base *url.URL) string {
+	var result string
+	var walk func(n *html.Node) bool
+	walk = func(n *html.Node) bool {
+		if n.Type == html.ElementNode &&
+			(n.DataAtom == atom.Link || n.DataAtom == atom.A || n.DataAtom == atom.Area) {
+			rel, _ := links.Attr(n, "rel")
+			for _, r := range strings.Fields(strings.ToLower(rel)) {
+				if r != "next" {
+					continue
+				}
+				href, _ := links.Attr(n, "href")
+				if absURL, ok := links.Resolve(base, href); ok {
+					result = absURL
+					return true
+				}
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			if walk(c) {
+				return true
+			}
+		}
+		return false
+	}
+	walk(root)
+	return result
+}
@@ -0,0 +1,128 @@
+package paginate
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+func genTestResponse(req *structure.Request, body string) *structure.Response {
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader(body)),
+		Request:    req.HTTPReq(),
+	}
+	return structure.NewResponseBy(httpResp, req)
+}
+
+func genTestRequest(t *testing.T, rawURL string, depth uint32) *structure.Request {
+	httpReq, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a request: %s", err)
+	}
+	return structure.NewRequest(httpReq, depth)
+}
+
+//返回正文中每个<li>的文本作为条目
+func parseItems(resp *structure.Response) ([]structure.Data, []error) {
+	body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+	var dataList []structure.Data
+	for _, part := range strings.Split(string(body), "<li>")[1:] {
+		text := strings.Split(part, "</li>")[0]
+		dataList = append(dataList, structure.Item{"text": text})
+	}
+	return dataList, nil
+}
+
+func nextRequest(t *testing.T, dataList []structure.Data) *structure.Request {
+	for _, data := range dataList {
+		if req, ok := data.(*structure.Request); ok {
+			return req
+		}
+	}
+	return nil
+}
+
+func TestNextLink(t *testing.T) {
+	for _, cfg := range []Config{
+		{NextSelector: "a.next"},
+		{NextXPath: "//a[@class='next']/@href"},
+		{RelNext: true},
+	} {
+		parse, err := Wrap(parseItems, cfg)
+		if err != nil {
+			t.Fatalf("An error occurs when wrapping parser: %s", err)
+		}
+		req := genTestRequest(t, "http://example.com/list/", 2).SetMeta("tag", "x")
+		body := `<ul><li>a</li><li>b</li></ul><a class="next" rel="next" href="p2.html">Next</a>`
+		dataList, errs := parse(genTestResponse(req, body))
+		if len(errs) != 0 || len(dataList) != 3 {
+			t.Fatalf("Inconsistent parse result: %v, %v", dataList, errs)
+		}
+		next := nextRequest(t, dataList)
+		if next == nil || next.HTTPReq().URL.String() != "http://example.com/list/p2.html" {
+			t.Fatalf("Inconsistent next page request: %v", next)
+		}
+		if !next.SameDepth() || next.Depth() != 2 || next.Meta(META_KEY_PAGE) != 2 ||
+			next.Meta("tag") != "x" {
+			t.Fatalf("Inconsistent next page request: depth %d, meta %v",
+				next.Depth(), next.MetaMap())
+		}
+	}
+}
+
+func TestStopConditions(t *testing.T) {
+	parse, err := Wrap(parseItems, Config{Param: "page", MaxPages: 3, StopWhenNoNewItems: true})
+	if err != nil {
+		t.Fatalf("An error occurs when wrapping parser: %s", err)
+	}
+	req := genTestRequest(t, "http://example.com/list?sort=new", 0)
+	dataList, _ := parse(genTestResponse(req, "<li>a</li>"))
+	next := nextRequest(t, dataList)
+	if next == nil || next.HTTPReq().URL.String() != "http://example.com/list?page=2&sort=new" {
+		t.Fatalf("Inconsistent next page request: %v", next)
+	}
+	//第2页没有新条目
+	dataList, _ = parse(genTestResponse(next, "<li>a</li>"))
+	if nextRequest(t, dataList) != nil {
+		t.Fatalf("Pagination should stop when there are no new items")
+	}
+	dataList, _ = parse(genTestResponse(next, "<li>b</li>"))
+	next = nextRequest(t, dataList)
+	if next == nil || next.Meta(META_KEY_PAGE) != 3 {
+		t.Fatalf("Inconsistent next page request: %v", next)
+	}
+	//第3页达到最大页数
+	dataList, _ = parse(genTestResponse(next, "<li>c</li>"))
+	if nextRequest(t, dataList) != nil {
+		t.Fatalf("Pagination should stop at max pages")
+	}
+	parse, _ = Wrap(parseItems, Config{URLTemplate: "/list/{page}", Step: 10, StopWhenEmpty: true})
+	first := genTestRequest(t, "http://example.com/list/0", 0).SetMeta(META_KEY_PAGE, 0)
+	dataList, _ = parse(genTestResponse(first, "<li>a</li>"))
+	if next = nextRequest(t, dataList); next == nil ||
+		next.HTTPReq().URL.String() != "http://example.com/list/10" {
+		t.Fatalf("Inconsistent next page request: %v", next)
+	}
+	dataList, _ = parse(genTestResponse(next, "<p>empty</p>"))
+	if nextRequest(t, dataList) != nil {
+		t.Fatalf("Pagination should stop when the page is empty")
+	}
+	//页码也可以从查询参数中获得
+	parse, _ = Wrap(parseItems, Config{Param: "page"})
+	dataList, _ = parse(genTestResponse(genTestRequest(t, "http://example.com/list?page=5", 0),
+		"<li>a</li>"))
+	if next = nextRequest(t, dataList); next == nil || next.Meta(META_KEY_PAGE) != 6 ||
+		next.HTTPReq().URL.String() != "http://example.com/list?page=6" {
+		t.Fatalf("Inconsistent next page request: %v", next)
+	}
+	for _, cfg := range []Config{{}, {URLTemplate: "/list"}, {NextSelector: "a["}} {
+		if _, err := Wrap(parseItems, cfg); err == nil {
+			t.Fatalf("No error when wrapping parser with invalid config: %+v", cfg)
+		}
+	}
+}
@@ -6,6 +6,8 @@ import (
 	"fmt"
 	"github.com/Vientiane/module/stub"
 	"github.com/Vientiane/module"
+	"sync/atomic"
+	"strings"
 )
 
 //pipeline接口的实现类型
@@ -15,6 +17,40 @@ type vientianePipeline struct{
 	itemProcessors []module.ProcessItem
 	//处理是否需要快速失败
 	failFast bool
+	//条目处理函数发生panic的次数
+	panicCount uint64
+	//被条目处理函数丢弃的条目数
+	droppedCount uint64
+	//未通过校验的条目数
+	rejectedCount uint64
+	//条目校验器
+	validator module.ItemValidator
+	//未通过校验的条目的接收函数
+	rejectSink module.RejectItem
+	//可同时处理的条目的最大数量，0代表条目处理管道自身不限制
+	concurrency uint32
+	//用于限制同时处理的条目数量的信号量
+	sem chan struct{}
+}
+
+//条目处理管道摘要中的额外信息的类型
+type summaryExtra struct {
+	//条目处理函数发生panic的次数
+	Panics uint64 `json:"panics"`
+	//被条目处理函数丢弃的条目数
+	Dropped uint64 `json:"dropped"`
+	//未通过校验的条目数
+	Rejected uint64 `json:"rejected"`
+}
+
+func(p *vientianePipeline)Summary() module.SummaryStruct {
+	summary := p.ModuleInternal.Summary()
+	summary.Extra = summaryExtra{
+		Panics:  atomic.LoadUint64(&p.panicCount),
+		Dropped: atomic.LoadUint64(&p.droppedCount),
+		Rejected: atomic.LoadUint64(&p.rejectedCount),
+	}
+	return summary
 }
 
 func(p *vientianePipeline)ItemProcessors()[]module.ProcessItem{
@@ -31,7 +67,41 @@ func(p *vientianePipeline)SetFailFast(failFast bool) {
 	p.failFast = failFast
 }
 
+func(p *vientianePipeline)Concurrency() uint32 {
+	return p.concurrency
+}
+
+func(p *vientianePipeline)SetConcurrency(concurrency uint32) {
+	p.concurrency = concurrency
+	if concurrency == 0 {
+		p.sem = nil
+		return
+	}
+	p.sem = make(chan struct{}, concurrency)
+}
+
+func(p *vientianePipeline)Validator() module.ItemValidator {
+	return p.validator
+}
+
+func(p *vientianePipeline)SetValidator(validator module.ItemValidator) {
+	p.validator = validator
+}
+
+func(p *vientianePipeline)RejectSink() module.RejectItem {
+	return p.rejectSink
+}
+
+func(p *vientianePipeline)SetRejectSink(sink module.RejectItem) {
+	p.rejectSink = sink
+}
+
 func(p *vientianePipeline)Send(item structure.Item)[]error{
+	//同时处理的条目达到上限时等待
+	if sem := p.sem; sem != nil {
+		sem <- struct{}{}
+		defer func() { <-sem }()
+	}
 	p.ModuleInternal.IncrHandlingNumber()
 	defer p.ModuleInternal.DecrHandlingNumber()
 	p.ModuleInternal.CalledCount()
@@ -41,11 +111,38 @@ func(p *vientianePipeline)Send(item structure.Item)[]error{
 		return errs
 	}
 	p.ModuleInternal.IncrAcceptedCount()
+	if p.validator != nil {
+		if reasons := p.validator.Validate(item); len(reasons) > 0 {
+			atomic.AddUint64(&p.rejectedCount, 1)
+			if p.rejectSink == nil {
+				errMsg := fmt.Sprintf("invalid item (requestURL: %s, MID: %s): %s",
+					itemURL(item), p.ID(), strings.Join(reasons, "; "))
+				errs = append(errs, errors.NewCrawlerError(errors.ERROR_TYPE_PIPELINE, errMsg).
+					WithCode(errors.ERROR_CODE_INVALID_ITEM).
+					WithContext(p.errorContext(item, errors.STAGE_VALIDATE)))
+				return errs
+			}
+			if err := p.reject(item, reasons); err != nil {
+				errs = append(errs, err)
+				return errs
+			}
+			//交给接收函数的条目视为已处理完成
+			p.ModuleInternal.IncrCompletedCount()
+			return nil
+		}
+	}
 	var currentItem = item
-	for _,processor:=range p.itemProcessors {
-		processedItem, err := processor(currentItem)
+	for i,processor:=range p.itemProcessors {
+		processedItem, err := p.process(i, processor, currentItem)
+		var dropErr *errors.DropItemError
+		if errors.As(err, &dropErr) {
+			//被丢弃的条目不再交给之后的条目处理函数，条目处理函数可以包装该错误
+			atomic.AddUint64(&p.droppedCount, 1)
+			break
+		}
 		if err!=nil{
-			errs=append(errs,err)
+			errs=append(errs,errors.Wrap(errors.ERROR_TYPE_PIPELINE, err,
+				p.errorContext(currentItem, errors.STAGE_PROCESS)))
 			if p.failFast{
 				break
 			}
@@ -60,6 +157,58 @@ func(p *vientianePipeline)Send(item structure.Item)[]error{
 	return errs
 }
 
+//用于调用条目处理函数
+//条目处理函数中发生的panic会被转换为带有调用栈的爬虫错误
+func(p *vientianePipeline)process(index int, processor module.ProcessItem,
+	item structure.Item)(result structure.Item, err error){
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&p.panicCount, 1)
+			pe := errors.NewPanicError(r)
+			errMsg := fmt.Sprintf("%s (processor: %d, requestURL: %s, MID: %s)\n%s",
+				pe, index, itemURL(item), p.ID(), pe.Stack)
+			result = nil
+			err = errors.NewCrawlerErrorWith(errors.ERROR_TYPE_PIPELINE, errMsg, pe)
+		}
+	}()
+	return processor(item)
+}
+
+//用于把未通过校验的条目交给接收函数
+//接收函数中发生的panic会被转换为带有调用栈的爬虫错误
+func(p *vientianePipeline)reject(item structure.Item, reasons []string)(err error){
+	defer func() {
+		if r := recover(); r != nil {
+			atomic.AddUint64(&p.panicCount, 1)
+			pe := errors.NewPanicError(r)
+			errMsg := fmt.Sprintf("%s (reject sink, requestURL: %s, MID: %s)\n%s",
+				pe, itemURL(item), p.ID(), pe.Stack)
+			err = errors.NewCrawlerErrorWith(errors.ERROR_TYPE_PIPELINE, errMsg, pe).
+				WithContext(p.errorContext(item, errors.STAGE_VALIDATE))
+		}
+	}()
+	p.rejectSink(item, reasons)
+	return nil
+}
+
+//用于生成处理条目时发生的错误的上下文
+func(p *vientianePipeline)errorContext(item structure.Item, stage errors.Stage) errors.ErrorContext {
+	ctx := errors.ErrorContext{MID: string(p.ID()), Stage: stage}
+	if summary, ok := item.Response(); ok {
+		ctx.URL = summary.URL
+		ctx.Depth = summary.Depth
+	}
+	return ctx
+}
+
+//用于获取产生条目的请求的URL，没有时返回空字符串
+func itemURL(item structure.Item) string {
+	if summary, ok := item.Response(); ok {
+		return summary.URL
+	}
+	return ""
+}
+
 func NewPipeLine(mid module.MID,scoreCalculator module.CalculateScore,itemProcessors []module.ProcessItem)(module.Pipeline,error) {
 	moduleBase, err := stub.NewModuleInternal(mid, scoreCalculator)
 	if err != nil {
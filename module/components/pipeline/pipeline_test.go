@@ -0,0 +1,180 @@
+package pipeline
+
+import (
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+)
+
+func TestProcessorPanic(t *testing.T) {
+	mid := module.MID("P1|127.0.0.1:8080")
+	var received structure.Item
+	p, err := NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+		func(item structure.Item) (structure.Item, error) {
+			panic("broken processor")
+		},
+		func(item structure.Item) (structure.Item, error) {
+			received = item
+			return item, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s", err)
+	}
+	item := structure.Item{"name": "x", structure.ITEM_KEY_RESPONSE: structure.ResponseSummary{
+		URL: "http://example.com/p"}}
+	errs := p.Send(item)
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	for _, part := range []string{"panic: broken processor", "processor: 0",
+		"requestURL: http://example.com/p", "MID: P1|127.0.0.1:8080"} {
+		if !strings.Contains(errs[0].Error(), part) {
+			t.Fatalf("The error message %q should contain %q", errs[0].Error(), part)
+		}
+	}
+	var pe *errors.PanicError
+	if !errors.As(errs[0], &pe) || pe.Value != "broken processor" {
+		t.Fatalf("The panic error should be the cause: %#v", errs[0])
+	}
+	if received["name"] != "x" {
+		t.Fatalf("The following processors should still receive the item")
+	}
+	if extra, ok := p.Summary().Extra.(summaryExtra); !ok || extra.Panics != 1 {
+		t.Fatalf("Inconsistent summary extra: %#v", p.Summary().Extra)
+	}
+	p.SetFailFast(true)
+	received = nil
+	p.Send(structure.Item{"name": "y"})
+	if received != nil {
+		t.Fatalf("The following processors should be skipped when failing fast")
+	}
+}
+
+func TestConcurrency(t *testing.T) {
+	mid := module.MID("P2|127.0.0.1:8080")
+	var running, maxRunning int32
+	release := make(chan struct{})
+	p, _ := NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+		func(item structure.Item) (structure.Item, error) {
+			n := atomic.AddInt32(&running, 1)
+			for {
+				m := atomic.LoadInt32(&maxRunning)
+				if n <= m || atomic.CompareAndSwapInt32(&maxRunning, m, n) {
+					break
+				}
+			}
+			<-release
+			atomic.AddInt32(&running, -1)
+			return item, nil
+		},
+	})
+	p.SetConcurrency(2)
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			p.Send(structure.Item{"n": 1})
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	if maxRunning != 2 {
+		t.Fatalf("Inconsistent max concurrency: expected: %d, actual: %d", 2, maxRunning)
+	}
+}
+
+func TestDropItem(t *testing.T) {
+	mid := module.MID("P3|127.0.0.1:8080")
+	var reached int
+	p, err := NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+		func(item structure.Item) (structure.Item, error) {
+			if item["drop"] == true {
+				return item, errors.NewDropItemError("unwanted")
+			}
+			if item["drop"] == "wrapped" {
+				return item, errors.Wrap(errors.ERROR_TYPE_PIPELINE,
+					errors.NewDropItemError("unwanted"), errors.ErrorContext{Stage: errors.STAGE_PROCESS})
+			}
+			return item, nil
+		},
+		func(item structure.Item) (structure.Item, error) {
+			reached++
+			return item, nil
+		},
+	})
+	if err != nil {
+		t.Fatalf("An error occurs when creating a pipeline: %s", err)
+	}
+	if errs := p.Send(structure.Item{"drop": true}); len(errs) > 0 {
+		t.Fatalf("Dropping an item should not be an error: %v", errs)
+	}
+	if errs := p.Send(structure.Item{"drop": "wrapped"}); len(errs) > 0 {
+		t.Fatalf("Dropping an item with a wrapped error should not be an error: %v", errs)
+	}
+	p.Send(structure.Item{"drop": false})
+	if reached != 1 {
+		t.Fatalf("Expected 1 item to reach the last processor, got %d", reached)
+	}
+	extra := p.Summary().Extra.(summaryExtra)
+	if extra.Dropped != 2 {
+		t.Fatalf("Expected 2 dropped items, got %d", extra.Dropped)
+	}
+}
+
+type testValidator struct{}
+
+func (testValidator) Validate(item structure.Item) []string {
+	if _, ok := item["name"].(string); !ok {
+		return []string{"name: expected string"}
+	}
+	return nil
+}
+
+func TestValidator(t *testing.T) {
+	mid := module.MID("P4|127.0.0.1:8080")
+	var processed int
+	p, _ := NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+		func(item structure.Item) (structure.Item, error) {
+			processed++
+			return item, nil
+		},
+	})
+	p.SetValidator(testValidator{})
+	errs := p.Send(structure.Item{"name": 1})
+	if len(errs) != 1 || !strings.Contains(errs[0].Error(), "name: expected string") ||
+		!errors.Is(errs[0], errors.ERROR_CODE_INVALID_ITEM) {
+		t.Fatalf("Inconsistent errors of an invalid item: %v", errs)
+	}
+	var rejected []string
+	p.SetRejectSink(func(item structure.Item, reasons []string) {
+		rejected = reasons
+	})
+	if errs := p.Send(structure.Item{}); len(errs) != 0 {
+		t.Fatalf("Errors occur when rejecting an item: %v", errs)
+	}
+	if len(rejected) != 1 {
+		t.Fatalf("The reject sink should receive the reasons: %v", rejected)
+	}
+	if errs := p.Send(structure.Item{"name": "x"}); len(errs) != 0 || processed != 1 {
+		t.Fatalf("A valid item should be processed: %v %d", errs, processed)
+	}
+	if extra := p.Summary().Extra.(summaryExtra); extra.Rejected != 2 {
+		t.Fatalf("Inconsistent rejected count: expected: %d, actual: %d", 2, extra.Rejected)
+	}
+	p.SetRejectSink(func(item structure.Item, reasons []string) {
+		panic("broken sink")
+	})
+	if errs := p.Send(structure.Item{}); len(errs) != 1 ||
+		!strings.Contains(errs[0].Error(), "reject sink") {
+		t.Fatalf("A panic in the reject sink should become an error: %v", errs)
+	}
+}
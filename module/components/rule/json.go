@@ -0,0 +1,402 @@
+package rule
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/jsonpath"
+	"github.com/Vientiane/toolkit/links"
+)
+
+//用于检查json类型的规则并编译其中的JSONPath表达式
+func (rule *Rule) checkJSON() error {
+	if item := rule.Item; item != nil {
+		if item.Scope != "" || item.ScopeXPath != "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("HTML scope in json rule %q", rule.Name))
+		}
+		scope := item.ScopeJSONPath
+		if scope == "" {
+			scope = "$"
+		}
+		path, err := jsonpath.Compile(scope)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal item scope in rule %q: %s", rule.Name, err))
+		}
+		item.scopePath = path
+		if err := checkJSONFields(rule.Name, item.Fields); err != nil {
+			return err
+		}
+	}
+	for i, follow := range rule.Follow {
+		if follow.Selector != "" || follow.XPath != "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("HTML follow selector[%d] in json rule %q", i, rule.Name))
+		}
+		if follow.JSONPath == "" && follow.Cursor == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("neither jsonpath nor cursor in follow[%d] of rule %q", i, rule.Name))
+		}
+		if follow.JSONPath != "" {
+			path, err := jsonpath.Compile(follow.JSONPath)
+			if err != nil {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("illegal follow JSONPath[%d] in rule %q: %s", i, rule.Name, err))
+			}
+			follow.path = path
+		}
+		if cursor := follow.Cursor; cursor != nil {
+			if err := cursor.check(); err != nil {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("illegal cursor in follow[%d] of rule %q: %s", i, rule.Name, err))
+			}
+		}
+	}
+	return nil
+}
+
+//用于检查json类型规则中的字段抽取规则
+func checkJSONFields(ruleName string, fields map[string]*Field) error {
+	for name, field := range fields {
+		if field == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("nil field %q in rule %q", name, ruleName))
+		}
+		if field.Selector != "" || field.XPath != "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("HTML selector of field %q in json rule %q", name, ruleName))
+		}
+		if field.JSONPath == "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("empty JSONPath of field %q in rule %q", name, ruleName))
+		}
+		path, err := jsonpath.Compile(field.JSONPath)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal JSONPath of field %q in rule %q: %s", name, ruleName, err))
+		}
+		field.path = path
+		switch field.Type {
+		case "":
+			field.Type = FIELD_TYPE_TEXT
+		case FIELD_TYPE_TEXT:
+		case FIELD_TYPE_OBJECT:
+			if len(field.Fields) == 0 {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("empty sub fields of field %q in rule %q", name, ruleName))
+			}
+			if err := checkJSONFields(ruleName, field.Fields); err != nil {
+				return err
+			}
+		default:
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("unsupported type %q of field %q in json rule %q", field.Type, name, ruleName))
+		}
+	}
+	return nil
+}
+
+//用于检查游标抽取规则并编译其中的JSONPath表达式
+func (cr *CursorRule) check() error {
+	if (cr.Param == "") == (cr.BodyField == "") {
+		return fmt.Errorf("exactly one of param and body_field should be given")
+	}
+	path, err := jsonpath.Compile(cr.JSONPath)
+	if err != nil {
+		return err
+	}
+	cr.path = path
+	if cr.While != "" {
+		if cr.whilePath, err = jsonpath.Compile(cr.While); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//用于生成json类型规则的响应解析函数
+func (rule *Rule) jsonParser(resp *structure.Response) ([]structure.Data, []error) {
+	httpResp := resp.HTTPResp()
+	reqURL := httpResp.Request.URL
+	if httpResp.Body == nil {
+		return nil, []error{fmt.Errorf("nil HTTP response body (requestURL: %s)", reqURL)}
+	}
+	var data interface{}
+	decoder := json.NewDecoder(httpResp.Body)
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		return nil, []error{fmt.Errorf("couldn't decode JSON: %s (requestURL: %s)", err, reqURL)}
+	}
+	return rule.ApplyJSON(data, resp)
+}
+
+//用于对已解码的JSON数据应用规则
+//游标翻页的请求以产生响应的请求为模板生成
+func (rule *Rule) ApplyJSON(data interface{},
+	resp *structure.Response) ([]structure.Data, []error) {
+	dataList := make([]structure.Data, 0)
+	errs := make([]error, 0)
+	base := resp.HTTPResp().Request.URL
+	if rule.Item != nil {
+		for _, scope := range rule.Item.scopePath.Find(data) {
+			var item map[string]interface{}
+			if len(rule.Item.Fields) == 0 {
+				item, _ = scope.(map[string]interface{})
+			} else {
+				item, _ = extractJSONFields(scope, rule.Item.Fields, base)
+			}
+			if len(item) > 0 {
+				dataList = append(dataList, structure.Item(item))
+			}
+		}
+	}
+	for _, follow := range rule.Follow {
+		if follow.path != nil {
+			reqs, fErrs := follow.extractJSON(data, base, resp.Depth())
+			dataList = append(dataList, reqs...)
+			errs = append(errs, fErrs...)
+		}
+		if follow.Cursor != nil {
+			req, err := follow.Cursor.nextRequest(data, resp)
+			if err != nil {
+				errs = append(errs, err)
+			} else if req != nil {
+				for k, v := range follow.Meta {
+					req.SetMeta(k, v)
+				}
+				req.SetPriority(follow.Priority)
+				dataList = append(dataList, req)
+			}
+		}
+	}
+	return dataList, errs
+}
+
+//用于按照字段抽取规则从JSON值中抽取字段
+//若有必需的字段缺失，第二个结果值为false
+func extractJSONFields(value interface{}, fields map[string]*Field,
+	base *url.URL) (map[string]interface{}, bool) {
+	values := map[string]interface{}{}
+	for name, field := range fields {
+		fieldValue, found := field.extractJSON(value, base)
+		if !found {
+			if field.Required {
+				return nil, false
+			}
+			continue
+		}
+		values[name] = fieldValue
+	}
+	return values, true
+}
+
+//用于从JSON值中抽取单个字段的值
+func (field *Field) extractJSON(value interface{}, base *url.URL) (interface{}, bool) {
+	matched := field.path.Find(value)
+	if !field.List {
+		if len(matched) == 0 {
+			return nil, false
+		}
+		return field.jsonValue(matched[0], base)
+	}
+	list := make([]interface{}, 0, len(matched))
+	for _, m := range matched {
+		if v, ok := field.jsonValue(m, base); ok {
+			list = append(list, v)
+		}
+	}
+	if len(list) == 0 {
+		return nil, false
+	}
+	return list, true
+}
+
+//用于获取单个JSON值对应的字段值
+func (field *Field) jsonValue(value interface{}, base *url.URL) (interface{}, bool) {
+	if field.Type == FIELD_TYPE_OBJECT {
+		values, ok := extractJSONFields(value, field.Fields, base)
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values, true
+	}
+	if value == nil {
+		return nil, false
+	}
+	if field.Absolute {
+		link, ok := value.(string)
+		if !ok {
+			return nil, false
+		}
+		return links.Resolve(base, link)
+	}
+	return value, true
+}
+
+//用于从JSON数据中抽取跟进的链接并生成请求
+func (fr *FollowRule) extractJSON(data interface{}, base *url.URL,
+	respDepth uint32) ([]structure.Data, []error) {
+	var dataList []structure.Data
+	var errs []error
+	for _, value := range fr.path.Find(data) {
+		link, ok := value.(string)
+		if !ok {
+			continue
+		}
+		absURL, ok := links.Resolve(base, link)
+		if !ok {
+			continue
+		}
+		if fr.urlRegexp != nil && !fr.urlRegexp.MatchString(absURL) {
+			continue
+		}
+		httpReq, err := http.NewRequest("GET", absURL, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		req := structure.NewRequest(httpReq, respDepth)
+		for k, v := range fr.Meta {
+			req.SetMeta(k, v)
+		}
+		req.SetPriority(fr.Priority)
+		dataList = append(dataList, req)
+	}
+	return dataList, errs
+}
+
+//用于根据游标生成下一页的请求
+//没有下一页时两个结果值都为nil
+func (cr *CursorRule) nextRequest(data interface{},
+	resp *structure.Response) (*structure.Request, error) {
+	if cr.whilePath != nil {
+		value, ok := cr.whilePath.FindOne(data)
+		if !ok || !truthy(value) {
+			return nil, nil
+		}
+	}
+	cursor, ok := cr.path.FindOne(data)
+	if !ok || !truthy(cursor) {
+		return nil, nil
+	}
+	httpReq := resp.HTTPResp().Request
+	method := httpReq.Method
+	var body []byte
+	var meta map[string]interface{}
+	if req := resp.Request(); req != nil {
+		httpReq = req.HTTPReq()
+		method = httpReq.Method
+		body = req.Body()
+		meta = req.MetaMap()
+	}
+	nextURL := *httpReq.URL
+	header := httpReq.Header.Clone()
+	if cr.Param != "" {
+		query := nextURL.Query()
+		query.Set(cr.Param, cursorString(cursor))
+		nextURL.RawQuery = query.Encode()
+	} else {
+		var err error
+		if body, err = setBodyField(body, cr.BodyField, cursor); err != nil {
+			return nil, fmt.Errorf("couldn't set cursor to request body: %s (requestURL: %s)",
+				err, httpReq.URL)
+		}
+		if method == "" || method == http.MethodGet {
+			method = http.MethodPost
+		}
+		if header == nil {
+			header = http.Header{}
+		}
+		if header.Get("Content-Type") == "" {
+			header.Set("Content-Type", "application/json")
+		}
+	}
+	header.Del("Referer")
+	req, err := structure.NewRequestWithBody(method, nextURL.String(), header, body, resp.Depth())
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range meta {
+		req.SetMeta(k, v)
+	}
+	//下一页与当前页处于同一逻辑深度
+	req.SetSameDepth(true)
+	return req, nil
+}
+
+//用于把游标值设置到JSON请求体中以点号分隔的字段上
+func setBodyField(body []byte, field string, value interface{}) ([]byte, error) {
+	object := map[string]interface{}{}
+	if len(bytes.TrimSpace(body)) > 0 {
+		decoder := json.NewDecoder(bytes.NewReader(body))
+		decoder.UseNumber()
+		if err := decoder.Decode(&object); err != nil {
+			return nil, err
+		}
+	}
+	keys := strings.Split(field, ".")
+	current := object
+	for _, key := range keys[:len(keys)-1] {
+		child, ok := current[key].(map[string]interface{})
+		if !ok {
+			child = map[string]interface{}{}
+			current[key] = child
+		}
+		current = child
+	}
+	current[keys[len(keys)-1]] = value
+	return json.Marshal(object)
+}
+
+//用于把游标值转换为字符串形式
+func cursorString(value interface{}) string {
+	switch v := value.(type) {
+	case string:
+		return v
+	case json.Number:
+		return v.String()
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	}
+	b, _ := json.Marshal(value)
+	return string(b)
+}
+
+//用于判断JSON值是否代表真
+func truthy(value interface{}) bool {
+	switch v := value.(type) {
+	case nil:
+		return false
+	case bool:
+		return v
+	case string:
+		return v != ""
+	case json.Number:
+		f, err := v.Float64()
+		return err != nil || f != 0
+	case float64:
+		return v != 0
+	}
+	return true
+}
+
+//用于判断响应的内容是否是JSON
+func isJSON(httpResp *http.Response) bool {
+	contentType := strings.ToLower(httpResp.Header.Get("Content-Type"))
+	if index := strings.Index(contentType, ";"); index >= 0 {
+		contentType = contentType[:index]
+	}
+	contentType = strings.TrimSpace(contentType)
+	return contentType == "application/json" || contentType == "text/json" ||
+		strings.HasSuffix(contentType, "+json")
+}
@@ -0,0 +1,123 @@
+package rule
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+var testJSONPage = `{
+  "data": {
+    "items": [
+      {"id": 1, "title": "First", "url": "/p/1", "author": {"name": "Tom"}},
+      {"id": 2, "title": "Second", "url": "/p/2"},
+      {"id": 3, "url": "/p/3"}
+    ]
+  },
+  "paging": {"cursor": "abc", "has_more": true}
+}`
+
+func genTestJSONResponse(t *testing.T, req *structure.Request) *structure.Response {
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"application/json; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(testJSONPage)),
+		Request:    req.HTTPReq(),
+	}
+	return structure.NewResponseBy(httpResp, req)
+}
+
+func TestJSONRule(t *testing.T) {
+	spec, err := ParseYAML([]byte(`
+rules:
+  - name: api
+    type: json
+    url: ^http://example\.com/api
+    item:
+      scope_jsonpath: $.data.items[*]
+      fields:
+        id: {jsonpath: $.id}
+        title: {jsonpath: $.title, required: true}
+        link: {jsonpath: $.url, absolute: true}
+        author: {jsonpath: $.author, type: object, fields: {name: {jsonpath: $.name}}}
+    follow:
+      - jsonpath: $.data.items[*].url
+        url: /p/[12]$
+      - cursor: {jsonpath: $.paging.cursor, param: cursor, while: $.paging.has_more}
+        meta: {page: next}
+`))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing spec: %s", err)
+	}
+	httpReq, _ := http.NewRequest("GET", "http://example.com/api/list?size=10", nil)
+	req := structure.NewRequest(httpReq, 1).SetMeta("category", "news")
+	dataList, errs := spec.Rules[0].Parser()(genTestJSONResponse(t, req))
+	if len(errs) != 0 {
+		t.Fatalf("Errors occur when parsing: %v", errs)
+	}
+	if len(dataList) != 5 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d", 5, len(dataList))
+	}
+	item, ok := dataList[0].(structure.Item)
+	if !ok {
+		t.Fatalf("Incorrect data type: %T", dataList[0])
+	}
+	if item["title"] != "First" || item["link"] != "http://example.com/p/1" ||
+		!reflect.DeepEqual(item["author"], map[string]interface{}{"name": "Tom"}) {
+		t.Fatalf("Inconsistent item: %#v", item)
+	}
+	if id := item["id"]; id == nil || id.(interface{ String() string }).String() != "1" {
+		t.Fatalf("Inconsistent item ID: %#v", id)
+	}
+	next, ok := dataList[4].(*structure.Request)
+	if !ok {
+		t.Fatalf("Incorrect data type: %T", dataList[4])
+	}
+	if next.HTTPReq().URL.String() != "http://example.com/api/list?cursor=abc&size=10" {
+		t.Fatalf("Inconsistent next page URL: %s", next.HTTPReq().URL)
+	}
+	if !next.SameDepth() {
+		t.Fatalf("The next page request should be at the same depth")
+	}
+	if next.Meta("category") != "news" || next.Meta("page") != "next" {
+		t.Fatalf("Inconsistent next page metadata: %v", next.MetaMap())
+	}
+}
+
+func TestJSONCursorBody(t *testing.T) {
+	spec, err := ParseJSON([]byte(`{"rules": [{
+		"name": "api", "type": "json",
+		"follow": [{"cursor": {"jsonpath": "$.paging.cursor", "body_field": "page.cursor"}}]
+	}]}`))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing spec: %s", err)
+	}
+	req, _ := structure.NewRequestWithBody("POST", "http://example.com/api",
+		nil, []byte(`{"size": 10}`), 0)
+	dataList, errs := spec.Rules[0].Parser()(genTestJSONResponse(t, req))
+	if len(errs) != 0 || len(dataList) != 1 {
+		t.Fatalf("Inconsistent parse result: %v %v", dataList, errs)
+	}
+	next := dataList[0].(*structure.Request)
+	if next.HTTPReq().Method != "POST" ||
+		string(next.Body()) != `{"page":{"cursor":"abc"},"size":10}` {
+		t.Fatalf("Inconsistent next page request: %s %s", next.HTTPReq().Method, next.Body())
+	}
+	if next.HTTPReq().Header.Get("Content-Type") != "application/json" {
+		t.Fatalf("Inconsistent content type: %q", next.HTTPReq().Header.Get("Content-Type"))
+	}
+	for _, data := range []string{
+		`{"rules": [{"type": "json", "follow": [{"selector": "a"}]}]}`,
+		`{"rules": [{"type": "json", "follow": [{"cursor": {"jsonpath": "$.c"}}]}]}`,
+		`{"rules": [{"type": "json", "item": {"fields": {"a": {"jsonpath": "$["}}}}]}`,
+		`{"rules": [{"item": {"fields": {"a": {"jsonpath": "$.a"}}}}]}`,
+	} {
+		if _, err := ParseJSON([]byte(data)); err == nil {
+			t.Fatalf("No error when parsing invalid spec: %s", data)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package rule
+
+import (
+	"fmt"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Vientiane/toolkit/xpath"
+	"github.com/andybalholm/cascadia"
+	"github.com/antchfx/htmlquery"
+	antxpath "github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+//节点定位器，使用CSS选择器或XPath表达式中的一种查找节点
+type locator struct {
+	//编译后的CSS选择器
+	css cascadia.Selector
+	//编译后的XPath表达式
+	xpath *antxpath.Expr
+}
+
+//用于编译CSS选择器或XPath表达式
+//两者都为空时返回nil，代表定位到当前节点
+func newLocator(selector string, xpathExpr string) (*locator, error) {
+	switch {
+	case selector != "" && xpathExpr != "":
+		return nil, fmt.Errorf("both selector %q and xpath %q are given", selector, xpathExpr)
+	case selector != "":
+		css, err := cascadia.Compile(selector)
+		if err != nil {
+			return nil, fmt.Errorf("illegal selector %q: %s", selector, err)
+		}
+		return &locator{css: css}, nil
+	case xpathExpr != "":
+		expr, err := xpath.Compile(xpathExpr)
+		if err != nil {
+			return nil, err
+		}
+		return &locator{xpath: expr}, nil
+	}
+	return nil, nil
+}
+
+//用于在给定节点中查找节点
+//CSS选择器只匹配后代节点，XPath表达式以给定节点为上下文节点求值
+func (l *locator) find(n *html.Node) []*html.Node {
+	if l == nil {
+		return []*html.Node{n}
+	}
+	if l.xpath != nil {
+		return htmlquery.QuerySelectorAll(n, l.xpath)
+	}
+	return goquery.NewDocumentFromNode(n).FindMatcher(l.css).Nodes
+}
@@ -0,0 +1,238 @@
+package rule
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/links"
+	"github.com/Vientiane/toolkit/xpath"
+	"golang.org/x/net/html"
+)
+
+//用于生成规则描述中所有规则对应的响应解析函数
+func (spec *Spec) Parsers() ([]module.ParseResponse, error) {
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	parsers := make([]module.ParseResponse, 0, len(spec.Rules))
+	for _, rule := range spec.Rules {
+		parsers = append(parsers, rule.Parser())
+	}
+	return parsers, nil
+}
+
+//用于生成规则描述中所有规则对应的带匹配条件的响应解析器
+//以便分析器只把URL和内容类型符合规则的响应交给解析函数
+func (spec *Spec) RespParsers() ([]module.RespParser, error) {
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	parsers := make([]module.RespParser, 0, len(spec.Rules))
+	for _, rule := range spec.Rules {
+		parsers = append(parsers, rule.RespParser())
+	}
+	return parsers, nil
+}
+
+//用于生成规则对应的带匹配条件的响应解析器
+func (rule *Rule) RespParser() module.RespParser {
+	cond := module.ParserCondition{URLPattern: rule.URL}
+	if rule.Type == RULE_TYPE_JSON {
+		cond.MIMETypes = []string{"application/json", "text/json", "application/*+json"}
+	} else {
+		cond.MIMETypes = []string{"text/html", "application/xhtml+xml"}
+	}
+	return module.RespParser{
+		Name:      rule.Name,
+		Parse:     rule.Parser(),
+		Condition: cond,
+	}
+}
+
+//用于生成规则对应的响应解析函数
+//规则应已经通过检查，URL不匹配或内容类型与规则类型不符的响应会被忽略
+func (rule *Rule) Parser() module.ParseResponse {
+	return func(resp *structure.Response) ([]structure.Data, []error) {
+		httpResp := resp.HTTPResp()
+		if httpResp == nil {
+			return nil, []error{fmt.Errorf("nil HTTP response")}
+		}
+		if httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{fmt.Errorf("nil HTTP request")}
+		}
+		reqURL := httpResp.Request.URL
+		if !rule.Match(reqURL.String()) {
+			return nil, nil
+		}
+		if rule.Type == RULE_TYPE_JSON {
+			if !isJSON(httpResp) {
+				return nil, nil
+			}
+			return rule.jsonParser(resp)
+		}
+		if !isHTML(httpResp) {
+			return nil, nil
+		}
+		root, err := resp.HTMLNode()
+		if err != nil {
+			return nil, []error{fmt.Errorf("%s (requestURL: %s)", err, reqURL)}
+		}
+		return rule.Apply(root, links.BaseURL(root, reqURL), resp.Depth())
+	}
+}
+
+//用于对已解析的文档树应用规则
+//base用于把相对链接解析为绝对URL
+func (rule *Rule) Apply(root *html.Node, base *url.URL,
+	respDepth uint32) ([]structure.Data, []error) {
+	dataList := make([]structure.Data, 0)
+	errs := make([]error, 0)
+	if rule.Item != nil {
+		for _, item := range rule.Item.extract(root, base) {
+			dataList = append(dataList, item)
+		}
+	}
+	for _, follow := range rule.Follow {
+		reqs, fErrs := follow.extract(root, base, respDepth)
+		dataList = append(dataList, reqs...)
+		errs = append(errs, fErrs...)
+	}
+	return dataList, errs
+}
+
+//用于抽取条目
+func (ir *ItemRule) extract(root *html.Node, base *url.URL) []structure.Item {
+	var items []structure.Item
+	for _, n := range ir.scope.find(root) {
+		values, ok := extractFields(n, ir.Fields, base)
+		if !ok || len(values) == 0 {
+			continue
+		}
+		items = append(items, structure.Item(values))
+	}
+	return items
+}
+
+//用于按照字段抽取规则抽取字段
+//若有必需的字段缺失，第二个结果值为false
+func extractFields(n *html.Node, fields map[string]*Field,
+	base *url.URL) (map[string]interface{}, bool) {
+	values := map[string]interface{}{}
+	for name, field := range fields {
+		value, found := field.extract(n, base)
+		if !found {
+			if field.Required {
+				return nil, false
+			}
+			continue
+		}
+		values[name] = value
+	}
+	return values, true
+}
+
+//用于抽取单个字段的值
+//第二个结果值代表是否找到了字段
+func (field *Field) extract(n *html.Node, base *url.URL) (interface{}, bool) {
+	matched := field.locator.find(n)
+	if !field.List {
+		if len(matched) == 0 {
+			return nil, false
+		}
+		return field.value(matched[0], base)
+	}
+	list := make([]interface{}, 0, len(matched))
+	for _, m := range matched {
+		if value, ok := field.value(m, base); ok {
+			list = append(list, value)
+		}
+	}
+	if len(list) == 0 {
+		return nil, false
+	}
+	return list, true
+}
+
+//用于获取单个节点对应的字段值
+func (field *Field) value(n *html.Node, base *url.URL) (interface{}, bool) {
+	switch field.Type {
+	case FIELD_TYPE_ATTR:
+		attr, exists := xpath.Attr(n, field.Attr)
+		if !exists {
+			return nil, false
+		}
+		attr = strings.TrimSpace(attr)
+		if field.Absolute {
+			return links.Resolve(base, attr)
+		}
+		return attr, true
+	case FIELD_TYPE_HTML:
+		return strings.TrimSpace(xpath.InnerHTML(n)), true
+	case FIELD_TYPE_OBJECT:
+		values, ok := extractFields(n, field.Fields, base)
+		if !ok || len(values) == 0 {
+			return nil, false
+		}
+		return values, true
+	default:
+		text := strings.TrimSpace(xpath.Text(n))
+		if field.Absolute {
+			//XPath选中属性时，属性值以文本的形式给出
+			return links.Resolve(base, text)
+		}
+		return text, true
+	}
+}
+
+//用于抽取跟进的链接并生成请求
+//XPath选中属性或文本时，直接以其文本作为链接
+func (fr *FollowRule) extract(root *html.Node, base *url.URL,
+	respDepth uint32) ([]structure.Data, []error) {
+	attr := fr.Attr
+	if attr == "" {
+		attr = "href"
+	}
+	var dataList []structure.Data
+	var errs []error
+	for _, n := range fr.locator.find(root) {
+		var link string
+		if n.Type == html.ElementNode && !xpath.IsAttribute(n) {
+			var exists bool
+			if link, exists = xpath.Attr(n, attr); !exists {
+				continue
+			}
+		} else {
+			link = xpath.Text(n)
+		}
+		absURL, ok := links.Resolve(base, link)
+		if !ok {
+			continue
+		}
+		if fr.urlRegexp != nil && !fr.urlRegexp.MatchString(absURL) {
+			continue
+		}
+		httpReq, err := http.NewRequest("GET", absURL, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		req := structure.NewRequest(httpReq, respDepth)
+		for k, v := range fr.Meta {
+			req.SetMeta(k, v)
+		}
+		req.SetPriority(fr.Priority)
+		dataList = append(dataList, req)
+	}
+	return dataList, errs
+}
+
+//用于判断响应的内容是否是HTML
+func isHTML(httpResp *http.Response) bool {
+	contentType := strings.ToLower(httpResp.Header.Get("Content-Type"))
+	return contentType == "" || strings.HasPrefix(contentType, "text/html") ||
+		strings.HasPrefix(contentType, "application/xhtml")
+}
@@ -0,0 +1,197 @@
+package rule
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+var testPage = `<html><head><base href="/news/"></head><body>
+<div class="post"><h2> First </h2><a class="more" href="1.html">more</a>
+<span class="tag">go</span><span class="tag">crawler</span>
+<div class="author"><b>Tom</b><i>tom@example.com</i></div></div>
+<div class="post"><h2>Second</h2><a class="more" href="2.html">more</a></div>
+<div class="post"><a class="more" href="3.html">more</a></div>
+<a class="next" href="/list?page=2">next</a>
+<a class="next" href="javascript:void(0)">noop</a>
+</body></html>`
+
+var testJSONSpec = `{
+  "rules": [{
+    "name": "list",
+    "url": "^http://example\\.com/list",
+    "item": {
+      "scope": "div.post",
+      "fields": {
+        "title": {"selector": "h2", "required": true},
+        "link": {"selector": "a.more", "type": "attr", "attr": "href", "absolute": true},
+        "tags": {"selector": ".tag", "list": true},
+        "author": {"selector": ".author", "type": "object", "fields": {
+          "name": {"selector": "b"},
+          "email": {"selector": "i"}
+        }}
+      }
+    },
+    "follow": [{"selector": "a.next", "meta": {"category": "list"}, "priority": 2}]
+  }]
+}`
+
+var testYAMLSpec = `
+rules:
+  - name: list
+    url: ^http://example\.com/list
+    item:
+      scope: div.post
+      fields:
+        title: {selector: h2, required: true}
+        link: {selector: a.more, type: attr, attr: href, absolute: true}
+        tags: {selector: .tag, list: true}
+        author:
+          selector: .author
+          type: object
+          fields:
+            name: {selector: b}
+            email: {selector: i}
+    follow:
+      - selector: a.next
+        meta: {category: list}
+        priority: 2
+`
+
+func genTestResponse(t *testing.T, rawURL string) *structure.Response {
+	httpReq, err := http.NewRequest("GET", rawURL, nil)
+	if err != nil {
+		t.Fatalf("An error occurs when creating HTTP request: %s", err)
+	}
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": []string{"text/html; charset=utf-8"}},
+		Body:       ioutil.NopCloser(strings.NewReader(testPage)),
+		Request:    httpReq,
+	}
+	return structure.NewResponse(httpResp, 1)
+}
+
+func TestRuleParser(t *testing.T) {
+	for format, parse := range map[string]func([]byte) (*Spec, error){
+		"JSON": ParseJSON,
+		"YAML": ParseYAML,
+	} {
+		spec, err := parse([]byte(map[string]string{
+			"JSON": testJSONSpec, "YAML": testYAMLSpec}[format]))
+		if err != nil {
+			t.Fatalf("An error occurs when parsing %s spec: %s", format, err)
+		}
+		parsers, err := spec.Parsers()
+		if err != nil {
+			t.Fatalf("An error occurs when generating parsers: %s", err)
+		}
+		dataList, errs := parsers[0](genTestResponse(t, "http://example.com/list"))
+		if len(errs) != 0 {
+			t.Fatalf("Errors occur when parsing (%s): %v", format, errs)
+		}
+		var items []structure.Item
+		var reqs []*structure.Request
+		for _, data := range dataList {
+			switch d := data.(type) {
+			case structure.Item:
+				items = append(items, d)
+			case *structure.Request:
+				reqs = append(reqs, d)
+			}
+		}
+		if len(items) != 2 {
+			t.Fatalf("Inconsistent item number (%s): expected: %d, actual: %d", format, 2, len(items))
+		}
+		expected := structure.Item{
+			"title": "First",
+			"link":  "http://example.com/news/1.html",
+			"tags":  []interface{}{"go", "crawler"},
+			"author": map[string]interface{}{
+				"name":  "Tom",
+				"email": "tom@example.com",
+			},
+		}
+		if !reflect.DeepEqual(items[0], expected) {
+			t.Fatalf("Inconsistent item (%s): expected: %#v, actual: %#v", format, expected, items[0])
+		}
+		if len(items[1]) != 2 || items[1]["title"] != "Second" {
+			t.Fatalf("Inconsistent item (%s): %#v", format, items[1])
+		}
+		if len(reqs) != 1 {
+			t.Fatalf("Inconsistent request number (%s): expected: %d, actual: %d", format, 1, len(reqs))
+		}
+		if reqs[0].HTTPReq().URL.String() != "http://example.com/list?page=2" ||
+			reqs[0].Meta("category") != "list" || reqs[0].Priority() != 2 {
+			t.Fatalf("Inconsistent request (%s): %s", format, reqs[0].HTTPReq().URL)
+		}
+		dataList, errs = parsers[0](genTestResponse(t, "http://example.com/other"))
+		if len(dataList) != 0 || len(errs) != 0 {
+			t.Fatalf("The rule is applied to an unmatched URL! (%s)", format)
+		}
+	}
+}
+
+func TestSpecCheck(t *testing.T) {
+	invalidSpecs := []string{
+		`{"rules": []}`,
+		`{"rules": [{"name": "a"}]}`,
+		`{"rules": [{"name": "a", "url": "(", "follow": [{"selector": "a"}]}]}`,
+		`{"rules": [{"name": "a", "item": {"fields": {"x": {"type": "attr"}}}}]}`,
+		`{"rules": [{"name": "a", "item": {"fields": {"x": {"type": "unknown"}}}}]}`,
+	}
+	for _, data := range invalidSpecs {
+		if _, err := ParseJSON([]byte(data)); err == nil {
+			t.Fatalf("No error when parsing invalid spec: %s", data)
+		}
+	}
+}
+
+func TestMixedXPathRule(t *testing.T) {
+	spec, err := ParseYAML([]byte(`
+rules:
+  - name: mixed
+    item:
+      scope_xpath: //div[@class="post"][h2]
+      fields:
+        title: {xpath: "./h2/text()", required: true}
+        link: {xpath: "./a[@class='more']/@href", absolute: true}
+        tags: {selector: .tag, list: true}
+        author_email: {xpath: ".//div[@class='author']/b/following-sibling::i"}
+    follow:
+      - xpath: //a[text()="next"]/@href
+`))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing spec: %s", err)
+	}
+	dataList, errs := spec.Rules[0].Parser()(genTestResponse(t, "http://example.com/list"))
+	if len(errs) != 0 {
+		t.Fatalf("Errors occur when parsing: %v", errs)
+	}
+	if len(dataList) != 3 {
+		t.Fatalf("Inconsistent data number: expected: %d, actual: %d", 3, len(dataList))
+	}
+	expected := structure.Item{
+		"title":        "First",
+		"link":         "http://example.com/news/1.html",
+		"tags":         []interface{}{"go", "crawler"},
+		"author_email": "tom@example.com",
+	}
+	if !reflect.DeepEqual(dataList[0], expected) {
+		t.Fatalf("Inconsistent item: expected: %#v, actual: %#v", expected, dataList[0])
+	}
+	req, ok := dataList[2].(*structure.Request)
+	if !ok || req.HTTPReq().URL.String() != "http://example.com/list?page=2" {
+		t.Fatalf("Inconsistent request: %#v", dataList[2])
+	}
+	if _, err = ParseJSON([]byte(`{"rules": [{"follow": [{"selector": "a", "xpath": "//a"}]}]}`)); err == nil {
+		t.Fatalf("No error when both selector and xpath are given!")
+	}
+	if _, err = ParseJSON([]byte(`{"rules": [{"follow": [{"xpath": "//a["}]}]}`)); err == nil {
+		t.Fatalf("No error when parsing illegal xpath!")
+	}
+}
@@ -0,0 +1,340 @@
+package rule
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/toolkit/jsonpath"
+	"gopkg.in/yaml.v3"
+)
+
+//声明式的抽取规则
+//规则描述以JSON或YAML格式书写，按URL模式匹配响应，
+//用CSS选择器或XPath表达式抽取字段生成条目，并抽取需要跟进的链接生成请求
+//同一规则中的两种选择语言可以混用，但每个选择位置只能使用其中一种
+
+//规则的类型
+type RuleType string
+
+const (
+	//适用于HTML响应，使用CSS选择器或XPath表达式
+	RULE_TYPE_HTML RuleType = "html"
+	//适用于JSON响应，使用JSONPath表达式
+	RULE_TYPE_JSON RuleType = "json"
+)
+
+//字段的类型
+type FieldType string
+
+const (
+	//元素的文本
+	FIELD_TYPE_TEXT FieldType = "text"
+	//元素的属性值
+	FIELD_TYPE_ATTR FieldType = "attr"
+	//元素内部的HTML
+	FIELD_TYPE_HTML FieldType = "html"
+	//由子字段组成的嵌套对象
+	FIELD_TYPE_OBJECT FieldType = "object"
+)
+
+//规则描述的类型
+type Spec struct {
+	//规则列表
+	Rules []*Rule `json:"rules" yaml:"rules"`
+}
+
+//单条规则的类型
+type Rule struct {
+	//规则的名称
+	Name string `json:"name" yaml:"name"`
+	//规则的类型，默认为html
+	Type RuleType `json:"type,omitempty" yaml:"type,omitempty"`
+	//匹配响应URL的正则表达式，为空代表匹配所有URL
+	URL string `json:"url" yaml:"url"`
+	//条目的抽取规则，为空代表不生成条目
+	Item *ItemRule `json:"item,omitempty" yaml:"item,omitempty"`
+	//跟进链接的抽取规则
+	Follow []*FollowRule `json:"follow,omitempty" yaml:"follow,omitempty"`
+	//编译后的URL正则表达式
+	urlRegexp *regexp.Regexp
+}
+
+//条目抽取规则的类型
+type ItemRule struct {
+	//条目所在范围的选择器，每个匹配的元素生成一个条目
+	//与ScopeXPath都为空代表每个页面生成一个条目
+	Scope string `json:"scope,omitempty" yaml:"scope,omitempty"`
+	//条目所在范围的XPath表达式
+	ScopeXPath string `json:"scope_xpath,omitempty" yaml:"scope_xpath,omitempty"`
+	//条目所在范围的JSONPath表达式，仅用于json类型的规则
+	ScopeJSONPath string `json:"scope_jsonpath,omitempty" yaml:"scope_jsonpath,omitempty"`
+	//字段名与字段抽取规则的映射
+	//json类型的规则可以不设置字段，此时范围内的每个对象直接作为条目
+	Fields map[string]*Field `json:"fields" yaml:"fields"`
+	//编译后的范围定位器
+	scope *locator
+	//编译后的范围JSONPath表达式
+	scopePath *jsonpath.Path
+}
+
+//字段抽取规则的类型
+type Field struct {
+	//字段所在元素的选择器，与XPath都为空代表当前元素
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	//字段所在节点的XPath表达式，以当前元素为上下文节点
+	//选中文本节点或属性（如text()或@href）时，字段值为其文本
+	XPath string `json:"xpath,omitempty" yaml:"xpath,omitempty"`
+	//字段值的JSONPath表达式，以当前对象为根，仅用于json类型的规则
+	JSONPath string `json:"jsonpath,omitempty" yaml:"jsonpath,omitempty"`
+	//字段的类型，默认为text
+	Type FieldType `json:"type,omitempty" yaml:"type,omitempty"`
+	//属性名，仅在类型为attr时有效
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	//是否把属性值解析为相对于页面的绝对URL
+	Absolute bool `json:"absolute,omitempty" yaml:"absolute,omitempty"`
+	//是否抽取所有匹配的元素，结果为列表
+	List bool `json:"list,omitempty" yaml:"list,omitempty"`
+	//是否为必需的字段，必需的字段缺失时不生成条目
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	//子字段，仅在类型为object时有效
+	Fields map[string]*Field `json:"fields,omitempty" yaml:"fields,omitempty"`
+	//编译后的字段定位器
+	locator *locator
+	//编译后的字段JSONPath表达式
+	path *jsonpath.Path
+}
+
+//跟进链接抽取规则的类型
+type FollowRule struct {
+	//链接所在元素的选择器
+	Selector string `json:"selector,omitempty" yaml:"selector,omitempty"`
+	//链接所在节点的XPath表达式，与Selector只能设置一个
+	XPath string `json:"xpath,omitempty" yaml:"xpath,omitempty"`
+	//链接的JSONPath表达式，仅用于json类型的规则
+	JSONPath string `json:"jsonpath,omitempty" yaml:"jsonpath,omitempty"`
+	//翻页游标的抽取规则，仅用于json类型的规则
+	Cursor *CursorRule `json:"cursor,omitempty" yaml:"cursor,omitempty"`
+	//链接所在的属性名，默认为href
+	Attr string `json:"attr,omitempty" yaml:"attr,omitempty"`
+	//链接需要匹配的正则表达式，为空代表不过滤
+	URL string `json:"url,omitempty" yaml:"url,omitempty"`
+	//附加到生成的请求上的元数据
+	Meta map[string]interface{} `json:"meta,omitempty" yaml:"meta,omitempty"`
+	//生成的请求的优先级
+	Priority int `json:"priority,omitempty" yaml:"priority,omitempty"`
+	//编译后的链接正则表达式
+	urlRegexp *regexp.Regexp
+	//编译后的链接定位器
+	locator *locator
+	//编译后的链接JSONPath表达式
+	path *jsonpath.Path
+}
+
+//翻页游标抽取规则的类型
+//游标会被放入当前请求的查询参数或JSON请求体中，生成下一页的请求
+//下一页的请求与当前页处于同一逻辑深度，不会消耗最大爬取深度
+type CursorRule struct {
+	//游标值的JSONPath表达式，游标为空时停止翻页
+	JSONPath string `json:"jsonpath" yaml:"jsonpath"`
+	//放置游标的查询参数名
+	Param string `json:"param,omitempty" yaml:"param,omitempty"`
+	//放置游标的JSON请求体字段名，可以用点号分隔嵌套的字段
+	BodyField string `json:"body_field,omitempty" yaml:"body_field,omitempty"`
+	//是否继续翻页的JSONPath表达式，为空代表只判断游标
+	//结果不存在或为false、null、空字符串时停止翻页
+	While string `json:"while,omitempty" yaml:"while,omitempty"`
+	//编译后的游标JSONPath表达式
+	path *jsonpath.Path
+	//编译后的继续条件JSONPath表达式
+	whilePath *jsonpath.Path
+}
+
+//用于从文件加载规则描述
+//扩展名为.yaml或.yml时按YAML解析，否则按JSON解析
+func Load(path string) (*Spec, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
+
+//用于解析JSON格式的规则描述
+func ParseJSON(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	if err := json.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("rule: couldn't parse JSON spec: %s", err)
+	}
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+//用于解析YAML格式的规则描述
+func ParseYAML(data []byte) (*Spec, error) {
+	spec := &Spec{}
+	if err := yaml.Unmarshal(data, spec); err != nil {
+		return nil, fmt.Errorf("rule: couldn't parse YAML spec: %s", err)
+	}
+	if err := spec.Check(); err != nil {
+		return nil, err
+	}
+	return spec, nil
+}
+
+//用于检查规则描述的有效性并编译其中的正则表达式
+func (spec *Spec) Check() error {
+	if len(spec.Rules) == 0 {
+		return errors.NewIllegalParameterError("empty rule list")
+	}
+	for i, rule := range spec.Rules {
+		if rule == nil {
+			return errors.NewIllegalParameterError(fmt.Sprintf("nil rule[%d]", i))
+		}
+		if err := rule.Check(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//用于检查规则的有效性并编译其中的正则表达式和选择器
+func (rule *Rule) Check() error {
+	if rule.Item == nil && len(rule.Follow) == 0 {
+		return errors.NewIllegalParameterError(
+			fmt.Sprintf("neither item nor follow in rule %q", rule.Name))
+	}
+	if rule.URL != "" {
+		re, err := regexp.Compile(rule.URL)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal URL pattern in rule %q: %s", rule.Name, err))
+		}
+		rule.urlRegexp = re
+	}
+	for i, follow := range rule.Follow {
+		if follow == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("nil follow[%d] in rule %q", i, rule.Name))
+		}
+		if follow.URL != "" {
+			re, err := regexp.Compile(follow.URL)
+			if err != nil {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("illegal follow URL pattern[%d] in rule %q: %s", i, rule.Name, err))
+			}
+			follow.urlRegexp = re
+		}
+	}
+	switch rule.Type {
+	case "", RULE_TYPE_HTML:
+		rule.Type = RULE_TYPE_HTML
+		return rule.checkHTML()
+	case RULE_TYPE_JSON:
+		return rule.checkJSON()
+	}
+	return errors.NewIllegalParameterError(
+		fmt.Sprintf("unsupported type %q of rule %q", rule.Type, rule.Name))
+}
+
+//用于检查html类型的规则并编译其中的选择器
+func (rule *Rule) checkHTML() error {
+	if rule.Item != nil {
+		if rule.Item.ScopeJSONPath != "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("JSONPath scope in html rule %q", rule.Name))
+		}
+		if len(rule.Item.Fields) == 0 {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("empty item fields in rule %q", rule.Name))
+		}
+		scope, err := newLocator(rule.Item.Scope, rule.Item.ScopeXPath)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal item scope in rule %q: %s", rule.Name, err))
+		}
+		rule.Item.scope = scope
+		if err := checkFields(rule.Name, rule.Item.Fields); err != nil {
+			return err
+		}
+	}
+	for i, follow := range rule.Follow {
+		if follow.Selector == "" && follow.XPath == "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("empty follow selector[%d] in rule %q", i, rule.Name))
+		}
+		if follow.JSONPath != "" || follow.Cursor != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("JSONPath follow[%d] in html rule %q", i, rule.Name))
+		}
+		locator, err := newLocator(follow.Selector, follow.XPath)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal follow selector[%d] in rule %q: %s", i, rule.Name, err))
+		}
+		follow.locator = locator
+	}
+	return nil
+}
+
+//用于检查字段抽取规则的有效性
+func checkFields(ruleName string, fields map[string]*Field) error {
+	for name, field := range fields {
+		if field == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("nil field %q in rule %q", name, ruleName))
+		}
+		if field.Type == "" {
+			field.Type = FIELD_TYPE_TEXT
+		}
+		if field.JSONPath != "" {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("JSONPath of field %q in html rule %q", name, ruleName))
+		}
+		locator, err := newLocator(field.Selector, field.XPath)
+		if err != nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("illegal selector of field %q in rule %q: %s", name, ruleName, err))
+		}
+		field.locator = locator
+		switch field.Type {
+		case FIELD_TYPE_TEXT, FIELD_TYPE_HTML:
+		case FIELD_TYPE_ATTR:
+			if field.Attr == "" {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("empty attribute name of field %q in rule %q", name, ruleName))
+			}
+		case FIELD_TYPE_OBJECT:
+			if len(field.Fields) == 0 {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("empty sub fields of field %q in rule %q", name, ruleName))
+			}
+			if err := checkFields(ruleName, field.Fields); err != nil {
+				return err
+			}
+		default:
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("unsupported type %q of field %q in rule %q", field.Type, name, ruleName))
+		}
+	}
+	return nil
+}
+
+//用于判断规则是否匹配给定的URL
+func (rule *Rule) Match(url string) bool {
+	if rule.urlRegexp == nil {
+		return rule.URL == ""
+	}
+	return rule.urlRegexp.MatchString(url)
+}
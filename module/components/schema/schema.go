@@ -0,0 +1,367 @@
+package schema
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"gopkg.in/yaml.v3"
+)
+
+//条目的模式定义，用于在条目处理函数运行之前校验条目
+//通过Pipeline.SetValidator挂到条目处理管道上，未通过校验的条目会交给Pipeline.SetRejectSink设置的函数
+
+//字段的类型
+type FieldType string
+
+const (
+	//任意类型
+	FIELD_TYPE_ANY    FieldType = ""
+	FIELD_TYPE_STRING FieldType = "string"
+	//整数或浮点数
+	FIELD_TYPE_NUMBER FieldType = "number"
+	//整数，也接受没有小数部分的浮点数
+	FIELD_TYPE_INTEGER FieldType = "integer"
+	FIELD_TYPE_BOOL    FieldType = "bool"
+	//切片或数组
+	FIELD_TYPE_ARRAY FieldType = "array"
+	//键为字符串的映射
+	FIELD_TYPE_OBJECT FieldType = "object"
+	//time.Time或RFC 3339格式的字符串
+	FIELD_TYPE_TIME FieldType = "time"
+	//io.Reader
+	FIELD_TYPE_READER FieldType = "reader"
+)
+
+//条目模式的类型
+type Schema struct {
+	//模式的名称
+	Name string `json:"name" yaml:"name"`
+	//字段名到字段定义的映射，字段名可用"."访问嵌套的映射，如"price.amount"
+	Fields map[string]*Field `json:"fields" yaml:"fields"`
+	//是否拒绝未定义的字段，以下划线开头的保留字段除外
+	Strict bool `json:"strict,omitempty" yaml:"strict,omitempty"`
+	//按字段名排序的字段列表
+	names []string
+}
+
+//字段定义的类型
+type Field struct {
+	//字段的类型
+	Type FieldType `json:"type,omitempty" yaml:"type,omitempty"`
+	//字段是否必须存在且不为nil
+	Required bool `json:"required,omitempty" yaml:"required,omitempty"`
+	//字符串需匹配的正则表达式
+	Pattern string `json:"pattern,omitempty" yaml:"pattern,omitempty"`
+	//数值的最小值
+	Min *float64 `json:"min,omitempty" yaml:"min,omitempty"`
+	//数值的最大值
+	Max *float64 `json:"max,omitempty" yaml:"max,omitempty"`
+	//字符串（按字符计）或数组的最小长度
+	MinLength *int `json:"min_length,omitempty" yaml:"min_length,omitempty"`
+	//字符串（按字符计）或数组的最大长度
+	MaxLength *int `json:"max_length,omitempty" yaml:"max_length,omitempty"`
+	//字符串可取的值，为空代表不限制
+	Enum []string `json:"enum,omitempty" yaml:"enum,omitempty"`
+	//编译后的正则表达式
+	patternRegexp *regexp.Regexp
+}
+
+//用于从文件加载模式
+//扩展名为.yaml或.yml时按YAML解析，否则按JSON解析
+func Load(path string) (*Schema, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return ParseYAML(data)
+	default:
+		return ParseJSON(data)
+	}
+}
+
+//用于解析JSON格式的模式
+func ParseJSON(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := json.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("schema: couldn't parse JSON schema: %s", err)
+	}
+	if err := schema.Check(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+//用于解析YAML格式的模式
+func ParseYAML(data []byte) (*Schema, error) {
+	schema := &Schema{}
+	if err := yaml.Unmarshal(data, schema); err != nil {
+		return nil, fmt.Errorf("schema: couldn't parse YAML schema: %s", err)
+	}
+	if err := schema.Check(); err != nil {
+		return nil, err
+	}
+	return schema, nil
+}
+
+//用于检查模式的有效性并编译其中的正则表达式
+//直接构造的模式必须先调用该方法才能用于校验
+func (schema *Schema) Check() error {
+	if len(schema.Fields) == 0 {
+		return errors.NewIllegalParameterError(
+			fmt.Sprintf("empty fields in schema %q", schema.Name))
+	}
+	schema.names = schema.names[:0]
+	for name, field := range schema.Fields {
+		if name == "" || field == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("empty field %q in schema %q", name, schema.Name))
+		}
+		switch field.Type {
+		case FIELD_TYPE_ANY, FIELD_TYPE_STRING, FIELD_TYPE_NUMBER, FIELD_TYPE_INTEGER,
+			FIELD_TYPE_BOOL, FIELD_TYPE_ARRAY, FIELD_TYPE_OBJECT, FIELD_TYPE_TIME, FIELD_TYPE_READER:
+		default:
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("unsupported type %q of field %q in schema %q", field.Type, name, schema.Name))
+		}
+		if field.Pattern != "" {
+			re, err := regexp.Compile(field.Pattern)
+			if err != nil {
+				return errors.NewIllegalParameterError(
+					fmt.Sprintf("illegal pattern of field %q in schema %q: %s", name, schema.Name, err))
+			}
+			field.patternRegexp = re
+		}
+		if field.Min != nil && field.Max != nil && *field.Min > *field.Max {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("min is greater than max in field %q of schema %q", name, schema.Name))
+		}
+		schema.names = append(schema.names, name)
+	}
+	sort.Strings(schema.names)
+	return nil
+}
+
+//实现module.ItemValidator接口，返回条目不符合模式的所有原因
+func (schema *Schema) Validate(item structure.Item) []string {
+	var reasons []string
+	for _, name := range schema.names {
+		field := schema.Fields[name]
+		value, ok := lookup(item, name)
+		if !ok || value == nil {
+			if field.Required {
+				reasons = append(reasons, fmt.Sprintf("%s: required field is missing", name))
+			}
+			continue
+		}
+		if reason := field.validate(value); reason != "" {
+			reasons = append(reasons, name+": "+reason)
+		}
+	}
+	if schema.Strict {
+		for _, name := range unknownFields(item, schema.Fields) {
+			reasons = append(reasons, fmt.Sprintf("%s: unknown field", name))
+		}
+	}
+	return reasons
+}
+
+//用于按照以"."分隔的字段名获取值
+func lookup(item structure.Item, name string) (interface{}, bool) {
+	if value, ok := item[name]; ok {
+		return value, true
+	}
+	var current interface{} = map[string]interface{}(item)
+	for _, part := range strings.Split(name, ".") {
+		m, ok := toMap(current)
+		if !ok {
+			return nil, false
+		}
+		if current, ok = m[part]; !ok {
+			return nil, false
+		}
+	}
+	return current, true
+}
+
+func toMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case structure.Item:
+		return m, true
+	}
+	return nil, false
+}
+
+//用于获取未定义的顶层字段，嵌套字段的定义会使其顶层字段成为已定义的字段
+func unknownFields(item structure.Item, fields map[string]*Field) []string {
+	known := map[string]bool{}
+	for name := range fields {
+		known[strings.SplitN(name, ".", 2)[0]] = true
+	}
+	var unknown []string
+	for name := range item {
+		if !known[name] && !strings.HasPrefix(name, "_") {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	return unknown
+}
+
+//用于校验字段的值，返回不符合的原因，符合时返回空字符串
+func (field *Field) validate(value interface{}) string {
+	v := reflect.ValueOf(value)
+	switch field.Type {
+	case FIELD_TYPE_STRING:
+		if v.Kind() != reflect.String {
+			return fmt.Sprintf("expected string, got %T", value)
+		}
+	case FIELD_TYPE_NUMBER:
+		if _, ok := toFloat(v); !ok {
+			return fmt.Sprintf("expected number, got %T", value)
+		}
+	case FIELD_TYPE_INTEGER:
+		f, ok := toFloat(v)
+		if !ok || f != float64(int64(f)) {
+			return fmt.Sprintf("expected integer, got %T(%v)", value, value)
+		}
+	case FIELD_TYPE_BOOL:
+		if v.Kind() != reflect.Bool {
+			return fmt.Sprintf("expected bool, got %T", value)
+		}
+	case FIELD_TYPE_ARRAY:
+		if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+			return fmt.Sprintf("expected array, got %T", value)
+		}
+	case FIELD_TYPE_OBJECT:
+		if v.Kind() != reflect.Map || v.Type().Key().Kind() != reflect.String {
+			return fmt.Sprintf("expected object, got %T", value)
+		}
+	case FIELD_TYPE_TIME:
+		switch t := value.(type) {
+		case time.Time, *time.Time:
+		case string:
+			if _, err := time.Parse(time.RFC3339, t); err != nil {
+				return fmt.Sprintf("expected RFC 3339 time, got %q", t)
+			}
+		default:
+			return fmt.Sprintf("expected time, got %T", value)
+		}
+	case FIELD_TYPE_READER:
+		if _, ok := value.(io.Reader); !ok {
+			return fmt.Sprintf("expected reader, got %T", value)
+		}
+	}
+	if f, ok := toFloat(v); ok {
+		if field.Min != nil && f < *field.Min {
+			return fmt.Sprintf("%v is less than %v", value, *field.Min)
+		}
+		if field.Max != nil && f > *field.Max {
+			return fmt.Sprintf("%v is greater than %v", value, *field.Max)
+		}
+	}
+	length := -1
+	switch v.Kind() {
+	case reflect.String:
+		length = utf8.RuneCountInString(v.String())
+	case reflect.Slice, reflect.Array:
+		length = v.Len()
+	}
+	if length >= 0 {
+		if field.MinLength != nil && length < *field.MinLength {
+			return fmt.Sprintf("length %d is less than %d", length, *field.MinLength)
+		}
+		if field.MaxLength != nil && length > *field.MaxLength {
+			return fmt.Sprintf("length %d is greater than %d", length, *field.MaxLength)
+		}
+	}
+	if v.Kind() == reflect.String {
+		s := v.String()
+		if field.patternRegexp != nil && !field.patternRegexp.MatchString(s) {
+			return fmt.Sprintf("%q does not match pattern %q", s, field.Pattern)
+		}
+		if len(field.Enum) > 0 {
+			for _, e := range field.Enum {
+				if s == e {
+					return ""
+				}
+			}
+			return fmt.Sprintf("%q is not one of %v", s, field.Enum)
+		}
+	}
+	return ""
+}
+
+//用于把数值转换为浮点数
+func toFloat(v reflect.Value) (float64, bool) {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	//json.Number等以字符串表示的数值
+	if n, ok := v.Interface().(json.Number); ok {
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+//未通过校验的条目的记录
+type Rejected struct {
+	Time    time.Time              `json:"time"`
+	Reasons []string               `json:"reasons"`
+	Item    map[string]interface{} `json:"item"`
+}
+
+//用于生成把未通过校验的条目以JSON Lines格式写入w的函数
+//无法编码为JSON的值（如io.Reader）会被替换为其类型名
+func JSONLinesSink(w io.Writer) module.RejectItem {
+	var lock sync.Mutex
+	return func(item structure.Item, reasons []string) {
+		record := Rejected{Time: time.Now(), Reasons: reasons, Item: encodable(item)}
+		data, err := json.Marshal(record)
+		if err != nil {
+			return
+		}
+		lock.Lock()
+		defer lock.Unlock()
+		w.Write(append(data, '\n'))
+	}
+}
+
+//用于把条目中无法编码为JSON的值替换为其类型名
+func encodable(item structure.Item) map[string]interface{} {
+	result := make(map[string]interface{}, len(item))
+	for k, v := range item {
+		if _, ok := v.(io.Reader); ok {
+			result[k] = fmt.Sprintf("%T", v)
+			continue
+		}
+		if _, err := json.Marshal(v); err != nil {
+			result[k] = fmt.Sprintf("%T", v)
+			continue
+		}
+		result[k] = v
+	}
+	return result
+}
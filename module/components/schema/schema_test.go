@@ -0,0 +1,109 @@
+package schema
+
+import (
+	"bytes"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/structure"
+)
+
+const testSchemaYAML = `
+name: product
+strict: true
+fields:
+  title:
+    type: string
+    required: true
+    min_length: 1
+    max_length: 10
+  sku:
+    type: string
+    pattern: '^[A-Z]{3}-\d+$'
+  price.amount:
+    type: number
+    required: true
+    min: 0
+  price.currency:
+    type: string
+    enum: [USD, EUR]
+  stock:
+    type: integer
+  tags:
+    type: array
+    max_length: 2
+  updated:
+    type: time
+`
+
+func TestValidate(t *testing.T) {
+	schema, err := ParseYAML([]byte(testSchemaYAML))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing the schema: %s", err)
+	}
+	valid := structure.Item{
+		"title":   "Phone",
+		"sku":     "ABC-12",
+		"price":   map[string]interface{}{"amount": 9.5, "currency": "USD"},
+		"stock":   3,
+		"tags":    []string{"a"},
+		"updated": time.Now(),
+		"_source": "reserved",
+	}
+	if reasons := schema.Validate(valid); len(reasons) != 0 {
+		t.Fatalf("A valid item is rejected: %v", reasons)
+	}
+	invalid := structure.Item{
+		"title":   "A very long title",
+		"sku":     "abc",
+		"price":   map[string]interface{}{"amount": -1, "currency": "CNY"},
+		"stock":   1.5,
+		"tags":    []string{"a", "b", "c"},
+		"updated": "yesterday",
+		"extra":   true,
+	}
+	reasons := schema.Validate(invalid)
+	expected := []string{"price.amount: ", "price.currency: ", "sku: ", "stock: ",
+		"tags: ", "title: ", "updated: ", "extra: unknown field"}
+	if len(reasons) != len(expected) {
+		t.Fatalf("Inconsistent reasons: expected: %d, actual: %v", len(expected), reasons)
+	}
+	for i, prefix := range expected {
+		if !strings.HasPrefix(reasons[i], prefix) {
+			t.Fatalf("The reason %q should start with %q", reasons[i], prefix)
+		}
+	}
+	reasons = schema.Validate(structure.Item{})
+	if len(reasons) != 2 || !strings.Contains(reasons[0], "required") {
+		t.Fatalf("Inconsistent reasons of missing fields: %v", reasons)
+	}
+}
+
+func TestParseError(t *testing.T) {
+	for _, data := range []string{
+		`{"name": "a"}`,
+		`{"name": "a", "fields": {"x": {"type": "date"}}}`,
+		`{"name": "a", "fields": {"x": {"pattern": "("}}}`,
+		`{"name": "a", "fields": {"x": {"min": 2, "max": 1}}}`,
+		`{"name": `,
+	} {
+		if _, err := ParseJSON([]byte(data)); err == nil {
+			t.Fatalf("No error when parsing an illegal schema: %s", data)
+		}
+	}
+}
+
+func TestJSONLinesSink(t *testing.T) {
+	var buf bytes.Buffer
+	sink := JSONLinesSink(&buf)
+	sink(structure.Item{"title": 1, "reader": strings.NewReader("x")}, []string{"title: expected string"})
+	var record Rejected
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("An error occurs when decoding the rejected record: %s", err)
+	}
+	if len(record.Reasons) != 1 || record.Item["reader"] != "*strings.Reader" {
+		t.Fatalf("Inconsistent rejected record: %+v", record)
+	}
+}
@@ -0,0 +1,240 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/kvstore"
+)
+
+//基于嵌入式键值存储的条目和页面存储
+//条目以JSON的形式按照键字段保存（存在则覆盖），页面的原始响应体按照URL保存
+//存储应被加入调度器的ModuleArgs.Closers，以便在调度器停止时关闭
+
+const (
+	//保存条目的桶
+	BUCKET_ITEMS = "items"
+	//保存页面的桶
+	BUCKET_PAGES = "pages"
+)
+
+//存储配置的类型
+type Config struct {
+	//存储文件的路径
+	Path string
+	//作为条目键的字段，为空时使用产生条目的响应的URL
+	//字段的值不是字符串时会被格式化为字符串
+	KeyField string
+	//保存页面时响应体的最大字节数，超出的部分会被截断，0代表不限制
+	MaxBodySize int64
+	//是否以只读方式打开，只读时文件必须已存在，不会截掉不完整的尾部记录
+	//可以用于查看正在被爬取过程写入的存储
+	ReadOnly bool
+}
+
+//保存的页面
+type Page struct {
+	URL        string      `json:"url"`
+	FinalURL   string      `json:"final_url"`
+	StatusCode int         `json:"status_code"`
+	Header     http.Header `json:"header,omitempty"`
+	Depth      uint32      `json:"depth"`
+	FetchedAt  time.Time   `json:"fetched_at"`
+	Truncated  bool        `json:"truncated,omitempty"`
+	Body       []byte      `json:"body"`
+}
+
+//条目和页面的存储
+type Sink struct {
+	cfg   Config
+	store *kvstore.Store
+}
+
+//用于打开存储，文件不存在时会被创建
+func Open(cfg Config) (*Sink, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("storage: empty path")
+	}
+	if cfg.MaxBodySize < 0 {
+		return nil, fmt.Errorf("storage: negative max body size")
+	}
+	var store *kvstore.Store
+	var err error
+	if cfg.ReadOnly {
+		store, err = kvstore.OpenReadOnly(cfg.Path)
+	} else {
+		store, err = kvstore.Open(cfg.Path)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("storage: %s", err)
+	}
+	return &Sink{cfg: cfg, store: store}, nil
+}
+
+//用于获取底层的键值存储
+func (s *Sink) Store() *kvstore.Store {
+	return s.store
+}
+
+//用于获取条目的键
+func (s *Sink) itemKey(item structure.Item) (string, error) {
+	if s.cfg.KeyField == "" {
+		summary, ok := item.Response()
+		if !ok || summary.URL == "" {
+			return "", fmt.Errorf("storage: no response URL in item")
+		}
+		return summary.URL, nil
+	}
+	value, ok := item[s.cfg.KeyField]
+	if !ok || value == nil {
+		return "", fmt.Errorf("storage: no key field %q in item", s.cfg.KeyField)
+	}
+	key, ok := value.(string)
+	if !ok {
+		key = fmt.Sprint(value)
+	}
+	if key == "" {
+		return "", fmt.Errorf("storage: empty key field %q in item", s.cfg.KeyField)
+	}
+	return key, nil
+}
+
+//实现条目处理函数，按照键保存条目（已存在的条目会被覆盖）后原样返回
+//可作为module.ProcessItem使用：sink.Process
+func (s *Sink) Process(item structure.Item) (structure.Item, error) {
+	key, err := s.itemKey(item)
+	if err != nil {
+		return item, err
+	}
+	data, err := json.Marshal(item)
+	if err != nil {
+		return item, fmt.Errorf("storage: couldn't encode item (key: %s): %s", key, err)
+	}
+	if err := s.store.Put(BUCKET_ITEMS, key, data); err != nil {
+		return item, fmt.Errorf("storage: couldn't save item (key: %s): %s", key, err)
+	}
+	return item, nil
+}
+
+//实现响应解析函数，按照请求的URL保存页面，不产生任何数据
+//分析器会为每个解析函数重置响应体，因此可与其他解析函数一同使用
+func (s *Sink) ParsePage(resp *structure.Response) ([]structure.Data, []error) {
+	httpResp := resp.HTTPResp()
+	if httpResp == nil || httpResp.Body == nil {
+		return nil, []error{fmt.Errorf("storage: nil HTTP response body")}
+	}
+	summary := resp.Summary()
+	page := Page{
+		URL:        summary.URL,
+		FinalURL:   summary.FinalURL,
+		StatusCode: httpResp.StatusCode,
+		Header:     httpResp.Header,
+		Depth:      resp.Depth(),
+		FetchedAt:  time.Now(),
+	}
+	if page.URL == "" {
+		return nil, []error{fmt.Errorf("storage: no response URL")}
+	}
+	var err error
+	if s.cfg.MaxBodySize > 0 {
+		page.Body, err = ioutil.ReadAll(io.LimitReader(httpResp.Body, s.cfg.MaxBodySize+1))
+		if int64(len(page.Body)) > s.cfg.MaxBodySize {
+			page.Body = page.Body[:s.cfg.MaxBodySize]
+			page.Truncated = true
+		}
+	} else {
+		page.Body, err = ioutil.ReadAll(httpResp.Body)
+	}
+	if err != nil {
+		return nil, []error{fmt.Errorf("storage: couldn't read body (URL: %s): %s", page.URL, err)}
+	}
+	data, err := json.Marshal(page)
+	if err != nil {
+		return nil, []error{fmt.Errorf("storage: couldn't encode page (URL: %s): %s", page.URL, err)}
+	}
+	if err := s.store.Put(BUCKET_PAGES, page.URL, data); err != nil {
+		return nil, []error{fmt.Errorf("storage: couldn't save page (URL: %s): %s", page.URL, err)}
+	}
+	return nil, nil
+}
+
+//用于生成保存页面的响应解析器
+func (s *Sink) RespParser(condition module.ParserCondition) module.RespParser {
+	return module.RespParser{
+		Name:      "storage",
+		Parse:     s.ParsePage,
+		Condition: condition,
+	}
+}
+
+//用于按照键获取条目，不存在时返回kvstore.ErrNotFound
+func (s *Sink) Item(key string) (structure.Item, error) {
+	data, err := s.store.Get(BUCKET_ITEMS, key)
+	if err != nil {
+		return nil, err
+	}
+	var item structure.Item
+	if err := json.Unmarshal(data, &item); err != nil {
+		return nil, fmt.Errorf("storage: couldn't decode item (key: %s): %s", key, err)
+	}
+	return item, nil
+}
+
+//用于按照URL获取页面，不存在时返回kvstore.ErrNotFound
+func (s *Sink) Page(url string) (*Page, error) {
+	data, err := s.store.Get(BUCKET_PAGES, url)
+	if err != nil {
+		return nil, err
+	}
+	page := &Page{}
+	if err := json.Unmarshal(data, page); err != nil {
+		return nil, fmt.Errorf("storage: couldn't decode page (URL: %s): %s", url, err)
+	}
+	return page, nil
+}
+
+//用于按照键的字典序遍历以prefix开头的条目，fn返回false时停止遍历
+func (s *Sink) ForEachItem(prefix string, fn func(key string, item structure.Item) bool) error {
+	var decodeErr error
+	err := s.store.ForEach(BUCKET_ITEMS, prefix, func(key string, data []byte) bool {
+		var item structure.Item
+		if decodeErr = json.Unmarshal(data, &item); decodeErr != nil {
+			decodeErr = fmt.Errorf("storage: couldn't decode item (key: %s): %s", key, decodeErr)
+			return false
+		}
+		return fn(key, item)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+//用于按照URL的字典序遍历以prefix开头的页面，fn返回false时停止遍历
+func (s *Sink) ForEachPage(prefix string, fn func(page *Page) bool) error {
+	var decodeErr error
+	err := s.store.ForEach(BUCKET_PAGES, prefix, func(key string, data []byte) bool {
+		page := &Page{}
+		if decodeErr = json.Unmarshal(data, page); decodeErr != nil {
+			decodeErr = fmt.Errorf("storage: couldn't decode page (URL: %s): %s", key, decodeErr)
+			return false
+		}
+		return fn(page)
+	})
+	if err != nil {
+		return err
+	}
+	return decodeErr
+}
+
+//用于关闭存储
+func (s *Sink) Close() error {
+	return s.store.Close()
+}
+
@@ -0,0 +1,95 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/kvstore"
+)
+
+func TestSink(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "crawl.kv")
+	sink, err := Open(Config{Path: path, KeyField: "id", MaxBodySize: 5})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sink.Process(structure.Item{"id": 1, "name": "old"})
+	sink.Process(structure.Item{"id": 1, "name": "new"})
+	if _, err := sink.Process(structure.Item{"name": "no key"}); err == nil {
+		t.Fatal("expected an error for missing key field")
+	}
+
+	httpReq, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	httpResp := &http.Response{
+		StatusCode: 200,
+		Header:     http.Header{"Content-Type": {"text/html"}},
+		Body:       ioutil.NopCloser(strings.NewReader("<html></html>")),
+		Request:    httpReq,
+	}
+	resp := structure.NewResponseBy(httpResp, structure.NewRequest(httpReq, 2))
+	if _, errs := sink.ParsePage(resp); len(errs) > 0 {
+		t.Fatal(errs)
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Open(Config{Path: filepath.Join(t.TempDir(), "missing.kv"), ReadOnly: true}); err == nil {
+		t.Fatal("expected an error when opening a missing storage read-only")
+	}
+	readOnly, err := Open(Config{Path: path, ReadOnly: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item, err := readOnly.Item("1"); err != nil || item["name"] != "new" {
+		t.Fatalf("unexpected item of the read-only storage: %v (error: %v)", item, err)
+	}
+	if _, err := readOnly.Process(structure.Item{"id": 2}); err == nil {
+		t.Fatal("expected an error when writing a read-only storage")
+	}
+	readOnly.Close()
+
+	sink, err = Open(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer sink.Close()
+	item, err := sink.Item("1")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if item["name"] != "new" {
+		t.Fatalf("expected the item to be replaced, got %v", item)
+	}
+	if n := sink.Store().Len(BUCKET_ITEMS); n != 1 {
+		t.Fatalf("expected 1 item, got %d", n)
+	}
+	page, err := sink.Page("http://example.com/a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(page.Body) != "<html" || !page.Truncated || page.Depth != 2 ||
+		page.StatusCode != 200 {
+		t.Fatalf("unexpected page: %+v", page)
+	}
+	if _, err := sink.Page("http://example.com/b"); err != kvstore.ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	//未给出键字段时使用响应的URL
+	item = structure.Item{"name": "x", structure.ITEM_KEY_RESPONSE: resp.Summary()}
+	if _, err := sink.Process(item); err != nil {
+		t.Fatal(err)
+	}
+	count := 0
+	sink.ForEachItem("http://", func(key string, item structure.Item) bool {
+		count++
+		return true
+	})
+	if count != 1 {
+		t.Fatalf("expected 1 item keyed by URL, got %d", count)
+	}
+}
@@ -0,0 +1,159 @@
+package structured
+
+import (
+	"net/url"
+	"strings"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/links"
+	"github.com/Vientiane/toolkit/xpath"
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//微数据抽取器
+type microdataExtractor struct {
+	base *url.URL
+	//带id属性的元素，用于处理itemref
+	idIndex map[string]*html.Node
+}
+
+//用于抽取微数据，每个顶层的itemscope生成一个条目
+//带itemprop的itemscope作为所在条目的属性值，以嵌套的类型和属性表示
+func extractMicrodata(root *html.Node, pageURL *url.URL) []structure.Item {
+	me := &microdataExtractor{
+		base:    links.BaseURL(root, pageURL),
+		idIndex: map[string]*html.Node{},
+	}
+	var tops []*html.Node
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			if id, ok := links.Attr(n, "id"); ok && id != "" {
+				if _, exists := me.idIndex[id]; !exists {
+					me.idIndex[id] = n
+				}
+			}
+			if hasAttr(n, "itemscope") && !hasAttr(n, "itemprop") {
+				tops = append(tops, n)
+			}
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(root)
+	var items []structure.Item
+	for _, n := range tops {
+		dataType, id, properties := me.item(n, map[*html.Node]bool{})
+		items = append(items, newItem(FORMAT_MICRODATA, dataType, id, properties))
+	}
+	return items
+}
+
+//用于抽取单个itemscope的类型、标识和属性
+//visiting用于避免itemref造成的循环引用
+func (me *microdataExtractor) item(n *html.Node,
+	visiting map[*html.Node]bool) (string, string, map[string]interface{}) {
+	visiting[n] = true
+	defer delete(visiting, n)
+	var types []string
+	if itemType, ok := links.Attr(n, "itemtype"); ok {
+		for _, t := range strings.Fields(itemType) {
+			types = append(types, shortType(t))
+		}
+	}
+	id, _ := links.Attr(n, "itemid")
+	properties := map[string]interface{}{}
+	roots := []*html.Node{}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		roots = append(roots, c)
+	}
+	if itemRef, ok := links.Attr(n, "itemref"); ok {
+		for _, ref := range strings.Fields(itemRef) {
+			if refNode, exists := me.idIndex[ref]; exists {
+				roots = append(roots, refNode)
+			}
+		}
+	}
+	for _, r := range roots {
+		me.properties(r, properties, visiting)
+	}
+	return strings.Join(types, ","), strings.TrimSpace(id), properties
+}
+
+//用于抽取节点及其后代中属于当前itemscope的属性
+func (me *microdataExtractor) properties(n *html.Node,
+	properties map[string]interface{}, visiting map[*html.Node]bool) {
+	if n.Type != html.ElementNode {
+		return
+	}
+	itemProp, isProp := links.Attr(n, "itemprop")
+	isScope := hasAttr(n, "itemscope")
+	if isProp {
+		var value interface{}
+		if isScope {
+			if visiting[n] {
+				return
+			}
+			dataType, id, nested := me.item(n, visiting)
+			nestedItem := map[string]interface{}{ITEM_KEY_PROPERTIES: nested}
+			if dataType != "" {
+				nestedItem[ITEM_KEY_TYPE] = dataType
+			}
+			if id != "" {
+				nestedItem[ITEM_KEY_ID] = id
+			}
+			value = nestedItem
+		} else {
+			value = me.value(n)
+		}
+		for _, name := range strings.Fields(itemProp) {
+			addProperty(properties, name, value)
+		}
+	}
+	if isScope {
+		//嵌套的itemscope的后代属于嵌套的条目
+		return
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		me.properties(c, properties, visiting)
+	}
+}
+
+//用于按照微数据规范获取属性值
+func (me *microdataExtractor) value(n *html.Node) string {
+	attrValue := func(name string) string {
+		value, _ := links.Attr(n, name)
+		return strings.TrimSpace(value)
+	}
+	urlValue := func(name string) string {
+		value := attrValue(name)
+		if absURL, ok := links.Resolve(me.base, value); ok {
+			return absURL
+		}
+		return value
+	}
+	switch n.DataAtom {
+	case atom.Meta:
+		return attrValue("content")
+	case atom.Audio, atom.Embed, atom.Iframe, atom.Img, atom.Source, atom.Track, atom.Video:
+		return urlValue("src")
+	case atom.A, atom.Area, atom.Link:
+		return urlValue("href")
+	case atom.Object:
+		return urlValue("data")
+	case atom.Data, atom.Meter:
+		return attrValue("value")
+	case atom.Time:
+		if hasAttr(n, "datetime") {
+			return attrValue("datetime")
+		}
+	}
+	return strings.Join(strings.Fields(xpath.Text(n)), " ")
+}
+
+func hasAttr(n *html.Node, name string) bool {
+	_, ok := links.Attr(n, name)
+	return ok
+}
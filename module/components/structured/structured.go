@@ -0,0 +1,296 @@
+package structured
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/PuerkitoBio/goquery"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"golang.org/x/net/html"
+)
+
+//结构化数据抽取
+//从HTML中抽取schema.org的JSON-LD、微数据以及OpenGraph和Twitter Card元数据，
+//每份数据生成一个形状一致的structure.Item：
+//	format     数据的格式，FORMAT_*之一
+//	type       数据的类型，如"Product"、"article"或"summary_large_image"
+//	id         数据的标识（JSON-LD的@id或微数据的itemid），没有时省略
+//	url        数据所在页面的URL
+//	properties 数据的属性，键为属性名称，同名属性出现多次时值为列表
+
+//数据的格式
+const (
+	FORMAT_JSON_LD   = "json-ld"
+	FORMAT_MICRODATA = "microdata"
+	FORMAT_OPENGRAPH = "opengraph"
+	FORMAT_TWITTER   = "twitter"
+)
+
+//条目中的字段名称
+const (
+	ITEM_KEY_FORMAT     = "format"
+	ITEM_KEY_TYPE       = "type"
+	ITEM_KEY_ID         = "id"
+	ITEM_KEY_URL        = "url"
+	ITEM_KEY_PROPERTIES = "properties"
+)
+
+//schema.org词汇表的前缀，类型会被简化为其后的名称
+var schemaPrefixes = []string{
+	"http://schema.org/",
+	"https://schema.org/",
+	"http://www.schema.org/",
+	"https://www.schema.org/",
+}
+
+//抽取选项的类型
+type Options struct {
+	//需要抽取的格式，为空代表抽取所有格式
+	Formats []string
+}
+
+func (opts Options) accept(format string) bool {
+	if len(opts.Formats) == 0 {
+		return true
+	}
+	for _, f := range opts.Formats {
+		if strings.EqualFold(f, format) {
+			return true
+		}
+	}
+	return false
+}
+
+//用于从文档树中抽取结构化数据
+//pageURL用于解析微数据中的相对链接以及填充条目的url字段，可以为nil
+//格式有误的JSON-LD块会被跳过并以错误的形式返回
+func Extract(root *html.Node, pageURL *url.URL, opts Options) ([]structure.Item, []error) {
+	doc := goquery.NewDocumentFromNode(root)
+	var items []structure.Item
+	var errs []error
+	if opts.accept(FORMAT_JSON_LD) {
+		jsonLDItems, jsonLDErrs := extractJSONLD(doc)
+		items = append(items, jsonLDItems...)
+		errs = append(errs, jsonLDErrs...)
+	}
+	if opts.accept(FORMAT_MICRODATA) {
+		items = append(items, extractMicrodata(root, pageURL)...)
+	}
+	if opts.accept(FORMAT_OPENGRAPH) {
+		if item := extractMeta(doc, FORMAT_OPENGRAPH); item != nil {
+			items = append(items, item)
+		}
+	}
+	if opts.accept(FORMAT_TWITTER) {
+		if item := extractMeta(doc, FORMAT_TWITTER); item != nil {
+			items = append(items, item)
+		}
+	}
+	if pageURL != nil {
+		for _, item := range items {
+			item[ITEM_KEY_URL] = pageURL.String()
+		}
+	}
+	return items, errs
+}
+
+//用于生成抽取结构化数据的响应解析函数
+func NewParser(opts Options) module.ParseResponse {
+	return func(resp *structure.Response) ([]structure.Data, []error) {
+		httpResp := resp.HTTPResp()
+		if httpResp == nil {
+			return nil, []error{fmt.Errorf("nil HTTP response")}
+		}
+		if httpResp.Request == nil || httpResp.Request.URL == nil {
+			return nil, []error{fmt.Errorf("nil HTTP request")}
+		}
+		reqURL := httpResp.Request.URL
+		root, err := resp.HTMLNode()
+		if err != nil {
+			return nil, []error{fmt.Errorf("%s (requestURL: %s)", err, reqURL)}
+		}
+		items, errs := Extract(root, reqURL, opts)
+		dataList := make([]structure.Data, 0, len(items))
+		for _, item := range items {
+			dataList = append(dataList, item)
+		}
+		for i, err := range errs {
+			errs[i] = fmt.Errorf("%s (requestURL: %s)", err, reqURL)
+		}
+		return dataList, errs
+	}
+}
+
+//用于生成抽取结构化数据的带匹配条件的响应解析器
+func NewRespParser(opts Options) module.RespParser {
+	return module.RespParser{
+		Name:  "structured",
+		Parse: NewParser(opts),
+		Condition: module.ParserCondition{
+			MIMETypes: []string{"text/html", "application/xhtml+xml"},
+			MinStatus: 200,
+			MaxStatus: 299,
+		},
+	}
+}
+
+//用于生成条目
+func newItem(format string, dataType string, id string,
+	properties map[string]interface{}) structure.Item {
+	item := structure.Item{
+		ITEM_KEY_FORMAT:     format,
+		ITEM_KEY_PROPERTIES: properties,
+	}
+	if dataType != "" {
+		item[ITEM_KEY_TYPE] = dataType
+	}
+	if id != "" {
+		item[ITEM_KEY_ID] = id
+	}
+	return item
+}
+
+//用于简化schema.org的类型名称
+func shortType(t string) string {
+	t = strings.TrimSpace(t)
+	for _, prefix := range schemaPrefixes {
+		if strings.HasPrefix(t, prefix) {
+			return strings.TrimPrefix(t, prefix)
+		}
+	}
+	return t
+}
+
+//用于添加属性，同名属性出现多次时值为列表
+func addProperty(properties map[string]interface{}, name string, value interface{}) {
+	existing, ok := properties[name]
+	if !ok {
+		properties[name] = value
+		return
+	}
+	if list, ok := existing.([]interface{}); ok {
+		properties[name] = append(list, value)
+		return
+	}
+	properties[name] = []interface{}{existing, value}
+}
+
+//用于抽取JSON-LD块
+//顶层为数组或带@graph时，其中的每个节点分别生成一个条目
+func extractJSONLD(doc *goquery.Document) ([]structure.Item, []error) {
+	var items []structure.Item
+	var errs []error
+	doc.Find("script").Each(func(i int, sel *goquery.Selection) {
+		scriptType, _ := sel.Attr("type")
+		scriptType = strings.ToLower(strings.TrimSpace(strings.Split(scriptType, ";")[0]))
+		if scriptType != "application/ld+json" {
+			return
+		}
+		text := strings.TrimSpace(sel.Text())
+		//去掉部分站点为兼容旧浏览器而加的注释和CDATA标记
+		for _, wrapper := range [][2]string{{"<!--", "-->"}, {"//<![CDATA[", "//]]>"}, {"<![CDATA[", "]]>"}} {
+			if strings.HasPrefix(text, wrapper[0]) && strings.HasSuffix(text, wrapper[1]) {
+				text = strings.TrimSpace(text[len(wrapper[0]) : len(text)-len(wrapper[1])])
+			}
+		}
+		if text == "" {
+			return
+		}
+		var data interface{}
+		if err := json.Unmarshal([]byte(text), &data); err != nil {
+			errs = append(errs, fmt.Errorf("invalid JSON-LD block[%d]: %s", i, err))
+			return
+		}
+		for _, node := range jsonLDNodes(data) {
+			items = append(items, jsonLDItem(node))
+		}
+	})
+	return items, errs
+}
+
+//用于获取JSON-LD数据中的顶层节点
+func jsonLDNodes(data interface{}) []map[string]interface{} {
+	var nodes []map[string]interface{}
+	switch d := data.(type) {
+	case []interface{}:
+		for _, e := range d {
+			nodes = append(nodes, jsonLDNodes(e)...)
+		}
+	case map[string]interface{}:
+		if graph, ok := d["@graph"]; ok {
+			return jsonLDNodes(graph)
+		}
+		nodes = append(nodes, d)
+	}
+	return nodes
+}
+
+//用于把JSON-LD节点转换为条目，类型有多个时以逗号分隔
+func jsonLDItem(node map[string]interface{}) structure.Item {
+	properties := map[string]interface{}{}
+	for k, v := range node {
+		if k == "@context" || k == "@type" || k == "@id" {
+			continue
+		}
+		properties[k] = v
+	}
+	var types []string
+	switch t := node["@type"].(type) {
+	case string:
+		types = append(types, shortType(t))
+	case []interface{}:
+		for _, e := range t {
+			if s, ok := e.(string); ok {
+				types = append(types, shortType(s))
+			}
+		}
+	}
+	id, _ := node["@id"].(string)
+	return newItem(FORMAT_JSON_LD, strings.Join(types, ","), id, properties)
+}
+
+//用于抽取OpenGraph或Twitter Card元数据，没有相应的元数据时返回nil
+//OpenGraph包含og:以及article:、product:等对象类型的属性，Twitter Card包含twitter:属性
+func extractMeta(doc *goquery.Document, format string) structure.Item {
+	properties := map[string]interface{}{}
+	doc.Find("meta").Each(func(i int, sel *goquery.Selection) {
+		name, _ := sel.Attr("property")
+		if name == "" {
+			name, _ = sel.Attr("name")
+		}
+		name = strings.ToLower(strings.TrimSpace(name))
+		content, exists := sel.Attr("content")
+		if name == "" || !exists || !isMetaProperty(name, format) {
+			return
+		}
+		addProperty(properties, name, strings.TrimSpace(content))
+	})
+	if len(properties) == 0 {
+		return nil
+	}
+	typeKey := "og:type"
+	if format == FORMAT_TWITTER {
+		typeKey = "twitter:card"
+	}
+	dataType, _ := properties[typeKey].(string)
+	return newItem(format, dataType, "", properties)
+}
+
+//OpenGraph中对象类型的属性前缀
+var openGraphPrefixes = []string{"og:", "article:", "book:", "profile:",
+	"music:", "video:", "product:", "fb:"}
+
+func isMetaProperty(name string, format string) bool {
+	if format == FORMAT_TWITTER {
+		return strings.HasPrefix(name, "twitter:")
+	}
+	for _, prefix := range openGraphPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,110 @@
+package structured
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+	"golang.org/x/net/html"
+)
+
+var testPage = `<html><head>
+<meta property="og:type" content="product">
+<meta property="og:title" content="Blue Shoes">
+<meta property="og:image" content="http://example.com/1.jpg">
+<meta property="og:image" content="http://example.com/2.jpg">
+<meta property="product:price:amount" content="19.99">
+<meta name="twitter:card" content="summary">
+<meta name="twitter:site" content="@example">
+<meta name="description" content="ignored">
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@type": "Product", "@id": "#shoes",
+ "name": "Blue Shoes", "offers": {"@type": "Offer", "price": "19.99"}}
+</script>
+<script type="application/ld+json">
+{"@context": "https://schema.org", "@graph": [
+  {"@type": "WebSite", "name": "Example"},
+  {"@type": ["Article", "NewsArticle"], "headline": "News"}]}
+</script>
+<script type="application/ld+json">{invalid</script>
+</head><body>
+<div itemscope itemtype="https://schema.org/Product" itemref="extra">
+  <span itemprop="name">Blue
+    Shoes</span>
+  <img itemprop="image" src="/img/shoes.jpg">
+  <a itemprop="url" href="shoes.html">link</a>
+  <div itemprop="offers" itemscope itemtype="https://schema.org/Offer">
+    <meta itemprop="price" content="19.99">
+    <time itemprop="validFrom" datetime="2020-01-01">Jan 1</time>
+  </div>
+  <span itemprop="color">blue</span><span itemprop="color">navy</span>
+</div>
+<p id="extra"><span itemprop="brand">Acme</span></p>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing HTML: %s", err)
+	}
+	pageURL, _ := url.Parse("http://example.com/shop/page.html")
+	items, errs := Extract(root, pageURL, Options{})
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d", 1, len(errs))
+	}
+	byFormat := map[string][]structure.Item{}
+	for _, item := range items {
+		if item[ITEM_KEY_URL] != pageURL.String() {
+			t.Fatalf("Inconsistent item URL: %v", item[ITEM_KEY_URL])
+		}
+		format := item[ITEM_KEY_FORMAT].(string)
+		byFormat[format] = append(byFormat[format], item)
+	}
+	jsonLD := byFormat[FORMAT_JSON_LD]
+	if len(jsonLD) != 3 || jsonLD[0][ITEM_KEY_TYPE] != "Product" ||
+		jsonLD[0][ITEM_KEY_ID] != "#shoes" || jsonLD[2][ITEM_KEY_TYPE] != "Article,NewsArticle" {
+		t.Fatalf("Inconsistent JSON-LD items: %v", jsonLD)
+	}
+	if jsonLD[0][ITEM_KEY_PROPERTIES].(map[string]interface{})["name"] != "Blue Shoes" {
+		t.Fatalf("Inconsistent JSON-LD properties: %v", jsonLD[0][ITEM_KEY_PROPERTIES])
+	}
+	microdata := byFormat[FORMAT_MICRODATA]
+	if len(microdata) != 1 || microdata[0][ITEM_KEY_TYPE] != "Product" {
+		t.Fatalf("Inconsistent microdata items: %v", microdata)
+	}
+	expected := map[string]interface{}{
+		"name":  "Blue Shoes",
+		"image": "http://example.com/img/shoes.jpg",
+		"url":   "http://example.com/shop/shoes.html",
+		"offers": map[string]interface{}{
+			ITEM_KEY_TYPE: "Offer",
+			ITEM_KEY_PROPERTIES: map[string]interface{}{
+				"price":     "19.99",
+				"validFrom": "2020-01-01",
+			},
+		},
+		"color": []interface{}{"blue", "navy"},
+		"brand": "Acme",
+	}
+	if actual := microdata[0][ITEM_KEY_PROPERTIES]; !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Inconsistent microdata properties:\nexpected: %v\nactual:   %v", expected, actual)
+	}
+	og := byFormat[FORMAT_OPENGRAPH]
+	if len(og) != 1 || og[0][ITEM_KEY_TYPE] != "product" {
+		t.Fatalf("Inconsistent OpenGraph items: %v", og)
+	}
+	ogProps := og[0][ITEM_KEY_PROPERTIES].(map[string]interface{})
+	if len(ogProps["og:image"].([]interface{})) != 2 || ogProps["product:price:amount"] != "19.99" {
+		t.Fatalf("Inconsistent OpenGraph properties: %v", ogProps)
+	}
+	twitter := byFormat[FORMAT_TWITTER]
+	if len(twitter) != 1 || twitter[0][ITEM_KEY_TYPE] != "summary" {
+		t.Fatalf("Inconsistent Twitter items: %v", twitter)
+	}
+	items, _ = Extract(root, nil, Options{Formats: []string{FORMAT_TWITTER}})
+	if len(items) != 1 || items[0][ITEM_KEY_FORMAT] != FORMAT_TWITTER {
+		t.Fatalf("Inconsistent filtered items: %v", items)
+	}
+}
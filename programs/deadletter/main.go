@@ -0,0 +1,103 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/deadletter"
+)
+
+// 检查和清理死信队列的命令行工具
+// 重新注入死信请使用爬虫程序的-reinject参数，或调用scheduler.Reinject
+var (
+	dbPath  string
+	kind    string
+	id      string
+	list    bool
+	remove  bool
+	purge   bool
+	compact bool
+)
+
+func init() {
+	flag.StringVar(&dbPath, "db", "./deadletters.kv", "The path of the dead-letter queue file")
+	flag.StringVar(&kind, "kind", "", "Only show the letters of this kind: request or item")
+	flag.StringVar(&id, "id", "", "The ID of the letter to show or delete")
+	flag.BoolVar(&list, "list", false, "List one line per letter instead of the full letters")
+	flag.BoolVar(&remove, "delete", false, "Delete the letter given by -id")
+	flag.BoolVar(&purge, "purge", false, "Delete all letters of the kind given by -kind")
+	flag.BoolVar(&compact, "compact", false, "Reclaim the space of deleted letters")
+}
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tdeadletter [flags] \n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+	if kind != "" && kind != deadletter.KIND_REQUEST && kind != deadletter.KIND_ITEM {
+		fmt.Fprintf(os.Stderr, "Unknown kind: %s\n", kind)
+		os.Exit(2)
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when opening dead-letter queue: %s\n", err)
+		os.Exit(1)
+	}
+	queue, err := deadletter.Open(dbPath)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when opening dead-letter queue: %s\n", err)
+		os.Exit(1)
+	}
+	defer queue.Close()
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	switch {
+	case id != "" && remove:
+		err = queue.Delete(id)
+	case id != "":
+		var letter *deadletter.Letter
+		if letter, err = queue.Get(id); err == nil {
+			encoder.Encode(letter)
+		}
+	case purge:
+		var letters []*deadletter.Letter
+		if letters, err = queue.List(kind); err == nil {
+			for _, letter := range letters {
+				if err = queue.Delete(letter.ID); err != nil {
+					break
+				}
+			}
+			fmt.Printf("Deleted %d letters.\n", len(letters))
+		}
+	case list:
+		err = queue.ForEach(kind, func(letter *deadletter.Letter) bool {
+			target := ""
+			if letter.Request != nil {
+				target = letter.Request.Method + " " + letter.Request.URL
+			} else if summary, ok := letter.Item[structure.ITEM_KEY_RESPONSE].(map[string]interface{}); ok {
+				target = fmt.Sprint(summary["url"])
+			}
+			fmt.Printf("%s\t%s\t%s\t%d errors\t%s\n", letter.ID, letter.Kind, letter.MID,
+				len(letter.Errors), target)
+			return true
+		})
+	default:
+		err = queue.ForEach(kind, func(letter *deadletter.Letter) bool {
+			return encoder.Encode(letter) == nil
+		})
+	}
+	if err == nil && compact {
+		err = queue.Store().Compact()
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when accessing dead-letter queue: %s\n", err)
+		os.Exit(1)
+	}
+}
@@ -6,9 +6,16 @@ import (
 	"github.com/Vientiane/module/components/downloader"
 	"github.com/Vientiane/module/components/analyzer"
 	"github.com/Vientiane/module/components/pipeline"
+	"github.com/Vientiane/module/components/schema"
 )
 var snGen = generator.NewSNGenertor(1, 0);
 
+//响应体大小的限制，下载器和分析器共用
+var bodyLimit = module.BodyLimit{
+	MaxSize:        32 << 20,
+	SpillThreshold: 4 << 20,
+}
+
 //用于获取下载器列表
 func GetDownloaders(number uint8)([]module.Downloader,error) {
 	downloaders := []module.Downloader{}
@@ -24,6 +31,7 @@ func GetDownloaders(number uint8)([]module.Downloader,error) {
 		if err != nil {
 			return downloaders, err
 		}
+		d.SetBodyLimit(bodyLimit)
 		downloaders = append(downloaders, d)
 	}
 	return downloaders, nil
@@ -41,16 +49,33 @@ func GetAnalyzers(number uint8)([]module.Analyzer,error){
 		if err != nil {
 			return analyzers, err
 		}
-		a, err := analyzer.NewAnalyzer(mid, module.CalculateScoreSimple, genResponseParsers())
+		a, err := analyzer.NewAnalyzerWithRoutes(mid, module.CalculateScoreSimple, genResponseParsers())
 		if err != nil {
 			return analyzers, err
 		}
+		a.SetTranscoding(true)
+		a.SetBodyLimit(bodyLimit)
 		analyzers = append(analyzers, a)
 	}
 	return analyzers, nil
 }
 
-//用于获取分析器列表
+//图片条目的模式，与条目处理函数期望的字段一致
+var pictureSchema = func() *schema.Schema {
+	s := &schema.Schema{
+		Name: "picture",
+		Fields: map[string]*schema.Field{
+			"reader": {Type: schema.FIELD_TYPE_READER, Required: true},
+			"name":   {Type: schema.FIELD_TYPE_STRING, Required: true},
+		},
+	}
+	if err := s.Check(); err != nil {
+		panic(err)
+	}
+	return s
+}()
+
+//用于获取条目处理管道列表
 func GetPipelines(number uint8, dirPath string) ([]module.Pipeline, error) {
 	pipelines := []module.Pipeline{}
 	if number == 0 {
@@ -68,6 +93,7 @@ func GetPipelines(number uint8, dirPath string) ([]module.Pipeline, error) {
 			return pipelines, err
 		}
 		a.SetFailFast(true)
+		a.SetValidator(pictureSchema)
 		pipelines = append(pipelines, a)
 	}
 	return pipelines, nil
@@ -7,15 +7,24 @@ import (
 	"path"
 	"fmt"
 	"strings"
-	"github.com/PuerkitoBio/goquery"
-	"net/url"
+	"github.com/Vientiane/toolkit/links"
 )
 
-func genResponseParsers()[]module.ParseResponse{
+//用于发现页面和图片的链接抽取选项
+var linkOptions = &links.Options{
+	Tags:         []string{"a", "area", "frame", "iframe", "img", "source"},
+	SkipNoFollow: true,
+}
+
+//用于生成响应解析器列表
+//响应的状态码和内容类型由分析器按照匹配条件检查
+func genResponseParsers()[]module.RespParser{
 	//分析函数用来发现的请求
-	parserLink:=func(httpResp *http.Response,respDepth uint32)([]structure.Data,[]error) {
+	parserLink:=func(resp *structure.Response)([]structure.Data,[]error) {
 		dataList := make([]structure.Data, 0)
 		//检查响应
+		httpResp := resp.HTTPResp()
+		respDepth := resp.Depth()
 		if httpResp == nil {
 			return nil, []error{fmt.Errorf("nil HTTP response")}
 		}
@@ -24,94 +33,34 @@ func genResponseParsers()[]module.ParseResponse{
 			return nil, []error{fmt.Errorf("nil HTTP request")}
 		}
 		reqUrl := httpReq.URL
-		if httpResp.StatusCode != 200 {
-			err := fmt.Errorf("unsupported status code %d (requestURL: %s)",
-				httpResp.StatusCode, reqUrl)
-			return nil, []error{err}
-		}
 		body := httpResp.Body
 		if body == nil {
 			err := fmt.Errorf("nil HTTP response body (requestURL: %s)",
 				reqUrl)
 			return nil, []error{err}
 		}
-		//检查Http响应头的内容类型
-		var matchedContentType bool
-		if httpResp.Header != nil {
-			contentTypes := httpResp.Header["Content-Type"]
-			for _, ct := range contentTypes {
-				if strings.HasPrefix(ct, "text/html") {
-					matchedContentType = true
-					break
-				}
-			}
-		}
-		if !matchedContentType {
-			return dataList, nil
-		}
-		//解析http响应体
-		doc, err := goquery.NewDocumentFromReader(body)
+		//解析http响应体，文档树由所有解析函数共享
+		root, err := resp.HTMLNode()
 		if err != nil {
 			return dataList, []error{err}
 		}
 		errs := make([]error, 0)
-		//查找a标签并提取地址
-		doc.Find("a").Each(func(index int, sel *goquery.Selection) {
-			href, exists := sel.Attr("href")
-			if !exists || href == "" || href == "#" || href == "/" {
-				return
-			}
-			href = strings.TrimSpace(href)
-			lowerHref := strings.ToLower(href)
-			if href == "" || strings.HasPrefix(lowerHref, "javascript") {
-				return
-			}
-			aURL, err := url.Parse(lowerHref)
-			if err != nil {
-				fmt.Printf("An error occurs when parsing attribute %q in tag %q : %s (href: %s)",
-					err, "href", "a", href)
-				return
-			}
-			if aURL.IsAbs() {
-				aURL = reqUrl.ResolveReference(aURL)
-			}
-			httpReq, err := http.NewRequest("GET", aURL.String(), nil)
-			if err != nil {
-				errs = append(errs, err)
-			} else {
-				req := structure.NewRequest(httpReq, respDepth)
-				dataList = append(dataList, req)
-			}
-		})
-		// 查找img标签并提取地址。
-		doc.Find("img").Each(func(index int, sel *goquery.Selection) {
-			imgSrc, exists := sel.Attr("src")
-			if !exists || imgSrc == "" || imgSrc == "#" || imgSrc == "/" {
-				return
-			}
-			fmt.Println("-----------------------",imgSrc)
-			imgSrc = strings.TrimSpace(imgSrc)
-			imgURL, err := url.Parse(imgSrc)
+		//查找页面和图片的地址，相对地址会基于<base href>或请求URL解析
+		for _, link := range links.Extract(root, reqUrl, linkOptions) {
+			httpReq, err := http.NewRequest("GET", link.URL, nil)
 			if err != nil {
 				errs = append(errs, err)
-				return
-			}
-			if !imgURL.IsAbs() {
-				imgURL = reqUrl.ResolveReference(imgURL)
+				continue
 			}
-			httpReq, err := http.NewRequest("GET", imgURL.String(), nil)
-			if err != nil {
-				errs = append(errs, err)
-			} else {
-				req := structure.NewRequest(httpReq, respDepth)
-				dataList = append(dataList, req)
-			}
-		})
+			req := structure.NewRequest(httpReq, respDepth)
+			dataList = append(dataList, req)
+		}
 		return dataList, errs
 	}
 	//分析函数用来对发现的图片进行处理
-	parseImage:= func(httpResp *http.Response,respDepth uint32) ([]structure.Data,[]error) {
+	parseImage:= func(resp *structure.Response) ([]structure.Data,[]error) {
 		// 检查响应。
+		httpResp := resp.HTTPResp()
 		if httpResp == nil {
 			return nil, []error{fmt.Errorf("nil HTTP response")}
 		}
@@ -120,11 +69,6 @@ func genResponseParsers()[]module.ParseResponse{
 			return nil, []error{fmt.Errorf("nil HTTP request")}
 		}
 		reqUrl := httpReq.URL
-		if httpResp.StatusCode != 200 {
-			err := fmt.Errorf("unsupported status code %d (requestURL: %s)",
-				httpResp.StatusCode, reqUrl)
-			return nil, []error{err}
-		}
 		httpRespBody := httpResp.Body
 		if httpRespBody == nil {
 			err := fmt.Errorf("nil HTTP response body (requestURL: %s)",
@@ -164,5 +108,24 @@ func genResponseParsers()[]module.ParseResponse{
 		return dataList, nil
 	}
 
-	return []module.ParseResponse{parserLink,parseImage}
+	return []module.RespParser{
+		{
+			Name:  "link",
+			Parse: parserLink,
+			Condition: module.ParserCondition{
+				MIMETypes: []string{"text/html"},
+				MinStatus: 200,
+				MaxStatus: 200,
+			},
+		},
+		{
+			Name:  "image",
+			Parse: parseImage,
+			Condition: module.ParserCondition{
+				MIMETypes: []string{"image/*"},
+				MinStatus: 200,
+				MaxStatus: 200,
+			},
+		},
+	}
 }
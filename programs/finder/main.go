@@ -10,6 +10,10 @@ import (
 	"time"
 	"github.com/Vientiane/programs/finder/monitor"
 	"net/http"
+	"github.com/Vientiane/module/components/downloader"
+	"github.com/Vientiane/toolkit/warc"
+	"github.com/Vientiane/module/components/dedup"
+	"github.com/Vientiane/toolkit/deadletter"
 )
 
 //一个简单的爬去图片的爬虫
@@ -18,6 +22,12 @@ var(
 	domains string
 	depth uint
 	dirPath string
+	useSitemap bool
+	warcPath string
+	useDedup bool
+	deadLetterPath string
+	reinject bool
+	maxRetries uint
 )
 
 func init(){
@@ -30,6 +40,17 @@ func init(){
 	flag.UintVar(&depth,"depth",6,"the depth for crawling")
 	flag.StringVar(&dirPath,"dir","./pictures",
 		"The path which you want to save the image files")
+	flag.BoolVar(&useSitemap,"sitemap",false,
+		"Seed the crawl with the URLs in the sitemaps declared in robots.txt")
+	flag.BoolVar(&useDedup,"dedup",false,
+		"Skip the pages and images whose content has been seen under other URLs")
+	flag.StringVar(&warcPath,"warc","",
+		"The path prefix of the WARC files recording the raw HTTP exchanges, empty for no recording")
+	flag.StringVar(&deadLetterPath,"deadletters","",
+		"The path of the dead-letter queue keeping the failed requests and items, empty for dropping them")
+	flag.BoolVar(&reinject,"reinject",false,
+		"Reinject the letters in the dead-letter queue after starting")
+	flag.UintVar(&maxRetries,"retries",2,"the max retries for the failed downloads")
 }
 
 func Usage(){
@@ -57,6 +78,7 @@ func main() {
 	requestArgs := scheduler.RequestArgs{
 		AcceptedDomains: acceptedDomains,
 		MaxDepth:        uint32(depth),
+		MaxRetries:      uint32(maxRetries),
 	}
 
 	dataArgs := scheduler.DataArgs{
@@ -80,6 +102,13 @@ func main() {
 		fmt.Printf("An error occurs when creating analyzers: %s", err)
 		os.Exit(1)
 	}
+	//按照内容去重，避免重复保存以不同URL提供的同一张图片
+	if useDedup {
+		deduplicator := dedup.New(dedup.Config{Exact: true, NearDuplicate: true})
+		for _, a := range analyzers {
+			a.SetDeduplicator(deduplicator)
+		}
+	}
 	pipelines, err := internal.GetPipelines(1, dirPath)
 	if err != nil {
 		fmt.Printf("An error occurs when creating pipelines: %s", err)
@@ -90,6 +119,33 @@ func main() {
 		Analyzers:   analyzers,
 		Pipelines:   pipelines,
 	}
+	//记录原始的HTTP交互
+	if warcPath != "" {
+		recorder, err := downloader.NewWARCRecorder(warc.Config{
+			Path:    warcPath,
+			MaxSize: 1 << 30,
+			Gzip:    true,
+		})
+		if err != nil {
+			fmt.Printf("An error occurs when creating WARC recorder: %s", err)
+			os.Exit(1)
+		}
+		for _, d := range downloaders {
+			d.SetRecorder(recorder)
+		}
+		moduleArgs.Closers = append(moduleArgs.Closers, recorder)
+	}
+	//保存处理失败的请求和条目
+	var deadLetters *deadletter.Queue
+	if deadLetterPath != "" {
+		deadLetters, err = deadletter.Open(deadLetterPath)
+		if err != nil {
+			fmt.Printf("An error occurs when opening dead-letter queue: %s", err)
+			os.Exit(1)
+		}
+		moduleArgs.DeadLetters = deadLetters
+		moduleArgs.Closers = append(moduleArgs.Closers, deadLetters)
+	}
 	err = sched.Init(requestArgs, dataArgs, moduleArgs)
 	if err != nil {
 		fmt.Printf("An error occurs when initializing scheduler: %s", err)
@@ -113,6 +169,28 @@ func main() {
 	if err != nil {
 		fmt.Printf("An error occurs when starting scheduler: %s", err)
 	}
+	//从站点地图中添加种子请求
+	if err == nil && useSitemap {
+		sitemapClient := &http.Client{Timeout: 30 * time.Second}
+		seeds, errs := scheduler.SitemapSeeds(sitemapClient, firstUrl)
+		for _, e := range errs {
+			fmt.Printf("An error occurs when reading sitemaps: %s\n", e)
+		}
+		n, err := sched.Seed(seeds)
+		if err != nil {
+			fmt.Printf("An error occurs when seeding scheduler: %s\n", err)
+		} else {
+			fmt.Printf("Seeded %d of %d URLs from sitemaps.\n", n, len(seeds))
+		}
+	}
+	//重新注入之前处理失败的请求和条目
+	if err == nil && reinject && deadLetters != nil {
+		n, errs := scheduler.Reinject(sched, deadLetters)
+		for _, e := range errs {
+			fmt.Printf("An error occurs when reinjecting dead letters: %s\n", e)
+		}
+		fmt.Printf("Reinjected %d dead letters.\n", n)
+	}
 	//等待监控结束
 	a:= <-checkCountChan
 	fmt.Print(a)
@@ -175,7 +175,7 @@ func reportError(sched scheduler.Scheduler,stopNotifier context.Context){
 			err, ok := <-errChan
 			if ok {
 				errMsg := fmt.Sprintf("Received an error from error channel: %s", err)
-				fmt.Printf(errMsg)
+				fmt.Print(errMsg)
 			}
 			time.Sleep(time.Microsecond)
 		}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/Vientiane/module/components/storage"
+	"github.com/Vientiane/structure"
+)
+
+// 查询条目和页面存储的命令行工具
+var (
+	dbPath  string
+	bucket  string
+	key     string
+	prefix  string
+	list    bool
+	rawBody bool
+	compact bool
+)
+
+func init() {
+	flag.StringVar(&dbPath, "db", "./crawl.kv", "The path of the storage file")
+	flag.StringVar(&bucket, "bucket", storage.BUCKET_ITEMS,
+		"The bucket to query: items or pages")
+	flag.StringVar(&key, "key", "", "The item key or page URL to get")
+	flag.StringVar(&prefix, "prefix", "", "Only list keys with this prefix")
+	flag.BoolVar(&list, "list", false, "List the keys instead of the values")
+	flag.BoolVar(&rawBody, "body", false, "Print the raw body of the page given by -key")
+	flag.BoolVar(&compact, "compact", false,
+		"Reclaim the space of overwritten records (opens the storage writable, never use it while a crawl is running)")
+}
+
+func Usage() {
+	fmt.Fprintf(os.Stderr, "Usage of %s:\n", os.Args[0])
+	fmt.Fprintf(os.Stderr, "\tstorage [flags] \n")
+	fmt.Fprintf(os.Stderr, "Flags:\n")
+	flag.PrintDefaults()
+}
+
+func main() {
+	flag.Usage = Usage
+	flag.Parse()
+	os.Exit(run())
+}
+
+//执行查询并返回退出码，使延迟的关闭操作在退出之前执行
+func run() int {
+	if bucket != storage.BUCKET_ITEMS && bucket != storage.BUCKET_PAGES {
+		fmt.Fprintf(os.Stderr, "Unknown bucket: %s\n", bucket)
+		return 2
+	}
+	if _, err := os.Stat(dbPath); err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when opening storage: %s\n", err)
+		return 1
+	}
+	//只有压缩时才需要写入，查询时以只读方式打开，以免截掉正在爬取的进程写入的数据
+	sink, err := storage.Open(storage.Config{Path: dbPath, ReadOnly: !compact})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when opening storage: %s\n", err)
+		return 1
+	}
+	defer sink.Close()
+	if compact {
+		if err := sink.Store().Compact(); err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurs when compacting storage: %s\n", err)
+			return 1
+		}
+	}
+	encoder := json.NewEncoder(os.Stdout)
+	encoder.SetIndent("", "  ")
+	switch {
+	case key != "" && bucket == storage.BUCKET_PAGES:
+		page, err := sink.Page(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurs when getting page: %s\n", err)
+			return 1
+		}
+		if rawBody {
+			os.Stdout.Write(page.Body)
+			return 0
+		}
+		encoder.Encode(page)
+	case key != "":
+		item, err := sink.Item(key)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "An error occurs when getting item: %s\n", err)
+			return 1
+		}
+		encoder.Encode(item)
+	case list:
+		for _, k := range sink.Store().Keys(bucket, prefix) {
+			fmt.Println(k)
+		}
+	case bucket == storage.BUCKET_PAGES:
+		err = sink.ForEachPage(prefix, func(page *storage.Page) bool {
+			//列出页面时不输出响应体
+			page.Body = nil
+			return encoder.Encode(page) == nil
+		})
+	default:
+		err = sink.ForEachItem(prefix, func(key string, item structure.Item) bool {
+			return encoder.Encode(item) == nil
+		})
+	}
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "An error occurs when reading storage: %s\n", err)
+		return 1
+	}
+	return 0
+}
@@ -1,8 +1,11 @@
 package scheduler
 
 import (
+	"io"
 	"github.com/Vientiane/module"
 	"github.com/Vientiane/errors"
+	"github.com/Vientiane/toolkit/recrawl"
+	"github.com/Vientiane/toolkit/deadletter"
 )
 
 //参数容器的接口类型
@@ -17,6 +20,9 @@ type RequestArgs struct {
 	AcceptedDomains []string `json:"accepted_primary_domains"`
 	//代表爬虫爬取的最大深度
 	MaxDepth uint32 `json:"max_depth"`
+	//代表下载失败的请求的最大重试次数，0代表不重试
+	//重试次数用尽的请求会被放入死信队列
+	MaxRetries uint32 `json:"max_retries"`
 }
 
 func(args *RequestArgs)Check()error {
@@ -33,7 +39,22 @@ type ModuleArgs struct {
 	//分析器列表
 	Analyzers []module.Analyzer
 	//条目处理管道列表
+	//未给出分支时，条目会被发送到按照负载均衡策略选出的一个条目处理管道
 	Pipelines []module.Pipeline
+	//条目分支列表，给出时条目会按照分支的匹配条件发送到各分支的条目处理管道
+	Branches []Branch
+	//需要在调度器停止时关闭的资源列表，如条目导出器
+	//调度器停止时会按照给出的顺序依次关闭
+	Closers []io.Closer
+	//增量爬取的状态跟踪器，nil代表每次都完整地爬取
+	//给出时深度大于0且未到访问时间的请求会被忽略，内容未变化的页面不会产生条目
+	//跟踪器不会被自动关闭，应同时加入Closers
+	Recrawl *recrawl.Tracker
+	//死信队列，nil代表丢弃处理失败的请求和条目
+	//给出时重试次数用尽的请求和快速失败的条目处理管道中处理失败的条目会连同错误被放入死信队列
+	//未启用快速失败的管道已把失败的条目交给了之后的条目处理函数，重新注入会导致重复处理，因此不会放入死信队列
+	//死信队列不会被自动关闭，应同时加入Closers
+	DeadLetters *deadletter.Queue
 }
 
 func(args *ModuleArgs)Check()error {
@@ -43,9 +64,14 @@ func(args *ModuleArgs)Check()error {
 	if len(args.Analyzers) == 0 {
 		return errors.NewIllegalParameterError("empty analyzer list")
 	}
-	if len(args.Pipelines) == 0 {
+	if len(args.Pipelines) == 0 && len(args.Branches) == 0 {
 		return errors.NewIllegalParameterError("empty pipeline list")
 	}
+	for i := range args.Branches {
+		if err := args.Branches[i].Check(); err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
@@ -106,6 +132,9 @@ func (args *RequestArgs) Same(another *RequestArgs) bool {
 	if another.MaxDepth != args.MaxDepth {
 		return false
 	}
+	if another.MaxRetries != args.MaxRetries {
+		return false
+	}
 	anotherDomains := another.AcceptedDomains
 	anotherDomainsLen := len(anotherDomains)
 	if anotherDomainsLen != len(args.AcceptedDomains) {
@@ -126,6 +155,9 @@ type ModuleArgsSummary struct {
 	DownloaderListSize int `json:"downloader_list_size"`
 	AnalyzerListSize   int `json:"analyzer_List_size"`
 	PipelineListSize   int `json:"pipeline_list_size"`
+	BranchListSize     int `json:"branch_list_size"`
+	Incremental        bool `json:"incremental"`
+	DeadLetters        bool `json:"dead_letters"`
 }
 
 
@@ -134,6 +166,9 @@ func (args *ModuleArgs) Summary() ModuleArgsSummary {
 		DownloaderListSize: len(args.Downloaders),
 		AnalyzerListSize:   len(args.Analyzers),
 		PipelineListSize:   len(args.Pipelines),
+		BranchListSize:     len(args.Branches),
+		Incremental:        args.Recrawl != nil,
+		DeadLetters:        args.DeadLetters != nil,
 	}
 }
 
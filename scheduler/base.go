@@ -2,6 +2,7 @@ package scheduler
 
 import (
 	"net/http"
+	"github.com/Vientiane/structure"
 )
 
 
@@ -11,6 +12,14 @@ type Scheduler interface{
 	Init(requestArgs RequestArgs,dataArgs DataArgs,moduleArgs ModuleArgs)(err error)
 	//用于启动调度器并执行爬取过程
 	Start(firstHTTPReq *http.Request)(err error)
+	//用于在调度器启动后添加种子请求，种子请求的深度总是0
+	//请求会按优先级从高到低同步地放入请求缓冲池，请求缓冲池满时会阻塞
+	//请求缓冲池只有一个缓冲器时顺序是严格的，返回值代表被接受的请求数
+	Seed(reqs []*structure.Request)(int,error)
+	//用于在调度器启动后重新注入之前处理失败的请求和条目
+	//请求保持原有的深度并跳过URL去重和增量爬取的访问时间检查，条目直接交给条目处理管道
+	//返回值代表被接受的请求和条目数，以及未被接受的请求和条目的原因
+	Inject(reqs []*structure.Request, items []structure.Item)(int,[]error)
 	//停止调度器的运行
 	Stop()(err error)
 	//用于获取调度器的状态
@@ -0,0 +1,188 @@
+package scheduler
+
+import (
+	"fmt"
+	"sync"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+)
+
+//条目分支的类型
+//条目会被发送到所有与之匹配的分支，即扇出；每个分支内按照负载均衡策略选出一个条目处理管道
+type Branch struct {
+	//分支的名称，用于错误信息
+	Name string
+	//用于判断条目是否进入此分支，为nil代表所有条目都进入此分支
+	Match func(item structure.Item) bool
+	//此分支的条目处理管道列表
+	Pipelines []module.Pipeline
+}
+
+//用于检查分支是否有效
+func (branch *Branch) Check() error {
+	if len(branch.Pipelines) == 0 {
+		return errors.NewIllegalParameterError(
+			fmt.Sprintf("empty pipeline list of branch %q", branch.Name))
+	}
+	for i, p := range branch.Pipelines {
+		if p == nil {
+			return errors.NewIllegalParameterError(
+				fmt.Sprintf("nil pipeline[%d] of branch %q", i, branch.Name))
+		}
+	}
+	return nil
+}
+
+//用于生成按照条目中某字段的值进行匹配的函数
+//字段的值等于types中的任意一个时匹配
+func MatchItemType(field string, types ...string) func(item structure.Item) bool {
+	typeSet := make(map[string]bool, len(types))
+	for _, t := range types {
+		typeSet[t] = true
+	}
+	return func(item structure.Item) bool {
+		value, ok := item[field]
+		if !ok {
+			return false
+		}
+		return typeSet[fmt.Sprint(value)]
+	}
+}
+
+//用于从条目处理管道列表中按照负载均衡策略选出一个
+func selectPipeline(pipelines []module.Pipeline) module.Pipeline {
+	var selected module.Pipeline
+	minScore := uint64(0)
+	for _, p := range pipelines {
+		module.SetScore(p)
+		score := p.Score()
+		if selected == nil || score < minScore {
+			selected = p
+			minScore = score
+		}
+	}
+	return selected
+}
+
+//用于把条目发送到所有与之匹配的分支
+//匹配多个分支时，各分支并发处理条目的深拷贝，以免相互影响
+//深拷贝只复制映射和切片，其他引用类型的值（如io.Reader和指针）仍然共享，分支不应修改它们
+func (sched *vientianeScheduler) pickBranches(item structure.Item) {
+	var matched []*Branch
+	for i := range sched.branches {
+		branch := &sched.branches[i]
+		if branch.Match == nil || branch.Match(item) {
+			matched = append(matched, branch)
+		}
+	}
+	if len(matched) == 0 {
+		errMsg := fmt.Sprintf("no branch matches the item (URL: %s)", itemURL(item))
+		sendError(errors.New(errMsg), "", sched.errorBufferPool)
+		return
+	}
+	send := func(branch *Branch, item structure.Item) {
+		pipeline := selectPipeline(branch.Pipelines)
+		errs := pipeline.Send(item)
+		for _, err := range errs {
+			sendError(err, pipeline.ID(), sched.errorBufferPool)
+		}
+		if len(errs) > 0 && pipeline.FailFast() {
+			sched.buryItem(item, pipeline.ID(), errs)
+		}
+	}
+	if len(matched) == 1 {
+		send(matched[0], item)
+		return
+	}
+	var wg sync.WaitGroup
+	wg.Add(len(matched))
+	for _, branch := range matched {
+		itemCopy := copyItem(item)
+		go func(branch *Branch, item structure.Item) {
+			defer wg.Done()
+			sched.protect(errors.ERROR_TYPE_PIPELINE, itemURL(item), func() {
+				send(branch, item)
+			})
+		}(branch, itemCopy)
+	}
+	wg.Wait()
+}
+
+//用于深拷贝条目
+func copyItem(item structure.Item) structure.Item {
+	itemCopy := make(structure.Item, len(item))
+	for k, v := range item {
+		itemCopy[k] = copyValue(v)
+	}
+	return itemCopy
+}
+
+//用于深拷贝条目中的值，只复制映射和切片
+func copyValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case structure.Item:
+		return copyItem(v)
+	case map[string]interface{}:
+		return map[string]interface{}(copyItem(structure.Item(v)))
+	case []interface{}:
+		vCopy := make([]interface{}, len(v))
+		for i, e := range v {
+			vCopy[i] = copyValue(e)
+		}
+		return vCopy
+	case map[string]string:
+		vCopy := make(map[string]string, len(v))
+		for k, e := range v {
+			vCopy[k] = e
+		}
+		return vCopy
+	case []string:
+		return append([]string(nil), v...)
+	case []byte:
+		return append([]byte(nil), v...)
+	default:
+		return value
+	}
+}
+
+//用于获取所有不重复的条目处理管道，包括各分支中的条目处理管道
+func allPipelines(moduleArgs ModuleArgs) []module.Pipeline {
+	var pipelines []module.Pipeline
+	seen := map[module.MID]bool{}
+	add := func(p module.Pipeline) {
+		if p == nil || seen[p.ID()] {
+			return
+		}
+		seen[p.ID()] = true
+		pipelines = append(pipelines, p)
+	}
+	for _, p := range moduleArgs.Pipelines {
+		add(p)
+	}
+	for _, branch := range moduleArgs.Branches {
+		for _, p := range branch.Pipelines {
+			add(p)
+		}
+	}
+	return pipelines
+}
+
+//用于计算处理条目的协程数量，使每个条目处理管道都能达到其并发上限
+//并发上限为0的条目处理管道只分配一个协程，因此实际上最多同时处理一个条目
+//协程数量只在调度器初始化时计算，之后修改并发上限不会改变协程数量
+func pickWorkerNumber(pipelines []module.Pipeline) int {
+	var number int
+	for _, p := range pipelines {
+		if concurrency := p.Concurrency(); concurrency > 0 {
+			number += int(concurrency)
+		} else {
+			number++
+		}
+	}
+	if number == 0 {
+		number = 1
+	}
+	return number
+}
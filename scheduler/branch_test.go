@@ -0,0 +1,111 @@
+package scheduler
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/module/components/pipeline"
+	"github.com/Vientiane/structure"
+)
+
+func TestPickBranches(t *testing.T) {
+	var lock sync.Mutex
+	received := map[string][]structure.Item{}
+	genPipeline := func(t *testing.T, name string, sn uint64) module.Pipeline {
+		mid, _ := module.GenMID(module.TYPE_PIPELINE, sn, nil)
+		p, err := pipeline.NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+			func(item structure.Item) (structure.Item, error) {
+				lock.Lock()
+				received[name] = append(received[name], item)
+				lock.Unlock()
+				//修改条目不应影响其他分支
+				item["handled_by"] = name
+				return item, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("An error occurs when creating a pipeline: %s", err)
+		}
+		return p
+	}
+	disk := genPipeline(t, "disk", 1)
+	index := genPipeline(t, "index", 2)
+	images := genPipeline(t, "images", 3)
+	moduleArgs := ModuleArgs{
+		Branches: []Branch{
+			{Name: "disk", Pipelines: []module.Pipeline{disk}},
+			{Name: "index", Match: MatchItemType("type", "article"),
+				Pipelines: []module.Pipeline{index}},
+			{Name: "images", Match: MatchItemType("type", "image"),
+				Pipelines: []module.Pipeline{images, images}},
+		},
+	}
+	for _, branch := range moduleArgs.Branches {
+		if err := branch.Check(); err != nil {
+			t.Fatalf("An error occurs when checking branch: %s", err)
+		}
+	}
+	if pipelines := allPipelines(moduleArgs); len(pipelines) != 3 {
+		t.Fatalf("Inconsistent pipeline number: expected: %d, actual: %d", 3, len(pipelines))
+	}
+	sched := &vientianeScheduler{branches: moduleArgs.Branches}
+	sched.resetContext()
+	sched.pickOne(structure.Item{"type": "article", "title": "a"})
+	sched.pickOne(structure.Item{"type": "image", "name": "b"})
+	if len(received["disk"]) != 2 || len(received["index"]) != 1 || len(received["images"]) != 1 {
+		t.Fatalf("Inconsistent received items: %v", received)
+	}
+	if received["index"][0]["title"] != "a" || received["images"][0]["name"] != "b" {
+		t.Fatalf("Inconsistent received items: %v", received)
+	}
+	if handledBy := received["disk"][0]["handled_by"]; handledBy != "disk" {
+		t.Fatalf("Branches should receive copies of the item: %v", handledBy)
+	}
+	invalid := Branch{Name: "empty"}
+	if err := invalid.Check(); err == nil {
+		t.Fatalf("No error when checking a branch without pipelines")
+	}
+}
+
+//需要使用-race运行
+func TestPickBranchesNestedValues(t *testing.T) {
+	genPipeline := func(t *testing.T, name string, sn uint64) module.Pipeline {
+		mid, _ := module.GenMID(module.TYPE_PIPELINE, sn, nil)
+		p, err := pipeline.NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+			func(item structure.Item) (structure.Item, error) {
+				//修改嵌套的映射和切片不应影响其他分支
+				meta := item["meta"].(map[string]interface{})
+				meta["handled_by"] = name
+				tags := item["tags"].([]interface{})
+				tags[0] = name
+				item["tags"] = append(tags, name)
+				return item, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("An error occurs when creating a pipeline: %s", err)
+		}
+		return p
+	}
+	branches := []Branch{
+		{Name: "disk", Pipelines: []module.Pipeline{genPipeline(t, "disk", 1)}},
+		{Name: "index", Pipelines: []module.Pipeline{genPipeline(t, "index", 2)}},
+		{Name: "images", Pipelines: []module.Pipeline{genPipeline(t, "images", 3)}},
+	}
+	sched := &vientianeScheduler{branches: branches}
+	sched.resetContext()
+	item := structure.Item{
+		"meta": map[string]interface{}{"depth": 1},
+		"tags": []interface{}{"origin", "news"},
+	}
+	for i := 0; i < 10; i++ {
+		sched.pickOne(item)
+	}
+	if _, ok := item["meta"].(map[string]interface{})["handled_by"]; ok {
+		t.Fatalf("The original item should not be modified: %v", item)
+	}
+	if tags := item["tags"].([]interface{}); len(tags) != 2 || tags[0] != "origin" {
+		t.Fatalf("The original item should not be modified: %v", item)
+	}
+}
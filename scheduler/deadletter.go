@@ -0,0 +1,200 @@
+package scheduler
+
+import (
+	"fmt"
+	"log"
+	"sync/atomic"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/deadletter"
+)
+
+//死信的统计
+type deadLetterStats struct {
+	//重试的请求数
+	retries uint64
+	//放入死信队列的请求数
+	requests uint64
+	//放入死信队列的条目数
+	items uint64
+	//放入死信队列失败的次数
+	failures uint64
+	//重新注入的请求数
+	injectedRequests uint64
+	//重新注入的条目数
+	injectedItems uint64
+}
+
+//死信的摘要类型
+type DeadLetterSummary struct {
+	Retries          uint64 `json:"retries"`
+	Requests         uint64 `json:"requests"`
+	Items            uint64 `json:"items"`
+	Failures         uint64 `json:"failures"`
+	InjectedRequests uint64 `json:"injected_requests"`
+	InjectedItems    uint64 `json:"injected_items"`
+}
+
+//用于获取死信的摘要，既没有启用重试也没有启用死信队列时返回nil
+func (sched *vientianeScheduler) deadLetterSummary() *DeadLetterSummary {
+	if sched.deadLetters == nil && sched.maxRetries == 0 {
+		return nil
+	}
+	return &DeadLetterSummary{
+		Retries:          atomic.LoadUint64(&sched.deadLetterStats.retries),
+		Requests:         atomic.LoadUint64(&sched.deadLetterStats.requests),
+		Items:            atomic.LoadUint64(&sched.deadLetterStats.items),
+		Failures:         atomic.LoadUint64(&sched.deadLetterStats.failures),
+		InjectedRequests: atomic.LoadUint64(&sched.deadLetterStats.injectedRequests),
+		InjectedItems:    atomic.LoadUint64(&sched.deadLetterStats.injectedItems),
+	}
+}
+
+//用于重试下载失败的请求，重试次数用尽后放入死信队列
+//重试的请求已在URL字典中，因此会直接放入请求缓冲池
+func (sched *vientianeScheduler) retryRequest(req *structure.Request, mid module.MID, err error) {
+	if sched.cancel() {
+		return
+	}
+	if req.Retries() < sched.maxRetries {
+		atomic.AddUint64(&sched.deadLetterStats.retries, 1)
+		go func(req *structure.Request) {
+			if err := sched.reqBufferPool.Put(req); err != nil {
+				log.Print("The request buffer pool was closed. Ignore request retrying.")
+			}
+		}(req.Retry())
+		return
+	}
+	if sched.deadLetters == nil {
+		return
+	}
+	if _, err := sched.deadLetters.PutRequest(req, string(mid), err); err != nil {
+		atomic.AddUint64(&sched.deadLetterStats.failures, 1)
+		errMsg := fmt.Sprintf("couldn't put the request into the dead-letter queue: %s (requestURL: %s)",
+			err, requestURL(req))
+		sendError(errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg), "", sched.errorBufferPool)
+		return
+	}
+	atomic.AddUint64(&sched.deadLetterStats.requests, 1)
+}
+
+//用于把条目处理管道处理失败的条目放入死信队列
+//只应在快速失败的管道中处理被中断时调用，否则条目已经被之后的条目处理函数处理过了
+func (sched *vientianeScheduler) buryItem(item structure.Item, mid module.MID, errs []error) {
+	if sched.deadLetters == nil {
+		return
+	}
+	if _, err := sched.deadLetters.PutItem(item, string(mid), errs...); err != nil {
+		atomic.AddUint64(&sched.deadLetterStats.failures, 1)
+		errMsg := fmt.Sprintf("couldn't put the item into the dead-letter queue: %s (requestURL: %s)",
+			err, itemURL(item))
+		sendError(errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg), "", sched.errorBufferPool)
+		return
+	}
+	atomic.AddUint64(&sched.deadLetterStats.items, 1)
+}
+
+func (sched *vientianeScheduler) Inject(reqs []*structure.Request, items []structure.Item) (int, []error) {
+	if status := sched.Status(); status != SCHED_STATUS_STARTED {
+		return 0, []error{errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER,
+			"the scheduler has not been started: "+GetStatusDescription(status))}
+	}
+	var accepted int
+	var errs []error
+	for _, req := range reqs {
+		if req == nil || !req.Valid() {
+			errs = append(errs, errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER,
+				"couldn't inject an invalid request"))
+			continue
+		}
+		//失败的请求已在URL字典中，需要先移除才能再次发送
+		//重新注入的请求不受增量爬取的访问时间限制
+		sched.urlMap.Delete(genReqKey(req))
+		if err := sched.acceptReqBy(req, false); err != nil {
+			errMsg := fmt.Sprintf("couldn't inject the request: %s (requestURL: %s)",
+				err, requestURL(req))
+			errs = append(errs, errors.NewCrawlerErrorWith(errors.ERROR_TYPE_SCHEDULER, errMsg, err))
+			continue
+		}
+		go func(req *structure.Request) {
+			if err := sched.reqBufferPool.Put(req); err != nil {
+				log.Print("The request buffer pool was closed. Ignore request injecting.")
+			}
+		}(req)
+		atomic.AddUint64(&sched.deadLetterStats.injectedRequests, 1)
+		accepted++
+	}
+	for _, item := range items {
+		if !sendItem(item, sched.itemBufferPool) {
+			errMsg := fmt.Sprintf("couldn't inject the item (requestURL: %s)", itemURL(item))
+			errs = append(errs, errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg))
+			continue
+		}
+		atomic.AddUint64(&sched.deadLetterStats.injectedItems, 1)
+		accepted++
+	}
+	return accepted, errs
+}
+
+//用于把死信队列中的死信重新注入到已启动的调度器，ids为空代表所有死信
+//被调度器接受的死信会从队列中删除，返回值代表被接受的死信数
+//有字段在保存时被替换的死信不会被重新注入，参见deadletter.Letter的Replaced字段
+func Reinject(sched Scheduler, queue *deadletter.Queue, ids ...string) (int, []error) {
+	if status := sched.Status(); status != SCHED_STATUS_STARTED {
+		return 0, []error{errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER,
+			"the scheduler has not been started: "+GetStatusDescription(status))}
+	}
+	var letters []*deadletter.Letter
+	var errs []error
+	if len(ids) == 0 {
+		all, err := queue.List("")
+		if err != nil {
+			return 0, []error{err}
+		}
+		letters = all
+	}
+	for _, id := range ids {
+		letter, err := queue.Get(id)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("couldn't get dead letter %s: %s", id, err))
+			continue
+		}
+		letters = append(letters, letter)
+	}
+	var accepted int
+	for _, letter := range letters {
+		var reqs []*structure.Request
+		var items []structure.Item
+		switch letter.Kind {
+		case deadletter.KIND_REQUEST:
+			req, err := letter.NewRequest()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			reqs = append(reqs, req)
+		case deadletter.KIND_ITEM:
+			item, err := letter.NewItem()
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			items = append(items, item)
+		default:
+			errs = append(errs, fmt.Errorf("unknown kind %q of dead letter %s", letter.Kind, letter.ID))
+			continue
+		}
+		n, injectErrs := sched.Inject(reqs, items)
+		errs = append(errs, injectErrs...)
+		if n == 0 {
+			continue
+		}
+		accepted++
+		if err := queue.Delete(letter.ID); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return accepted, errs
+}
@@ -0,0 +1,150 @@
+package scheduler
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/module/components/pipeline"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/buffer"
+	"github.com/Vientiane/toolkit/cmap"
+	"github.com/Vientiane/toolkit/deadletter"
+	"github.com/Vientiane/toolkit/recrawl"
+)
+
+func TestDeadLetters(t *testing.T) {
+	queue, err := deadletter.Open(filepath.Join(t.TempDir(), "dead.kv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	sched := &vientianeScheduler{maxDepth: 3, maxRetries: 1, deadLetters: queue,
+		status: SCHED_STATUS_STARTED}
+	sched.resetContext()
+	sched.reqBufferPool, _ = buffer.NewPool(10, 2)
+	sched.itemBufferPool, _ = buffer.NewPool(10, 2)
+	sched.urlMap, _ = cmap.NewConcurrentMap(1, nil)
+	sched.acceptedDomainMap, _ = cmap.NewConcurrentMap(1, nil)
+	sched.acceptedDomainMap.Put("example.com", struct{}{})
+
+	httpReq, _ := http.NewRequest("GET", "http://example.com/a", nil)
+	req := structure.NewRequest(httpReq, 1)
+	if !sched.sendReq(req) {
+		t.Fatalf("The request should be accepted")
+	}
+	sent, _ := sched.reqBufferPool.Get()
+	sched.retryRequest(sent.(*structure.Request), "D1", errors.New("timeout"))
+	retried, err := sched.reqBufferPool.Get()
+	if err != nil || retried.(*structure.Request).Retries() != 1 {
+		t.Fatalf("The request should be retried: %v %v", retried, err)
+	}
+	sched.retryRequest(retried.(*structure.Request), "D1", errors.New("timeout"))
+	sched.buryItem(structure.Item{"name": "x"}, "P1", []error{errors.New("disk full")})
+	if queue.Len(deadletter.KIND_REQUEST) != 1 || queue.Len(deadletter.KIND_ITEM) != 1 {
+		t.Fatalf("Inconsistent dead letters: %d", queue.Len(""))
+	}
+	summary := sched.deadLetterSummary()
+	if summary.Retries != 1 || summary.Requests != 1 || summary.Items != 1 {
+		t.Fatalf("Inconsistent summary: %+v", summary)
+	}
+
+	n, errs := Reinject(sched, queue)
+	if n != 2 || len(errs) != 0 {
+		t.Fatalf("Inconsistent reinjection result: %d %v", n, errs)
+	}
+	if queue.Len("") != 0 {
+		t.Fatalf("The reinjected letters should be deleted: %d", queue.Len(""))
+	}
+	injected, _ := sched.reqBufferPool.Get()
+	if r := injected.(*structure.Request); r.Retries() != 0 || r.Depth() != 1 {
+		t.Fatalf("Inconsistent injected request: %+v", r)
+	}
+	item, _ := sched.itemBufferPool.Get()
+	if item.(structure.Item)["name"] != "x" {
+		t.Fatalf("Inconsistent injected item: %v", item)
+	}
+
+	//保存时被替换了字段的条目不会被重新注入，也不会从队列中删除
+	sched.buryItem(structure.Item{"reader": strings.NewReader("x")}, "P1", nil)
+	n, errs = Reinject(sched, queue)
+	if n != 0 || len(errs) != 1 || queue.Len(deadletter.KIND_ITEM) != 1 {
+		t.Fatalf("The letter with replaced fields should be kept: %d %v", n, errs)
+	}
+
+	//重新注入的请求跳过增量爬取的访问时间检查，被过滤的请求会返回原因
+	tracker, err := recrawl.Open(recrawl.Config{Path: filepath.Join(t.TempDir(), "recrawl.kv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	sched.recrawl = tracker
+	httpReq, _ = http.NewRequest("GET", "http://example.com/b", nil)
+	if _, _, err := tracker.Observe(httpReq.URL.String(), []byte("b"), time.Now()); err != nil {
+		t.Fatal(err)
+	}
+	otherReq, _ := http.NewRequest("GET", "http://other.com/c", nil)
+	n, errs = sched.Inject([]*structure.Request{
+		structure.NewRequest(httpReq, 1), structure.NewRequest(otherReq, 1)}, nil)
+	if n != 1 || len(errs) != 1 || !strings.Contains(errs[0].Error(), "other.com") {
+		t.Fatalf("Inconsistent injection result: %d %v", n, errs)
+	}
+	injected, _ = sched.reqBufferPool.Get()
+	if r := injected.(*structure.Request); r.HTTPReq().URL.String() != "http://example.com/b" {
+		t.Fatalf("Inconsistent injected request: %+v", r)
+	}
+}
+
+//只有快速失败的管道中处理失败的条目才会被放入死信队列
+//其他管道已把失败的条目交给了之后的条目处理函数，重新注入会导致重复处理
+func TestBuryFailFastOnly(t *testing.T) {
+	queue, err := deadletter.Open(filepath.Join(t.TempDir(), "dead.kv"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer queue.Close()
+	var lock sync.Mutex
+	exported := map[string]int{}
+	genPipeline := func(t *testing.T, name string, sn uint64, failFast bool) module.Pipeline {
+		mid, _ := module.GenMID(module.TYPE_PIPELINE, sn, nil)
+		p, err := pipeline.NewPipeLine(mid, module.CalculateScoreSimple, []module.ProcessItem{
+			func(item structure.Item) (structure.Item, error) {
+				return nil, errors.New("invalid price")
+			},
+			func(item structure.Item) (structure.Item, error) {
+				lock.Lock()
+				exported[name]++
+				lock.Unlock()
+				return item, nil
+			},
+		})
+		if err != nil {
+			t.Fatalf("An error occurs when creating a pipeline: %s", err)
+		}
+		p.SetFailFast(failFast)
+		return p
+	}
+	strict := genPipeline(t, "strict", 1, true)
+	lenient := genPipeline(t, "lenient", 2, false)
+	sched := &vientianeScheduler{deadLetters: queue, branches: []Branch{
+		{Name: "strict", Pipelines: []module.Pipeline{strict}},
+		{Name: "lenient", Pipelines: []module.Pipeline{lenient}},
+	}}
+	sched.resetContext()
+	sched.pickOne(structure.Item{"name": "x"})
+	if exported["strict"] != 0 || exported["lenient"] != 1 {
+		t.Fatalf("Inconsistent exported items: %v", exported)
+	}
+	letters, err := queue.List(deadletter.KIND_ITEM)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(letters) != 1 || letters[0].MID != string(strict.ID()) {
+		t.Fatalf("Only the item failed in the fail-fast pipeline should be buried: %+v", letters)
+	}
+}
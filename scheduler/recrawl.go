@@ -0,0 +1,164 @@
+package scheduler
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/recrawl"
+)
+
+//增量爬取的统计
+type recrawlStats struct {
+	//第一次获取的页面数
+	newPages uint64
+	//内容已变化的页面数
+	changedPages uint64
+	//内容未变化的页面数
+	unchangedPages uint64
+	//因未到访问时间而被忽略的请求数
+	skippedRequests uint64
+	//因页面内容未变化而被丢弃的条目数
+	skippedItems uint64
+}
+
+//增量爬取的摘要类型
+type RecrawlSummary struct {
+	Tracked         int    `json:"tracked"`
+	NewPages        uint64 `json:"new_pages"`
+	ChangedPages    uint64 `json:"changed_pages"`
+	UnchangedPages  uint64 `json:"unchanged_pages"`
+	SkippedRequests uint64 `json:"skipped_requests"`
+	SkippedItems    uint64 `json:"skipped_items"`
+}
+
+//用于获取增量爬取的摘要，未启用增量爬取时返回nil
+func (sched *vientianeScheduler) recrawlSummary() *RecrawlSummary {
+	if sched.recrawl == nil {
+		return nil
+	}
+	return &RecrawlSummary{
+		Tracked:         sched.recrawl.Len(),
+		NewPages:        atomic.LoadUint64(&sched.recrawlStats.newPages),
+		ChangedPages:    atomic.LoadUint64(&sched.recrawlStats.changedPages),
+		UnchangedPages:  atomic.LoadUint64(&sched.recrawlStats.unchangedPages),
+		SkippedRequests: atomic.LoadUint64(&sched.recrawlStats.skippedRequests),
+		SkippedItems:    atomic.LoadUint64(&sched.recrawlStats.skippedItems),
+	}
+}
+
+//用于记录响应的内容，返回内容是否未变化
+//只记录状态码为2xx的响应，响应体会被读入内存后重置
+//响应体按照分析器的大小限制读取：允许截断时只记录限制以内的部分，与分析器看到的内容一致
+//否则超出限制的响应不会被记录，并发送响应体过大的错误
+func (sched *vientianeScheduler) observe(resp *structure.Response, limit module.BodyLimit) bool {
+	if sched.recrawl == nil {
+		return false
+	}
+	httpResp := resp.HTTPResp()
+	if httpResp == nil || httpResp.Body == nil ||
+		httpResp.StatusCode < 200 || httpResp.StatusCode > 299 {
+		return false
+	}
+	var key string
+	if req := resp.Request(); req != nil && req.Valid() {
+		key = genReqKey(req)
+	} else {
+		key = resp.FinalURL()
+	}
+	if key == "" {
+		return false
+	}
+	maxSize := limit.MaxSize
+	if maxSize > 0 && !limit.Truncate && httpResp.ContentLength > maxSize {
+		sendError(sched.tooLargeError(resp, maxSize), "", sched.errorBufferPool)
+		return false
+	}
+	var r io.Reader = httpResp.Body
+	if maxSize > 0 {
+		r = io.LimitReader(httpResp.Body, maxSize+1)
+	}
+	body, err := ioutil.ReadAll(r)
+	if err != nil {
+		httpResp.Body.Close()
+		httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+		sendError(errors.NewCrawlerErrorBy(errors.ERROR_TYPE_SCHEDULER, err), "", sched.errorBufferPool)
+		return false
+	}
+	if maxSize > 0 && int64(len(body)) > maxSize {
+		//放回已读取的部分，由分析器按照其限制处理剩余的响应体
+		httpResp.Body = struct {
+			io.Reader
+			io.Closer
+		}{io.MultiReader(bytes.NewReader(body), httpResp.Body), httpResp.Body}
+		if !limit.Truncate {
+			sendError(sched.tooLargeError(resp, maxSize), "", sched.errorBufferPool)
+			return false
+		}
+		body = body[:maxSize]
+	} else {
+		httpResp.Body.Close()
+		httpResp.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+	result, _, err := sched.recrawl.Observe(key, body, time.Now())
+	if err != nil {
+		sendError(errors.NewCrawlerErrorBy(errors.ERROR_TYPE_SCHEDULER, err), "", sched.errorBufferPool)
+	}
+	switch result {
+	case recrawl.RESULT_NEW:
+		atomic.AddUint64(&sched.recrawlStats.newPages, 1)
+	case recrawl.RESULT_CHANGED:
+		atomic.AddUint64(&sched.recrawlStats.changedPages, 1)
+	case recrawl.RESULT_UNCHANGED:
+		atomic.AddUint64(&sched.recrawlStats.unchangedPages, 1)
+		return true
+	}
+	return false
+}
+
+//用于生成响应体超出限制而无法记录内容的错误
+func (sched *vientianeScheduler) tooLargeError(resp *structure.Response, maxSize int64) error {
+	summary := resp.Summary()
+	errMsg := fmt.Sprintf("too large response body to track: more than %d bytes (requestURL: %s)",
+		maxSize, summary.URL)
+	return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg).
+		WithCode(errors.ERROR_CODE_BODY_TOO_LARGE).WithContext(errors.ErrorContext{
+		URL:   summary.URL,
+		Depth: summary.Depth,
+		MID:   summary.MID,
+		Stage: errors.STAGE_SCHEDULE,
+	})
+}
+
+//用于根据增量爬取的状态生成种子请求
+//返回的请求为到了访问时间的URL，按照下次访问时间的先后排列
+//只有GET请求可以作为种子，其他请求的键不是URL，会被跳过
+func RecrawlSeeds(tracker *recrawl.Tracker, now time.Time) ([]*structure.Request, []error) {
+	urls, err := tracker.DueURLs(now)
+	if err != nil {
+		return nil, []error{err}
+	}
+	var errs []error
+	reqs := make([]*structure.Request, 0, len(urls))
+	for _, url := range urls {
+		//其他请求的键形如"POST URL 摘要"
+		if strings.ContainsRune(url, ' ') {
+			continue
+		}
+		httpReq, err := http.NewRequest(http.MethodGet, url, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		reqs = append(reqs, structure.NewRequest(httpReq, 0))
+	}
+	return reqs, errs
+}
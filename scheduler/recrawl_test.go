@@ -0,0 +1,74 @@
+package scheduler
+
+import (
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/module"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/buffer"
+	"github.com/Vientiane/toolkit/recrawl"
+)
+
+func TestObserve(t *testing.T) {
+	tracker, err := recrawl.Open(recrawl.Config{Path: filepath.Join(t.TempDir(), "recrawl.kv")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	sched := &vientianeScheduler{recrawl: tracker}
+	sched.errorBufferPool, _ = buffer.NewPool(10, 1)
+	newResp := func(status int, body string) *structure.Response {
+		httpReq, _ := http.NewRequest("GET", "http://example.com/page", nil)
+		httpResp := &http.Response{
+			StatusCode: status,
+			Body:       ioutil.NopCloser(strings.NewReader(body)),
+			Request:    httpReq,
+		}
+		return structure.NewResponseBy(httpResp, structure.NewRequest(httpReq, 1))
+	}
+	truncate := module.BodyLimit{MaxSize: 2, Truncate: true}
+	reject := module.BodyLimit{MaxSize: 2}
+	cases := []struct {
+		status    int
+		body      string
+		limit     module.BodyLimit
+		unchanged bool
+	}{
+		{200, "v1", module.BodyLimit{}, false},
+		{200, "v1", module.BodyLimit{}, true},
+		{404, "v1", module.BodyLimit{}, false},
+		{200, "v2", module.BodyLimit{}, false},
+		//允许截断时只记录限制以内的部分
+		{200, "v2-suffix", truncate, true},
+		//不允许截断时不记录超出限制的响应
+		{200, "v3-suffix", reject, false},
+	}
+	for i, c := range cases {
+		resp := newResp(c.status, c.body)
+		if unchanged := sched.observe(resp, c.limit); unchanged != c.unchanged {
+			t.Fatalf("case %d: expected unchanged %v, got %v", i, c.unchanged, unchanged)
+		}
+		body, _ := ioutil.ReadAll(resp.HTTPResp().Body)
+		if string(body) != c.body {
+			t.Fatalf("case %d: the body should be readable after observing, got %q", i, body)
+		}
+	}
+	//错误是异步发送的
+	if err, _ := sched.errorBufferPool.Get(); !errors.Is(err.(error), errors.ERROR_CODE_BODY_TOO_LARGE) {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	summary := sched.recrawlSummary()
+	if summary.NewPages != 1 || summary.UnchangedPages != 2 || summary.ChangedPages != 1 {
+		t.Fatalf("unexpected summary: %+v", summary)
+	}
+	reqs, errs := RecrawlSeeds(tracker, time.Now().Add(365*24*time.Hour))
+	if len(errs) > 0 || len(reqs) != 1 || reqs[0].HTTPReq().URL.String() != "http://example.com/page" {
+		t.Fatalf("unexpected seeds: %v %v", reqs, errs)
+	}
+}
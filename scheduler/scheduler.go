@@ -12,12 +12,20 @@ import (
 	"log"
 	"github.com/Vientiane/structure"
 	"strings"
+	"crypto/sha1"
+	"io"
+	"sync/atomic"
+	"time"
+	"github.com/Vientiane/toolkit/recrawl"
+	"github.com/Vientiane/toolkit/deadletter"
 )
 
 //scheduler接口的实现类型
 type vientianeScheduler struct {
 	//爬取的最大深度
 	maxDepth uint32
+	//下载失败的请求的最大重试次数
+	maxRetries uint32
 	//可以接受的Url的主域名的字典
 	acceptedDomainMap cmap.ConcurrentMap
 	//组件注册器
@@ -42,6 +50,20 @@ type vientianeScheduler struct {
 	statusLock sync.RWMutex
 	//摘要信息
 	summary SchedSummary
+	//条目分支列表
+	branches []Branch
+	//处理条目的协程数量
+	pickWorkers int
+	//调度器停止时需要关闭的资源列表
+	closers []io.Closer
+	//增量爬取的状态跟踪器
+	recrawl *recrawl.Tracker
+	//增量爬取的统计
+	recrawlStats recrawlStats
+	//死信队列
+	deadLetters *deadletter.Queue
+	//死信的统计
+	deadLetterStats deadLetterStats
 }
 
 func(sched *vientianeScheduler)Init(requestArgs RequestArgs,dataArgs DataArgs,
@@ -77,12 +99,20 @@ func(sched *vientianeScheduler)Init(requestArgs RequestArgs,dataArgs DataArgs,
 		sched.register.Clear()
 	}
 	sched.maxDepth = requestArgs.MaxDepth
+	sched.maxRetries = requestArgs.MaxRetries
 	sched.acceptedDomainMap, _ =
 		cmap.NewConcurrentMap(1, nil)
 	for _,domain:=range requestArgs.AcceptedDomains {
 		sched.acceptedDomainMap.Put(domain, struct {}{})
 	}
 	sched.urlMap, _ = cmap.NewConcurrentMap(16, nil)
+	sched.branches = append([]Branch(nil), moduleArgs.Branches...)
+	sched.pickWorkers = pickWorkerNumber(allPipelines(moduleArgs))
+	sched.closers = append([]io.Closer(nil), moduleArgs.Closers...)
+	sched.recrawl = moduleArgs.Recrawl
+	sched.recrawlStats = recrawlStats{}
+	sched.deadLetters = moduleArgs.DeadLetters
+	sched.deadLetterStats = deadLetterStats{}
 	sched.initBufferPool(dataArgs)
 	sched.resetContext()
 	sched.summary = newSchedSummary(requestArgs, dataArgs, moduleArgs, sched)
@@ -153,7 +183,9 @@ func (sched *vientianeScheduler)download(){
 				sendError(errors.New(errMsg), "", sched.errorBufferPool)
 			}
 			fmt.Println(req.HTTPReq().URL)
-			sched.downloadOne(req)
+			sched.protect(errors.ERROR_TYPE_DOWNLOADER, requestURL(req), func() {
+				sched.downloadOne(req)
+			})
 		}
 	}()
 }
@@ -196,6 +228,10 @@ func(sched *vientianeScheduler)downloadOne(req *structure.Request) {
 	}
 	if err!=nil {
 		sendError(err, m.ID(), sched.errorBufferPool)
+		//没有得到响应的请求会被重试，重试次数用尽后放入死信队列
+		if resp == nil {
+			sched.retryRequest(req, m.ID(), err)
+		}
 	}
 }
 
@@ -216,7 +252,9 @@ func(sched *vientianeScheduler)analyze(){
 				errMsg:=fmt.Sprintf("incorrect response type:%T",datum)
 				sendError(errors.New(errMsg),"",sched.errorBufferPool)
 			}
-			sched.analyzeOne(resp)
+			sched.protect(errors.ERROR_TYPE_ANALYZER, responseURL(resp), func() {
+				sched.analyzeOne(resp)
+			})
 		}
 	}()
 }
@@ -243,6 +281,8 @@ func(sched *vientianeScheduler)analyzeOne(resp *structure.Response){
 		sendResp(resp,sched.respBufferPool)
 		return
 	}
+	//内容未变化的页面仍然会被分析以便发现新的请求，但不会产生条目
+	unchanged := sched.observe(resp, analyzer.BodyLimit())
 	dataList,errs:=analyzer.Analyze(resp)
 	if dataList!=nil{
 		for _,data:=range dataList{
@@ -253,6 +293,10 @@ func(sched *vientianeScheduler)analyzeOne(resp *structure.Response){
 			case *structure.Request:
 				sched.sendReq(d)
 			case structure.Item:
+				if unchanged {
+					atomic.AddUint64(&sched.recrawlStats.skippedItems, 1)
+					continue
+				}
 				sendItem(d,sched.itemBufferPool)
 			default:
 				errMsg:=fmt.Sprintf("Unsupported data type %T! (data:%#v)",d,d)
@@ -269,7 +313,19 @@ func(sched *vientianeScheduler)analyzeOne(resp *structure.Response){
 }
 
 
+//处理条目的协程数量由各条目处理管道的并发上限决定
 func(sched *vientianeScheduler)pick(){
+	workers := sched.pickWorkers
+	if workers <= 0 {
+		workers = 1
+	}
+	for i := 0; i < workers; i++ {
+		sched.pickLoop()
+	}
+}
+
+//从条目缓冲池中取出条目并处理
+func(sched *vientianeScheduler)pickLoop(){
 	go func() {
 		for {
 			if sched.cancel() {
@@ -285,7 +341,9 @@ func(sched *vientianeScheduler)pick(){
 				errMsg:=fmt.Sprintf("incorrect item type:%T",datum)
 				sendError(errors.New(errMsg),"",sched.errorBufferPool)
 			}
-			sched.pickOne(item)
+			sched.protect(errors.ERROR_TYPE_PIPELINE, itemURL(item), func() {
+				sched.pickOne(item)
+			})
 		}
 	}()
 }
@@ -294,6 +352,10 @@ func (sched *vientianeScheduler) pickOne(item structure.Item) {
 	if sched.cancel(){
 		return
 	}
+	if len(sched.branches) > 0 {
+		sched.pickBranches(item)
+		return
+	}
 	m,err:=sched.register.Get(module.TYPE_PIPELINE)
 	if err!=nil || m==nil {
 		errMsg := fmt.Sprintf("couldn't get a pipeline pipline: %s", err)
@@ -314,58 +376,93 @@ func (sched *vientianeScheduler) pickOne(item structure.Item) {
 		for _, err := range errs {
 			sendError(err, m.ID(), sched.errorBufferPool)
 		}
+		if pipeline.FailFast() {
+			sched.buryItem(item, m.ID(), errs)
+		}
 	}
 }
 
 //向请求缓冲池中发送请求，同时过滤掉不满足要求的请求
 func(sched *vientianeScheduler)sendReq(req *structure.Request)bool{
-	if req==nil{
+	if !sched.acceptReq(req){
 		return false
 	}
+	go func(req *structure.Request){
+		if err:=sched.reqBufferPool.Put(req);err!=nil{
+			log.Print("The request buffer pool was closed. Ignore request sending.")
+		}
+	}(req)
+	return true
+}
+
+//过滤掉不满足要求的请求，被接受的请求会记录到URL字典中
+func(sched *vientianeScheduler)acceptReq(req *structure.Request)bool{
+	return sched.acceptReqBy(req, true) == nil
+}
+
+//过滤掉不满足要求的请求，被接受的请求会记录到URL字典中，不满足要求时返回原因
+//checkDue代表是否检查增量爬取的访问时间
+func(sched *vientianeScheduler)acceptReqBy(req *structure.Request, checkDue bool)error{
+	if req==nil{
+		return errors.New("nil request")
+	}
 	if sched.cancel(){
-		return false
+		return errors.New("the scheduler has been stopped")
+	}
+	ignore := func(format string, args ...interface{}) error {
+		errMsg := fmt.Sprintf(format, args...)
+		log.Printf("Ignore the request! %s\n", errMsg)
+		return errors.New(errMsg)
 	}
 	httpReq:=req.HTTPReq()
 	if httpReq==nil {
-		log.Print("Ignore the request! Its HTTP request is invalid!")
-		return false
+		return ignore("Its HTTP request is invalid!")
+	}
+	if err := req.BodyError(); err != nil {
+		return ignore("Its body is lost: %s (URL: %s)", err, httpReq.URL)
 	}
 	reqUrl:=httpReq.URL
 	if reqUrl==nil{
-		log.Print("Ignore the request! Its URL is invalid!")
-		return false
+		return ignore("Its URL is invalid!")
 	}
 	scheme:=strings.ToLower(reqUrl.Scheme)
 	if scheme != "http" && scheme != "https" {
-		log.Print("Ignore the request! Its URL scheme is %q, but should be %q or %q. (URL: %s)\n",
+		return ignore("Its URL scheme is %q, but should be %q or %q. (URL: %s)",
 			scheme, "http", "https", reqUrl)
-		return false
 	}
-	if v:=sched.urlMap.Get(reqUrl.String());v!=nil {
-		log.Print("Ignore the request! Its URL is repeated. (URL: %s)\n", reqUrl)
-		return false
+	reqKey := genReqKey(req)
+	if v:=sched.urlMap.Get(reqKey);v!=nil {
+		return ignore("Its URL is repeated. (URL: %s)", reqUrl)
 	}
 	pd, _ := getPrimaryDomain(httpReq.Host)
 	if sched.acceptedDomainMap.Get(pd)==nil {
 		if pd == "bing.net" {
 			panic(httpReq.URL)
 		}
-		log.Print("Ignore the request! Its host %q is not in accepted primary domain map. (URL: %s)\n",
+		return ignore("Its host %q is not in accepted primary domain map. (URL: %s)",
 			httpReq.Host, reqUrl)
-		return false
 	}
 	if req.Depth()> sched.maxDepth{
-		log.Print("Ignore the request! Its depth %d is greater than %d. (URL: %s)\n",
+		return ignore("Its depth %d is greater than %d. (URL: %s)",
 			req.Depth(), sched.maxDepth, reqUrl)
-		return false
 	}
-	go func(req *structure.Request){
-		if err:=sched.reqBufferPool.Put(req);err!=nil{
-			log.Print("The request buffer pool was closed. Ignore request sending.")
-		}
-	}(req)
-	sched.urlMap.Put(reqUrl.String(), struct {}{})
-	return true
+	if checkDue && sched.recrawl != nil && req.Depth() > 0 && !sched.recrawl.Due(reqKey, time.Now()) {
+		atomic.AddUint64(&sched.recrawlStats.skippedRequests, 1)
+		return ignore("It is not due for revisit. (URL: %s)", reqUrl)
+	}
+	sched.urlMap.Put(reqKey, struct {}{})
+	return nil
+}
+
+//生成用于请求去重的键
+//GET和HEAD请求以URL为键，其他请求还需要区分方法和请求体
+func genReqKey(req *structure.Request) string {
+	httpReq := req.HTTPReq()
+	method := strings.ToUpper(httpReq.Method)
+	if method == "" || method == http.MethodGet || method == http.MethodHead {
+		return httpReq.URL.String()
+	}
+	return fmt.Sprintf("%s %s %x", method, httpReq.URL, sha1.Sum(req.Body()))
 }
 
 // resetContext 用于重置调度器的上下文。
@@ -394,10 +491,24 @@ func (sched *vientianeScheduler) Stop() (err error) {
 	sched.reqBufferPool.Close()
 	sched.itemBufferPool.Close()
 	sched.errorBufferPool.Close()
+	sched.closeAll()
 	log.Print("Scheduler has been stopped.")
 	return nil
 }
 
+//用于关闭调度器停止时需要关闭的资源
+//关闭失败不会影响调度器的停止，只会记录日志
+func (sched *vientianeScheduler) closeAll() {
+	for i, closer := range sched.closers {
+		if closer == nil {
+			continue
+		}
+		if err := closer.Close(); err != nil {
+			log.Printf("Couldn't close the resource[%d]: %s", i, err)
+		}
+	}
+}
+
 func(sched *vientianeScheduler)ErrorChan()<-chan error {
 	errBuffer := sched.errorBufferPool
 	errCh := make(chan error, errBuffer.BufferCap())
@@ -564,7 +675,7 @@ func (sched *vientianeScheduler) registerModules(moduleArgs ModuleArgs) error {
 			return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg)
 		}
 	}
-	log.Print("All downloads have been registered. (number: %d)",
+	log.Printf("All downloads have been registered. (number: %d)",
 		len(moduleArgs.Downloaders))
 	//注册分析器类型的组件
 	for _, a := range moduleArgs.Analyzers {
@@ -580,13 +691,11 @@ func (sched *vientianeScheduler) registerModules(moduleArgs ModuleArgs) error {
 			return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg)
 		}
 	}
-	log.Print("All analyzes have been registered. (number: %d)",
+	log.Printf("All analyzes have been registered. (number: %d)",
 		len(moduleArgs.Analyzers))
-	//注册处理管道类型的组件
-	for _, p := range moduleArgs.Pipelines {
-		if p == nil {
-			continue
-		}
+	//注册处理管道类型的组件，包括各分支中的条目处理管道
+	pipelines := allPipelines(moduleArgs)
+	for _, p := range pipelines {
 		ok, err := sched.register.Register(p)
 		if err != nil {
 			return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, err.Error())
@@ -596,11 +705,49 @@ func (sched *vientianeScheduler) registerModules(moduleArgs ModuleArgs) error {
 			return errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER, errMsg)
 		}
 	}
-	log.Print("All pipelines have been registered. (number: %d)",
-		len(moduleArgs.Pipelines))
+	log.Printf("All pipelines have been registered. (number: %d)",
+		len(pipelines))
 	return nil
 }
 
+//用于隔离处理单个数据时发生的panic，使所在的处理循环可以继续运行
+//panic会被转换为带有调用栈的爬虫错误并发送到错误缓冲池
+func (sched *vientianeScheduler) protect(errType errors.ErrorType, url string, handle func()) {
+	defer func() {
+		if p := recover(); p != nil {
+			pe := errors.NewPanicError(p)
+			errMsg := fmt.Sprintf("%s (requestURL: %s)\n%s", pe, url, pe.Stack)
+			sendError(errors.NewCrawlerErrorWith(errType, errMsg, pe).
+				WithContext(errors.ErrorContext{URL: url}), "", sched.errorBufferPool)
+		}
+	}()
+	handle()
+}
+
+//用于获取请求的URL，用于错误信息
+func requestURL(req *structure.Request) string {
+	if req == nil || !req.Valid() {
+		return ""
+	}
+	return req.HTTPReq().URL.String()
+}
+
+//用于获取响应对应的请求的URL，用于错误信息
+func responseURL(resp *structure.Response) string {
+	if resp == nil || !resp.Valid() {
+		return ""
+	}
+	return resp.Summary().URL
+}
+
+//用于获取产生条目的请求的URL，用于错误信息
+func itemURL(item structure.Item) string {
+	if summary, ok := item.Response(); ok {
+		return summary.URL
+	}
+	return ""
+}
+
 //向错误缓冲池发送值（进一步加工错误）
 func sendError(err error,mid module.MID,
 	errorBufferPool buffer.Pool)bool {
@@ -626,7 +773,11 @@ func sendError(err error,mid module.MID,
 				errorType = errors.ERROR_TYPE_PIPELINE
 			}
 		}
-		crawelError = errors.NewCrawlerError(errorType, err.Error())
+		crawelError = errors.NewCrawlerErrorBy(errorType, err)
+	}
+	//补充组件ID，以便错误的接收方区分出错的组件
+	if mid != "" && crawelError.Context().MID == "" {
+		crawelError = crawelError.WithContext(errors.ErrorContext{MID: string(mid)})
 	}
 	if errorBufferPool.Closed() {
 		return false
@@ -0,0 +1,41 @@
+package scheduler
+
+import (
+	"net/http"
+	"testing"
+
+	"github.com/Vientiane/structure"
+)
+
+func TestGenReqKey(t *testing.T) {
+	genReq := func(method string, url string, body string) *structure.Request {
+		var data []byte
+		if body != "" {
+			data = []byte(body)
+		}
+		req, err := structure.NewRequestWithBody(method, url, nil, data, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return req
+	}
+	url := "http://example.com/api"
+	if key := genReqKey(genReq("GET", url, "")); key != url {
+		t.Fatalf("The key of a GET request should be its URL: %q", key)
+	}
+	if genReqKey(genReq("HEAD", url, "")) != genReqKey(genReq("GET", url, "")) {
+		t.Fatalf("HEAD and GET requests of the same URL should share a key")
+	}
+	a := genReqKey(genReq("POST", url, `{"page":1}`))
+	b := genReqKey(genReq("post", url, `{"page":2}`))
+	if a == b || a == url {
+		t.Fatalf("POST requests with different bodies should have different keys: %q %q", a, b)
+	}
+	if a != genReqKey(genReq("POST", url, `{"page":1}`)) {
+		t.Fatalf("POST requests with the same body should have the same key")
+	}
+	httpReq, _ := http.NewRequest("PUT", url, nil)
+	if genReqKey(structure.NewRequest(httpReq, 0)) == genReqKey(genReq("POST", url, "")) {
+		t.Fatalf("The method should be part of the key")
+	}
+}
@@ -0,0 +1,76 @@
+package scheduler
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/sitemap"
+)
+
+func (sched *vientianeScheduler) Seed(reqs []*structure.Request) (int, error) {
+	if status := sched.Status(); status != SCHED_STATUS_STARTED {
+		return 0, errors.NewCrawlerError(errors.ERROR_TYPE_SCHEDULER,
+			"the scheduler has not been started: "+GetStatusDescription(status))
+	}
+	seeds := make([]*structure.Request, 0, len(reqs))
+	for _, req := range reqs {
+		if req == nil {
+			continue
+		}
+		if req.Depth() != 0 {
+			req = req.WithDepth(0)
+		}
+		seeds = append(seeds, req)
+	}
+	sort.SliceStable(seeds, func(i, j int) bool {
+		return seeds[i].Priority() > seeds[j].Priority()
+	})
+	//种子请求需要同步地按优先级放入请求缓冲池，异步放入会打乱顺序
+	//请求缓冲池满时会阻塞，直到有空间或缓冲池被关闭
+	var accepted int
+	for _, req := range seeds {
+		if !sched.acceptReq(req) {
+			continue
+		}
+		if err := sched.reqBufferPool.Put(req); err != nil {
+			return accepted, errors.NewCrawlerErrorWith(errors.ERROR_TYPE_SCHEDULER,
+				"couldn't put the seed request into the request buffer pool", err)
+		}
+		accepted++
+	}
+	return accepted, nil
+}
+
+//用于根据站点地图生成种子请求
+//sitemapURLs为空时使用站点的robots.txt中声明的站点地图，没有声明时使用/sitemap.xml
+//请求的优先级由站点地图中的优先级、更新频率和最后修改时间决定
+func SitemapSeeds(client *http.Client, siteURL string,
+	sitemapURLs ...string) ([]*structure.Request, []error) {
+	var errs []error
+	collector := &sitemap.Collector{Client: client}
+	if len(sitemapURLs) == 0 {
+		robotsSitemaps, err := collector.RobotsSitemaps(siteURL)
+		if err != nil {
+			errs = append(errs, err)
+		}
+		sitemapURLs = robotsSitemaps
+	}
+	urls, collectErrs := collector.Collect(sitemapURLs)
+	errs = append(errs, collectErrs...)
+	now := time.Now()
+	reqs := make([]*structure.Request, 0, len(urls))
+	for _, u := range urls {
+		httpReq, err := http.NewRequest("GET", u.Loc, nil)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		req := structure.NewRequest(httpReq, 0)
+		req.SetPriority(u.RequestPriority(now))
+		reqs = append(reqs, req)
+	}
+	return reqs, errs
+}
@@ -0,0 +1,85 @@
+package scheduler
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/buffer"
+	"github.com/Vientiane/toolkit/cmap"
+)
+
+func TestSeed(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			fmt.Fprintf(w, "User-agent: *\nSitemap: %s/index.xml\n", server.URL)
+		case "/index.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<sitemap><loc>%[1]s/a.xml</loc></sitemap>
+<sitemap><loc>%[1]s/b.xml</loc></sitemap>
+</sitemapindex>`, server.URL)
+		case "/a.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/low</loc><priority>0.1</priority></url>
+<url><loc>%[1]s/high</loc><priority>0.9</priority></url>
+</urlset>`, server.URL)
+		case "/b.xml":
+			fmt.Fprintf(w, `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+<url><loc>%[1]s/middle</loc><priority>0.5</priority></url>
+<url><loc>%[1]s/high</loc><priority>0.9</priority></url>
+</urlset>`, server.URL)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+
+	reqs, errs := SitemapSeeds(server.Client(), server.URL)
+	if len(errs) != 0 {
+		t.Fatalf("Couldn't collect seeds: %v", errs)
+	}
+	if len(reqs) < 3 {
+		t.Fatalf("Inconsistent seed number: expected at least 3, actual %d", len(reqs))
+	}
+
+	sched := &vientianeScheduler{maxDepth: 1, status: SCHED_STATUS_STARTED}
+	sched.resetContext()
+	//只有一个缓冲器时请求缓冲池是先进先出的
+	sched.reqBufferPool, _ = buffer.NewPool(10, 1)
+	sched.urlMap, _ = cmap.NewConcurrentMap(1, nil)
+	sched.acceptedDomainMap, _ = cmap.NewConcurrentMap(1, nil)
+	httpReq, _ := http.NewRequest("GET", server.URL+"/high", nil)
+	pd, _ := getPrimaryDomain(httpReq.Host)
+	sched.acceptedDomainMap.Put(pd, struct{}{})
+	duplicate := structure.NewRequest(httpReq, 2)
+	n, err := sched.Seed(append(reqs, duplicate, nil))
+	if err != nil {
+		t.Fatalf("Couldn't seed: %s", err)
+	}
+	if n != 3 {
+		t.Fatalf("Inconsistent accepted number: expected 3, actual %d", n)
+	}
+	if sched.reqBufferPool.Total() != 3 {
+		t.Fatalf("Inconsistent request number in pool: expected 3, actual %d", sched.reqBufferPool.Total())
+	}
+	for _, path := range []string{"/high", "/middle", "/low"} {
+		datum, err := sched.reqBufferPool.Get()
+		if err != nil {
+			t.Fatalf("Couldn't get the seed request: %s", err)
+		}
+		req := datum.(*structure.Request)
+		if req.HTTPReq().URL.Path != path {
+			t.Fatalf("Inconsistent seed order: expected %s, actual %s", path, req.HTTPReq().URL)
+		}
+		if req.Depth() != 0 {
+			t.Fatalf("Inconsistent seed depth: expected 0, actual %d", req.Depth())
+		}
+	}
+}
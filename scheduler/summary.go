@@ -6,6 +6,7 @@ import (
 	"sort"
 	"encoding/json"
 	"log"
+	"reflect"
 )
 
 //处理摘要信息
@@ -46,6 +47,8 @@ type SummaryStruct struct {
 	ItemBufferPool  BufferPoolSummaryStruct `json:"item_buffer_pool"`
 	ErrorBufferPool BufferPoolSummaryStruct `json:"error_buffer_pool"`
 	NumURL          uint64                  `json:"url_number"`
+	Recrawl         *RecrawlSummary         `json:"recrawl,omitempty"`
+	DeadLetters     *DeadLetterSummary      `json:"dead_letters,omitempty"`
 }
 
 
@@ -67,7 +70,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, ds := range another.Downloaders {
-		if ds != one.Downloaders[i] {
+		if !sameModuleSummary(ds, one.Downloaders[i]) {
 			return false
 		}
 	}
@@ -75,7 +78,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, as := range another.Analyzers {
-		if as != one.Analyzers[i] {
+		if !sameModuleSummary(as, one.Analyzers[i]) {
 			return false
 		}
 	}
@@ -83,7 +86,7 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 		return false
 	}
 	for i, ps := range another.Pipelines {
-		if ps != one.Pipelines[i] {
+		if !sameModuleSummary(ps, one.Pipelines[i]) {
 			return false
 		}
 	}
@@ -102,9 +105,23 @@ func (one *SummaryStruct) Same(another SummaryStruct) bool {
 	if another.NumURL != one.NumURL {
 		return false
 	}
+	if !reflect.DeepEqual(another.Recrawl, one.Recrawl) {
+		return false
+	}
+	if !reflect.DeepEqual(another.DeadLetters, one.DeadLetters) {
+		return false
+	}
 	return true
 }
 
+// sameModuleSummary 用于判断两份组件摘要是否相同。
+// 额外信息中可能含有切片等不可比较的值，因此不能直接用==比较。
+func sameModuleSummary(one module.SummaryStruct, another module.SummaryStruct) bool {
+	extra1, extra2 := one.Extra, another.Extra
+	one.Extra, another.Extra = nil, nil
+	return one == another && reflect.DeepEqual(extra1, extra2)
+}
+
 func (ss *vientianeSchedSummary) Struct() SummaryStruct {
 	registrar := ss.sched.register
 	return SummaryStruct{
@@ -120,6 +137,8 @@ func (ss *vientianeSchedSummary) Struct() SummaryStruct {
 		ItemBufferPool:  getBufferPoolSummary(ss.sched.itemBufferPool),
 		ErrorBufferPool: getBufferPoolSummary(ss.sched.errorBufferPool),
 		NumURL:          ss.sched.urlMap.Len(),
+		Recrawl:         ss.sched.recrawlSummary(),
+		DeadLetters:     ss.sched.deadLetterSummary(),
 	}
 }
 
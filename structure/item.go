@@ -2,7 +2,28 @@ package structure
 
 type Item map[string]interface{}
 
+const (
+	//条目中保存请求元数据的键
+	ITEM_KEY_META = "_meta"
+	//条目中保存响应摘要的键
+	ITEM_KEY_RESPONSE = "_response"
+)
+
 //实现Data接口:判断条目是否有效
 func(item Item)Valid()bool {
 	return item != nil
+}
+
+//用于获取条目所携带的请求元数据
+//分析器会把产生条目的请求的元数据放在ITEM_KEY_META键下
+func(item Item)Meta()map[string]interface{} {
+	meta, _ := item[ITEM_KEY_META].(map[string]interface{})
+	return meta
+}
+
+//用于获取产生条目的响应的摘要
+//分析器会把响应摘要放在ITEM_KEY_RESPONSE键下
+func(item Item)Response()(ResponseSummary,bool) {
+	summary, ok := item[ITEM_KEY_RESPONSE].(ResponseSummary)
+	return summary, ok
 }
\ No newline at end of file
@@ -1,6 +1,13 @@
 package structure
 
-import "net/http"
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
 
 //用于请求的数据结构
 type Request struct {
@@ -8,6 +15,20 @@ type Request struct {
 	httpReq *http.Request
 	//请求的深度
 	depth uint32
+	//请求体，保存下来以便在重试时重放
+	body []byte
+	//读取请求体时发生的错误，不为nil时请求体已经丢失，请求无效
+	bodyErr error
+	//附加在请求上的元数据，会传递给响应、解析函数和条目
+	meta map[string]interface{}
+	//发现此请求的页面的URL
+	referer string
+	//请求的优先级，数值越大越优先
+	priority int
+	//请求已重试的次数
+	retries uint32
+	//是否与发现它的页面处于同一逻辑深度，如分页链接
+	sameDepth bool
 }
 
 //用于获取请求的深度
@@ -20,12 +41,163 @@ func (req *Request) HTTPReq() *http.Request {
 	return req.httpReq
 }
 
+//用于获取请求体
+//没有请求体时返回nil
+func (req *Request) Body() []byte {
+	return req.body
+}
+
+//用于获取读取请求体时发生的错误
+//不为nil时请求体已经丢失，请求不应被发送
+func (req *Request) BodyError() error {
+	return req.bodyErr
+}
+
+//用于重置Http请求的请求体，使请求可以被再次发送
+func (req *Request) ResetBody() {
+	if req.httpReq == nil || req.body == nil {
+		return
+	}
+	body := req.body
+	req.httpReq.Body = ioutil.NopCloser(bytes.NewReader(body))
+	req.httpReq.GetBody = func() (io.ReadCloser, error) {
+		return ioutil.NopCloser(bytes.NewReader(body)), nil
+	}
+	req.httpReq.ContentLength = int64(len(body))
+}
+
+//用于获取指定键的元数据
+func (req *Request) Meta(key string) interface{} {
+	return req.meta[key]
+}
+
+//用于获取所有元数据的副本
+func (req *Request) MetaMap() map[string]interface{} {
+	result := make(map[string]interface{}, len(req.meta))
+	for k, v := range req.meta {
+		result[k] = v
+	}
+	return result
+}
+
+//用于设置元数据
+//应在请求被发送到调度器之前调用
+func (req *Request) SetMeta(key string, value interface{}) *Request {
+	if req.meta == nil {
+		req.meta = map[string]interface{}{}
+	}
+	req.meta[key] = value
+	return req
+}
+
+//用于获取发现此请求的页面的URL
+func (req *Request) Referer() string {
+	return req.referer
+}
+
+//用于设置发现此请求的页面的URL，同时设置Referer请求头
+func (req *Request) SetReferer(referer string) *Request {
+	req.referer = referer
+	if req.httpReq != nil && referer != "" &&
+		req.httpReq.Header.Get("Referer") == "" {
+		if req.httpReq.Header == nil {
+			req.httpReq.Header = http.Header{}
+		}
+		req.httpReq.Header.Set("Referer", referer)
+	}
+	return req
+}
+
+//用于获取请求的优先级
+func (req *Request) Priority() int {
+	return req.priority
+}
+
+//用于设置请求的优先级
+func (req *Request) SetPriority(priority int) *Request {
+	req.priority = priority
+	return req
+}
+
+//用于判断请求是否与发现它的页面处于同一逻辑深度
+func (req *Request) SameDepth() bool {
+	return req.sameDepth
+}
+
+//用于设置请求是否与发现它的页面处于同一逻辑深度
+//为true时分析器不会增加请求的深度，因此不会消耗最大爬取深度
+func (req *Request) SetSameDepth(sameDepth bool) *Request {
+	req.sameDepth = sameDepth
+	return req
+}
+
+//用于获取请求已重试的次数
+func (req *Request) Retries() uint32 {
+	return req.retries
+}
+
+//用于生成一个重试次数加1的请求副本
+func (req *Request) Retry() *Request {
+	newReq := req.copy()
+	newReq.retries++
+	newReq.ResetBody()
+	return newReq
+}
+
+//用于生成一个指定深度的请求副本，其余字段保持不变
+func (req *Request) WithDepth(depth uint32) *Request {
+	newReq := req.copy()
+	newReq.depth = depth
+	return newReq
+}
+
 //实现Data接口:判断请求是否有效
+//读取请求体失败的请求是无效的
 func (req *Request) Valid() bool {
-	return req.httpReq != nil && req.httpReq.URL != nil
+	return req.httpReq != nil && req.httpReq.URL != nil && req.bodyErr == nil
+}
+
+//用于复制请求，元数据会被浅复制
+func (req *Request) copy() *Request {
+	newReq := *req
+	newReq.meta = req.MetaMap()
+	return &newReq
 }
 
 //创建一个请求
+//若Http请求带有请求体，则会读取并保存请求体以便重放
+//读取请求体失败时请求无效，错误可通过BodyError获取
 func NewRequest(req *http.Request, depth uint32) *Request {
-	return &Request{httpReq: req, depth: depth}
+	newReq := &Request{httpReq: req, depth: depth}
+	if req != nil && req.Body != nil && req.Body != http.NoBody {
+		body, err := ioutil.ReadAll(req.Body)
+		req.Body.Close()
+		if err != nil {
+			newReq.bodyErr = fmt.Errorf("couldn't read the request body: %s", err)
+			return newReq
+		}
+		newReq.body = body
+		newReq.ResetBody()
+	}
+	return newReq
+}
+
+//根据方法、URL、请求头和请求体创建一个请求
+func NewRequestWithBody(method string, url string, header http.Header,
+	body []byte, depth uint32) (*Request, error) {
+	var bodyReader io.Reader
+	if body != nil {
+		bodyReader = bytes.NewReader(body)
+	}
+	httpReq, err := http.NewRequest(strings.ToUpper(method), url, bodyReader)
+	if err != nil {
+		return nil, err
+	}
+	for k, values := range header {
+		for _, v := range values {
+			httpReq.Header.Add(k, v)
+		}
+	}
+	newReq := &Request{httpReq: httpReq, depth: depth, body: body}
+	return newReq, nil
 }
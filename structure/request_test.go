@@ -0,0 +1,73 @@
+package structure
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestRequestBodyReplay(t *testing.T) {
+	httpReq, _ := http.NewRequest("POST", "http://example.com/search", bytes.NewReader([]byte("q=go")))
+	req := NewRequest(httpReq, 1)
+	first, _ := ioutil.ReadAll(req.HTTPReq().Body)
+	if string(first) != "q=go" {
+		t.Fatalf("Inconsistent body: %q", first)
+	}
+	//读完之后重置请求体，使请求可以被再次发送
+	req.ResetBody()
+	second, _ := ioutil.ReadAll(req.HTTPReq().Body)
+	if string(second) != "q=go" || req.HTTPReq().ContentLength != 4 {
+		t.Fatalf("The body should be replayable: %q", second)
+	}
+	retried := req.Retry()
+	if retried.Retries() != 1 || req.Retries() != 0 || retried.Depth() != 1 {
+		t.Fatalf("Inconsistent retries: %d %d", retried.Retries(), req.Retries())
+	}
+	body, _ := ioutil.ReadAll(retried.HTTPReq().Body)
+	if string(body) != "q=go" {
+		t.Fatalf("The retried request should resend the body: %q", body)
+	}
+	getReq, _ := http.NewRequest("GET", "http://example.com/", nil)
+	if NewRequest(getReq, 0).Body() != nil {
+		t.Fatalf("A request without a body should have a nil body")
+	}
+	//读取请求体失败的请求无效
+	brokenReq, _ := http.NewRequest("POST", "http://example.com/search",
+		io.MultiReader(strings.NewReader("q="), iotest.ErrReader(errors.New("reset"))))
+	broken := NewRequest(brokenReq, 0)
+	if broken.Valid() || broken.BodyError() == nil || broken.Body() != nil {
+		t.Fatalf("A request whose body couldn't be read should be invalid: %v", broken.BodyError())
+	}
+}
+
+func TestRequestMeta(t *testing.T) {
+	httpReq, _ := http.NewRequest("GET", "http://example.com/list?page=2", nil)
+	req := NewRequest(httpReq, 0).SetMeta("category", "books").
+		SetReferer("http://example.com/").SetPriority(3)
+	if req.Meta("category") != "books" || req.Priority() != 3 {
+		t.Fatalf("Inconsistent request: %+v", req)
+	}
+	if req.HTTPReq().Header.Get("Referer") != "http://example.com/" {
+		t.Fatalf("The referer header should be set: %q", req.HTTPReq().Header.Get("Referer"))
+	}
+	//副本的元数据与原请求互不影响
+	copied := req.WithDepth(2)
+	copied.SetMeta("category", "music")
+	if req.Meta("category") != "books" || copied.Meta("category") != "music" || copied.Depth() != 2 {
+		t.Fatalf("The metadata of the copy should be independent")
+	}
+	meta := req.MetaMap()
+	meta["category"] = "changed"
+	if req.Meta("category") != "books" {
+		t.Fatalf("MetaMap should return a copy")
+	}
+	resp := NewResponseBy(&http.Response{StatusCode: 200, Request: httpReq}, req)
+	if resp.Meta("category") != "books" || resp.Depth() != 0 {
+		t.Fatalf("The response should carry the request metadata")
+	}
+}
@@ -1,6 +1,14 @@
 package structure
 
-import "net/http"
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"golang.org/x/net/html"
+)
 
 //用于响应的数据结构
 type Response struct {
@@ -8,6 +16,67 @@ type Response struct {
 	httpResp *http.Response
 	//响应的深度
 	depth uint32
+	//产生此响应的请求
+	req *Request
+	//获取此响应的下载器的ID
+	mid string
+	//检测出的响应体字符集
+	charset string
+	//重定向经过的URL，不包含最终的URL
+	redirectChain []string
+	//已下载的响应体字节数
+	bytesRead uint64
+	//下载过程的计时信息
+	timing Timing
+	//专用于计时信息的读写锁
+	timingLock sync.RWMutex
+	//解析后的HTML文档树，由各个解析函数共享
+	htmlNode *html.Node
+	//解析HTML文档树时发生的错误
+	htmlErr error
+	//专用于HTML文档树的互斥锁
+	htmlLock sync.Mutex
+	//响应的缓存状态，下载器未使用缓存时为空
+	cacheStatus string
+}
+
+//响应的缓存状态
+const (
+	//缓存的响应仍然新鲜，未访问网络
+	CACHE_STATUS_FRESH = "fresh"
+	//缓存的响应经服务器验证未改变
+	CACHE_STATUS_REVALIDATED = "revalidated"
+	//响应是从网络获取的
+	CACHE_STATUS_FETCHED = "fetched"
+)
+
+//响应下载过程的计时信息
+//有重定向时，DNS、Connect和TLS为各次请求之和
+type Timing struct {
+	//DNS查询耗时
+	DNS time.Duration `json:"dns"`
+	//建立TCP连接耗时
+	Connect time.Duration `json:"connect"`
+	//TLS握手耗时
+	TLS time.Duration `json:"tls"`
+	//从开始下载到收到首个响应字节的耗时
+	TTFB time.Duration `json:"ttfb"`
+	//从开始下载到读完响应体的耗时
+	Total time.Duration `json:"total"`
+}
+
+//响应摘要的类型，便于分析器和条目处理管道保存响应信息
+type ResponseSummary struct {
+	URL           string   `json:"url"`
+	FinalURL      string   `json:"final_url"`
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+	StatusCode    int      `json:"status_code"`
+	Depth         uint32   `json:"depth"`
+	BytesRead     uint64   `json:"bytes_read"`
+	Timing        Timing   `json:"timing"`
+	MID           string   `json:"mid,omitempty"`
+	Charset       string   `json:"charset,omitempty"`
+	CacheStatus   string   `json:"cache_status,omitempty"`
 }
 
 //用于获取的http响应
@@ -20,6 +89,143 @@ func (resp *Response) Depth() uint32 {
 	return resp.depth
 }
 
+//用于获取产生此响应的请求
+//若响应不是由请求创建的则返回nil
+func (resp *Response) Request() *Request {
+	return resp.req
+}
+
+//用于获取产生此响应的请求上的元数据
+func (resp *Response) Meta(key string) interface{} {
+	if resp.req == nil {
+		return nil
+	}
+	return resp.req.Meta(key)
+}
+
+//用于获取重定向之后最终的URL
+func (resp *Response) FinalURL() string {
+	if resp.httpResp == nil || resp.httpResp.Request == nil ||
+		resp.httpResp.Request.URL == nil {
+		return ""
+	}
+	return resp.httpResp.Request.URL.String()
+}
+
+//用于获取重定向经过的URL，按请求的先后排列，不包含最终的URL
+func (resp *Response) RedirectChain() []string {
+	chain := make([]string, len(resp.redirectChain))
+	copy(chain, resp.redirectChain)
+	return chain
+}
+
+//用于设置重定向经过的URL
+func (resp *Response) SetRedirectChain(chain []string) {
+	resp.redirectChain = chain
+}
+
+//用于获取获取此响应的下载器的ID
+func (resp *Response) MID() string {
+	return resp.mid
+}
+
+//用于设置获取此响应的下载器的ID
+func (resp *Response) SetMID(mid string) {
+	resp.mid = mid
+}
+
+//用于获取检测出的响应体字符集
+//分析器检测字符集之前为空
+func (resp *Response) Charset() string {
+	return resp.charset
+}
+
+//用于设置检测出的响应体字符集
+func (resp *Response) SetCharset(charset string) {
+	resp.charset = charset
+}
+
+//用于获取响应的缓存状态，下载器未使用缓存时为空
+func (resp *Response) CacheStatus() string {
+	return resp.cacheStatus
+}
+
+//用于设置响应的缓存状态
+func (resp *Response) SetCacheStatus(status string) {
+	resp.cacheStatus = status
+}
+
+//用于获取已下载的响应体字节数
+//响应体被读完之前该值会持续增长
+func (resp *Response) BytesRead() uint64 {
+	return atomic.LoadUint64(&resp.bytesRead)
+}
+
+//用于增加已下载的响应体字节数
+func (resp *Response) AddBytesRead(n uint64) {
+	atomic.AddUint64(&resp.bytesRead, n)
+}
+
+//用于获取下载过程的计时信息
+func (resp *Response) Timing() Timing {
+	resp.timingLock.RLock()
+	defer resp.timingLock.RUnlock()
+	return resp.timing
+}
+
+//用于设置下载过程的计时信息
+func (resp *Response) SetTiming(timing Timing) {
+	resp.timingLock.Lock()
+	defer resp.timingLock.Unlock()
+	resp.timing = timing
+}
+
+//用于设置下载的总耗时
+func (resp *Response) SetTotalTime(total time.Duration) {
+	resp.timingLock.Lock()
+	defer resp.timingLock.Unlock()
+	resp.timing.Total = total
+}
+
+//用于获取解析后的HTML文档树
+//文档树在第一次调用时从当前的响应体解析，之后的调用会返回同一棵树
+//调用方不应修改文档树
+func (resp *Response) HTMLNode() (*html.Node, error) {
+	resp.htmlLock.Lock()
+	defer resp.htmlLock.Unlock()
+	if resp.htmlNode != nil || resp.htmlErr != nil {
+		return resp.htmlNode, resp.htmlErr
+	}
+	if resp.httpResp == nil || resp.httpResp.Body == nil {
+		return nil, fmt.Errorf("nil HTTP response body")
+	}
+	resp.htmlNode, resp.htmlErr = html.Parse(resp.httpResp.Body)
+	return resp.htmlNode, resp.htmlErr
+}
+
+//用于获取响应的摘要
+func (resp *Response) Summary() ResponseSummary {
+	summary := ResponseSummary{
+		FinalURL:      resp.FinalURL(),
+		RedirectChain: resp.RedirectChain(),
+		Depth:         resp.depth,
+		BytesRead:     resp.BytesRead(),
+		Timing:        resp.Timing(),
+		MID:           resp.mid,
+		Charset:       resp.charset,
+		CacheStatus:   resp.cacheStatus,
+	}
+	if resp.req != nil && resp.req.Valid() {
+		summary.URL = resp.req.HTTPReq().URL.String()
+	} else {
+		summary.URL = summary.FinalURL
+	}
+	if resp.httpResp != nil {
+		summary.StatusCode = resp.httpResp.StatusCode
+	}
+	return summary
+}
+
 //实现Data接口:判断响应是否有效
 func (resp *Response) Valid() bool {
 	return resp.httpResp != nil && resp.httpResp.Body != nil
@@ -29,3 +235,11 @@ func (resp *Response) Valid() bool {
 func NewResponse(resp *http.Response, depth uint32) *Response {
 	return &Response{httpResp: resp, depth: depth}
 }
+
+//根据产生响应的请求创建一个响应，响应的深度与请求一致
+func NewResponseBy(resp *http.Response, req *Request) *Response {
+	if req == nil {
+		return NewResponse(resp, 0)
+	}
+	return &Response{httpResp: resp, depth: req.Depth(), req: req}
+}
@@ -0,0 +1,104 @@
+package charset
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"strings"
+
+	htmlcharset "golang.org/x/net/html/charset"
+	"golang.org/x/text/encoding"
+	"golang.org/x/text/encoding/htmlindex"
+	"golang.org/x/text/transform"
+)
+
+//字符集检测与转码工具
+//检测顺序为BOM、Content-Type头和HTML中的<meta charset>
+
+//用于检测字符集时读取的内容的最大长度
+const PEEK_SIZE = 1024
+
+//默认的字符集，无法检测出字符集时使用
+const DEFAULT_CHARSET = "utf-8"
+
+//用于根据内容开头的字节和Content-Type头检测字符集
+//返回规范化的字符集名称，例如"gbk"、"utf-8"
+//certain代表结果是否来自BOM或Content-Type等确定的来源
+func Detect(head []byte, contentType string) (name string, certain bool) {
+	if len(head) > PEEK_SIZE {
+		head = head[:PEEK_SIZE]
+	}
+	_, name, certain = htmlcharset.DetermineEncoding(head, contentType)
+	if name == "" || name == "windows-1252" && !certain && !hasCharsetHint(head, contentType) {
+		//DetermineEncoding在没有任何线索时会给出windows-1252
+		return DEFAULT_CHARSET, false
+	}
+	return normalize(name), certain
+}
+
+//用于判断Content-Type头或内容中是否声明了字符集
+func hasCharsetHint(head []byte, contentType string) bool {
+	if _, params, err := mime.ParseMediaType(contentType); err == nil {
+		if _, ok := params["charset"]; ok {
+			return true
+		}
+	}
+	return bytes.Contains(bytes.ToLower(head), []byte("charset"))
+}
+
+//用于规范化字符集名称
+func normalize(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	if canonical, err := htmlindex.Name(lookup(name)); err == nil {
+		return strings.ToLower(canonical)
+	}
+	return name
+}
+
+//用于查找字符集对应的编码，找不到时返回nil
+func lookup(name string) encoding.Encoding {
+	enc, err := htmlindex.Get(name)
+	if err != nil {
+		return nil
+	}
+	return enc
+}
+
+//用于判断字符集是否是UTF-8
+func IsUTF8(name string) bool {
+	name = strings.ToLower(strings.TrimSpace(name))
+	return name == "" || name == "utf-8" || name == "utf8"
+}
+
+//用于生成把指定字符集的内容转换为UTF-8的读取器
+//若字符集不受支持则返回错误
+func NewUTF8Reader(reader io.Reader, name string) (io.Reader, error) {
+	if IsUTF8(name) {
+		return reader, nil
+	}
+	enc := lookup(name)
+	if enc == nil {
+		return nil, &UnsupportedError{name: name}
+	}
+	return transform.NewReader(reader, enc.NewDecoder()), nil
+}
+
+//用于把Content-Type头中的字符集替换为指定字符集
+//若Content-Type头无法解析则原样返回
+func ReplaceContentTypeCharset(contentType string, name string) string {
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	params["charset"] = name
+	return mime.FormatMediaType(mediaType, params)
+}
+
+//代表不支持的字符集的错误类型
+type UnsupportedError struct {
+	name string
+}
+
+func (ue *UnsupportedError) Error() string {
+	return "charset: unsupported charset: " + ue.name
+}
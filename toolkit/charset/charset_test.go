@@ -0,0 +1,56 @@
+package charset
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestDetect(t *testing.T) {
+	cases := []struct {
+		head        string
+		contentType string
+		expected    string
+	}{
+		{"<html></html>", "text/html; charset=GBK", "gbk"},
+		{"<html></html>", "text/html; charset=gb2312", "gbk"},
+		{`<html><head><meta charset="gb2312"></head></html>`, "text/html", "gbk"},
+		{`<meta http-equiv="Content-Type" content="text/html; charset=big5">`, "", "big5"},
+		{"\xef\xbb\xbf<html></html>", "text/html; charset=gbk", "utf-8"},
+		{"<html></html>", "text/html", "utf-8"},
+		{"", "", "utf-8"},
+	}
+	for _, c := range cases {
+		name, _ := Detect([]byte(c.head), c.contentType)
+		if name != c.expected {
+			t.Fatalf("Inconsistent charset for %q (content type: %q): expected: %s, actual: %s",
+				c.head, c.contentType, c.expected, name)
+		}
+	}
+}
+
+func TestNewUTF8Reader(t *testing.T) {
+	//"中文"的GBK编码
+	gbkBytes := []byte{0xd6, 0xd0, 0xce, 0xc4}
+	reader, err := NewUTF8Reader(bytes.NewReader(gbkBytes), "gbk")
+	if err != nil {
+		t.Fatalf("An error occurs when creating UTF-8 reader: %s", err)
+	}
+	result, err := ioutil.ReadAll(reader)
+	if err != nil {
+		t.Fatalf("An error occurs when reading: %s", err)
+	}
+	if string(result) != "中文" {
+		t.Fatalf("Inconsistent content: expected: %q, actual: %q", "中文", result)
+	}
+	if _, err = NewUTF8Reader(bytes.NewReader(gbkBytes), "no-such-charset"); err == nil {
+		t.Fatalf("No error when creating reader with unsupported charset!")
+	}
+}
+
+func TestReplaceContentTypeCharset(t *testing.T) {
+	result := ReplaceContentTypeCharset("text/html; charset=GBK", "utf-8")
+	if result != "text/html; charset=utf-8" {
+		t.Fatalf("Inconsistent content type: %q", result)
+	}
+}
@@ -0,0 +1,327 @@
+package deadletter
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	"github.com/Vientiane/errors"
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/kvstore"
+)
+
+//死信队列
+//保存处理失败的请求和条目，以及失败时的错误、组件ID和时间，
+//以便之后检查并重新注入到新的或正在运行的爬取中
+
+const (
+	//保存请求死信的桶
+	BUCKET_REQUESTS = "requests"
+	//保存条目死信的桶
+	BUCKET_ITEMS = "items"
+)
+
+//死信的种类
+const (
+	KIND_REQUEST = "request"
+	KIND_ITEM    = "item"
+)
+
+//死信ID中时间部分的格式，保证ID按照时间先后排列
+const ID_TIME_FORMAT = "20060102T150405.000000000"
+
+//死信的类型
+type Letter struct {
+	//死信的ID
+	ID string `json:"id"`
+	//死信的种类，KIND_REQUEST或KIND_ITEM
+	Kind string `json:"kind"`
+	//进入死信队列的时间
+	Time time.Time `json:"time"`
+	//处理失败的组件的ID，为空代表调度器
+	MID string `json:"mid,omitempty"`
+	//失败的原因
+	Errors []string `json:"errors"`
+	//失败原因中爬虫错误的详细信息，包括错误码和上下文
+	Details []errors.ErrorRecord `json:"details,omitempty"`
+	//失败的请求，仅当种类为KIND_REQUEST时有效
+	Request *RequestRecord `json:"request,omitempty"`
+	//失败的条目，仅当种类为KIND_ITEM时有效
+	//经过JSON编码，数值会变为float64，io.Reader等无法编码的值会被替换为其类型名
+	Item map[string]interface{} `json:"item,omitempty"`
+	//被替换为类型名的字段，请求的元数据字段以meta.为前缀
+	//有这样的字段的死信不能被重新注入，以免替换后的值再次导致处理失败
+	Replaced []string `json:"replaced,omitempty"`
+}
+
+//请求的记录
+type RequestRecord struct {
+	Method    string                 `json:"method"`
+	URL       string                 `json:"url"`
+	Header    http.Header            `json:"header,omitempty"`
+	Body      []byte                 `json:"body,omitempty"`
+	Depth     uint32                 `json:"depth"`
+	Referer   string                 `json:"referer,omitempty"`
+	Priority  int                    `json:"priority,omitempty"`
+	Retries   uint32                 `json:"retries"`
+	SameDepth bool                   `json:"same_depth,omitempty"`
+	Meta      map[string]interface{} `json:"meta,omitempty"`
+}
+
+//用于根据记录重新生成请求，重试次数会被清零
+func (letter *Letter) NewRequest() (*structure.Request, error) {
+	record := letter.Request
+	if letter.Kind != KIND_REQUEST || record == nil {
+		return nil, fmt.Errorf("deadletter: letter %s is not a request", letter.ID)
+	}
+	if err := letter.checkReplaced(); err != nil {
+		return nil, err
+	}
+	req, err := structure.NewRequestWithBody(record.Method, record.URL,
+		record.Header, record.Body, record.Depth)
+	if err != nil {
+		return nil, err
+	}
+	for k, v := range record.Meta {
+		req.SetMeta(k, v)
+	}
+	req.SetReferer(record.Referer).SetPriority(record.Priority).SetSameDepth(record.SameDepth)
+	return req, nil
+}
+
+//用于根据记录重新生成条目
+func (letter *Letter) NewItem() (structure.Item, error) {
+	if letter.Kind != KIND_ITEM || letter.Item == nil {
+		return nil, fmt.Errorf("deadletter: letter %s is not an item", letter.ID)
+	}
+	if err := letter.checkReplaced(); err != nil {
+		return nil, err
+	}
+	item := make(structure.Item, len(letter.Item))
+	for k, v := range letter.Item {
+		item[k] = v
+	}
+	return item, nil
+}
+
+//用于检查死信是否有被替换的字段
+func (letter *Letter) checkReplaced() error {
+	if len(letter.Replaced) == 0 {
+		return nil
+	}
+	return fmt.Errorf("deadletter: letter %s can't be reinjected, its fields were replaced when stored: %s",
+		letter.ID, strings.Join(letter.Replaced, ", "))
+}
+
+//死信队列的类型，并发安全
+type Queue struct {
+	store *kvstore.Store
+	//用于生成死信ID的序号
+	seq uint64
+}
+
+//用于打开死信队列，文件不存在时会被创建
+func Open(path string) (*Queue, error) {
+	store, err := kvstore.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return &Queue{store: store}, nil
+}
+
+//用于获取底层的存储
+func (q *Queue) Store() *kvstore.Store {
+	return q.store
+}
+
+//用于把失败的请求放入死信队列
+func (q *Queue) PutRequest(req *structure.Request, mid string, errs ...error) (*Letter, error) {
+	if req == nil || !req.Valid() {
+		return nil, fmt.Errorf("deadletter: invalid request")
+	}
+	httpReq := req.HTTPReq()
+	letter := q.newLetter(KIND_REQUEST, mid, errs)
+	meta, replaced := encodable(req.MetaMap())
+	for _, k := range replaced {
+		letter.Replaced = append(letter.Replaced, "meta."+k)
+	}
+	letter.Request = &RequestRecord{
+		Method:    httpReq.Method,
+		URL:       httpReq.URL.String(),
+		Header:    httpReq.Header,
+		Body:      req.Body(),
+		Depth:     req.Depth(),
+		Referer:   req.Referer(),
+		Priority:  req.Priority(),
+		Retries:   req.Retries(),
+		SameDepth: req.SameDepth(),
+		Meta:      meta,
+	}
+	return letter, q.put(letter)
+}
+
+//用于把失败的条目放入死信队列
+func (q *Queue) PutItem(item structure.Item, mid string, errs ...error) (*Letter, error) {
+	if item == nil {
+		return nil, fmt.Errorf("deadletter: nil item")
+	}
+	letter := q.newLetter(KIND_ITEM, mid, errs)
+	letter.Item, letter.Replaced = encodable(item)
+	return letter, q.put(letter)
+}
+
+func (q *Queue) newLetter(kind string, mid string, errs []error) *Letter {
+	now := time.Now()
+	seq := atomic.AddUint64(&q.seq, 1)
+	letter := &Letter{
+		ID:   fmt.Sprintf("%s-%06d", now.UTC().Format(ID_TIME_FORMAT), seq%1000000),
+		Kind: kind,
+		Time: now,
+		MID:  mid,
+	}
+	for _, err := range errs {
+		if err == nil {
+			continue
+		}
+		letter.Errors = append(letter.Errors, err.Error())
+		var ce errors.CrawlerError
+		if errors.As(err, &ce) {
+			letter.Details = append(letter.Details, ce.Record())
+		}
+	}
+	return letter
+}
+
+func (q *Queue) put(letter *Letter) error {
+	data, err := json.Marshal(letter)
+	if err != nil {
+		return err
+	}
+	return q.store.Put(bucketOf(letter.Kind), letter.ID, data)
+}
+
+//用于获取死信的桶
+func bucketOf(kind string) string {
+	if kind == KIND_ITEM {
+		return BUCKET_ITEMS
+	}
+	return BUCKET_REQUESTS
+}
+
+//用于根据ID获取死信，不存在时返回kvstore.ErrNotFound
+func (q *Queue) Get(id string) (*Letter, error) {
+	for _, bucket := range []string{BUCKET_REQUESTS, BUCKET_ITEMS} {
+		data, err := q.store.Get(bucket, id)
+		if err == kvstore.ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		letter := &Letter{}
+		if err := json.Unmarshal(data, letter); err != nil {
+			return nil, err
+		}
+		return letter, nil
+	}
+	return nil, kvstore.ErrNotFound
+}
+
+//用于按照时间先后获取指定种类的死信，kind为空代表所有种类
+func (q *Queue) List(kind string) ([]*Letter, error) {
+	var letters []*Letter
+	err := q.ForEach(kind, func(letter *Letter) bool {
+		letters = append(letters, letter)
+		return true
+	})
+	sort.SliceStable(letters, func(i, j int) bool {
+		return letters[i].ID < letters[j].ID
+	})
+	return letters, err
+}
+
+//用于遍历指定种类的死信，kind为空代表所有种类，fn返回false时停止遍历
+func (q *Queue) ForEach(kind string, fn func(letter *Letter) bool) error {
+	buckets := []string{BUCKET_REQUESTS, BUCKET_ITEMS}
+	if kind != "" {
+		buckets = []string{bucketOf(kind)}
+	}
+	var decodeErr error
+	for _, bucket := range buckets {
+		stopped := false
+		err := q.store.ForEach(bucket, "", func(key string, value []byte) bool {
+			letter := &Letter{}
+			if decodeErr = json.Unmarshal(value, letter); decodeErr != nil {
+				stopped = true
+				return false
+			}
+			if !fn(letter) {
+				stopped = true
+				return false
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+		if decodeErr != nil {
+			return decodeErr
+		}
+		if stopped {
+			break
+		}
+	}
+	return nil
+}
+
+//用于删除死信，不存在时不做任何事
+func (q *Queue) Delete(id string) error {
+	for _, bucket := range []string{BUCKET_REQUESTS, BUCKET_ITEMS} {
+		if q.store.Has(bucket, id) {
+			return q.store.Delete(bucket, id)
+		}
+	}
+	return nil
+}
+
+//用于获取指定种类的死信数量，kind为空代表所有种类
+func (q *Queue) Len(kind string) int {
+	if kind != "" {
+		return q.store.Len(bucketOf(kind))
+	}
+	return q.store.Len(BUCKET_REQUESTS) + q.store.Len(BUCKET_ITEMS)
+}
+
+//用于关闭死信队列
+func (q *Queue) Close() error {
+	return q.store.Close()
+}
+
+//用于把无法编码为JSON的值（如io.Reader）替换为其类型名，同时返回被替换的键
+func encodable(m map[string]interface{}) (map[string]interface{}, []string) {
+	if len(m) == 0 {
+		return nil, nil
+	}
+	result := make(map[string]interface{}, len(m))
+	var replaced []string
+	for k, v := range m {
+		if _, ok := v.(io.Reader); ok {
+			result[k] = fmt.Sprintf("%T", v)
+			replaced = append(replaced, k)
+			continue
+		}
+		if _, err := json.Marshal(v); err != nil {
+			result[k] = fmt.Sprintf("%T", v)
+			replaced = append(replaced, k)
+			continue
+		}
+		result[k] = v
+	}
+	sort.Strings(replaced)
+	return result, replaced
+}
@@ -0,0 +1,95 @@
+package deadletter
+
+import (
+	"errors"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Vientiane/structure"
+	"github.com/Vientiane/toolkit/kvstore"
+)
+
+func TestQueue(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead.kv")
+	q, err := Open(path)
+	if err != nil {
+		t.Fatalf("An error occurs when opening the queue: %s", err)
+	}
+	req, _ := structure.NewRequestWithBody("POST", "http://example.com/api",
+		http.Header{"X-Token": {"t"}}, []byte("q=1"), 2)
+	req.SetMeta("page", 3).SetReferer("http://example.com/").SetPriority(5)
+	req = req.Retry()
+	reqLetter, err := q.PutRequest(req, "D1", errors.New("timeout"))
+	if err != nil {
+		t.Fatalf("An error occurs when putting a request: %s", err)
+	}
+	itemLetter, err := q.PutItem(structure.Item{"name": "a", "reader": strings.NewReader("x")},
+		"P1", errors.New("disk full"), nil)
+	if err != nil {
+		t.Fatalf("An error occurs when putting an item: %s", err)
+	}
+	if reqLetter.ID >= itemLetter.ID {
+		t.Fatalf("The IDs should be ordered by time: %s %s", reqLetter.ID, itemLetter.ID)
+	}
+	q.Close()
+
+	q, err = Open(path)
+	if err != nil {
+		t.Fatalf("An error occurs when reopening the queue: %s", err)
+	}
+	defer q.Close()
+	if q.Len("") != 2 || q.Len(KIND_ITEM) != 1 {
+		t.Fatalf("Inconsistent letter number: %d", q.Len(""))
+	}
+	letters, err := q.List("")
+	if err != nil || len(letters) != 2 || letters[0].Kind != KIND_REQUEST {
+		t.Fatalf("Inconsistent letters: %v %v", letters, err)
+	}
+	letter, err := q.Get(reqLetter.ID)
+	if err != nil {
+		t.Fatalf("An error occurs when getting a letter: %s", err)
+	}
+	if letter.MID != "D1" || len(letter.Errors) != 1 || letter.Request.Retries != 1 {
+		t.Fatalf("Inconsistent letter: %+v", letter)
+	}
+	newReq, err := letter.NewRequest()
+	if err != nil {
+		t.Fatalf("An error occurs when creating the request: %s", err)
+	}
+	if newReq.HTTPReq().Method != "POST" || string(newReq.Body()) != "q=1" ||
+		newReq.Depth() != 2 || newReq.Retries() != 0 || newReq.Priority() != 5 ||
+		newReq.Meta("page") != float64(3) || newReq.HTTPReq().Header.Get("X-Token") != "t" {
+		t.Fatalf("Inconsistent request: %+v", newReq)
+	}
+	if _, err := letter.NewItem(); err == nil {
+		t.Fatalf("No error when creating an item from a request letter")
+	}
+	letter, _ = q.Get(itemLetter.ID)
+	if letter.Item["name"] != "a" || letter.Item["reader"] != "*strings.Reader" {
+		t.Fatalf("Inconsistent item: %v", letter.Item)
+	}
+	//有字段被替换的死信不能被重新注入
+	if len(letter.Replaced) != 1 || letter.Replaced[0] != "reader" {
+		t.Fatalf("Inconsistent replaced fields: %v", letter.Replaced)
+	}
+	if _, err := letter.NewItem(); err == nil {
+		t.Fatalf("No error when creating an item with replaced fields")
+	}
+	plainLetter, _ := q.PutItem(structure.Item{"name": "b", "size": 2}, "P1")
+	item, err := plainLetter.NewItem()
+	if err != nil || item["name"] != "b" || len(plainLetter.Replaced) != 0 {
+		t.Fatalf("Inconsistent item: %v %v", item, err)
+	}
+	q.Delete(plainLetter.ID)
+	if len(letter.Errors) != 1 {
+		t.Fatalf("The nil errors should be skipped: %v", letter.Errors)
+	}
+	if err := q.Delete(itemLetter.ID); err != nil {
+		t.Fatalf("An error occurs when deleting a letter: %s", err)
+	}
+	if _, err := q.Get(itemLetter.ID); err != kvstore.ErrNotFound {
+		t.Fatalf("The deleted letter should not be found: %v", err)
+	}
+}
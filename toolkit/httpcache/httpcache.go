@@ -0,0 +1,157 @@
+package httpcache
+
+import (
+	"bufio"
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+//保存原始HTTP响应的磁盘缓存目录
+//每个条目保存为一个文件，文件名为键的SHA-1摘要，按照摘要的前两个字符分目录
+//文件的第一行为JSON格式的条目信息，之后是原始的HTTP响应（状态行、响应头和响应体）
+
+//条目不存在时返回的错误
+var ErrNotFound = errors.New("httpcache: entry not found")
+
+//缓存条目的文件扩展名
+const FILE_EXT = ".http"
+
+//缓存条目
+type Entry struct {
+	//请求的方法
+	Method string `json:"method"`
+	//请求的URL
+	URL string `json:"url"`
+	//请求体，用于区分同一URL上请求体不同的请求
+	RequestBody []byte `json:"request_body,omitempty"`
+	//重定向之后最终的URL
+	FinalURL string `json:"final_url"`
+	//重定向经过的URL，不包含最终的URL
+	RedirectChain []string `json:"redirect_chain,omitempty"`
+	//保存的时间
+	StoredAt time.Time `json:"stored_at"`
+	//原始的HTTP响应
+	Raw []byte `json:"-"`
+}
+
+//用于根据原始的HTTP响应生成HTTP响应，req为最终的请求
+func (e *Entry) Response(req *http.Request) (*http.Response, error) {
+	resp, err := http.ReadResponse(bufio.NewReader(bytes.NewReader(e.Raw)), req)
+	if err != nil {
+		return nil, fmt.Errorf("httpcache: malformed response (URL: %s): %s", e.URL, err)
+	}
+	return resp, nil
+}
+
+//用于生成条目的键，GET请求的键为URL本身
+//其他请求的键还包含方法和请求体的SHA-1摘要，与调度器对请求去重的键一致
+func Key(method, url string, body []byte) string {
+	if method == "" || method == http.MethodGet {
+		return url
+	}
+	return fmt.Sprintf("%s %s %x", method, url, sha1.Sum(body))
+}
+
+//缓存目录
+type Dir struct {
+	root string
+}
+
+//用于打开缓存目录，目录不存在时会被创建
+func NewDir(root string) (*Dir, error) {
+	if root == "" {
+		return nil, fmt.Errorf("httpcache: empty directory")
+	}
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+	return &Dir{root: root}, nil
+}
+
+//用于获取缓存目录的路径
+func (d *Dir) Root() string {
+	return d.root
+}
+
+//用于获取键对应的文件路径
+func (d *Dir) Path(method, url string, body []byte) string {
+	sum := sha1.Sum([]byte(Key(method, url, body)))
+	name := hex.EncodeToString(sum[:])
+	return filepath.Join(d.root, name[:2], name+FILE_EXT)
+}
+
+//用于读取条目，不存在时返回ErrNotFound
+func (d *Dir) Get(method, url string, body []byte) (*Entry, error) {
+	data, err := ioutil.ReadFile(d.Path(method, url, body))
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	i := bytes.IndexByte(data, '\n')
+	if i < 0 {
+		return nil, fmt.Errorf("httpcache: malformed entry (URL: %s)", url)
+	}
+	entry := &Entry{}
+	if err := json.Unmarshal(data[:i], entry); err != nil {
+		return nil, fmt.Errorf("httpcache: malformed entry (URL: %s): %s", url, err)
+	}
+	entry.Raw = data[i+1:]
+	return entry, nil
+}
+
+//实现重放来源的查找方法，与Get相同
+func (d *Dir) Lookup(method, url string, body []byte) (*Entry, error) {
+	return d.Get(method, url, body)
+}
+
+//用于写入条目，已存在的条目会被替换
+//条目先写入临时文件再重命名，因此读取方不会读到不完整的条目
+func (d *Dir) Put(entry *Entry) error {
+	if entry.URL == "" {
+		return fmt.Errorf("httpcache: empty URL")
+	}
+	head, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+	path := d.Path(entry.Method, entry.URL, entry.RequestBody)
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempFile(filepath.Dir(path), ".tmp-")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(append(append(head, '\n'), entry.Raw...))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), path)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	return nil
+}
+
+//用于删除条目，条目不存在时不做任何事
+func (d *Dir) Delete(method, url string, body []byte) error {
+	err := os.Remove(d.Path(method, url, body))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
@@ -0,0 +1,98 @@
+package httpcache
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newEntry(header http.Header, storedAt time.Time) *Entry {
+	resp := &http.Response{StatusCode: 200, Status: "200 OK", Header: header}
+	return &Entry{URL: "http://example.com/", StoredAt: storedAt, Raw: RawResponse(resp, []byte("body"))}
+}
+
+func TestFresh(t *testing.T) {
+	now := time.Now()
+	date := now.Add(-time.Hour).UTC().Format(http.TimeFormat)
+	cases := []struct {
+		header http.Header
+		age    time.Duration
+		fresh  bool
+	}{
+		{http.Header{"Cache-Control": {"max-age=60"}}, 30 * time.Second, true},
+		{http.Header{"Cache-Control": {"max-age=60"}}, 90 * time.Second, false},
+		{http.Header{"Cache-Control": {"max-age=60"}, "Age": {"45"}}, 30 * time.Second, false},
+		{http.Header{"Cache-Control": {"no-cache, max-age=60"}}, time.Second, false},
+		{http.Header{"Date": {date},
+			"Expires": {now.Add(time.Hour).UTC().Format(http.TimeFormat)}}, time.Minute, true},
+		{http.Header{"Expires": {"0"}}, 0, false},
+		//启发式新鲜期为最后修改以来时间的10%，即1天
+		{http.Header{"Date": {now.UTC().Format(http.TimeFormat)},
+			"Last-Modified": {now.Add(-240 * time.Hour).UTC().Format(http.TimeFormat)}}, time.Hour, true},
+		{http.Header{}, 0, false},
+	}
+	for i, c := range cases {
+		entry := newEntry(c.header, now.Add(-c.age))
+		if fresh := entry.Fresh(now); fresh != c.fresh {
+			t.Errorf("case %d: expected fresh %v, got %v", i, c.fresh, fresh)
+		}
+	}
+}
+
+func TestRevalidated(t *testing.T) {
+	entry := newEntry(http.Header{"Etag": {`"v1"`}, "Content-Type": {"text/html"},
+		"Cache-Control": {"max-age=0"}}, time.Now().Add(-time.Hour))
+	req, _ := http.NewRequest("GET", entry.URL, nil)
+	if !entry.SetValidators(req) || req.Header.Get("If-None-Match") != `"v1"` {
+		t.Fatalf("unexpected validators: %v", req.Header)
+	}
+	notModified := &http.Response{StatusCode: 304, Header: http.Header{
+		"Cache-Control": {"max-age=60"}, "Content-Type": {"text/plain"}}}
+	updated, err := entry.Revalidated(notModified, time.Now())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !updated.Fresh(time.Now()) {
+		t.Fatal("expected the revalidated entry to be fresh")
+	}
+	resp, _ := updated.Response(nil)
+	body, _ := ioutil.ReadAll(resp.Body)
+	if string(body) != "body" || resp.Header.Get("Content-Type") != "text/html" {
+		t.Fatalf("unexpected revalidated response: %v %q", resp.Header, body)
+	}
+}
+
+func TestDir(t *testing.T) {
+	dir, err := NewDir(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	entry := newEntry(http.Header{}, time.Now())
+	entry.Method = http.MethodPost
+	entry.RequestBody = []byte("q=1")
+	if err := dir.Put(entry); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := dir.Get(http.MethodGet, entry.URL, nil); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for another method, got %v", err)
+	}
+	if _, err := dir.Get(http.MethodPost, entry.URL, []byte("q=2")); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound for another request body, got %v", err)
+	}
+	got, err := dir.Get(http.MethodPost, entry.URL, []byte("q=1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasSuffix(string(got.Raw), "\r\n\r\nbody") || string(got.RequestBody) != "q=1" {
+		t.Fatalf("unexpected entry %q %q", got.Raw, got.RequestBody)
+	}
+	dir.Delete(http.MethodPost, entry.URL, []byte("q=1"))
+	if _, err := dir.Get(http.MethodPost, entry.URL, []byte("q=1")); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound after deletion, got %v", err)
+	}
+	if Key(http.MethodGet, entry.URL, []byte("ignored")) != entry.URL {
+		t.Fatalf("unexpected key of a GET request: %s", Key(http.MethodGet, entry.URL, nil))
+	}
+}
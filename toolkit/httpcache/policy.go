@@ -0,0 +1,223 @@
+package httpcache
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//缓存的新鲜度和重新验证规则，按照私有缓存的语义实现RFC 9111的主要部分
+
+//启发式新鲜期的上限
+const MAX_HEURISTIC_LIFETIME = 24 * time.Hour
+
+//可以缓存的状态码
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+//用于解析Cache-Control头，指令名会被转换为小写
+func ParseCacheControl(header http.Header) map[string]string {
+	directives := map[string]string{}
+	for _, line := range header["Cache-Control"] {
+		for _, part := range strings.Split(line, ",") {
+			part = strings.TrimSpace(part)
+			if part == "" {
+				continue
+			}
+			name, value := part, ""
+			if i := strings.IndexByte(part, '='); i >= 0 {
+				name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), "\"")
+			}
+			directives[strings.ToLower(strings.TrimSpace(name))] = value
+		}
+	}
+	return directives
+}
+
+//用于判断请求是否可以使用缓存
+//只有GET请求会被缓存，请求头中的no-store会跳过缓存
+func Cacheable(req *http.Request) bool {
+	if req.Method != "" && req.Method != http.MethodGet {
+		return false
+	}
+	_, noStore := ParseCacheControl(req.Header)["no-store"]
+	return !noStore
+}
+
+//用于判断请求是否要求重新验证，即使缓存的响应仍然新鲜
+func MustRevalidate(req *http.Request) bool {
+	cc := ParseCacheControl(req.Header)
+	if _, ok := cc["no-cache"]; ok {
+		return true
+	}
+	if maxAge, ok := cc["max-age"]; ok && maxAge == "0" {
+		return true
+	}
+	return strings.Contains(strings.ToLower(req.Header.Get("Pragma")), "no-cache")
+}
+
+//用于判断响应是否可以保存
+//可以保存的响应需要有新鲜期或者可用于重新验证的ETag或Last-Modified
+func Storable(resp *http.Response, storedAt time.Time) bool {
+	if !cacheableStatus[resp.StatusCode] {
+		return false
+	}
+	if _, noStore := ParseCacheControl(resp.Header)["no-store"]; noStore {
+		return false
+	}
+	if resp.Header.Get("ETag") != "" || resp.Header.Get("Last-Modified") != "" {
+		return true
+	}
+	return lifetime(resp.Header, storedAt) > 0
+}
+
+//用于计算响应的新鲜期
+func lifetime(header http.Header, storedAt time.Time) time.Duration {
+	cc := ParseCacheControl(header)
+	if _, ok := cc["no-cache"]; ok {
+		return 0
+	}
+	if _, ok := cc["no-store"]; ok {
+		return 0
+	}
+	if maxAge, ok := cc["max-age"]; ok {
+		seconds, err := strconv.ParseInt(maxAge, 10, 64)
+		if err != nil || seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	date := storedAt
+	if t, err := http.ParseTime(header.Get("Date")); err == nil {
+		date = t
+	}
+	if expires := header.Get("Expires"); expires != "" {
+		//无效的Expires代表已经过期
+		t, err := http.ParseTime(expires)
+		if err != nil || !t.After(date) {
+			return 0
+		}
+		return t.Sub(date)
+	}
+	//没有明确的新鲜期时，取自最后修改以来时间的10%
+	if t, err := http.ParseTime(header.Get("Last-Modified")); err == nil && date.After(t) {
+		heuristic := date.Sub(t) / 10
+		if heuristic > MAX_HEURISTIC_LIFETIME {
+			heuristic = MAX_HEURISTIC_LIFETIME
+		}
+		return heuristic
+	}
+	return 0
+}
+
+//用于获取条目中响应的响应头
+func (e *Entry) Header() (http.Header, error) {
+	resp, err := e.Response(nil)
+	if err != nil {
+		return nil, err
+	}
+	resp.Body.Close()
+	return resp.Header, nil
+}
+
+//用于判断条目在now时是否仍然新鲜
+func (e *Entry) Fresh(now time.Time) bool {
+	header, err := e.Header()
+	if err != nil {
+		return false
+	}
+	age := now.Sub(e.StoredAt)
+	if seconds, err := strconv.ParseInt(header.Get("Age"), 10, 64); err == nil && seconds > 0 {
+		age += time.Duration(seconds) * time.Second
+	}
+	return lifetime(header, e.StoredAt) > age
+}
+
+//用于给请求加上条目的验证器，返回是否有可用的验证器
+func (e *Entry) SetValidators(req *http.Request) bool {
+	header, err := e.Header()
+	if err != nil {
+		return false
+	}
+	ok := false
+	if etag := header.Get("ETag"); etag != "" {
+		req.Header.Set("If-None-Match", etag)
+		ok = true
+	}
+	if lastModified := header.Get("Last-Modified"); lastModified != "" {
+		req.Header.Set("If-Modified-Since", lastModified)
+		ok = true
+	}
+	return ok
+}
+
+//在重新验证时不应被304响应覆盖的响应头
+var preservedHeaders = map[string]bool{
+	"Content-Length":    true,
+	"Content-Encoding":  true,
+	"Transfer-Encoding": true,
+	"Content-Type":      true,
+}
+
+//用于根据304响应更新条目，返回更新后的条目
+func (e *Entry) Revalidated(notModified *http.Response, now time.Time) (*Entry, error) {
+	resp, err := e.Response(nil)
+	if err != nil {
+		return nil, err
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+	for name, values := range notModified.Header {
+		if preservedHeaders[http.CanonicalHeaderKey(name)] {
+			continue
+		}
+		resp.Header[name] = values
+	}
+	updated := *e
+	updated.StoredAt = now
+	updated.Raw = RawResponse(resp, body)
+	return &updated, nil
+}
+
+//用于生成原始的HTTP响应
+//Go的HTTP客户端会去掉分块传输编码并可能透明地解压响应体，
+//因此会按照给出的响应体修正Content-Length等字段
+func RawResponse(httpResp *http.Response, body []byte) []byte {
+	var b bytes.Buffer
+	status := httpResp.Status
+	if status == "" {
+		status = strconv.Itoa(httpResp.StatusCode) + " " + http.StatusText(httpResp.StatusCode)
+	}
+	//Status可能带有状态码，也可能不带
+	if !strings.HasPrefix(status, strconv.Itoa(httpResp.StatusCode)) {
+		status = strconv.Itoa(httpResp.StatusCode) + " " + status
+	}
+	major, minor := httpResp.ProtoMajor, httpResp.ProtoMinor
+	if major == 0 {
+		major, minor = 1, 1
+	}
+	fmt.Fprintf(&b, "HTTP/%d.%d %s\r\n", major, minor, status)
+	header := httpResp.Header.Clone()
+	if header == nil {
+		header = http.Header{}
+	}
+	header.Del("Transfer-Encoding")
+	if httpResp.Uncompressed {
+		header.Del("Content-Encoding")
+	}
+	header.Set("Content-Length", strconv.Itoa(len(body)))
+	header.Write(&b)
+	b.WriteString("\r\n")
+	b.Write(body)
+	return b.Bytes()
+}
+
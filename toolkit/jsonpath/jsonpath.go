@@ -0,0 +1,656 @@
+package jsonpath
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//JSONPath求值工具
+//支持的语法：
+//  $                根对象
+//  .name ['name']   子成员
+//  .* [*]           所有子成员
+//  ..name ..*       递归查找
+//  [0] [-1]         数组下标，负数代表从末尾开始
+//  [1:3] [::2]      数组切片
+//  [0,2] ['a','b']  多个下标或成员
+//  [?(@.price < 10 && @.tags)]  过滤器，支持==、!=、<、<=、>、>=、&&、||
+//被求值的数据应是encoding/json解码的结果，数字可以是float64或json.Number
+
+//编译后的JSONPath表达式
+type Path struct {
+	//原始表达式
+	raw string
+	//路径片段
+	segments []*segment
+}
+
+//路径片段，由若干选择器组成
+type segment struct {
+	//是否递归查找
+	recursive bool
+	//选择器列表，结果按选择器的顺序合并
+	selectors []selector
+}
+
+//选择器的接口类型
+type selector interface {
+	//用于从给定值中选出子值并追加到结果中
+	selectFrom(value interface{}, result []interface{}) []interface{}
+}
+
+//用于编译JSONPath表达式
+func Compile(expr string) (*Path, error) {
+	p := &parser{expr: strings.TrimSpace(expr)}
+	if !p.consume("$") {
+		return nil, p.errorf("expression should start with '$'")
+	}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	if !p.done() {
+		return nil, p.errorf("unexpected character %q", p.peek())
+	}
+	return &Path{raw: expr, segments: segments}, nil
+}
+
+//用于编译JSONPath表达式，表达式非法时会引发运行时恐慌
+func MustCompile(expr string) *Path {
+	path, err := Compile(expr)
+	if err != nil {
+		panic(err)
+	}
+	return path
+}
+
+//用于对表达式求值并返回所有匹配的值
+func Find(data interface{}, expr string) ([]interface{}, error) {
+	path, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return path.Find(data), nil
+}
+
+//用于返回所有匹配的值
+func (path *Path) Find(data interface{}) []interface{} {
+	return applySegments(path.segments, []interface{}{data})
+}
+
+//用于返回第一个匹配的值，第二个结果值代表是否有匹配的值
+func (path *Path) FindOne(data interface{}) (interface{}, bool) {
+	result := path.Find(data)
+	if len(result) == 0 {
+		return nil, false
+	}
+	return result[0], true
+}
+
+func (path *Path) String() string {
+	return path.raw
+}
+
+//用于依次应用路径片段
+func applySegments(segments []*segment, values []interface{}) []interface{} {
+	for _, seg := range segments {
+		var next []interface{}
+		for _, value := range values {
+			candidates := []interface{}{value}
+			if seg.recursive {
+				candidates = descendants(value, nil)
+			}
+			for _, candidate := range candidates {
+				for _, sel := range seg.selectors {
+					next = sel.selectFrom(candidate, next)
+				}
+			}
+		}
+		values = next
+		if len(values) == 0 {
+			break
+		}
+	}
+	return values
+}
+
+//用于按先序收集值本身及其所有后代值
+func descendants(value interface{}, result []interface{}) []interface{} {
+	result = append(result, value)
+	for _, child := range children(value) {
+		result = descendants(child, result)
+	}
+	return result
+}
+
+//用于获取值的所有直接子值，对象的子值按键排序
+func children(value interface{}) []interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		result := make([]interface{}, 0, len(v))
+		for _, k := range keys {
+			result = append(result, v[k])
+		}
+		return result
+	case []interface{}:
+		return v
+	}
+	return nil
+}
+
+//成员名选择器
+type nameSelector struct {
+	name string
+}
+
+func (ns *nameSelector) selectFrom(value interface{}, result []interface{}) []interface{} {
+	if m, ok := value.(map[string]interface{}); ok {
+		if child, ok := m[ns.name]; ok {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+//通配选择器
+type wildcardSelector struct{}
+
+func (ws *wildcardSelector) selectFrom(value interface{}, result []interface{}) []interface{} {
+	return append(result, children(value)...)
+}
+
+//数组下标选择器
+type indexSelector struct {
+	index int
+}
+
+func (is *indexSelector) selectFrom(value interface{}, result []interface{}) []interface{} {
+	list, ok := value.([]interface{})
+	if !ok {
+		return result
+	}
+	index := is.index
+	if index < 0 {
+		index += len(list)
+	}
+	if index >= 0 && index < len(list) {
+		result = append(result, list[index])
+	}
+	return result
+}
+
+//数组切片选择器
+type sliceSelector struct {
+	start, end, step    int
+	hasStart, hasEnd    bool
+}
+
+func (ss *sliceSelector) selectFrom(value interface{}, result []interface{}) []interface{} {
+	list, ok := value.([]interface{})
+	if !ok || ss.step == 0 {
+		return result
+	}
+	length := len(list)
+	normalize := func(i int) int {
+		if i < 0 {
+			i += length
+		}
+		if i < 0 {
+			return 0
+		}
+		if i > length {
+			return length
+		}
+		return i
+	}
+	if ss.step > 0 {
+		start, end := 0, length
+		if ss.hasStart {
+			start = normalize(ss.start)
+		}
+		if ss.hasEnd {
+			end = normalize(ss.end)
+		}
+		for i := start; i < end; i += ss.step {
+			result = append(result, list[i])
+		}
+		return result
+	}
+	start, end := length-1, -1
+	if ss.hasStart {
+		start = normalize(ss.start)
+		if start >= length {
+			start = length - 1
+		}
+	}
+	if ss.hasEnd {
+		end = normalize(ss.end)
+	}
+	for i := start; i > end; i += ss.step {
+		result = append(result, list[i])
+	}
+	return result
+}
+
+//过滤器选择器
+type filterSelector struct {
+	expr filterExpr
+}
+
+func (fs *filterSelector) selectFrom(value interface{}, result []interface{}) []interface{} {
+	for _, child := range children(value) {
+		if fs.expr.eval(child) {
+			result = append(result, child)
+		}
+	}
+	return result
+}
+
+//过滤表达式的接口类型
+type filterExpr interface {
+	eval(current interface{}) bool
+}
+
+//逻辑与或表达式
+type logicExpr struct {
+	and         bool
+	left, right filterExpr
+}
+
+func (le *logicExpr) eval(current interface{}) bool {
+	if le.and {
+		return le.left.eval(current) && le.right.eval(current)
+	}
+	return le.left.eval(current) || le.right.eval(current)
+}
+
+//比较表达式，没有运算符时判断相对路径是否存在
+type compareExpr struct {
+	//以@开头的相对路径
+	segments []*segment
+	//比较运算符
+	op string
+	//比较的字面值
+	literal interface{}
+}
+
+func (ce *compareExpr) eval(current interface{}) bool {
+	values := applySegments(ce.segments, []interface{}{current})
+	if len(values) == 0 {
+		return false
+	}
+	if ce.op == "" {
+		return true
+	}
+	return compare(values[0], ce.op, ce.literal)
+}
+
+//用于比较两个值
+func compare(left interface{}, op string, right interface{}) bool {
+	if lf, ok := toFloat(left); ok {
+		if rf, ok := toFloat(right); ok {
+			switch op {
+			case "==":
+				return lf == rf
+			case "!=":
+				return lf != rf
+			case "<":
+				return lf < rf
+			case "<=":
+				return lf <= rf
+			case ">":
+				return lf > rf
+			case ">=":
+				return lf >= rf
+			}
+			return false
+		}
+	}
+	if ls, ok := left.(string); ok {
+		if rs, ok := right.(string); ok {
+			switch op {
+			case "==":
+				return ls == rs
+			case "!=":
+				return ls != rs
+			case "<":
+				return ls < rs
+			case "<=":
+				return ls <= rs
+			case ">":
+				return ls > rs
+			case ">=":
+				return ls >= rs
+			}
+			return false
+		}
+	}
+	switch op {
+	case "==":
+		return left == right
+	case "!=":
+		return left != right
+	}
+	return false
+}
+
+//用于把数字类型的值转换为float64
+func toFloat(value interface{}) (float64, bool) {
+	switch v := value.(type) {
+	case float64:
+		return v, true
+	case json.Number:
+		f, err := v.Float64()
+		return f, err == nil
+	case int:
+		return float64(v), true
+	case int64:
+		return float64(v), true
+	}
+	return 0, false
+}
+
+//表达式解析器
+type parser struct {
+	expr string
+	pos  int
+}
+
+func (p *parser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("jsonpath: illegal expression %q at %d: %s",
+		p.expr, p.pos, fmt.Sprintf(format, args...))
+}
+
+func (p *parser) done() bool {
+	return p.pos >= len(p.expr)
+}
+
+func (p *parser) peek() byte {
+	if p.done() {
+		return 0
+	}
+	return p.expr[p.pos]
+}
+
+func (p *parser) skipSpaces() {
+	for !p.done() && p.expr[p.pos] == ' ' {
+		p.pos++
+	}
+}
+
+func (p *parser) consume(s string) bool {
+	if strings.HasPrefix(p.expr[p.pos:], s) {
+		p.pos += len(s)
+		return true
+	}
+	return false
+}
+
+//用于解析路径片段，遇到无法识别的字符时停止
+func (p *parser) parseSegments() ([]*segment, error) {
+	var segments []*segment
+	for !p.done() {
+		var seg *segment
+		var err error
+		switch {
+		case p.consume(".."):
+			if p.peek() == '[' {
+				seg, err = p.parseBracket()
+			} else {
+				seg, err = p.parseDotMember()
+			}
+			if seg != nil {
+				seg.recursive = true
+			}
+		case p.consume("."):
+			seg, err = p.parseDotMember()
+		case p.peek() == '[':
+			seg, err = p.parseBracket()
+		default:
+			return segments, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		segments = append(segments, seg)
+	}
+	return segments, nil
+}
+
+//用于解析点号之后的成员名或通配符
+func (p *parser) parseDotMember() (*segment, error) {
+	if p.consume("*") {
+		return &segment{selectors: []selector{&wildcardSelector{}}}, nil
+	}
+	start := p.pos
+	for !p.done() {
+		c := p.peek()
+		if c == '.' || c == '[' || c == ' ' || c == ')' || c == '=' || c == '!' ||
+			c == '<' || c == '>' || c == '&' || c == '|' {
+			break
+		}
+		p.pos++
+	}
+	if start == p.pos {
+		return nil, p.errorf("empty member name")
+	}
+	return &segment{selectors: []selector{&nameSelector{name: p.expr[start:p.pos]}}}, nil
+}
+
+//用于解析方括号中的选择器
+func (p *parser) parseBracket() (*segment, error) {
+	p.consume("[")
+	seg := &segment{}
+	for {
+		p.skipSpaces()
+		sel, err := p.parseSelector()
+		if err != nil {
+			return nil, err
+		}
+		seg.selectors = append(seg.selectors, sel)
+		p.skipSpaces()
+		if p.consume("]") {
+			return seg, nil
+		}
+		if !p.consume(",") {
+			return nil, p.errorf("expecting ',' or ']'")
+		}
+	}
+}
+
+//用于解析方括号中的单个选择器
+func (p *parser) parseSelector() (selector, error) {
+	switch c := p.peek(); {
+	case c == '*':
+		p.pos++
+		return &wildcardSelector{}, nil
+	case c == '\'' || c == '"':
+		name, err := p.parseString()
+		if err != nil {
+			return nil, err
+		}
+		return &nameSelector{name: name}, nil
+	case c == '?':
+		p.pos++
+		if !p.consume("(") {
+			return nil, p.errorf("expecting '(' after '?'")
+		}
+		expr, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		p.skipSpaces()
+		if !p.consume(")") {
+			return nil, p.errorf("expecting ')'")
+		}
+		return &filterSelector{expr: expr}, nil
+	default:
+		return p.parseIndexOrSlice()
+	}
+}
+
+//用于解析数组下标或切片
+func (p *parser) parseIndexOrSlice() (selector, error) {
+	var parts [3]int
+	var has [3]bool
+	count := 0
+	for count < 3 {
+		p.skipSpaces()
+		start := p.pos
+		if p.peek() == '-' {
+			p.pos++
+		}
+		for !p.done() && p.peek() >= '0' && p.peek() <= '9' {
+			p.pos++
+		}
+		if p.pos > start {
+			n, err := strconv.Atoi(p.expr[start:p.pos])
+			if err != nil {
+				return nil, p.errorf("illegal index %q", p.expr[start:p.pos])
+			}
+			parts[count], has[count] = n, true
+		}
+		count++
+		p.skipSpaces()
+		if !p.consume(":") {
+			break
+		}
+	}
+	if count == 1 {
+		if !has[0] {
+			return nil, p.errorf("empty index")
+		}
+		return &indexSelector{index: parts[0]}, nil
+	}
+	step := 1
+	if has[2] {
+		step = parts[2]
+	}
+	if step == 0 {
+		return nil, p.errorf("zero slice step")
+	}
+	return &sliceSelector{
+		start: parts[0], hasStart: has[0],
+		end: parts[1], hasEnd: has[1],
+		step: step,
+	}, nil
+}
+
+//用于解析单引号或双引号括起来的字符串
+func (p *parser) parseString() (string, error) {
+	quote := p.peek()
+	p.pos++
+	var buf strings.Builder
+	for !p.done() {
+		c := p.peek()
+		p.pos++
+		switch {
+		case c == '\\' && !p.done():
+			buf.WriteByte(p.peek())
+			p.pos++
+		case c == quote:
+			return buf.String(), nil
+		default:
+			buf.WriteByte(c)
+		}
+	}
+	return "", p.errorf("unterminated string")
+}
+
+//用于解析逻辑或表达式
+func (p *parser) parseOr() (filterExpr, error) {
+	left, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("||") {
+			return left, nil
+		}
+		right, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{left: left, right: right}
+	}
+}
+
+//用于解析逻辑与表达式
+func (p *parser) parseAnd() (filterExpr, error) {
+	left, err := p.parseCompare()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		p.skipSpaces()
+		if !p.consume("&&") {
+			return left, nil
+		}
+		right, err := p.parseCompare()
+		if err != nil {
+			return nil, err
+		}
+		left = &logicExpr{and: true, left: left, right: right}
+	}
+}
+
+//用于解析比较表达式
+func (p *parser) parseCompare() (filterExpr, error) {
+	p.skipSpaces()
+	if !p.consume("@") {
+		return nil, p.errorf("filter should start with '@'")
+	}
+	segments, err := p.parseSegments()
+	if err != nil {
+		return nil, err
+	}
+	expr := &compareExpr{segments: segments}
+	p.skipSpaces()
+	for _, op := range []string{"==", "!=", "<=", ">=", "<", ">"} {
+		if p.consume(op) {
+			expr.op = op
+			break
+		}
+	}
+	if expr.op == "" {
+		return expr, nil
+	}
+	p.skipSpaces()
+	expr.literal, err = p.parseLiteral()
+	if err != nil {
+		return nil, err
+	}
+	return expr, nil
+}
+
+//用于解析过滤器中的字面值
+func (p *parser) parseLiteral() (interface{}, error) {
+	switch c := p.peek(); {
+	case c == '\'' || c == '"':
+		return p.parseString()
+	case p.consume("true"):
+		return true, nil
+	case p.consume("false"):
+		return false, nil
+	case p.consume("null"):
+		return nil, nil
+	}
+	start := p.pos
+	for !p.done() && strings.IndexByte("+-.0123456789eE", p.peek()) >= 0 {
+		p.pos++
+	}
+	f, err := strconv.ParseFloat(p.expr[start:p.pos], 64)
+	if err != nil {
+		return nil, p.errorf("illegal literal %q", p.expr[start:p.pos])
+	}
+	return f, nil
+}
@@ -0,0 +1,85 @@
+package jsonpath
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+var testData = `{
+  "store": {
+    "book": [
+      {"title": "A", "price": 8.95, "tags": ["x"]},
+      {"title": "B", "price": 12.99},
+      {"title": "C", "price": 8.99, "isbn": "0-553"},
+      {"title": "D", "price": 22.99, "isbn": "0-395"}
+    ],
+    "bicycle": {"color": "red", "price": 19.95}
+  },
+  "paging": {"next": 12345678901234567890, "has_more": true}
+}`
+
+func decodeTestData(t *testing.T) interface{} {
+	var data interface{}
+	decoder := json.NewDecoder(bytes.NewReader([]byte(testData)))
+	decoder.UseNumber()
+	if err := decoder.Decode(&data); err != nil {
+		t.Fatalf("An error occurs when decoding test data: %s", err)
+	}
+	return data
+}
+
+func titles(values []interface{}) []interface{} {
+	result := []interface{}{}
+	for _, v := range values {
+		if m, ok := v.(map[string]interface{}); ok {
+			result = append(result, m["title"])
+		} else {
+			result = append(result, v)
+		}
+	}
+	return result
+}
+
+func TestFind(t *testing.T) {
+	data := decodeTestData(t)
+	cases := []struct {
+		expr     string
+		expected []interface{}
+	}{
+		{"$.store.book[0].title", []interface{}{"A"}},
+		{"$['store']['book'][-1]", []interface{}{"D"}},
+		{"$.store.book[*].title", []interface{}{"A", "B", "C", "D"}},
+		{"$.store.book[1:3]", []interface{}{"B", "C"}},
+		{"$.store.book[::-2]", []interface{}{"D", "B"}},
+		{"$.store.book[0,2].title", []interface{}{"A", "C"}},
+		{"$..isbn", []interface{}{"0-553", "0-395"}},
+		{"$.store.book[?(@.isbn)]", []interface{}{"C", "D"}},
+		{"$.store.book[?(@.price < 10)]", []interface{}{"A", "C"}},
+		{"$.store.book[?(@.price > 10 && @.title != 'D')]", []interface{}{"B"}},
+		{"$.store.book[?(@.title == 'A' || @.title == \"D\")]", []interface{}{"A", "D"}},
+		{"$.store.bicycle.*", []interface{}{"red", json.Number("19.95")}},
+		{"$.paging.has_more", []interface{}{true}},
+		{"$.paging.next", []interface{}{json.Number("12345678901234567890")}},
+		{"$.store.nothing", []interface{}{}},
+	}
+	for _, c := range cases {
+		result, err := Find(data, c.expr)
+		if err != nil {
+			t.Fatalf("An error occurs when finding %q: %s", c.expr, err)
+		}
+		if actual := titles(result); !reflect.DeepEqual(actual, c.expected) {
+			t.Fatalf("Inconsistent result for %q: expected: %v, actual: %v",
+				c.expr, c.expected, actual)
+		}
+	}
+}
+
+func TestCompileError(t *testing.T) {
+	for _, expr := range []string{"", "store", "$.", "$[", "$[1", "$[?(@.a ==)]", "$['a", "$[::0]", "$.a b"} {
+		if _, err := Compile(expr); err == nil {
+			t.Fatalf("No error when compiling illegal expression %q!", expr)
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package kvstore
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+)
+
+//嵌入式的键值存储
+//数据以追加的方式写入单个日志文件，内存中保存每个键最新记录的位置
+//同一个键的多次写入以最后一次为准，可通过Compact回收被覆盖的记录占用的空间
+//键按照桶（bucket）划分命名空间
+
+//记录头的长度：校验和、桶长度、键长度、值长度
+const HEADER_SIZE = 4 + 2 + 4 + 4
+
+//代表删除标记的值长度
+const TOMBSTONE = ^uint32(0)
+
+//键不存在时返回的错误
+var ErrNotFound = errors.New("kvstore: key not found")
+
+//存储关闭后返回的错误
+var ErrClosed = errors.New("kvstore: store closed")
+
+//写入只读的存储时返回的错误
+var ErrReadOnly = errors.New("kvstore: store opened read-only")
+
+//记录在文件中的位置
+type entry struct {
+	//值在文件中的偏移量
+	offset int64
+	//值的长度
+	size uint32
+}
+
+//键值存储的类型
+type Store struct {
+	path string
+	file *os.File
+	//文件末尾的偏移量
+	size int64
+	//桶名到键到记录位置的索引
+	index map[string]map[string]entry
+	//被覆盖或删除的记录占用的字节数
+	garbage int64
+	//是否只读
+	readOnly bool
+	lock     sync.RWMutex
+}
+
+//用于打开或创建键值存储
+//文件末尾不完整或损坏的记录（如写入时进程退出）会被截掉
+func Open(path string) (*Store, error) {
+	file, err := os.OpenFile(path, os.O_RDWR|os.O_CREATE, 0644)
+	if err != nil {
+		return nil, err
+	}
+	return open(path, file, false)
+}
+
+//用于以只读方式打开已存在的键值存储，可以用于查看正在被其他进程写入的存储
+//文件末尾不完整或损坏的记录会被忽略而不会被截掉，写入和压缩会返回ErrReadOnly
+func OpenReadOnly(path string) (*Store, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	return open(path, file, true)
+}
+
+func open(path string, file *os.File, readOnly bool) (*Store, error) {
+	s := &Store{path: path, file: file, index: map[string]map[string]entry{}, readOnly: readOnly}
+	if err := s.load(); err != nil {
+		file.Close()
+		return nil, err
+	}
+	return s, nil
+}
+
+//用于读取日志文件并建立索引
+func (s *Store) load() error {
+	r := bufio.NewReader(io.NewSectionReader(s.file, 0, 1<<62))
+	var offset int64
+	for {
+		bucket, key, value, n, err := readRecord(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			//不完整或损坏的尾部记录，只读时可能是其他进程正在写入的记录
+			if s.readOnly {
+				break
+			}
+			if err := s.file.Truncate(offset); err != nil {
+				return err
+			}
+			break
+		}
+		valueOffset := offset + int64(n) - int64(len(value))
+		if value == nil {
+			s.remove(bucket, key, int64(n))
+		} else {
+			s.set(bucket, key, entry{offset: valueOffset, size: uint32(len(value))})
+		}
+		offset += int64(n)
+	}
+	s.size = offset
+	return nil
+}
+
+//用于读取一条记录，值为nil代表删除标记，n为记录的总长度
+func readRecord(r io.Reader) (bucket, key string, value []byte, n int, err error) {
+	header := make([]byte, HEADER_SIZE)
+	if _, err = io.ReadFull(r, header); err != nil {
+		if err == io.ErrUnexpectedEOF {
+			err = fmt.Errorf("kvstore: truncated record")
+		}
+		return
+	}
+	sum := binary.BigEndian.Uint32(header[0:4])
+	bucketLen := binary.BigEndian.Uint16(header[4:6])
+	keyLen := binary.BigEndian.Uint32(header[6:10])
+	valueLen := binary.BigEndian.Uint32(header[10:14])
+	bodyLen := int(bucketLen) + int(keyLen)
+	if valueLen != TOMBSTONE {
+		bodyLen += int(valueLen)
+	}
+	body := make([]byte, bodyLen)
+	if _, err = io.ReadFull(r, body); err != nil {
+		err = fmt.Errorf("kvstore: truncated record")
+		return
+	}
+	crc := crc32.NewIEEE()
+	crc.Write(header[4:])
+	crc.Write(body)
+	if crc.Sum32() != sum {
+		err = fmt.Errorf("kvstore: corrupted record")
+		return
+	}
+	bucket = string(body[:bucketLen])
+	key = string(body[bucketLen : int(bucketLen)+int(keyLen)])
+	if valueLen != TOMBSTONE {
+		value = body[int(bucketLen)+int(keyLen):]
+	}
+	n = HEADER_SIZE + bodyLen
+	return
+}
+
+//用于编码一条记录，值为nil代表删除标记
+func encodeRecord(bucket, key string, value []byte) []byte {
+	bodyLen := len(bucket) + len(key) + len(value)
+	record := make([]byte, HEADER_SIZE+bodyLen)
+	binary.BigEndian.PutUint16(record[4:6], uint16(len(bucket)))
+	binary.BigEndian.PutUint32(record[6:10], uint32(len(key)))
+	if value == nil {
+		binary.BigEndian.PutUint32(record[10:14], TOMBSTONE)
+	} else {
+		binary.BigEndian.PutUint32(record[10:14], uint32(len(value)))
+	}
+	body := record[HEADER_SIZE:]
+	copy(body, bucket)
+	copy(body[len(bucket):], key)
+	copy(body[len(bucket)+len(key):], value)
+	binary.BigEndian.PutUint32(record[0:4], crc32.ChecksumIEEE(record[4:]))
+	return record
+}
+
+//用于更新索引
+func (s *Store) set(bucket, key string, e entry) {
+	keys, ok := s.index[bucket]
+	if !ok {
+		keys = map[string]entry{}
+		s.index[bucket] = keys
+	}
+	if old, ok := keys[key]; ok {
+		s.garbage += recordLength(bucket, key, old.size)
+	}
+	keys[key] = e
+}
+
+//用于从索引中删除键，recordSize为删除标记的总长度
+func (s *Store) remove(bucket, key string, recordSize int64) {
+	s.garbage += recordSize
+	keys := s.index[bucket]
+	if old, ok := keys[key]; ok {
+		s.garbage += recordLength(bucket, key, old.size)
+		delete(keys, key)
+	}
+	if len(keys) == 0 {
+		delete(s.index, bucket)
+	}
+}
+
+func recordLength(bucket, key string, valueSize uint32) int64 {
+	return int64(HEADER_SIZE+len(bucket)+len(key)) + int64(valueSize)
+}
+
+func checkKey(bucket, key string) error {
+	if bucket == "" || len(bucket) > 0xFFFF {
+		return fmt.Errorf("kvstore: invalid bucket length %d", len(bucket))
+	}
+	if key == "" {
+		return fmt.Errorf("kvstore: empty key")
+	}
+	return nil
+}
+
+//用于写入键值，已存在的键会被覆盖
+func (s *Store) Put(bucket, key string, value []byte) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	if value == nil {
+		value = []byte{}
+	}
+	if uint64(len(value)) >= uint64(TOMBSTONE) {
+		return fmt.Errorf("kvstore: value too large")
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	record := encodeRecord(bucket, key, value)
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		return err
+	}
+	e := entry{offset: s.size + int64(len(record)-len(value)), size: uint32(len(value))}
+	s.size += int64(len(record))
+	s.set(bucket, key, e)
+	return nil
+}
+
+//用于读取键对应的值，键不存在时返回ErrNotFound
+func (s *Store) Get(bucket, key string) ([]byte, error) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if s.file == nil {
+		return nil, ErrClosed
+	}
+	e, ok := s.index[bucket][key]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	value := make([]byte, e.size)
+	if _, err := s.file.ReadAt(value, e.offset); err != nil {
+		return nil, err
+	}
+	return value, nil
+}
+
+//用于判断键是否存在
+func (s *Store) Has(bucket, key string) bool {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	_, ok := s.index[bucket][key]
+	return ok
+}
+
+//用于删除键，键不存在时不做任何事
+func (s *Store) Delete(bucket, key string) error {
+	if err := checkKey(bucket, key); err != nil {
+		return err
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	if _, ok := s.index[bucket][key]; !ok {
+		return nil
+	}
+	record := encodeRecord(bucket, key, nil)
+	if _, err := s.file.WriteAt(record, s.size); err != nil {
+		return err
+	}
+	s.size += int64(len(record))
+	s.remove(bucket, key, int64(len(record)))
+	return nil
+}
+
+//用于获取所有的桶名，按字典序排列
+func (s *Store) Buckets() []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	buckets := make([]string, 0, len(s.index))
+	for bucket := range s.index {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+//用于获取桶中以prefix开头的所有键，按字典序排列
+func (s *Store) Keys(bucket, prefix string) []string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	keys := make([]string, 0)
+	for key := range s.index[bucket] {
+		if strings.HasPrefix(key, prefix) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+//用于获取桶中键的数量
+func (s *Store) Len(bucket string) int {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return len(s.index[bucket])
+}
+
+//用于按键的字典序遍历桶中以prefix开头的键值，fn返回false时停止遍历
+//遍历期间写入的键值可能不会被遍历到
+func (s *Store) ForEach(bucket, prefix string, fn func(key string, value []byte) bool) error {
+	for _, key := range s.Keys(bucket, prefix) {
+		value, err := s.Get(bucket, key)
+		if err == ErrNotFound {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		if !fn(key, value) {
+			break
+		}
+	}
+	return nil
+}
+
+//用于获取被覆盖或删除的记录占用的字节数以及文件的总字节数
+func (s *Store) Garbage() (garbage int64, size int64) {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	return s.garbage, s.size
+}
+
+//用于重写日志文件，只保留每个键最新的记录
+func (s *Store) Compact() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.readOnly {
+		return ErrReadOnly
+	}
+	tmpPath := s.path + ".compact"
+	tmp, err := os.OpenFile(tmpPath, os.O_RDWR|os.O_CREATE|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	index := map[string]map[string]entry{}
+	w := bufio.NewWriter(tmp)
+	var offset int64
+	for bucket, keys := range s.index {
+		index[bucket] = make(map[string]entry, len(keys))
+		for key, e := range keys {
+			value := make([]byte, e.size)
+			if _, err = s.file.ReadAt(value, e.offset); err != nil {
+				break
+			}
+			record := encodeRecord(bucket, key, value)
+			if _, err = w.Write(record); err != nil {
+				break
+			}
+			index[bucket][key] = entry{offset: offset + int64(len(record)-len(value)), size: e.size}
+			offset += int64(len(record))
+		}
+		if err != nil {
+			break
+		}
+	}
+	if err == nil {
+		err = w.Flush()
+	}
+	if err == nil {
+		err = tmp.Sync()
+	}
+	if err == nil {
+		err = os.Rename(tmpPath, s.path)
+	}
+	if err != nil {
+		tmp.Close()
+		os.Remove(tmpPath)
+		return err
+	}
+	s.file.Close()
+	s.file = tmp
+	s.index = index
+	s.size = offset
+	s.garbage = 0
+	return nil
+}
+
+//用于把数据同步到磁盘
+func (s *Store) Sync() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return ErrClosed
+	}
+	if s.readOnly {
+		return nil
+	}
+	return s.file.Sync()
+}
+
+//用于判断存储是否只读
+func (s *Store) ReadOnly() bool {
+	return s.readOnly
+}
+
+//用于关闭存储，关闭前会把数据同步到磁盘
+func (s *Store) Close() error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if s.file == nil {
+		return nil
+	}
+	var err error
+	if !s.readOnly {
+		err = s.file.Sync()
+	}
+	if closeErr := s.file.Close(); err == nil {
+		err = closeErr
+	}
+	s.file = nil
+	return err
+}
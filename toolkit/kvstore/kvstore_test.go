@@ -0,0 +1,86 @@
+package kvstore
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStore(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "data.kv")
+	s, err := Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Put("items", "a", []byte("1"))
+	s.Put("items", "b", []byte("2"))
+	s.Put("items", "a", []byte("3"))
+	s.Put("pages", "http://x/", []byte{})
+	s.Delete("items", "b")
+	if value, err := s.Get("items", "a"); err != nil || string(value) != "3" {
+		t.Fatalf("unexpected value %q (error: %v)", value, err)
+	}
+	if _, err := s.Get("items", "b"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound, got %v", err)
+	}
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+	//模拟写入时中断留下的不完整记录
+	file, _ := os.OpenFile(path, os.O_WRONLY|os.O_APPEND, 0644)
+	file.Write(encodeRecord("items", "c", []byte("torn"))[:10])
+	file.Close()
+
+	//只读打开时不应截掉不完整的记录，也不应允许写入
+	info, _ := os.Stat(path)
+	r, err := OpenReadOnly(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if keys := r.Keys("items", ""); len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("unexpected keys of the read-only store: %v", keys)
+	}
+	if err := r.Put("items", "e", []byte("5")); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := r.Compact(); err != ErrReadOnly {
+		t.Fatalf("expected ErrReadOnly, got %v", err)
+	}
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if after, _ := os.Stat(path); after.Size() != info.Size() {
+		t.Fatalf("the read-only store changed the file size: %d -> %d", info.Size(), after.Size())
+	}
+	if _, err := OpenReadOnly(filepath.Join(t.TempDir(), "missing.kv")); err == nil {
+		t.Fatal("expected an error when opening a missing store read-only")
+	}
+
+	s, err = Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	if keys := s.Keys("items", ""); len(keys) != 1 || keys[0] != "a" {
+		t.Fatalf("unexpected keys after reopening: %v", keys)
+	}
+	if value, err := s.Get("pages", "http://x/"); err != nil || len(value) != 0 {
+		t.Fatalf("unexpected empty value %q (error: %v)", value, err)
+	}
+	if garbage, _ := s.Garbage(); garbage == 0 {
+		t.Fatal("expected garbage from overwritten records")
+	}
+	if err := s.Compact(); err != nil {
+		t.Fatal(err)
+	}
+	if garbage, _ := s.Garbage(); garbage != 0 {
+		t.Fatalf("unexpected garbage after compaction: %d", garbage)
+	}
+	s.Put("items", "d", []byte("4"))
+	if value, err := s.Get("items", "a"); err != nil || string(value) != "3" {
+		t.Fatalf("unexpected value after compaction %q (error: %v)", value, err)
+	}
+	if buckets := s.Buckets(); len(buckets) != 2 {
+		t.Fatalf("unexpected buckets: %v", buckets)
+	}
+}
@@ -0,0 +1,376 @@
+package links
+
+import (
+	"net/url"
+	"regexp"
+	"strings"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+)
+
+//HTML链接抽取工具
+//在解析函数中可通过structure.Response.HTMLNode()获得文档树，再用本包抽取其中的链接，
+//相对链接会基于<base href>或页面URL解析为绝对URL
+
+//链接所在的伪标签名称
+const (
+	//CSS中的url()和@import，包括<style>元素和style属性
+	TAG_CSS = "css"
+)
+
+//链接的类型
+type Link struct {
+	//绝对URL，不含片段标识
+	URL string `json:"url"`
+	//链接所在的标签名称，如"a"、"img"，CSS中的链接为TAG_CSS
+	Tag string `json:"tag"`
+	//链接所在的属性名称，如"href"、"srcset"，元素内容中的链接为空
+	Attr string `json:"attr,omitempty"`
+	//链接的rel属性值，已转换为小写
+	Rel []string `json:"rel,omitempty"`
+	//链接的文本，仅对<a>有效
+	Text string `json:"text,omitempty"`
+	//链接是否不应被跟进，rel=nofollow或<meta name="robots" content="nofollow">时为true
+	NoFollow bool `json:"nofollow,omitempty"`
+	//链接是否是页面的规范URL，即<link rel="canonical">
+	Canonical bool `json:"canonical,omitempty"`
+}
+
+//抽取选项的类型，零值代表抽取所有链接
+type Options struct {
+	//需要抽取的标签名称，如"a"、"img"或TAG_CSS，为空代表不限制
+	Tags []string
+	//是否忽略不应被跟进的链接
+	SkipNoFollow bool
+}
+
+//用于判断是否需要抽取某标签中的链接
+func (opts *Options) accept(tag string) bool {
+	if opts == nil || len(opts.Tags) == 0 {
+		return true
+	}
+	for _, t := range opts.Tags {
+		if strings.EqualFold(t, tag) {
+			return true
+		}
+	}
+	return false
+}
+
+//元素及其包含链接的属性
+var linkAttrs = map[atom.Atom][]string{
+	atom.A:      {"href"},
+	atom.Area:   {"href"},
+	atom.Link:   {"href"},
+	atom.Iframe: {"src"},
+	atom.Frame:  {"src"},
+	atom.Img:    {"src", "srcset"},
+	atom.Source: {"src", "srcset"},
+	atom.Script: {"src"},
+	atom.Embed:  {"src"},
+	atom.Video:  {"src", "poster"},
+	atom.Audio:  {"src"},
+	atom.Track:  {"src"},
+	atom.Form:   {"action"},
+}
+
+//CSS中的url()和@import
+var cssURLRegexp = regexp.MustCompile(
+	`(?i)url\(\s*(?:"([^"]*)"|'([^']*)'|([^)'"\s]*))\s*\)|@import\s+(?:"([^"]*)"|'([^']*)')`)
+
+//meta refresh中的URL部分
+var refreshRegexp = regexp.MustCompile(`(?i)^\s*[\d.]+\s*[;,]?\s*(?:url\s*=\s*)?(.*)$`)
+
+//用于抽取文档树中的链接
+//pageURL为页面的URL，用于解析相对链接，可以为nil
+//结果按照在文档中出现的顺序排列，相同标签和属性中的重复链接会被去除
+func Extract(root *html.Node, pageURL *url.URL, opts *Options) []Link {
+	e := &extractor{
+		base: BaseURL(root, pageURL),
+		opts: opts,
+		seen: map[string]bool{},
+	}
+	e.noFollowAll = robotsNoFollow(root)
+	e.walk(root)
+	return e.links
+}
+
+//链接抽取器
+type extractor struct {
+	base        *url.URL
+	opts        *Options
+	noFollowAll bool
+	seen        map[string]bool
+	links       []Link
+}
+
+func (e *extractor) walk(n *html.Node) {
+	if n.Type == html.ElementNode {
+		e.element(n)
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		e.walk(c)
+	}
+}
+
+//用于抽取单个元素中的链接
+func (e *extractor) element(n *html.Node) {
+	tag := n.Data
+	if e.opts.accept(tag) {
+		rel := relOf(n)
+		for _, attr := range linkAttrs[n.DataAtom] {
+			value, exists := Attr(n, attr)
+			if !exists {
+				continue
+			}
+			link := Link{Tag: tag, Attr: attr, Rel: rel}
+			link.NoFollow = e.noFollowAll || contains(rel, "nofollow")
+			link.Canonical = n.DataAtom == atom.Link && contains(rel, "canonical")
+			if n.DataAtom == atom.A {
+				link.Text = strings.Join(strings.Fields(textOf(n)), " ")
+			}
+			switch {
+			case attr == "srcset":
+				for _, candidate := range ParseSrcset(value) {
+					e.add(link, candidate)
+				}
+			case n.DataAtom == atom.Form && strings.TrimSpace(value) == "":
+				//空的action代表提交到当前页面
+				if e.base != nil {
+					e.add(link, e.base.String())
+				}
+			default:
+				e.add(link, value)
+			}
+		}
+		if n.DataAtom == atom.Meta {
+			if equiv, _ := Attr(n, "http-equiv"); strings.EqualFold(strings.TrimSpace(equiv), "refresh") {
+				content, _ := Attr(n, "content")
+				if target := refreshURL(content); target != "" {
+					e.add(Link{Tag: tag, Attr: "content", NoFollow: e.noFollowAll}, target)
+				}
+			}
+		}
+	}
+	if e.opts.accept(TAG_CSS) {
+		if style, exists := Attr(n, "style"); exists {
+			e.addCSS(style, "style")
+		}
+		if n.DataAtom == atom.Style {
+			e.addCSS(textOf(n), "")
+		}
+	}
+}
+
+//用于抽取CSS中的链接
+func (e *extractor) addCSS(css string, attr string) {
+	for _, u := range CSSURLs(css) {
+		e.add(Link{Tag: TAG_CSS, Attr: attr, NoFollow: e.noFollowAll}, u)
+	}
+}
+
+//用于解析并添加链接，会忽略无效、重复和非HTTP的链接
+func (e *extractor) add(link Link, rawURL string) {
+	absURL, ok := Resolve(e.base, rawURL)
+	if !ok {
+		return
+	}
+	if e.opts != nil && e.opts.SkipNoFollow && link.NoFollow {
+		return
+	}
+	key := link.Tag + " " + link.Attr + " " + absURL
+	if e.seen[key] {
+		return
+	}
+	e.seen[key] = true
+	link.URL = absURL
+	e.links = append(e.links, link)
+}
+
+//用于把链接解析为绝对URL
+//空链接、单纯的锚点以及javascript、mailto、data等非HTTP链接会被忽略，片段标识会被去除
+func Resolve(base *url.URL, link string) (string, bool) {
+	link = strings.TrimSpace(link)
+	if link == "" || strings.HasPrefix(link, "#") {
+		return "", false
+	}
+	linkURL, err := url.Parse(link)
+	if err != nil {
+		return "", false
+	}
+	if !linkURL.IsAbs() && base != nil {
+		linkURL = base.ResolveReference(linkURL)
+	}
+	scheme := strings.ToLower(linkURL.Scheme)
+	if scheme != "http" && scheme != "https" {
+		return "", false
+	}
+	linkURL.Fragment = ""
+	return linkURL.String(), true
+}
+
+//用于获取解析相对链接所用的基础URL，会考虑文档中第一个<base href>
+func BaseURL(root *html.Node, pageURL *url.URL) *url.URL {
+	baseNode := findElement(root, func(n *html.Node) bool {
+		_, exists := Attr(n, "href")
+		return n.DataAtom == atom.Base && exists
+	})
+	if baseNode == nil {
+		return pageURL
+	}
+	href, _ := Attr(baseNode, "href")
+	baseHref, err := url.Parse(strings.TrimSpace(href))
+	if err != nil {
+		return pageURL
+	}
+	if pageURL == nil {
+		if baseHref.IsAbs() {
+			return baseHref
+		}
+		return nil
+	}
+	return pageURL.ResolveReference(baseHref)
+}
+
+//用于解析srcset属性，返回其中的所有URL
+//按照HTML规范，URL之后紧跟的逗号或描述符之后的逗号才是分隔符，URL中可以含有逗号
+func ParseSrcset(srcset string) []string {
+	var urls []string
+	isSpace := func(c byte) bool {
+		return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+	}
+	for i := 0; i < len(srcset); {
+		for i < len(srcset) && (isSpace(srcset[i]) || srcset[i] == ',') {
+			i++
+		}
+		start := i
+		for i < len(srcset) && !isSpace(srcset[i]) {
+			i++
+		}
+		if start == i {
+			break
+		}
+		rawURL := srcset[start:i]
+		if strings.HasSuffix(rawURL, ",") {
+			//没有描述符的候选项
+			urls = append(urls, strings.TrimRight(rawURL, ","))
+			continue
+		}
+		urls = append(urls, rawURL)
+		//跳过描述符，括号中的逗号不是分隔符
+		depth := 0
+		for ; i < len(srcset); i++ {
+			if srcset[i] == '(' {
+				depth++
+			} else if srcset[i] == ')' && depth > 0 {
+				depth--
+			} else if srcset[i] == ',' && depth == 0 {
+				break
+			}
+		}
+	}
+	return urls
+}
+
+//用于抽取CSS中url()和@import引用的URL
+func CSSURLs(css string) []string {
+	var urls []string
+	for _, m := range cssURLRegexp.FindAllStringSubmatch(css, -1) {
+		for _, group := range m[1:] {
+			if group = strings.TrimSpace(group); group != "" {
+				urls = append(urls, group)
+				break
+			}
+		}
+	}
+	return urls
+}
+
+//用于获取meta refresh中的URL，如"5; url=/next"
+func refreshURL(content string) string {
+	m := refreshRegexp.FindStringSubmatch(content)
+	if m == nil {
+		return ""
+	}
+	return strings.Trim(strings.TrimSpace(m[1]), `"'`)
+}
+
+//用于判断文档是否通过<meta name="robots">禁止跟进链接
+func robotsNoFollow(root *html.Node) bool {
+	meta := findElement(root, func(n *html.Node) bool {
+		if n.DataAtom != atom.Meta {
+			return false
+		}
+		name, _ := Attr(n, "name")
+		if !strings.EqualFold(strings.TrimSpace(name), "robots") {
+			return false
+		}
+		content, _ := Attr(n, "content")
+		for _, directive := range strings.Split(strings.ToLower(content), ",") {
+			directive = strings.TrimSpace(directive)
+			if directive == "nofollow" || directive == "none" {
+				return true
+			}
+		}
+		return false
+	})
+	return meta != nil
+}
+
+//用于获取元素的rel属性值
+func relOf(n *html.Node) []string {
+	rel, exists := Attr(n, "rel")
+	if !exists {
+		return nil
+	}
+	return strings.Fields(strings.ToLower(rel))
+}
+
+//用于获取元素的属性值，属性名称不区分大小写
+func Attr(n *html.Node, name string) (string, bool) {
+	for _, attr := range n.Attr {
+		if attr.Namespace == "" && strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+//用于获取节点包含的全部文本
+func textOf(n *html.Node) string {
+	var sb strings.Builder
+	var walk func(*html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.TextNode {
+			sb.WriteString(n.Data)
+		}
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(n)
+	return sb.String()
+}
+
+//用于按照文档顺序查找第一个满足条件的元素
+func findElement(n *html.Node, match func(*html.Node) bool) *html.Node {
+	if n.Type == html.ElementNode && match(n) {
+		return n
+	}
+	for c := n.FirstChild; c != nil; c = c.NextSibling {
+		if found := findElement(c, match); found != nil {
+			return found
+		}
+	}
+	return nil
+}
+
+func contains(list []string, s string) bool {
+	for _, e := range list {
+		if e == s {
+			return true
+		}
+	}
+	return false
+}
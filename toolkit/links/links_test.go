@@ -0,0 +1,108 @@
+package links
+
+import (
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var testPage = `<!DOCTYPE html>
+<html><head>
+<base href="/Docs/">
+<link rel="canonical" href="http://example.com/Docs/Index.html">
+<link rel="stylesheet" href="Style.css">
+<meta http-equiv="refresh" content="5; URL='Next.html'">
+<style>body { background: url("/img/Bg.png"); } @import 'print.css';</style>
+</head><body>
+<a href="Guide/Intro.html#top">Intro
+  guide</a>
+<a href="http://other.com/Page" rel="nofollow external">Other</a>
+<a href="javascript:void(0)">JS</a>
+<a href="mailto:a@example.com">Mail</a>
+<a href="#section">Anchor</a>
+<a href="Guide/Intro.html">Intro again</a>
+<img src="Logo.PNG" srcset="small.jpg 1x, large.jpg 2x, a,b.jpg 3x">
+<img srcset="c.jpg, d.jpg">
+<iframe src="//cdn.example.com/Frame"></iframe>
+<map><area href="Area.html"></map>
+<form action=""></form>
+<form action="/search"></form>
+<div style="background-image: url(Div.png)"></div>
+</body></html>`
+
+func TestExtract(t *testing.T) {
+	root, err := html.Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing HTML: %s", err)
+	}
+	pageURL, _ := url.Parse("http://example.com/Path/Page.html")
+	var actual []string
+	for _, link := range Extract(root, pageURL, nil) {
+		actual = append(actual, link.Tag+" "+link.Attr+" "+link.URL)
+	}
+	expected := []string{
+		"link href http://example.com/Docs/Index.html",
+		"link href http://example.com/Docs/Style.css",
+		"meta content http://example.com/Docs/Next.html",
+		"css  http://example.com/img/Bg.png",
+		"css  http://example.com/Docs/print.css",
+		"a href http://example.com/Docs/Guide/Intro.html",
+		"a href http://other.com/Page",
+		"img src http://example.com/Docs/Logo.PNG",
+		"img srcset http://example.com/Docs/small.jpg",
+		"img srcset http://example.com/Docs/large.jpg",
+		"img srcset http://example.com/Docs/a,b.jpg",
+		"img srcset http://example.com/Docs/c.jpg",
+		"img srcset http://example.com/Docs/d.jpg",
+		"iframe src http://cdn.example.com/Frame",
+		"area href http://example.com/Docs/Area.html",
+		"form action http://example.com/Docs/",
+		"form action http://example.com/search",
+		"css style http://example.com/Docs/Div.png",
+	}
+	if !reflect.DeepEqual(actual, expected) {
+		t.Fatalf("Inconsistent links:\nexpected: %q\nactual:   %q", expected, actual)
+	}
+	links := Extract(root, pageURL, &Options{Tags: []string{"a", "link"}, SkipNoFollow: true})
+	if len(links) != 3 {
+		t.Fatalf("Inconsistent link number: expected: %d, actual: %d", 3, len(links))
+	}
+	if !links[0].Canonical || links[1].Canonical {
+		t.Fatalf("Inconsistent canonical flags: %+v", links[:2])
+	}
+	if links[2].Text != "Intro guide" {
+		t.Fatalf("Inconsistent link text: %q", links[2].Text)
+	}
+}
+
+func TestRobotsNoFollow(t *testing.T) {
+	root, _ := html.Parse(strings.NewReader(
+		`<meta name="robots" content="noindex, nofollow"><a href="/a">A</a>`))
+	pageURL, _ := url.Parse("http://example.com/")
+	links := Extract(root, pageURL, nil)
+	if len(links) != 1 || !links[0].NoFollow {
+		t.Fatalf("Inconsistent links: %+v", links)
+	}
+	if links := Extract(root, pageURL, &Options{SkipNoFollow: true}); len(links) != 0 {
+		t.Fatalf("Links should be skipped: %+v", links)
+	}
+}
+
+func TestParseSrcset(t *testing.T) {
+	for srcset, expected := range map[string][]string{
+		"a.jpg":                       {"a.jpg"},
+		" a.jpg 100w , b.jpg 200w ":   {"a.jpg", "b.jpg"},
+		"a.jpg,b.jpg":                 {"a.jpg,b.jpg"},
+		"a.jpg, b.jpg,":               {"a.jpg", "b.jpg"},
+		"data:image/png;base64,xx 1x": {"data:image/png;base64,xx"},
+		"":                            nil,
+	} {
+		if actual := ParseSrcset(srcset); !reflect.DeepEqual(actual, expected) {
+			t.Fatalf("Inconsistent srcset URLs of %q: expected: %q, actual: %q",
+				srcset, expected, actual)
+		}
+	}
+}
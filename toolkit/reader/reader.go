@@ -5,6 +5,7 @@ import (
 	"io/ioutil"
 	"fmt"
 	"bytes"
+	"os"
 )
 
 //多重读取器
@@ -14,6 +15,13 @@ import (
 type MultipleReader interface {
 	//用于获得一个可关闭的读取器实例
 	Reader() io.ReadCloser
+	//用于获得可读取的数据的字节数
+	Size() int64
+	//用于判断数据是否因超出最大字节数而被截断
+	Truncated() bool
+	//用于释放多重读取器占用的资源，例如临时文件
+	//已经获得的读取器在关闭之前仍然可用
+	Close() error
 }
 
 
@@ -21,12 +29,25 @@ type MultipleReader interface {
 //多重读取器接口的实现类型
 type vientianeMultipleReader struct {
 	data []byte
+	truncated bool
 }
 
 func(reader *vientianeMultipleReader)Reader() io.ReadCloser{
 	return ioutil.NopCloser(bytes.NewReader(reader.data))
 }
 
+func(reader *vientianeMultipleReader)Size() int64{
+	return int64(len(reader.data))
+}
+
+func(reader *vientianeMultipleReader)Truncated() bool{
+	return reader.truncated
+}
+
+func(reader *vientianeMultipleReader)Close() error{
+	return nil
+}
+
 func NewMultipleReader(reader io.Reader)(MultipleReader,error) {
 	var data []byte
 	var err error
@@ -41,4 +62,111 @@ func NewMultipleReader(reader io.Reader)(MultipleReader,error) {
 	return &vientianeMultipleReader{
 		data: data,
 	}, nil
-}
\ No newline at end of file
+}
+
+//数据暂存在临时文件中的多重读取器的实现类型
+type fileMultipleReader struct {
+	//临时文件的路径
+	filePath string
+	//可读取的数据的字节数
+	size int64
+	truncated bool
+}
+
+func(reader *fileMultipleReader)Reader() io.ReadCloser{
+	file, err := os.Open(reader.filePath)
+	if err != nil {
+		return ioutil.NopCloser(&errReader{
+			err: fmt.Errorf("multiple reader: couldn`t open the temp file:%s", err)})
+	}
+	return &fileReadCloser{Reader: io.LimitReader(file, reader.size), file: file}
+}
+
+func(reader *fileMultipleReader)Size() int64{
+	return reader.size
+}
+
+func(reader *fileMultipleReader)Truncated() bool{
+	return reader.truncated
+}
+
+//删除临时文件，已打开的读取器在类Unix系统上仍可继续读取
+func(reader *fileMultipleReader)Close() error{
+	err := os.Remove(reader.filePath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+//从临时文件读取数据的读取器
+type fileReadCloser struct {
+	io.Reader
+	file *os.File
+}
+
+func(frc *fileReadCloser)Close() error{
+	return frc.file.Close()
+}
+
+//总是返回错误的读取器
+type errReader struct {
+	err error
+}
+
+func(er *errReader)Read(p []byte) (int, error){
+	return 0, er.err
+}
+
+//用于创建一个有大小限制的多重读取器
+//maxSize代表最多读取的字节数，超出部分会被丢弃并标记为截断，0代表不限制
+//数据超过spillThreshold字节时会被暂存到临时文件而不是内存中，0代表总是保存在内存中
+func NewLimitedMultipleReader(reader io.Reader, maxSize int64,
+	spillThreshold int64)(MultipleReader,error) {
+	if reader == nil {
+		return NewMultipleReader(nil)
+	}
+	if maxSize > 0 {
+		//多读一个字节用于判断是否超出了最大字节数
+		reader = io.LimitReader(reader, maxSize+1)
+	}
+	if spillThreshold <= 0 {
+		result, err := NewMultipleReader(reader)
+		if err != nil {
+			return nil, err
+		}
+		mr := result.(*vientianeMultipleReader)
+		if maxSize > 0 && int64(len(mr.data)) > maxSize {
+			mr.data = mr.data[:maxSize]
+			mr.truncated = true
+		}
+		return mr, nil
+	}
+	var buffer bytes.Buffer
+	_, err := io.CopyN(&buffer, reader, spillThreshold+1)
+	if err == io.EOF {
+		return NewLimitedMultipleReader(&buffer, maxSize, 0)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("multiple reader: couldn`t create a new one:%s", err)
+	}
+	file, err := ioutil.TempFile("", "vientiane-body-")
+	if err != nil {
+		return nil, fmt.Errorf("multiple reader: couldn`t create the temp file:%s", err)
+	}
+	defer file.Close()
+	size, err := io.Copy(file, io.MultiReader(&buffer, reader))
+	if err != nil {
+		os.Remove(file.Name())
+		return nil, fmt.Errorf("multiple reader: couldn`t write the temp file:%s", err)
+	}
+	mr := &fileMultipleReader{
+		filePath: file.Name(),
+		size:     size,
+	}
+	if maxSize > 0 && size > maxSize {
+		mr.size = maxSize
+		mr.truncated = true
+	}
+	return mr, nil
+}
@@ -0,0 +1,78 @@
+package reader
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"testing"
+)
+
+func TestLimitedMultipleReader(t *testing.T) {
+	data := bytes.Repeat([]byte("vientiane"), 100)
+	cases := []struct {
+		maxSize        int64
+		spillThreshold int64
+		expectedSize   int64
+		truncated      bool
+	}{
+		{0, 0, int64(len(data)), false},
+		{100, 0, 100, true},
+		{0, 50, int64(len(data)), false},
+		{100, 50, 100, true},
+		{int64(len(data)), 50, int64(len(data)), false},
+		{0, int64(len(data)), int64(len(data)), false},
+	}
+	for _, c := range cases {
+		mr, err := NewLimitedMultipleReader(bytes.NewReader(data), c.maxSize, c.spillThreshold)
+		if err != nil {
+			t.Fatalf("An error occurs when creating a multiple reader: %s", err)
+		}
+		if mr.Size() != c.expectedSize {
+			t.Fatalf("Inconsistent size: expected: %d, actual: %d (maxSize: %d, spillThreshold: %d)",
+				c.expectedSize, mr.Size(), c.maxSize, c.spillThreshold)
+		}
+		if mr.Truncated() != c.truncated {
+			t.Fatalf("Inconsistent truncated flag: expected: %v, actual: %v (maxSize: %d, spillThreshold: %d)",
+				c.truncated, mr.Truncated(), c.maxSize, c.spillThreshold)
+		}
+		for i := 0; i < 2; i++ {
+			reader := mr.Reader()
+			content, err := ioutil.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				t.Fatalf("An error occurs when reading: %s", err)
+			}
+			if !bytes.Equal(content, data[:c.expectedSize]) {
+				t.Fatalf("Inconsistent content! (maxSize: %d, spillThreshold: %d)",
+					c.maxSize, c.spillThreshold)
+			}
+		}
+		if err := mr.Close(); err != nil {
+			t.Fatalf("An error occurs when closing the multiple reader: %s", err)
+		}
+	}
+}
+
+func TestFileMultipleReaderClose(t *testing.T) {
+	data := bytes.Repeat([]byte("vientiane"), 10)
+	mr, err := NewLimitedMultipleReader(bytes.NewReader(data), 0, 10)
+	if err != nil {
+		t.Fatalf("An error occurs when creating a multiple reader: %s", err)
+	}
+	fmr, ok := mr.(*fileMultipleReader)
+	if !ok {
+		t.Fatalf("Incorrect multiple reader type: %T", mr)
+	}
+	reader := mr.Reader()
+	defer reader.Close()
+	if err := mr.Close(); err != nil {
+		t.Fatalf("An error occurs when closing the multiple reader: %s", err)
+	}
+	if _, err := os.Stat(fmr.filePath); !os.IsNotExist(err) {
+		t.Fatalf("The temp file %s still exists after closing!", fmr.filePath)
+	}
+	content, err := ioutil.ReadAll(reader)
+	if err != nil || !bytes.Equal(content, data) {
+		t.Fatalf("The opened reader is unusable after closing! (error: %v)", err)
+	}
+}
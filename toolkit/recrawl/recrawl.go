@@ -0,0 +1,249 @@
+package recrawl
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/Vientiane/toolkit/kvstore"
+)
+
+//增量爬取的状态跟踪器
+//跨多次运行记录每个URL的最后获取时间、内容摘要和变化历史，
+//并根据页面变化的频繁程度自适应地安排下次访问的时间：
+//内容变化时访问间隔减半，未变化时增加一半，且限制在最小和最大间隔之间
+
+//保存URL状态的桶
+const BUCKET_URLS = "urls"
+
+const (
+	//默认的初始访问间隔
+	DEFAULT_INITIAL_INTERVAL = 24 * time.Hour
+	//默认的最小访问间隔
+	DEFAULT_MIN_INTERVAL = time.Hour
+	//默认的最大访问间隔
+	DEFAULT_MAX_INTERVAL = 30 * 24 * time.Hour
+	//默认保留的变化历史数量
+	DEFAULT_HISTORY_SIZE = 10
+)
+
+//跟踪器配置的类型
+type Config struct {
+	//状态文件的路径
+	Path string
+	//第一次获取之后的访问间隔，默认为DEFAULT_INITIAL_INTERVAL
+	InitialInterval time.Duration
+	//最小的访问间隔，默认为DEFAULT_MIN_INTERVAL
+	MinInterval time.Duration
+	//最大的访问间隔，默认为DEFAULT_MAX_INTERVAL
+	MaxInterval time.Duration
+	//保留的变化历史数量，默认为DEFAULT_HISTORY_SIZE
+	HistorySize int
+}
+
+//内容变化的记录
+type Change struct {
+	Time time.Time `json:"time"`
+	Hash string    `json:"hash"`
+}
+
+//URL的状态
+type State struct {
+	URL string `json:"url"`
+	//第一次获取的时间
+	FirstFetch time.Time `json:"first_fetch"`
+	//最后一次获取的时间
+	LastFetch time.Time `json:"last_fetch"`
+	//最后一次发现内容变化的时间
+	LastChange time.Time `json:"last_change"`
+	//最后一次获取的内容摘要
+	Hash string `json:"hash"`
+	//获取的次数
+	Fetches int `json:"fetches"`
+	//发现内容变化的次数，不包含第一次获取
+	Changes int `json:"changes"`
+	//当前的访问间隔
+	Interval time.Duration `json:"interval"`
+	//下次访问的时间
+	NextVisit time.Time `json:"next_visit"`
+	//最近的内容变化，按时间先后排列，包含第一次获取
+	History []Change `json:"history,omitempty"`
+}
+
+//观察的结果
+type Result int
+
+const (
+	//第一次获取
+	RESULT_NEW Result = iota
+	//内容已变化
+	RESULT_CHANGED
+	//内容未变化
+	RESULT_UNCHANGED
+)
+
+//增量爬取的状态跟踪器
+type Tracker struct {
+	cfg   Config
+	store *kvstore.Store
+	//保证同一URL的读取和更新是原子的
+	lock sync.Mutex
+}
+
+//用于打开跟踪器，状态文件不存在时会被创建
+func Open(cfg Config) (*Tracker, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("recrawl: empty path")
+	}
+	if cfg.InitialInterval <= 0 {
+		cfg.InitialInterval = DEFAULT_INITIAL_INTERVAL
+	}
+	if cfg.MinInterval <= 0 {
+		cfg.MinInterval = DEFAULT_MIN_INTERVAL
+	}
+	if cfg.MaxInterval <= 0 {
+		cfg.MaxInterval = DEFAULT_MAX_INTERVAL
+	}
+	if cfg.MinInterval > cfg.MaxInterval {
+		return nil, fmt.Errorf("recrawl: min interval %s is greater than max interval %s",
+			cfg.MinInterval, cfg.MaxInterval)
+	}
+	if cfg.HistorySize <= 0 {
+		cfg.HistorySize = DEFAULT_HISTORY_SIZE
+	}
+	store, err := kvstore.Open(cfg.Path)
+	if err != nil {
+		return nil, fmt.Errorf("recrawl: %s", err)
+	}
+	return &Tracker{cfg: cfg, store: store}, nil
+}
+
+//用于计算内容摘要
+func ContentHash(body []byte) string {
+	sum := sha256.Sum256(body)
+	return hex.EncodeToString(sum[:])
+}
+
+//用于获取URL的状态，第二个返回值代表是否获取过该URL
+func (t *Tracker) State(url string) (State, bool, error) {
+	data, err := t.store.Get(BUCKET_URLS, url)
+	if err == kvstore.ErrNotFound {
+		return State{}, false, nil
+	}
+	if err != nil {
+		return State{}, false, err
+	}
+	var state State
+	if err := json.Unmarshal(data, &state); err != nil {
+		return State{}, false, fmt.Errorf("recrawl: malformed state (URL: %s): %s", url, err)
+	}
+	return state, true, nil
+}
+
+//用于判断URL在now时是否需要访问，从未获取过的URL总是需要访问
+func (t *Tracker) Due(url string, now time.Time) bool {
+	state, ok, err := t.State(url)
+	if err != nil || !ok {
+		return true
+	}
+	return !now.Before(state.NextVisit)
+}
+
+//用于记录一次获取，返回内容是否变化以及更新后的状态
+func (t *Tracker) Observe(url string, body []byte, now time.Time) (Result, State, error) {
+	hash := ContentHash(body)
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	state, ok, err := t.State(url)
+	if err != nil {
+		return RESULT_NEW, state, err
+	}
+	var result Result
+	switch {
+	case !ok:
+		result = RESULT_NEW
+		state = State{URL: url, FirstFetch: now, LastChange: now, Interval: t.cfg.InitialInterval}
+	case state.Hash != hash:
+		result = RESULT_CHANGED
+		state.Changes++
+		state.LastChange = now
+		state.Interval = t.clamp(state.Interval / 2)
+	default:
+		result = RESULT_UNCHANGED
+		state.Interval = t.clamp(state.Interval + state.Interval/2)
+	}
+	if result != RESULT_UNCHANGED {
+		state.History = append(state.History, Change{Time: now, Hash: hash})
+		if n := len(state.History) - t.cfg.HistorySize; n > 0 {
+			state.History = append([]Change(nil), state.History[n:]...)
+		}
+	}
+	state.Hash = hash
+	state.Fetches++
+	state.LastFetch = now
+	state.NextVisit = now.Add(state.Interval)
+	data, err := json.Marshal(state)
+	if err != nil {
+		return result, state, err
+	}
+	if err := t.store.Put(BUCKET_URLS, url, data); err != nil {
+		return result, state, fmt.Errorf("recrawl: couldn't save state (URL: %s): %s", url, err)
+	}
+	return result, state, nil
+}
+
+//用于把访问间隔限制在最小和最大间隔之间
+func (t *Tracker) clamp(interval time.Duration) time.Duration {
+	if interval < t.cfg.MinInterval {
+		return t.cfg.MinInterval
+	}
+	if interval > t.cfg.MaxInterval {
+		return t.cfg.MaxInterval
+	}
+	return interval
+}
+
+//用于获取在now时需要访问的URL，按照下次访问的时间先后排列
+func (t *Tracker) DueURLs(now time.Time) ([]string, error) {
+	var states []State
+	var decodeErr error
+	err := t.store.ForEach(BUCKET_URLS, "", func(url string, data []byte) bool {
+		var state State
+		if decodeErr = json.Unmarshal(data, &state); decodeErr != nil {
+			decodeErr = fmt.Errorf("recrawl: malformed state (URL: %s): %s", url, decodeErr)
+			return false
+		}
+		if !now.Before(state.NextVisit) {
+			states = append(states, state)
+		}
+		return true
+	})
+	if err == nil {
+		err = decodeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(states, func(i, j int) bool {
+		return states[i].NextVisit.Before(states[j].NextVisit)
+	})
+	urls := make([]string, len(states))
+	for i, state := range states {
+		urls[i] = state.URL
+	}
+	return urls, nil
+}
+
+//用于获取跟踪的URL数量
+func (t *Tracker) Len() int {
+	return t.store.Len(BUCKET_URLS)
+}
+
+//用于关闭跟踪器
+func (t *Tracker) Close() error {
+	return t.store.Close()
+}
@@ -0,0 +1,79 @@
+package recrawl
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestTracker(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "recrawl.kv")
+	tracker, err := Open(Config{
+		Path:            path,
+		InitialInterval: 4 * time.Hour,
+		MinInterval:     time.Hour,
+		MaxInterval:     8 * time.Hour,
+		HistorySize:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	url := "http://example.com/"
+	now := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if !tracker.Due(url, now) {
+		t.Fatal("expected an unknown URL to be due")
+	}
+	steps := []struct {
+		body     string
+		result   Result
+		interval time.Duration
+	}{
+		{"a", RESULT_NEW, 4 * time.Hour},
+		{"a", RESULT_UNCHANGED, 6 * time.Hour},
+		{"a", RESULT_UNCHANGED, 8 * time.Hour},
+		{"b", RESULT_CHANGED, 4 * time.Hour},
+		{"c", RESULT_CHANGED, 2 * time.Hour},
+		{"d", RESULT_CHANGED, time.Hour},
+	}
+	for i, step := range steps {
+		result, state, err := tracker.Observe(url, []byte(step.body), now)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if result != step.result || state.Interval != step.interval {
+			t.Fatalf("step %d: expected %v/%s, got %v/%s",
+				i, step.result, step.interval, result, state.Interval)
+		}
+		if tracker.Due(url, now.Add(step.interval-time.Minute)) ||
+			!tracker.Due(url, now.Add(step.interval)) {
+			t.Fatalf("step %d: unexpected due time", i)
+		}
+		now = now.Add(step.interval)
+	}
+	if err := tracker.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	//状态在多次运行之间保留
+	tracker, err = Open(Config{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer tracker.Close()
+	state, ok, err := tracker.State(url)
+	if err != nil || !ok {
+		t.Fatalf("expected the state to be kept (error: %v)", err)
+	}
+	if state.Fetches != 6 || state.Changes != 3 || len(state.History) != 2 ||
+		state.History[1].Hash != ContentHash([]byte("d")) {
+		t.Fatalf("unexpected state: %+v", state)
+	}
+	tracker.Observe("http://example.com/other", []byte("x"), now)
+	urls, err := tracker.DueURLs(now)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 1 || urls[0] != url {
+		t.Fatalf("unexpected due URLs: %v", urls)
+	}
+}
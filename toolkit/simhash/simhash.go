@@ -0,0 +1,151 @@
+package simhash
+
+import (
+	"hash/fnv"
+	"math/bits"
+	"strings"
+	"sync"
+	"unicode"
+)
+
+//64位SimHash，用于检测近似重复的文本
+//文本被切分为词（汉字等表意文字每个字为一个词），以连续的SHINGLE_SIZE个词为特征
+
+//特征包含的词数
+const SHINGLE_SIZE = 3
+
+//用于切分文本
+func tokenize(text string) []string {
+	var tokens []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			tokens = append(tokens, b.String())
+			b.Reset()
+		}
+	}
+	for _, r := range strings.ToLower(text) {
+		switch {
+		case unicode.Is(unicode.Han, r) || unicode.Is(unicode.Hiragana, r) ||
+			unicode.Is(unicode.Katakana, r) || unicode.Is(unicode.Hangul, r):
+			flush()
+			tokens = append(tokens, string(r))
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		default:
+			flush()
+		}
+	}
+	flush()
+	return tokens
+}
+
+//用于计算文本的SimHash，没有任何词时返回0
+func Hash(text string) uint64 {
+	tokens := tokenize(text)
+	if len(tokens) == 0 {
+		return 0
+	}
+	var weights [64]int
+	add := func(feature string) {
+		h := fnv.New64a()
+		h.Write([]byte(feature))
+		sum := h.Sum64()
+		for i := 0; i < 64; i++ {
+			if sum&(1<<uint(i)) != 0 {
+				weights[i]++
+			} else {
+				weights[i]--
+			}
+		}
+	}
+	if len(tokens) < SHINGLE_SIZE {
+		add(strings.Join(tokens, " "))
+	} else {
+		for i := 0; i+SHINGLE_SIZE <= len(tokens); i++ {
+			add(strings.Join(tokens[i:i+SHINGLE_SIZE], " "))
+		}
+	}
+	var hash uint64
+	for i := 0; i < 64; i++ {
+		if weights[i] > 0 {
+			hash |= 1 << uint(i)
+		}
+	}
+	return hash
+}
+
+//用于计算两个SimHash的汉明距离
+func Distance(a, b uint64) int {
+	return bits.OnesCount64(a ^ b)
+}
+
+//近似重复的索引中分段的数量
+//汉明距离不超过BANDS-1的两个值至少有一段完全相同，因此只需比较有相同段的值
+const BANDS = 4
+
+//SimHash的索引，用于查找汉明距离不超过给定值的近似重复
+type Index struct {
+	//最大的汉明距离
+	maxDistance int
+	//每一段的值到条目的映射
+	bands [BANDS]map[uint16][]entry
+	lock  sync.RWMutex
+}
+
+type entry struct {
+	hash uint64
+	key  string
+}
+
+//用于创建索引，maxDistance不能超过BANDS-1
+func NewIndex(maxDistance int) *Index {
+	if maxDistance < 0 {
+		maxDistance = 0
+	}
+	if maxDistance > BANDS-1 {
+		maxDistance = BANDS - 1
+	}
+	idx := &Index{maxDistance: maxDistance}
+	for i := range idx.bands {
+		idx.bands[i] = map[uint16][]entry{}
+	}
+	return idx
+}
+
+func band(hash uint64, i int) uint16 {
+	return uint16(hash >> uint(16*i))
+}
+
+//用于查找近似重复，返回最接近的条目的键和距离
+func (idx *Index) Lookup(hash uint64) (key string, distance int, ok bool) {
+	idx.lock.RLock()
+	defer idx.lock.RUnlock()
+	return idx.lookup(hash)
+}
+
+func (idx *Index) lookup(hash uint64) (key string, distance int, ok bool) {
+	distance = idx.maxDistance + 1
+	for i := range idx.bands {
+		for _, e := range idx.bands[i][band(hash, i)] {
+			if d := Distance(hash, e.hash); d < distance {
+				key, distance, ok = e.key, d, true
+			}
+		}
+	}
+	return
+}
+
+//用于查找近似重复，没有找到时加入索引
+func (idx *Index) LookupOrAdd(hash uint64, key string) (dupKey string, distance int, found bool) {
+	idx.lock.Lock()
+	defer idx.lock.Unlock()
+	if dupKey, distance, found = idx.lookup(hash); found {
+		return
+	}
+	for i := range idx.bands {
+		b := band(hash, i)
+		idx.bands[i][b] = append(idx.bands[i][b], entry{hash: hash, key: key})
+	}
+	return "", 0, false
+}
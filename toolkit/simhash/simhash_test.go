@@ -0,0 +1,40 @@
+package simhash
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHash(t *testing.T) {
+	base := strings.Repeat("the quick brown fox jumps over the lazy dog and runs away into the forest ", 10)
+	similar := base + "today"
+	different := strings.Repeat("completely unrelated text about databases indexes and query planning ", 10)
+	if d := Distance(Hash(base), Hash(similar)); d > 3 {
+		t.Fatalf("expected similar texts to be close, distance %d", d)
+	}
+	if d := Distance(Hash(base), Hash(different)); d <= 3 {
+		t.Fatalf("expected different texts to be far, distance %d", d)
+	}
+	if Hash("Hello, World!") != Hash("hello world") {
+		t.Fatal("expected case and punctuation to be ignored")
+	}
+	if len(tokenize("爬虫abc 测试")) != 5 {
+		t.Fatalf("unexpected tokens: %v", tokenize("爬虫abc 测试"))
+	}
+}
+
+func TestIndex(t *testing.T) {
+	idx := NewIndex(3)
+	var h uint64 = 0x0123456789abcdef
+	if _, _, found := idx.LookupOrAdd(h, "a"); found {
+		t.Fatal("unexpected duplicate in an empty index")
+	}
+	//每一段都翻转一位，距离为4，超过最大距离
+	if _, _, found := idx.LookupOrAdd(h^0x0001000100010001, "b"); found {
+		t.Fatal("unexpected duplicate beyond the max distance")
+	}
+	key, distance, found := idx.LookupOrAdd(h^0x0000000200020002, "c")
+	if !found || key != "a" || distance != 3 {
+		t.Fatalf("expected a duplicate of a at distance 3, got %q %d %v", key, distance, found)
+	}
+}
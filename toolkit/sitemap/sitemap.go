@@ -0,0 +1,323 @@
+package sitemap
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+//站点地图解析工具
+//支持sitemap.xml、站点地图索引文件、gzip压缩的站点地图、纯文本站点地图
+//以及robots.txt中声明的站点地图
+
+//站点地图中URL的默认优先级
+const DEFAULT_PRIORITY = 0.5
+
+//单个站点地图文件的最大字节数，与站点地图协议的规定一致
+const MAX_SITEMAP_SIZE = 50 << 20
+
+//站点地图中的条目，也用于表示站点地图索引中的子站点地图
+type URL struct {
+	//URL
+	Loc string `json:"loc"`
+	//最后修改时间，未给出时为零值
+	LastMod time.Time `json:"lastmod,omitempty"`
+	//更新频率，如"daily"，已转换为小写
+	ChangeFreq string `json:"changefreq,omitempty"`
+	//优先级，取值范围为0.0到1.0，未给出时为DEFAULT_PRIORITY
+	Priority float64 `json:"priority"`
+}
+
+//解析后的站点地图
+type Sitemap struct {
+	//站点地图中的URL
+	URLs []URL
+	//站点地图索引中的子站点地图
+	Sitemaps []URL
+}
+
+//XML格式的站点地图
+type xmlSitemap struct {
+	XMLName  xml.Name `xml:""`
+	URLs     []xmlURL `xml:"url"`
+	Sitemaps []xmlURL `xml:"sitemap"`
+}
+
+type xmlURL struct {
+	Loc        string `xml:"loc"`
+	LastMod    string `xml:"lastmod"`
+	ChangeFreq string `xml:"changefreq"`
+	Priority   string `xml:"priority"`
+}
+
+func (xu xmlURL) toURL() (URL, bool) {
+	u := URL{
+		Loc:        strings.TrimSpace(xu.Loc),
+		ChangeFreq: strings.ToLower(strings.TrimSpace(xu.ChangeFreq)),
+		Priority:   DEFAULT_PRIORITY,
+	}
+	if u.Loc == "" {
+		return u, false
+	}
+	u.LastMod, _ = ParseTime(xu.LastMod)
+	if priority := strings.TrimSpace(xu.Priority); priority != "" {
+		var p float64
+		if _, err := fmt.Sscanf(priority, "%g", &p); err == nil && p >= 0 && p <= 1 {
+			u.Priority = p
+		}
+	}
+	return u, true
+}
+
+//用于解析站点地图或站点地图索引
+//gzip压缩的内容会被自动解压，非XML的内容会被当做每行一个URL的纯文本站点地图
+func Parse(r io.Reader) (*Sitemap, error) {
+	br := bufio.NewReader(r)
+	if magic, _ := br.Peek(2); len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		gr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("sitemap: invalid gzip data: %s", err)
+		}
+		defer gr.Close()
+		br = bufio.NewReader(gr)
+	}
+	data, err := ioutil.ReadAll(io.LimitReader(br, MAX_SITEMAP_SIZE))
+	if err != nil {
+		return nil, fmt.Errorf("sitemap: couldn't read data: %s", err)
+	}
+	trimmed := bytes.TrimSpace(bytes.TrimPrefix(data, []byte("\xef\xbb\xbf")))
+	if !bytes.HasPrefix(trimmed, []byte("<")) {
+		return parseText(trimmed), nil
+	}
+	var xs xmlSitemap
+	if err := xml.Unmarshal(trimmed, &xs); err != nil {
+		return nil, fmt.Errorf("sitemap: invalid XML: %s", err)
+	}
+	root := xs.XMLName.Local
+	if root != "urlset" && root != "sitemapindex" {
+		return nil, fmt.Errorf("sitemap: unsupported root element %q", root)
+	}
+	sitemap := &Sitemap{}
+	for _, xu := range xs.URLs {
+		if u, ok := xu.toURL(); ok {
+			sitemap.URLs = append(sitemap.URLs, u)
+		}
+	}
+	for _, xu := range xs.Sitemaps {
+		if u, ok := xu.toURL(); ok {
+			sitemap.Sitemaps = append(sitemap.Sitemaps, u)
+		}
+	}
+	return sitemap, nil
+}
+
+//用于解析纯文本站点地图
+func parseText(data []byte) *Sitemap {
+	sitemap := &Sitemap{}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "http://") || strings.HasPrefix(line, "https://") {
+			sitemap.URLs = append(sitemap.URLs, URL{Loc: line, Priority: DEFAULT_PRIORITY})
+		}
+	}
+	return sitemap
+}
+
+//用于获取robots.txt中声明的站点地图的URL
+func ParseRobots(r io.Reader) []string {
+	var sitemaps []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if index := strings.Index(line, "#"); index >= 0 {
+			line = line[:index]
+		}
+		index := strings.Index(line, ":")
+		if index < 0 {
+			continue
+		}
+		if !strings.EqualFold(strings.TrimSpace(line[:index]), "sitemap") {
+			continue
+		}
+		if loc := strings.TrimSpace(line[index+1:]); loc != "" {
+			sitemaps = append(sitemaps, loc)
+		}
+	}
+	return sitemaps
+}
+
+//站点地图中可能出现的时间格式，即W3C Datetime
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02T15:04:05",
+	"2006-01-02",
+	"2006-01",
+	"2006",
+}
+
+//用于解析站点地图中的时间
+func ParseTime(value string) (time.Time, error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, value); err == nil {
+			return t, nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("sitemap: invalid time %q", value)
+}
+
+//更新频率对应的优先级调整值
+var changeFreqBonus = map[string]int{
+	"always":  3,
+	"hourly":  3,
+	"daily":   2,
+	"weekly":  1,
+	"monthly": 0,
+	"yearly":  -1,
+	"never":   -2,
+}
+
+//用于根据优先级、更新频率和最后修改时间计算请求的优先级，数值越大越优先
+//优先级0.0到1.0对应0到10，更新越频繁、修改越近的URL优先级越高
+func (u URL) RequestPriority(now time.Time) int {
+	priority := int(math.Round(u.Priority * 10))
+	priority += changeFreqBonus[u.ChangeFreq]
+	if !u.LastMod.IsZero() {
+		age := now.Sub(u.LastMod)
+		switch {
+		case age < 24*time.Hour:
+			priority += 2
+		case age < 7*24*time.Hour:
+			priority++
+		}
+	}
+	return priority
+}
+
+//站点地图收集器，用于下载站点地图并展开其中的站点地图索引
+type Collector struct {
+	//下载站点地图所用的HTTP客户端，为nil时使用http.DefaultClient
+	Client *http.Client
+	//最多下载的站点地图文件数，0代表不限制
+	MaxSitemaps int
+	//最多收集的URL数，0代表不限制
+	MaxURLs int
+}
+
+//用于获取站点的robots.txt中声明的站点地图
+//robots.txt不存在或没有声明站点地图时，返回站点根路径下的/sitemap.xml
+func (c *Collector) RobotsSitemaps(siteURL string) ([]string, error) {
+	base, err := url.Parse(siteURL)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap: invalid site URL %q: %s", siteURL, err)
+	}
+	robotsURL := base.ResolveReference(&url.URL{Path: "/robots.txt"})
+	defaultSitemaps := []string{base.ResolveReference(&url.URL{Path: "/sitemap.xml"}).String()}
+	resp, err := c.client().Get(robotsURL.String())
+	if err != nil {
+		return defaultSitemaps, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return defaultSitemaps, nil
+	}
+	sitemaps := ParseRobots(io.LimitReader(resp.Body, MAX_SITEMAP_SIZE))
+	if len(sitemaps) == 0 {
+		return defaultSitemaps, nil
+	}
+	for i, loc := range sitemaps {
+		if locURL, err := url.Parse(loc); err == nil {
+			sitemaps[i] = robotsURL.ResolveReference(locURL).String()
+		}
+	}
+	return sitemaps, nil
+}
+
+//用于下载站点地图并收集其中的URL，站点地图索引会被逐层展开
+//某个站点地图出错不会影响其他站点地图，所有错误会一并返回
+func (c *Collector) Collect(sitemapURLs []string) ([]URL, []error) {
+	var urls []URL
+	var errs []error
+	queue := append([]string{}, sitemapURLs...)
+	visitedSitemaps := map[string]bool{}
+	seenURLs := map[string]bool{}
+	for len(queue) > 0 {
+		if c.MaxSitemaps > 0 && len(visitedSitemaps) >= c.MaxSitemaps {
+			break
+		}
+		sitemapURL := queue[0]
+		queue = queue[1:]
+		if visitedSitemaps[sitemapURL] {
+			continue
+		}
+		visitedSitemaps[sitemapURL] = true
+		sitemap, err := c.fetch(sitemapURL)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		for _, child := range sitemap.Sitemaps {
+			queue = append(queue, c.resolve(sitemapURL, child.Loc))
+		}
+		for _, u := range sitemap.URLs {
+			u.Loc = c.resolve(sitemapURL, u.Loc)
+			if seenURLs[u.Loc] {
+				continue
+			}
+			seenURLs[u.Loc] = true
+			urls = append(urls, u)
+			if c.MaxURLs > 0 && len(urls) >= c.MaxURLs {
+				return urls, errs
+			}
+		}
+	}
+	return urls, errs
+}
+
+//用于下载并解析单个站点地图
+func (c *Collector) fetch(sitemapURL string) (*Sitemap, error) {
+	resp, err := c.client().Get(sitemapURL)
+	if err != nil {
+		return nil, fmt.Errorf("sitemap: couldn't download %s: %s", sitemapURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("sitemap: unexpected status code %d (URL: %s)",
+			resp.StatusCode, sitemapURL)
+	}
+	sitemap, err := Parse(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("%s (URL: %s)", err, sitemapURL)
+	}
+	return sitemap, nil
+}
+
+//用于把站点地图中的相对URL解析为绝对URL
+func (c *Collector) resolve(sitemapURL string, loc string) string {
+	base, err := url.Parse(sitemapURL)
+	if err != nil {
+		return loc
+	}
+	locURL, err := url.Parse(loc)
+	if err != nil {
+		return loc
+	}
+	return base.ResolveReference(locURL).String()
+}
+
+func (c *Collector) client() *http.Client {
+	if c.Client != nil {
+		return c.Client
+	}
+	return http.DefaultClient
+}
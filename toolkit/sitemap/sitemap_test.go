@@ -0,0 +1,129 @@
+package sitemap
+
+import (
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var testURLSet = `<?xml version="1.0" encoding="UTF-8"?>
+<urlset xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <url>
+    <loc>http://example.com/</loc>
+    <lastmod>2020-01-02</lastmod>
+    <changefreq>Daily</changefreq>
+    <priority>1.0</priority>
+  </url>
+  <url><loc> http://example.com/about </loc></url>
+  <url><loc></loc></url>
+</urlset>`
+
+var testIndex = `<?xml version="1.0" encoding="UTF-8"?>
+<sitemapindex xmlns="http://www.sitemaps.org/schemas/sitemap/0.9">
+  <sitemap><loc>/sitemap-1.xml.gz</loc><lastmod>2020-01-02T03:04:05+08:00</lastmod></sitemap>
+  <sitemap><loc>/sitemap-2.txt</loc></sitemap>
+</sitemapindex>`
+
+func gzipData(t *testing.T, data string) []byte {
+	var buf bytes.Buffer
+	gw := gzip.NewWriter(&buf)
+	if _, err := gw.Write([]byte(data)); err != nil {
+		t.Fatalf("An error occurs when compressing data: %s", err)
+	}
+	gw.Close()
+	return buf.Bytes()
+}
+
+func TestParse(t *testing.T) {
+	sitemap, err := Parse(strings.NewReader(testURLSet))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing sitemap: %s", err)
+	}
+	if len(sitemap.URLs) != 2 || len(sitemap.Sitemaps) != 0 {
+		t.Fatalf("Inconsistent sitemap: %+v", sitemap)
+	}
+	first := sitemap.URLs[0]
+	if first.Loc != "http://example.com/" || first.ChangeFreq != "daily" || first.Priority != 1 ||
+		!first.LastMod.Equal(time.Date(2020, 1, 2, 0, 0, 0, 0, time.UTC)) {
+		t.Fatalf("Inconsistent URL: %+v", first)
+	}
+	if second := sitemap.URLs[1]; second.Loc != "http://example.com/about" ||
+		second.Priority != DEFAULT_PRIORITY {
+		t.Fatalf("Inconsistent URL: %+v", second)
+	}
+	sitemap, err = Parse(bytes.NewReader(gzipData(t, testIndex)))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing gzipped sitemap index: %s", err)
+	}
+	if len(sitemap.Sitemaps) != 2 || sitemap.Sitemaps[0].LastMod.IsZero() {
+		t.Fatalf("Inconsistent sitemap index: %+v", sitemap)
+	}
+	sitemap, err = Parse(strings.NewReader("http://example.com/a\nnot a URL\nhttps://example.com/b\n"))
+	if err != nil || len(sitemap.URLs) != 2 {
+		t.Fatalf("Inconsistent text sitemap: %+v, %v", sitemap, err)
+	}
+	if _, err := Parse(strings.NewReader("<html></html>")); err == nil {
+		t.Fatalf("No error when parsing an HTML document")
+	}
+}
+
+func TestParseRobots(t *testing.T) {
+	robots := "User-agent: *\nDisallow: /private\n" +
+		"Sitemap: http://example.com/sitemap.xml # main\nsitemap:/news.xml\n"
+	sitemaps := ParseRobots(strings.NewReader(robots))
+	if len(sitemaps) != 2 || sitemaps[0] != "http://example.com/sitemap.xml" ||
+		sitemaps[1] != "/news.xml" {
+		t.Fatalf("Inconsistent sitemaps: %q", sitemaps)
+	}
+}
+
+func TestRequestPriority(t *testing.T) {
+	now := time.Date(2020, 1, 2, 12, 0, 0, 0, time.UTC)
+	fresh := URL{Priority: 0.8, ChangeFreq: "daily", LastMod: now.Add(-time.Hour)}
+	stale := URL{Priority: 0.8, ChangeFreq: "yearly"}
+	if fresh.RequestPriority(now) != 12 || stale.RequestPriority(now) != 7 {
+		t.Fatalf("Inconsistent request priorities: %d, %d",
+			fresh.RequestPriority(now), stale.RequestPriority(now))
+	}
+}
+
+func TestCollect(t *testing.T) {
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/robots.txt":
+			w.Write([]byte("Sitemap: /sitemap-index.xml\n"))
+		case "/sitemap-index.xml":
+			w.Write([]byte(testIndex))
+		case "/sitemap-1.xml.gz":
+			w.Header().Set("Content-Type", "application/x-gzip")
+			w.Write(gzipData(t, strings.Replace(testURLSet,
+				"http://example.com", server.URL, -1)))
+		case "/sitemap-2.txt":
+			w.Write([]byte(server.URL + "/about\n" + server.URL + "/contact\n"))
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	collector := &Collector{}
+	sitemaps, err := collector.RobotsSitemaps(server.URL + "/some/page")
+	if err != nil || len(sitemaps) != 1 || sitemaps[0] != server.URL+"/sitemap-index.xml" {
+		t.Fatalf("Inconsistent robots sitemaps: %q, %v", sitemaps, err)
+	}
+	urls, errs := collector.Collect(append(sitemaps, server.URL+"/missing.xml"))
+	if len(errs) != 1 {
+		t.Fatalf("Inconsistent error number: expected: %d, actual: %d (%v)", 1, len(errs), errs)
+	}
+	var locs []string
+	for _, u := range urls {
+		locs = append(locs, strings.TrimPrefix(u.Loc, server.URL))
+	}
+	if strings.Join(locs, " ") != "/ /about /contact" {
+		t.Fatalf("Inconsistent URLs: %q", locs)
+	}
+}
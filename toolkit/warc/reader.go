@@ -0,0 +1,104 @@
+package warc
+
+import (
+	"bufio"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
+//WARC记录的读取器，支持未压缩和逐记录gzip压缩的文件
+type Reader struct {
+	r *bufio.Reader
+	//用于关闭gzip读取器
+	closer io.Closer
+}
+
+//用于创建读取器，会根据开头的字节判断是否经过gzip压缩
+func NewReader(r io.Reader) (*Reader, error) {
+	br := bufio.NewReader(r)
+	magic, err := br.Peek(2)
+	if err != nil && err != io.EOF {
+		return nil, err
+	}
+	if len(magic) == 2 && magic[0] == 0x1f && magic[1] == 0x8b {
+		zr, err := gzip.NewReader(br)
+		if err != nil {
+			return nil, fmt.Errorf("warc: %s", err)
+		}
+		return &Reader{r: bufio.NewReader(zr), closer: zr}, nil
+	}
+	return &Reader{r: br}, nil
+}
+
+//用于读取下一条记录，没有更多记录时返回io.EOF
+func (r *Reader) Next() (*Record, error) {
+	var line string
+	var err error
+	//跳过记录之间多余的空行
+	for {
+		line, err = r.r.ReadString('\n')
+		if err != nil {
+			if err == io.EOF && strings.TrimSpace(line) == "" {
+				return nil, io.EOF
+			}
+			return nil, fmt.Errorf("warc: truncated record: %s", err)
+		}
+		if strings.TrimSpace(line) != "" {
+			break
+		}
+	}
+	version := strings.TrimSpace(line)
+	if !strings.HasPrefix(version, "WARC/1.") {
+		return nil, fmt.Errorf("warc: unsupported version %q", version)
+	}
+	record := &Record{}
+	for {
+		line, err = r.r.ReadString('\n')
+		if err != nil {
+			return nil, fmt.Errorf("warc: truncated header: %s", err)
+		}
+		line = strings.TrimRight(line, "\r\n")
+		if line == "" {
+			break
+		}
+		//以空白开头的行是上一个字段的延续
+		if (line[0] == ' ' || line[0] == '\t') && len(record.Header) > 0 {
+			last := &record.Header[len(record.Header)-1]
+			last.Value += " " + strings.TrimSpace(line)
+			continue
+		}
+		i := strings.IndexByte(line, ':')
+		if i <= 0 {
+			return nil, fmt.Errorf("warc: malformed header line %q", line)
+		}
+		record.Header = append(record.Header, Field{
+			Name:  line[:i],
+			Value: strings.TrimSpace(line[i+1:]),
+		})
+	}
+	length, err := strconv.ParseInt(record.Header.Get(HEADER_CONTENT_LENGTH), 10, 64)
+	if err != nil || length < 0 {
+		return nil, fmt.Errorf("warc: invalid content length %q",
+			record.Header.Get(HEADER_CONTENT_LENGTH))
+	}
+	record.Block = make([]byte, length)
+	if _, err := io.ReadFull(r.r, record.Block); err != nil {
+		return nil, fmt.Errorf("warc: truncated block: %s", err)
+	}
+	trailer := make([]byte, 4)
+	if _, err := io.ReadFull(r.r, trailer); err != nil || string(trailer) != "\r\n\r\n" {
+		return nil, fmt.Errorf("warc: missing record trailer")
+	}
+	return record, nil
+}
+
+//用于关闭读取器，不会关闭底层的读取器
+func (r *Reader) Close() error {
+	if r.closer != nil {
+		return r.closer.Close()
+	}
+	return nil
+}
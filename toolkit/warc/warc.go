@@ -0,0 +1,322 @@
+package warc
+
+import (
+	"compress/gzip"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//WARC 1.1格式（ISO 28500:2017）的记录和写入器
+
+//WARC的版本行
+const VERSION = "WARC/1.1"
+
+//记录的类型
+const (
+	TYPE_WARCINFO = "warcinfo"
+	TYPE_REQUEST  = "request"
+	TYPE_RESPONSE = "response"
+	TYPE_METADATA = "metadata"
+	TYPE_RESOURCE = "resource"
+)
+
+//常用的头部字段
+const (
+	HEADER_TYPE           = "WARC-Type"
+	HEADER_RECORD_ID      = "WARC-Record-ID"
+	HEADER_DATE           = "WARC-Date"
+	HEADER_TARGET_URI     = "WARC-Target-URI"
+	HEADER_CONCURRENT_TO  = "WARC-Concurrent-To"
+	HEADER_REFERS_TO      = "WARC-Refers-To"
+	HEADER_BLOCK_DIGEST   = "WARC-Block-Digest"
+	HEADER_PAYLOAD_DIGEST = "WARC-Payload-Digest"
+	HEADER_WARCINFO_ID    = "WARC-Warcinfo-ID"
+	HEADER_FILENAME       = "WARC-Filename"
+	HEADER_CONTENT_TYPE   = "Content-Type"
+	HEADER_CONTENT_LENGTH = "Content-Length"
+)
+
+//WARC-Date的格式，WARC 1.1允许秒的小数部分
+const DATE_FORMAT = "2006-01-02T15:04:05.000000Z"
+
+//头部字段
+type Field struct {
+	Name  string
+	Value string
+}
+
+//记录的头部，保持字段的顺序
+type Header []Field
+
+//用于获取字段的值，字段名不区分大小写
+func (h Header) Get(name string) string {
+	for _, f := range h {
+		if strings.EqualFold(f.Name, name) {
+			return f.Value
+		}
+	}
+	return ""
+}
+
+//用于设置字段的值，已存在的字段会被替换
+func (h *Header) Set(name, value string) {
+	for i, f := range *h {
+		if strings.EqualFold(f.Name, name) {
+			(*h)[i].Value = value
+			return
+		}
+	}
+	*h = append(*h, Field{Name: name, Value: value})
+}
+
+//WARC记录
+type Record struct {
+	Header Header
+	Block  []byte
+}
+
+//用于创建指定类型的记录，会生成记录ID、日期和内容长度以外的必需字段
+func NewRecord(recordType string, date time.Time, contentType string, block []byte) *Record {
+	r := &Record{Block: block}
+	r.Header.Set(HEADER_TYPE, recordType)
+	r.Header.Set(HEADER_RECORD_ID, NewRecordID())
+	r.Header.Set(HEADER_DATE, date.UTC().Format(DATE_FORMAT))
+	if contentType != "" {
+		r.Header.Set(HEADER_CONTENT_TYPE, contentType)
+	}
+	return r
+}
+
+//用于获取记录的类型
+func (r *Record) Type() string {
+	return r.Header.Get(HEADER_TYPE)
+}
+
+//用于获取记录的ID
+func (r *Record) ID() string {
+	return r.Header.Get(HEADER_RECORD_ID)
+}
+
+//用于获取记录的日期
+func (r *Record) Date() (time.Time, error) {
+	return time.Parse(time.RFC3339Nano, r.Header.Get(HEADER_DATE))
+}
+
+//用于把记录写入w，会设置内容长度
+func (r *Record) WriteTo(w io.Writer) (int64, error) {
+	r.Header.Set(HEADER_CONTENT_LENGTH, strconv.Itoa(len(r.Block)))
+	var b strings.Builder
+	b.WriteString(VERSION + "\r\n")
+	for _, f := range r.Header {
+		b.WriteString(f.Name + ": " + f.Value + "\r\n")
+	}
+	b.WriteString("\r\n")
+	n, err := io.WriteString(w, b.String())
+	total := int64(n)
+	if err != nil {
+		return total, err
+	}
+	n, err = w.Write(r.Block)
+	total += int64(n)
+	if err != nil {
+		return total, err
+	}
+	n, err = io.WriteString(w, "\r\n\r\n")
+	total += int64(n)
+	return total, err
+}
+
+//用于生成记录ID
+func NewRecordID() string {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		panic(err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("<urn:uuid:%x-%x-%x-%x-%x>", b[0:4], b[4:6], b[6:8], b[8:10], b[10:])
+}
+
+//用于计算数据的SHA-1摘要，格式为"sha1:"加上Base32编码
+func Digest(data []byte) string {
+	sum := sha1.Sum(data)
+	return "sha1:" + base32.StdEncoding.EncodeToString(sum[:])
+}
+
+//用于把字段编码为application/warc-fields格式
+func Fields(fields Header) []byte {
+	var b strings.Builder
+	for _, f := range fields {
+		b.WriteString(f.Name + ": " + f.Value + "\r\n")
+	}
+	return []byte(b.String())
+}
+
+//写入器配置的类型
+type Config struct {
+	//文件路径的前缀，如"archive/crawl"
+	//实际的文件名会带上创建时间和序号，如"archive/crawl-20060102150405-00001.warc.gz"
+	Path string
+	//单个文件的最大字节数（压缩后），超出时轮转到新文件，0代表不限制
+	//一组记录总是写入同一个文件，因此文件可能略大于该值
+	MaxSize int64
+	//是否压缩，压缩时每条记录为一个独立的gzip成员
+	Gzip bool
+	//写入每个文件开头的warcinfo记录的字段，如software、operator
+	Info Header
+}
+
+//带文件轮转的WARC写入器
+type Writer struct {
+	cfg  Config
+	lock sync.Mutex
+	file *os.File
+	//当前文件名（不含目录）
+	name string
+	//当前文件已写入的字节数
+	size int64
+	//当前文件的warcinfo记录ID
+	infoID string
+	seq    int
+	closed bool
+}
+
+//用于创建写入器，文件会在写入第一组记录时创建
+func NewWriter(cfg Config) (*Writer, error) {
+	if cfg.Path == "" {
+		return nil, fmt.Errorf("warc: empty path")
+	}
+	if cfg.MaxSize < 0 {
+		return nil, fmt.Errorf("warc: negative max size")
+	}
+	return &Writer{cfg: cfg}, nil
+}
+
+//用于写入一组相关的记录，如请求、响应和元数据记录
+//同一组的记录总是写入同一个文件，记录会带上当前文件的warcinfo记录ID
+func (w *Writer) Write(records ...*Record) error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return fmt.Errorf("warc: writer closed")
+	}
+	if w.file != nil && w.cfg.MaxSize > 0 && w.size >= w.cfg.MaxSize {
+		if err := w.closeFile(); err != nil {
+			return err
+		}
+	}
+	if w.file == nil {
+		if err := w.openFile(); err != nil {
+			return err
+		}
+	}
+	for _, r := range records {
+		r.Header.Set(HEADER_WARCINFO_ID, w.infoID)
+		if err := w.writeRecord(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+//用于写入单条记录，调用方需持有锁
+func (w *Writer) writeRecord(r *Record) error {
+	var n int64
+	var err error
+	if w.cfg.Gzip {
+		counter := &countingWriter{w: w.file}
+		zw := gzip.NewWriter(counter)
+		if _, err = r.WriteTo(zw); err == nil {
+			err = zw.Close()
+		}
+		n = counter.n
+	} else {
+		n, err = r.WriteTo(w.file)
+	}
+	w.size += n
+	if err != nil {
+		return fmt.Errorf("warc: couldn't write record: %s", err)
+	}
+	return nil
+}
+
+//用于创建新文件并写入warcinfo记录，调用方需持有锁
+func (w *Writer) openFile() error {
+	w.seq++
+	now := time.Now()
+	path := fmt.Sprintf("%s-%s-%05d.warc", w.cfg.Path, now.Format("20060102150405"), w.seq)
+	if w.cfg.Gzip {
+		path += ".gz"
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("warc: couldn't create directory: %s", err)
+	}
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return fmt.Errorf("warc: couldn't create file: %s", err)
+	}
+	w.file = file
+	w.name = filepath.Base(path)
+	w.size = 0
+	fields := Header{{Name: "format", Value: "WARC File Format 1.1"}}
+	fields = append(fields, w.cfg.Info...)
+	info := NewRecord(TYPE_WARCINFO, now, "application/warc-fields", Fields(fields))
+	info.Header.Set(HEADER_FILENAME, w.name)
+	w.infoID = info.ID()
+	return w.writeRecord(info)
+}
+
+//用于关闭当前文件，调用方需持有锁
+func (w *Writer) closeFile() error {
+	if w.file == nil {
+		return nil
+	}
+	err := w.file.Close()
+	w.file = nil
+	if err != nil {
+		return fmt.Errorf("warc: couldn't close file: %s", err)
+	}
+	return nil
+}
+
+//用于获取当前文件名（不含目录），尚未创建文件时为空
+func (w *Writer) Filename() string {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.file == nil {
+		return ""
+	}
+	return w.name
+}
+
+//用于关闭写入器，关闭后不能再写入记录
+func (w *Writer) Close() error {
+	w.lock.Lock()
+	defer w.lock.Unlock()
+	if w.closed {
+		return nil
+	}
+	w.closed = true
+	return w.closeFile()
+}
+
+//统计写入字节数的写入器
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (cw *countingWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.Write(p)
+	cw.n += int64(n)
+	return n, err
+}
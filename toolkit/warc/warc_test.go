@@ -0,0 +1,87 @@
+package warc
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func readAll(t *testing.T, path string) []*Record {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	r, err := NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	var records []*Record
+	for {
+		record, err := r.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		records = append(records, record)
+	}
+	return records
+}
+
+func TestWriteAndRead(t *testing.T) {
+	for _, gz := range []bool{false, true} {
+		dir := t.TempDir()
+		w, err := NewWriter(Config{Path: filepath.Join(dir, "crawl"), MaxSize: 1, Gzip: gz})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 2; i++ {
+			resp := NewRecord(TYPE_RESPONSE, time.Now(), "application/http;msgtype=response",
+				[]byte("HTTP/1.1 200 OK\r\n\r\nbody"))
+			resp.Header.Set(HEADER_TARGET_URI, "http://example.com/")
+			req := NewRecord(TYPE_REQUEST, time.Now(), "application/http;msgtype=request",
+				[]byte("GET / HTTP/1.1\r\nHost: example.com\r\n\r\n"))
+			req.Header.Set(HEADER_CONCURRENT_TO, resp.ID())
+			if err := w.Write(req, resp); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+		paths, _ := filepath.Glob(filepath.Join(dir, "*"))
+		if len(paths) != 2 {
+			t.Fatalf("expected 2 files after rotation, got %d (gzip: %v)", len(paths), gz)
+		}
+		records := readAll(t, paths[0])
+		if len(records) != 3 {
+			t.Fatalf("expected 3 records, got %d (gzip: %v)", len(records), gz)
+		}
+		info, req, resp := records[0], records[1], records[2]
+		if info.Type() != TYPE_WARCINFO || info.Header.Get(HEADER_FILENAME) != filepath.Base(paths[0]) {
+			t.Fatalf("unexpected warcinfo record: %v", info.Header)
+		}
+		if req.Header.Get(HEADER_CONCURRENT_TO) != resp.ID() ||
+			resp.Header.Get(HEADER_WARCINFO_ID) != info.ID() {
+			t.Fatalf("unexpected record references: %v %v", req.Header, resp.Header)
+		}
+		if string(resp.Block) != "HTTP/1.1 200 OK\r\n\r\nbody" {
+			t.Fatalf("unexpected block %q", resp.Block)
+		}
+		if _, err := resp.Date(); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestDigest(t *testing.T) {
+	//"abc"的SHA-1摘要
+	if d := Digest([]byte("abc")); d != "sha1:VGMT4NSHA2AWVOR6EVYXQUGCNSONBWE5" {
+		t.Fatalf("unexpected digest %s", d)
+	}
+}
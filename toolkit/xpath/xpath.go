@@ -0,0 +1,114 @@
+package xpath
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/antchfx/htmlquery"
+	antxpath "github.com/antchfx/xpath"
+	"golang.org/x/net/html"
+)
+
+//XPath求值工具
+//在解析函数中可通过structure.Response.HTMLNode()获得文档树，再用本包查找节点，
+//与goquery共享同一棵文档树
+
+//已编译的表达式的缓存
+var exprCache sync.Map
+
+//用于编译XPath表达式，编译结果会被缓存并在多个goroutine间共享
+//共享的表达式只能通过会复制查询的htmlquery.QuerySelector、htmlquery.QuerySelectorAll或Expr.Select使用，
+//Expr.Evaluate会在表达式内部保存迭代状态，不能并发调用
+func Compile(expr string) (*antxpath.Expr, error) {
+	if cached, ok := exprCache.Load(expr); ok {
+		return cached.(*antxpath.Expr), nil
+	}
+	compiled, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	exprCache.Store(expr, compiled)
+	return compiled, nil
+}
+
+//用于编译XPath表达式，编译结果不会被缓存
+func compile(expr string) (*antxpath.Expr, error) {
+	compiled, err := antxpath.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("xpath: illegal expression %q: %s", expr, err)
+	}
+	return compiled, nil
+}
+
+//用于查找所有匹配表达式的节点
+//表达式选中属性（如//a/@href）时，结果节点的文本即为属性值
+func Find(top *html.Node, expr string) ([]*html.Node, error) {
+	compiled, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return htmlquery.QuerySelectorAll(top, compiled), nil
+}
+
+//用于查找第一个匹配表达式的节点
+//没有匹配的节点时返回nil
+func FindOne(top *html.Node, expr string) (*html.Node, error) {
+	compiled, err := Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	return htmlquery.QuerySelector(top, compiled), nil
+}
+
+//用于对表达式求值，适用于count()、string()等返回非节点值的表达式
+//结果的类型为float64、string、bool或[]*html.Node
+//求值会修改表达式内部的状态，因此每次调用都会重新编译表达式而不使用缓存
+func Eval(top *html.Node, expr string) (interface{}, error) {
+	compiled, err := compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	result := compiled.Evaluate(htmlquery.CreateXPathNavigator(top))
+	if _, ok := result.(*antxpath.NodeIterator); ok {
+		//节点集通过会复制查询的QuerySelectorAll获取，以便生成属性节点
+		return htmlquery.QuerySelectorAll(top, compiled), nil
+	}
+	return result, nil
+}
+
+//用于判断节点是否是表达式选中属性时生成的属性节点
+//属性节点不在文档树中，其唯一的子节点保存属性值
+func IsAttribute(n *html.Node) bool {
+	return n != nil && n.Type == html.ElementNode && n.Parent == nil &&
+		n.FirstChild != nil && n.FirstChild.Type == html.TextNode
+}
+
+//用于获取节点的文本，对元素节点会拼接所有后代文本节点的内容
+func Text(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	return htmlquery.InnerText(n)
+}
+
+//用于获取节点的属性值，属性不存在时第二个结果值为false
+func Attr(n *html.Node, name string) (string, bool) {
+	if n == nil {
+		return "", false
+	}
+	for _, attr := range n.Attr {
+		if strings.EqualFold(attr.Key, name) {
+			return attr.Val, true
+		}
+	}
+	return "", false
+}
+
+//用于获取节点内部的HTML
+func InnerHTML(n *html.Node) string {
+	if n == nil {
+		return ""
+	}
+	return htmlquery.OutputHTML(n, false)
+}
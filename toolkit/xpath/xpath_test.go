@@ -0,0 +1,94 @@
+package xpath
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"golang.org/x/net/html"
+)
+
+var testPage = `<html><body>
+<dl><dt>Author</dt><dd>Tom</dd><dt>Price</dt><dd> 42 </dd></dl>
+<a href="/a">A</a><a href="/b">B</a>
+</body></html>`
+
+func parseTestPage(t *testing.T) *html.Node {
+	doc, err := html.Parse(strings.NewReader(testPage))
+	if err != nil {
+		t.Fatalf("An error occurs when parsing the page: %s", err)
+	}
+	return doc
+}
+
+func TestFind(t *testing.T) {
+	doc := parseTestPage(t)
+	node, err := FindOne(doc, `//dt[text()="Price"]/following-sibling::dd[1]`)
+	if err != nil {
+		t.Fatalf("An error occurs when finding: %s", err)
+	}
+	if text := strings.TrimSpace(Text(node)); text != "42" {
+		t.Fatalf("Inconsistent text: expected: %q, actual: %q", "42", text)
+	}
+	nodes, err := Find(doc, "//a/@href")
+	if err != nil {
+		t.Fatalf("An error occurs when finding: %s", err)
+	}
+	if len(nodes) != 2 || Text(nodes[0]) != "/a" || Text(nodes[1]) != "/b" ||
+		!IsAttribute(nodes[0]) {
+		t.Fatalf("Inconsistent attribute nodes: %v", nodes)
+	}
+	nodes, _ = Find(doc, "//a")
+	if IsAttribute(nodes[0]) {
+		t.Fatalf("An element node is regarded as an attribute node!")
+	}
+	if href, ok := Attr(nodes[1], "href"); !ok || href != "/b" {
+		t.Fatalf("Inconsistent attribute: expected: %q, actual: %q", "/b", href)
+	}
+	if _, err = Find(doc, "//a["); err == nil {
+		t.Fatalf("No error when finding with illegal expression!")
+	}
+}
+
+func TestEval(t *testing.T) {
+	doc := parseTestPage(t)
+	result, err := Eval(doc, "count(//dd)")
+	if err != nil {
+		t.Fatalf("An error occurs when evaluating: %s", err)
+	}
+	if count, ok := result.(float64); !ok || count != 2 {
+		t.Fatalf("Inconsistent count: %v", result)
+	}
+	result, _ = Eval(doc, "//dd")
+	if nodes, ok := result.([]*html.Node); !ok || len(nodes) != 2 {
+		t.Fatalf("Inconsistent nodes: %v", result)
+	}
+}
+
+//同一表达式可以被并发地求值，需要配合-race运行
+func TestEvalConcurrent(t *testing.T) {
+	doc := parseTestPage(t)
+	var wg sync.WaitGroup
+	errs := make(chan error, 20)
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			if result, err := Eval(doc, "count(//dd)"); err != nil || result != float64(2) {
+				errs <- fmt.Errorf("inconsistent count: %v %v", result, err)
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			if result, err := Eval(doc, "//a/@href"); err != nil || len(result.([]*html.Node)) != 2 {
+				errs <- fmt.Errorf("inconsistent nodes: %v %v", result, err)
+			}
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		t.Fatal(err)
+	}
+}